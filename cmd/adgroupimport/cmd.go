@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/brian1917/illumioapi/v2"
 
@@ -22,13 +23,18 @@ const (
 var pce illumioapi.PCE
 var err error
 var updatePCE, noPrompt bool
-var csvFile string
+var csvFile, ldifFile, searchFilter, nameAttribute string
 
-func init() {}
+func init() {
+	AdGroupImportCmd.Flags().StringVar(&ldifFile, "ldif", "", "ldif export of the directory to use instead of a csv. see below for details.")
+	AdGroupImportCmd.Flags().StringVar(&searchFilter, "filter", "(objectClass=group)", "ldap search filter to select groups from the ldif.")
+	AdGroupImportCmd.Flags().StringVar(&nameAttribute, "name-attribute", "sAMAccountName", "ldif attribute for the ad group name. cn is used if the attribute is blank.")
+	AdGroupImportCmd.Flags().SortFlags = false
+}
 
 // IplImportCmd runs the iplist import command
 var AdGroupImportCmd = &cobra.Command{
-	Use:   "adgroup-import [csv file to import]",
+	Use:   "adgroup-import [csv file to import or --ldif]",
 	Short: "Create and update AD groups from a csv.",
 	Long: `
 	Create and update AD groups from a csv. 
@@ -39,6 +45,12 @@ The input should have a header row as the first row will be skipped. The CSV can
 - ` + HeaderDescription + `
 
 If the SID already exists, workloader will update the description and/or name if needed. If SID does not already exist, workloader creates a new AD group.
+
+Use --ldif instead of a csv to discover the groups from an LDIF export of Active Directory or another directory. For example:
+  ldifde -f groups.ldf -r "(objectClass=group)" -l "cn,sAMAccountName,objectSid,description,objectClass"
+The --filter is an ldap search filter applied to the ldif entries. Supported operators are &, |, !, equality with * wildcards, and presence (e.g., "(&(objectClass=group)(cn=app-*))"). Matching is case insensitive. The name is the --name-attribute, the sid is the objectSid (binary or string), and the description is the description attribute. The groups are written to a csv that is then imported the same as a csv input so row numbers in the log refer to that file.
+
+With --ldif, AD groups in the PCE with a SID that is not in the ldif are written to a stale csv for review. All entries in the ldif are used for the stale check regardless of the --filter. Stale groups are not deleted.
 	
 Recommended to run without --update-pce first to log of what will change. If --update-pce is used, workloader will create and update the AD groups with a user prompt. To disable the prompt, use --no-prompt.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -49,6 +61,16 @@ Recommended to run without --update-pce first to log of what will change. If --u
 			utils.LogError(err.Error())
 		}
 
+		// Get the viper values
+		updatePCE = viper.Get("update_pce").(bool)
+		noPrompt = viper.Get("no_prompt").(bool)
+
+		// Use the ldif if provided
+		if ldifFile != "" {
+			ImportADGroupsLDIF(pce, ldifFile, searchFilter, nameAttribute, updatePCE, noPrompt)
+			return
+		}
+
 		// Set the CSV file
 		if len(args) != 1 {
 			fmt.Println("Command requires 1 argument for the csv file. See usage help.")
@@ -56,10 +78,6 @@ Recommended to run without --update-pce first to log of what will change. If --u
 		}
 		csvFile = args[0]
 
-		// Get the viper values
-		updatePCE = viper.Get("update_pce").(bool)
-		noPrompt = viper.Get("no_prompt").(bool)
-
 		ImportADGroups(pce, csvFile, updatePCE, noPrompt)
 	},
 }
@@ -85,6 +103,65 @@ func ImportADGroups(pce illumioapi.PCE, inputFile string, updatePCE, noPrompt bo
 		utils.LogError(err.Error())
 	}
 
+	importADGroupData(pce, csvData, updatePCE, noPrompt)
+}
+
+// ImportADGroupsLDIF creates and updates AD groups from the groups in an LDIF export and reports PCE AD groups not in the export
+func ImportADGroupsLDIF(pce illumioapi.PCE, ldifFile, searchFilter, nameAttribute string, updatePCE, noPrompt bool) {
+
+	// Read the directory
+	directory, err := ReadLDIF(ldifFile, searchFilter, nameAttribute)
+	if err != nil {
+		utils.LogErrorf("reading ldif - %s", err)
+	}
+	utils.LogInfof(true, "%d groups in %s match %s", len(directory.Groups), ldifFile, searchFilter)
+
+	// Get all the existing AD groups
+	apiResps, err := pce.Load(illumioapi.LoadInput{ConsumingSecurityPrincipals: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Write the groups to a csv for the import
+	timestamp := time.Now().Format("20060102_150405")
+	csvData := [][]string{{HeaderName, HeaderSid, HeaderDescription}}
+	for _, g := range directory.Groups {
+		csvData = append(csvData, []string{g.Name, g.SID, g.Description})
+	}
+	if len(csvData) > 1 {
+		utils.WriteOutput(csvData, nil, fmt.Sprintf("workloader-adgroup-import-ldif-%s.csv", timestamp))
+	}
+
+	// Report AD groups in the PCE that are not in the directory
+	staleData := [][]string{{HeaderName, HeaderSid, HeaderDescription, "href"}}
+	processed := make(map[string]bool)
+	for _, cp := range pce.ConsumingSecurityPrincipals {
+		if processed[cp.Href] || cp.SID == "" {
+			continue
+		}
+		processed[cp.Href] = true
+		if !directory.SIDs[cp.SID] {
+			staleData = append(staleData, []string{cp.Name, cp.SID, cp.Description, cp.Href})
+			utils.LogInfof(false, "%s - %s is not in %s", cp.Name, cp.SID, ldifFile)
+		}
+	}
+	if len(staleData) > 1 {
+		staleFile := fmt.Sprintf("workloader-adgroup-import-stale-%s.csv", timestamp)
+		utils.WriteOutput(staleData, nil, staleFile)
+		utils.LogInfof(true, "%d ad groups in the pce have a sid not in %s. see %s", len(staleData)-1, ldifFile, staleFile)
+	}
+
+	if len(csvData) == 1 {
+		utils.LogInfo("nothing to be done.", true)
+		return
+	}
+	importADGroupData(pce, csvData, updatePCE, noPrompt)
+}
+
+// importADGroupData creates and updates the AD groups in the csv data. The PCE must be loaded with the consuming security principals.
+func importADGroupData(pce illumioapi.PCE, csvData [][]string, updatePCE, noPrompt bool) {
+
 	// Set headers
 	headers := make(map[string]*int)
 
@@ -0,0 +1,327 @@
+package adgroupimport
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DirectoryGroup is a group from an LDIF export
+type DirectoryGroup struct {
+	DN          string
+	Name        string
+	SID         string
+	Description string
+}
+
+// Directory is the result of reading an LDIF export
+type Directory struct {
+	// Groups are the groups matching the search filter
+	Groups []DirectoryGroup
+	// SIDs and Names are all the SIDs and group names in the export regardless of the filter
+	SIDs  map[string]bool
+	Names map[string]bool
+}
+
+// ldifEntry is an LDIF record with lowercase attribute names
+type ldifEntry map[string][]string
+
+// ReadLDIF reads an LDIF export (e.g., ldifde -f groups.ldf -r "(objectClass=group)" -l "cn,sAMAccountName,objectSid,description,objectClass")
+// and returns the groups matching the search filter. The name is the nameAttribute with cn as a fallback.
+func ReadLDIF(file, searchFilter, nameAttribute string) (Directory, error) {
+	directory := Directory{SIDs: make(map[string]bool), Names: make(map[string]bool)}
+
+	f, err := parseFilter(searchFilter)
+	if err != nil {
+		return directory, fmt.Errorf("search filter %s - %s", searchFilter, err)
+	}
+	entries, err := parseLDIF(file)
+	if err != nil {
+		return directory, err
+	}
+
+	nameAttribute = strings.ToLower(nameAttribute)
+	for _, entry := range entries {
+		group := DirectoryGroup{DN: entry.first("dn"), Name: entry.first(nameAttribute), SID: entry.first("objectsid"), Description: entry.first("description")}
+		if group.Name == "" {
+			group.Name = entry.first("cn")
+		}
+		if group.SID != "" {
+			directory.SIDs[group.SID] = true
+		}
+		if group.Name != "" {
+			directory.Names[group.Name] = true
+		}
+		if !f.match(entry) {
+			continue
+		}
+		if group.Name == "" || group.SID == "" {
+			continue
+		}
+		directory.Groups = append(directory.Groups, group)
+	}
+	return directory, nil
+}
+
+func (e ldifEntry) first(attribute string) string {
+	if len(e[attribute]) == 0 {
+		return ""
+	}
+	return e[attribute][0]
+}
+
+// parseLDIF parses the records of an LDIF file. Folded lines are joined, base64 values are decoded, and objectSid values are converted to the string format.
+func parseLDIF(file string) ([]ldifEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []ldifEntry{}
+	lines := []string{}
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		entry := make(ldifEntry)
+		for _, line := range lines {
+			attribute, value, err := parseLDIFLine(line)
+			if err != nil {
+				return err
+			}
+			if attribute == "" {
+				continue
+			}
+			entry[attribute] = append(entry[attribute], value)
+		}
+		if entry["dn"] != nil {
+			entries = append(entries, entry)
+		}
+		lines = []string{}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		switch {
+		case strings.TrimSpace(line) == "":
+			if err := flush(); err != nil {
+				return nil, fmt.Errorf("%s line %d - %s", file, lineNum, err)
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, " ") && len(lines) > 0:
+			lines[len(lines)-1] = lines[len(lines)-1] + line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, fmt.Errorf("%s - %s", file, err)
+	}
+	return entries, nil
+}
+
+// parseLDIFLine returns the lowercase attribute and the value. Version lines and url values are skipped.
+func parseLDIFLine(line string) (string, string, error) {
+	i := strings.Index(line, ":")
+	if i < 1 {
+		return "", "", fmt.Errorf("invalid line: %s", line)
+	}
+	attribute := strings.ToLower(strings.TrimSpace(line[:i]))
+	if j := strings.Index(attribute, ";"); j > 0 {
+		attribute = attribute[:j]
+	}
+	rest := line[i+1:]
+	if attribute == "version" || strings.HasPrefix(rest, "<") {
+		return "", "", nil
+	}
+
+	// Plain value
+	if !strings.HasPrefix(rest, ":") {
+		return attribute, strings.TrimSpace(rest), nil
+	}
+
+	// Base64 value
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+	if err != nil {
+		return "", "", fmt.Errorf("decoding %s - %s", attribute, err)
+	}
+	if attribute == "objectsid" {
+		sid, err := sidString(decoded)
+		return attribute, sid, err
+	}
+	return attribute, string(decoded), nil
+}
+
+// sidString converts a binary SID to the S-1-5-21-... format
+func sidString(b []byte) (string, error) {
+	if len(b) < 8 || len(b) != 8+4*int(b[1]) {
+		return "", fmt.Errorf("invalid objectSid")
+	}
+	var authority uint64
+	for _, x := range b[2:8] {
+		authority = authority<<8 | uint64(x)
+	}
+	sid := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 0; i < int(b[1]); i++ {
+		sid = sid + fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sid, nil
+}
+
+// ******************** Search filter ********************
+
+// filter is a parsed LDAP search filter (RFC 4515). Supported are &, |, !, equality with * wildcards, and presence.
+// Matching is case insensitive like Active Directory.
+type filter struct {
+	op        byte
+	children  []filter
+	attribute string
+	value     string
+}
+
+func parseFilter(s string) (filter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return filter{op: '&'}, nil
+	}
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	f, rest, err := parseFilterComponent(s)
+	if err != nil {
+		return f, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return f, fmt.Errorf("unexpected %s", rest)
+	}
+	return f, nil
+}
+
+func parseFilterComponent(s string) (filter, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return filter{}, s, fmt.Errorf("expected ( at %s", s)
+	}
+	s = strings.TrimSpace(s[1:])
+	if s == "" {
+		return filter{}, s, fmt.Errorf("unexpected end")
+	}
+
+	switch s[0] {
+	case '&', '|', '!':
+		f := filter{op: s[0]}
+		s = strings.TrimSpace(s[1:])
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilterComponent(s)
+			if err != nil {
+				return f, rest, err
+			}
+			f.children = append(f.children, child)
+			s = strings.TrimSpace(rest)
+		}
+		if !strings.HasPrefix(s, ")") {
+			return f, s, fmt.Errorf("expected ) at %s", s)
+		}
+		if f.op == '!' && len(f.children) != 1 {
+			return f, s, fmt.Errorf("! must have one filter")
+		}
+		return f, s[1:], nil
+	}
+
+	end := strings.Index(s, ")")
+	if end == -1 {
+		return filter{}, s, fmt.Errorf("expected ) at %s", s)
+	}
+	item := s[:end]
+	eq := strings.Index(item, "=")
+	if eq < 1 {
+		return filter{}, s, fmt.Errorf("invalid item %s", item)
+	}
+	if strings.ContainsAny(item[eq-1:eq], "<>~:") {
+		return filter{}, s, fmt.Errorf("only equality and presence are supported - %s", item)
+	}
+	return filter{op: '=', attribute: strings.ToLower(strings.TrimSpace(item[:eq])), value: unescapeFilterValue(item[eq+1:])}, s[end+1:], nil
+}
+
+// unescapeFilterValue converts \xx hex escapes
+func unescapeFilterValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+2 < len(v) {
+			var x byte
+			if _, err := fmt.Sscanf(v[i+1:i+3], "%02x", &x); err == nil {
+				b.WriteByte(x)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+func (f filter) match(e ldifEntry) bool {
+	switch f.op {
+	case '&':
+		for _, c := range f.children {
+			if !c.match(e) {
+				return false
+			}
+		}
+		return true
+	case '|':
+		for _, c := range f.children {
+			if c.match(e) {
+				return true
+			}
+		}
+		return false
+	case '!':
+		return !f.children[0].match(e)
+	}
+	values := e[f.attribute]
+	if f.value == "*" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if wildcardMatch(strings.ToLower(f.value), strings.ToLower(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches a value with * wildcards
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i == -1 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
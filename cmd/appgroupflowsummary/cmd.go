@@ -7,11 +7,12 @@ import (
 	"time"
 
 	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 )
 
-var app, start, end, outputFileName string
+var app, start, end, fromStore, outputFileName string
 var exclAllowed, exclPotentiallyBlocked, exclBlocked, appGroupLoc, ignoreIPGroup, consolidate bool
 var pce illumioapi.PCE
 var err error
@@ -27,6 +28,7 @@ func init() {
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&appGroupLoc, "appgrp-loc", "l", false, "use location in app group")
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&ignoreIPGroup, "ignore-ip", "i", false, "exlude IP address app groups from output")
 	AppGroupFlowSummaryCmd.Flags().BoolVarP(&consolidate, "consolidate", "c", false, "consolidate all communication between 2 app groups into one CSV entry. See description below for example of output formats.")
+	AppGroupFlowSummaryCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory.")
 	AppGroupFlowSummaryCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	AppGroupFlowSummaryCmd.Flags().SortFlags = false
@@ -63,6 +65,8 @@ Including the consolidate flag (--consolidate, -c) will combine all entries betw
 | 45.54.45.54                  | Point-of-Sale | Staging      |                      | 443 TCP (126 flows)              |                      |
 +------------------------------+------------------------------+----------------------+----------------------------------+----------------------+
 
+Use --from-store to summarize a local traffic store populated by traffic-sync instead of explorer.
+
 The update-pce and --no-prompt flags are ignored for this command.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -140,24 +144,14 @@ func flowSummary() {
 	}
 
 	// Run traffic query
-	traffic, a, err := pce.GetTrafficAnalysis(tq)
-	utils.LogAPIRespV2("GetTrafficAnalysis", a)
-	utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
-	if err != nil {
-		utils.LogError(err.Error())
-	}
+	traffic := getTraffic(tq)
 	utils.LogInfof(false, "first traffic query result count: %d", len(traffic))
 
 	// If app is provided, switch to the destination include, clear the sources include, run query again, append to previous result
 	if app != "" {
 		tq.DestinationsInclude = tq.SourcesInclude
 		tq.SourcesInclude = [][]string{}
-		traffic2, a, err := pce.GetTrafficAnalysis(tq)
-		utils.LogAPIRespV2("GetTrafficAnalysis", a)
-		utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
-		if err != nil {
-			utils.LogError(err.Error())
-		}
+		traffic2 := getTraffic(tq)
 		utils.LogInfo(fmt.Sprintf("second traffic query result count: %d", len(traffic2)), false)
 		traffic = append(traffic, traffic2...)
 		utils.LogInfo(fmt.Sprintf("combined traffic query result count: %d", len(traffic)), false)
@@ -272,3 +266,21 @@ func flowSummary() {
 	}
 
 }
+
+// getTraffic runs the query against the traffic store if provided or explorer
+func getTraffic(tq illumioapi.TrafficQuery) []illumioapi.TrafficAnalysis {
+	if fromStore != "" {
+		traffic, err := trafficsync.QueryV2(fromStore, tq)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		return traffic
+	}
+	traffic, a, err := pce.GetTrafficAnalysis(tq)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	utils.LogInfof(false, "explorer query body: %s", a.ReqBody)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	return traffic
+}
@@ -39,7 +39,7 @@ When enforcement-state sent to "visibility_only" or "full":
    - Pairing profile set to enforcement-state. This can be skipped (see pairing-profile flag).
 
 When enforcement-state sent to "unmanaged":
-   - Container workload profiles (including the default value for new container workload profiles) will be updated to unmanaged. This includes removing role, app, env, and location labels as it's necessary for moving to unmanaged. Custom label types not support in this command yet.
+   - Container workload profiles (including the default value for new container workload profiles) will be updated to unmanaged. This includes removing the labels for all label dimensions as it's necessary for moving to unmanaged. A cwp-import file to restore the labels (assignments and restrictions) is created.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -113,9 +113,23 @@ func ContainerClusterUpdate(originalPce illumioapi.PCE, containerClusterName str
 
 	cwpCsvData := [][]string{{"container_cluster", "name", "description", "namespace", "enforcement", "visibility", "managed", "href"}}
 	labelKeys := []string{"role", "app", "env", "loc"}
+	api, err = cwpPce.GetLabelDimensions(nil)
+	utils.LogAPIRespV2("GetLabelDimensions", api)
+	if err != nil {
+		utils.LogWarningf(true, "getting label dimensions - %s - will use 4 default keys", err)
+	} else {
+		labelKeys = nil
+		for _, ld := range cwpPce.LabelDimensionsSlice {
+			labelKeys = append(labelKeys, ld.Key)
+		}
+	}
 	cwpCsvData[0] = append(cwpCsvData[0], labelKeys...)
 	restoreCwpCsvData := [][]string{cwpCsvData[0]}
 	if targetMode == "unmanaged" {
+		profileLabels, err := cwpexport.GetProfileLabels(cwpPce, containerCluster.ID())
+		if err != nil {
+			utils.LogError(err.Error())
+		}
 		for _, cwp := range cwpPce.ContainerWorkloadProfilesSlice {
 			row := []string{containerClusterName, illumioapi.PtrToVal(cwp.Name), illumioapi.PtrToVal(cwp.Description), cwp.Namespace, "idle", visLevels[*cwp.VisibilityLevel], "false", cwp.Href}
 			restoreRow := []string{containerClusterName, illumioapi.PtrToVal(cwp.Name), illumioapi.PtrToVal(cwp.Description), cwp.Namespace, illumioapi.PtrToVal(cwp.EnforcementMode), visLevels[*cwp.VisibilityLevel], strconv.FormatBool(*cwp.Managed), cwp.Href}
@@ -123,7 +137,7 @@ func ContainerClusterUpdate(originalPce illumioapi.PCE, containerClusterName str
 				row = append(row, "DELETE")
 			}
 			for _, key := range labelKeys {
-				restoreRow = append(restoreRow, cwp.GetLabelByKey(key))
+				restoreRow = append(restoreRow, cwpexport.LabelCell(profileLabels[cwp.Href], key, originalPce.Labels))
 			}
 
 			cwpCsvData = append(cwpCsvData, row)
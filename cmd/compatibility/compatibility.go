@@ -13,14 +13,21 @@ import (
 
 var modeChangeInput, issuesOnly, single bool
 var pce illumioapi.PCE
-var outputFileName, labelFile, hrefFile string
+var outputFileName, labelFile, hrefFile, selectExpr, previousFile, rollupKeys, remediationFile string
 var err error
 
+// checkNames are the check columns in the output
+var checkNames = []string{"required_packages_installed", "ipsec_service_enabled", "ipv4_forwarding_enabled", "ipv4_forwarding_pkt_cnt", "iptables_rule_cnt", "ipv6_global_scope", "ipv6_active_conn_cnt", "ip6tables_rule_cnt", "routing_table_conflict", "IPv6_enabled", "Unwanted_nics", "GroupPolicy"}
+
 func init() {
 	CompatibilityCmd.Flags().StringVar(&labelFile, "label-file", "", "csv file with labels to filter query. the file should have 4 headers: role, app, env, and loc. The four columns in each row is an \"AND\" operation. Each row is an \"OR\" operation.")
 	CompatibilityCmd.Flags().StringVar(&hrefFile, "href-file", "", "csv file with hrefs.")
+	CompatibilityCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to filter workloads. can be combined with label-file or href-file. see description below.")
 	CompatibilityCmd.Flags().BoolVarP(&modeChangeInput, "mode-input", "m", false, "generate the input file to change all idle workloads to build using workloader mode command")
 	CompatibilityCmd.Flags().BoolVarP(&issuesOnly, "issues-only", "i", false, "only export compatibility checks with an issue")
+	CompatibilityCmd.Flags().StringVar(&previousFile, "previous", "", "output file of a previous compatibility run to compare against. creates a trend file with newly failing and newly passing workloads.")
+	CompatibilityCmd.Flags().StringVar(&rollupKeys, "rollup-keys", "app,env", "comma-separated label keys to roll up the readiness percentage.")
+	CompatibilityCmd.Flags().StringVar(&remediationFile, "remediation-file", "", "yaml file to replace the built-in remediation categories. see description below.")
 	CompatibilityCmd.Flags().BoolVar(&single, "single", false, "only used with --host-file. gets hosts by individual api calls vs. getting all workloads and filtering after.")
 	CompatibilityCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 	CompatibilityCmd.Flags().SortFlags = false
@@ -48,6 +55,27 @@ This example queries all idle workloads that are
 - OR bos(loc) AND it (bu)
 - OR CRM (app)
 
+` + utils.SelectorHelp + `
+
+Each failed check (yellow or red) is classified into a remediation category and the remediation text is added to the output in the issue_categories and remediation columns. The built-in categories are:
+  - missing-kernel-modules, missing-packages, ipsec-conflict, ip-forwarding, iptables-conflict
+  - ipv6-active, routing-conflict, ipv6-disabled, unwanted-nics, group-policy
+Failed checks without a category are reported as unclassified. Use --remediation-file to provide your own categories in the same format as the built-in file:
+  categories:
+    - id: iptables-conflict
+      name: Existing iptables rules
+      checks: [iptables_rule_cnt, ip6tables_rule_cnt]
+      remediation: Review the existing rules and recreate required rules as PCE policy.
+    - id: missing-kernel-modules
+      checks: [required_packages_installed]
+      packages: (?i)(kmod|kernel|ip_set)
+      remediation: Install the kernel module packages for the running kernel.
+The packages regex limits the category to workloads with a matching missing package. The first matching category is used.
+
+A readiness file is created with the workload count, status counts, percentage of green workloads, and issue categories for each combination of the --rollup-keys labels.
+
+Use --previous with the output of an earlier run to create a trend file. Workloads are matched by href and reported as newly-failing, newly-passing, still-failing, new-host (not in the previous file), or not-in-current (no longer idle or not processed). If the previous run used --issues-only, green workloads are not in the file and are reported as new-host if they start failing.
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -62,6 +90,27 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 
 func compatibilityReport() {
 
+	// Load the remediation knowledge
+	k, err := loadKnowledge(remediationFile)
+	if err != nil {
+		utils.LogErrorf("loading remediation categories - %s", err)
+	}
+
+	// Parse the previous run
+	var previous map[string]result
+	if previousFile != "" {
+		previous, err = parsePrevious(previousFile, k)
+		if err != nil {
+			utils.LogErrorf("parsing previous file - %s", err)
+		}
+	}
+
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Get labels and label dimensions
 	apiResps, err := pce.Load(illumioapi.LoadInput{LabelDimensions: true, Labels: true}, utils.UseMulti())
 	utils.LogMultiAPIRespV2(apiResps)
@@ -125,6 +174,9 @@ func compatibilityReport() {
 		pce.WorkloadsSlice = confirmedIdle
 	}
 
+	// Filter with the selector
+	pce.WorkloadsSlice = selector.FilterV2(pce.WorkloadsSlice, pce.Labels)
+
 	// Get the label information
 	labelKeys := []string{}
 	for _, ld := range pce.LabelDimensionsSlice {
@@ -135,9 +187,18 @@ func compatibilityReport() {
 
 	// Start the output
 	outputHeaders := append([]string{"hostname", "href", "status"}, labelKeys...)
-	outputHeaders = append(outputHeaders, "os_id", "os_details", "required_packages_installed", "required_packages_missing", "ipsec_service_enabled", "ipv4_forwarding_enabled", "ipv4_forwarding_pkt_cnt", "iptables_rule_cnt", "ipv6_global_scope", "ipv6_active_conn_cnt", "ip6tables_rule_cnt", "routing_table_conflict", "IPv6_enabled", "Unwanted_nics", "GroupPolicy", "raw_data")
+	outputHeaders = append(outputHeaders, "os_id", "os_details", "required_packages_installed", "required_packages_missing", "ipsec_service_enabled", "ipv4_forwarding_enabled", "ipv4_forwarding_pkt_cnt", "iptables_rule_cnt", "ipv6_global_scope", "ipv6_active_conn_cnt", "ip6tables_rule_cnt", "routing_table_conflict", "IPv6_enabled", "Unwanted_nics", "GroupPolicy", "issue_categories", "remediation", "raw_data")
 	csvData := [][]string{outputHeaders}
 	modeChangeInputData := [][]string{{"href", "mode"}}
+	results := []result{}
+
+	// Set the rollup keys
+	keys := []string{}
+	for _, key := range strings.Split(rollupKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
 
 	// Create a warning logs holder
 	warningLogs := []string{}
@@ -162,7 +223,7 @@ func compatibilityReport() {
 
 		// Set the initial values for Linux, AIX, and Solaris and override for Windows
 		requiredPackagesInstalled := "green"
-		requiredPackagesMissing := ""
+		requiredPackagesMissing := []string{}
 		ipsecServiceEnabled := "green"
 		iPv6Enabled := "na"
 		unwantedNics := "na"
@@ -224,7 +285,7 @@ func compatibilityReport() {
 
 				// Process missing packages separately
 				if c.RequiredPackagesMissing != nil {
-					requiredPackagesMissing = strings.Join(*c.RequiredPackagesMissing, ";")
+					requiredPackagesMissing = *c.RequiredPackagesMissing
 				}
 			}
 		} else {
@@ -238,13 +299,31 @@ func compatibilityReport() {
 			continue
 		}
 
+		// Classify the failed checks
+		checkValues := []string{requiredPackagesInstalled, ipsecServiceEnabled, ipv4ForwardingEnabled, ipv4ForwardingPktCnt, iptablesRuleCnt, ipv6GlobalScope, ipv6ActiveConnCnt, iP6TablesRuleCnt, routingTableConflict, iPv6Enabled, unwantedNics, groupPolicy}
+		checkStatus := make(map[string]string)
+		for i, check := range checkNames {
+			checkStatus[check] = checkValues[i]
+		}
+		categories := k.classify(checkStatus, requiredPackagesMissing)
+
+		// Save the result for the readiness and trend
+		r := result{hostname: illumioapi.PtrToVal(w.Hostname), href: w.Href, status: cr.QualifyStatus, labels: make(map[string]string)}
+		for _, key := range keys {
+			r.labels[key] = wkldMapData[w.Href][key]
+		}
+		for _, c := range categories {
+			r.categories = append(r.categories, c.ID)
+		}
+		results = append(results, r)
+
 		// Put into slice if it's not green and issuesOnly is true
 		if (cr.QualifyStatus != "green" && issuesOnly) || !issuesOnly {
 			rowEntry := []string{illumioapi.PtrToVal(w.Hostname), w.Href, cr.QualifyStatus}
 			for _, key := range labelKeys {
 				rowEntry = append(rowEntry, wkldMapData[w.Href][key])
 			}
-			rowEntry = append(rowEntry, illumioapi.PtrToVal(w.OsID), illumioapi.PtrToVal(w.OsDetail), requiredPackagesInstalled, requiredPackagesMissing, ipsecServiceEnabled, ipv4ForwardingEnabled, ipv4ForwardingPktCnt, iptablesRuleCnt, ipv6GlobalScope, ipv6ActiveConnCnt, iP6TablesRuleCnt, routingTableConflict, iPv6Enabled, unwantedNics, groupPolicy, a.RespBody)
+			rowEntry = append(rowEntry, illumioapi.PtrToVal(w.OsID), illumioapi.PtrToVal(w.OsDetail), requiredPackagesInstalled, strings.Join(requiredPackagesMissing, ";"), ipsecServiceEnabled, ipv4ForwardingEnabled, ipv4ForwardingPktCnt, iptablesRuleCnt, ipv6GlobalScope, ipv6ActiveConnCnt, iP6TablesRuleCnt, routingTableConflict, iPv6Enabled, unwantedNics, groupPolicy, categoryIDs(categories), remediationText(categories), a.RespBody)
 			csvData = append(csvData, rowEntry)
 		}
 
@@ -271,6 +350,18 @@ func compatibilityReport() {
 		utils.LogInfo("no workloads with compatibility reports for provided query.", true)
 	}
 
+	// Write the readiness and trend
+	if len(results) > 0 {
+		if outputFileName == "" {
+			outputFileName = fmt.Sprintf("workloader-compatibility-%s.csv", time.Now().Format("20060102_150405"))
+		}
+		base := strings.TrimSuffix(outputFileName, ".csv")
+		writeReadiness(results, keys, base+"-readiness.csv")
+		if previousFile != "" {
+			writeTrend(results, previous, base+"-trend.csv")
+		}
+	}
+
 	// Write the mode change CSV
 	if modeChangeInput && len(modeChangeInputData) > 1 {
 		// Create CSV
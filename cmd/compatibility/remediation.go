@@ -0,0 +1,136 @@
+package compatibility
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtInRemediation is the remediation knowledge shipped with workloader. Replace it with --remediation-file.
+//
+//go:embed remediation.yaml
+var builtInRemediation []byte
+
+const unclassified = "unclassified"
+
+// category is a known remediation category for failed checks
+type category struct {
+	ID          string   `yaml:"id"`
+	Name        string   `yaml:"name"`
+	Checks      []string `yaml:"checks"`
+	Packages    string   `yaml:"packages"`
+	Remediation string   `yaml:"remediation"`
+
+	packageRe *regexp.Regexp
+}
+
+type knowledge struct {
+	Categories []category `yaml:"categories"`
+}
+
+// loadKnowledge parses the remediation file or the built-in knowledge if the file is blank
+func loadKnowledge(file string) (knowledge, error) {
+	k := knowledge{}
+	data := builtInRemediation
+	if file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return k, err
+		}
+	}
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return k, err
+	}
+	for i := range k.Categories {
+		c := &k.Categories[i]
+		if c.ID == "" || len(c.Checks) == 0 {
+			return k, fmt.Errorf("category %d requires an id and at least one check", i+1)
+		}
+		if c.Packages != "" {
+			var err error
+			if c.packageRe, err = regexp.Compile(c.Packages); err != nil {
+				return k, fmt.Errorf("%s - packages - %s", c.ID, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+// failed returns true if the check status is an issue
+func failed(status string) bool {
+	return status != "" && status != "green" && status != "na"
+}
+
+// classify returns the categories for the failed checks in the order they appear in the knowledge file.
+// Failed checks without a category are returned as unclassified.
+func (k knowledge) classify(checkStatus map[string]string, missingPackages []string) []category {
+	matched := make(map[string]bool)
+	unmatched := []string{}
+	for _, check := range checkNames {
+		if !failed(checkStatus[check]) {
+			continue
+		}
+		found := false
+		for _, c := range k.Categories {
+			if c.matches(check, missingPackages) {
+				matched[c.ID] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, check)
+		}
+	}
+
+	categories := []category{}
+	for _, c := range k.Categories {
+		if matched[c.ID] {
+			categories = append(categories, c)
+		}
+	}
+	if len(unmatched) > 0 {
+		categories = append(categories, category{ID: unclassified, Remediation: fmt.Sprintf("no remediation guidance for %s. review the raw_data.", strings.Join(unmatched, ", "))})
+	}
+	return categories
+}
+
+// matches returns true if the category covers the check and, if set, a missing package matches the packages regex
+func (c category) matches(check string, missingPackages []string) bool {
+	for _, cc := range c.Checks {
+		if !strings.EqualFold(cc, check) {
+			continue
+		}
+		if c.packageRe == nil {
+			return true
+		}
+		for _, p := range missingPackages {
+			if c.packageRe.MatchString(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// categoryIDs returns the ids joined with a semicolon
+func categoryIDs(categories []category) string {
+	ids := []string{}
+	for _, c := range categories {
+		ids = append(ids, c.ID)
+	}
+	return strings.Join(ids, ";")
+}
+
+// remediationText returns the remediation for each category
+func remediationText(categories []category) string {
+	text := []string{}
+	for _, c := range categories {
+		text = append(text, fmt.Sprintf("%s: %s", c.ID, strings.TrimSpace(c.Remediation)))
+	}
+	return strings.Join(text, " | ")
+}
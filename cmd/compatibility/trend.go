@@ -0,0 +1,213 @@
+package compatibility
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// Trend changes
+const (
+	changeNewlyFailing = "newly-failing"
+	changeNewlyPassing = "newly-passing"
+	changeStillFailing = "still-failing"
+	changeNewHost      = "new-host"
+	changeNotInCurrent = "not-in-current"
+)
+
+// result is the compatibility status of a workload
+type result struct {
+	hostname   string
+	href       string
+	status     string
+	labels     map[string]string
+	categories []string
+}
+
+// parsePrevious parses a previous compatibility output keyed by href. Files without the issue_categories column are classified with the knowledge.
+func parsePrevious(file string, k knowledge) (map[string]result, error) {
+	csvData, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(csvData) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	cols := make(map[string]int)
+	for i, h := range csvData[0] {
+		cols[h] = i
+	}
+	for _, required := range []string{"hostname", "href", "status"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("%s does not have a %s header", file, required)
+		}
+	}
+
+	previous := make(map[string]result)
+	for _, row := range csvData[1:] {
+		r := result{hostname: row[cols["hostname"]], href: row[cols["href"]], status: row[cols["status"]]}
+		if col, ok := cols["issue_categories"]; ok {
+			r.categories = strings.FieldsFunc(row[col], func(c rune) bool { return c == ';' })
+		} else {
+			checkStatus := make(map[string]string)
+			for _, check := range checkNames {
+				if col, ok := cols[check]; ok {
+					checkStatus[check] = row[col]
+				}
+			}
+			missing := []string{}
+			if col, ok := cols["required_packages_missing"]; ok && row[col] != "" {
+				missing = strings.Split(row[col], ";")
+			}
+			for _, c := range k.classify(checkStatus, missing) {
+				r.categories = append(r.categories, c.ID)
+			}
+		}
+		previous[r.href] = r
+	}
+	return previous, nil
+}
+
+// writeTrend compares the results to the previous run and writes the hosts that changed or are still failing
+func writeTrend(results []result, previous map[string]result, fileName string) {
+	csvData := [][]string{{"hostname", "href", "previous_status", "current_status", "change", "new_categories", "resolved_categories"}}
+	counts := make(map[string]int)
+	current := make(map[string]bool)
+	for _, r := range results {
+		current[r.href] = true
+		p, ok := previous[r.href]
+		change := ""
+		switch {
+		case !ok:
+			if r.status == "green" {
+				continue
+			}
+			change = changeNewHost
+		case p.status == "green" && r.status != "green":
+			change = changeNewlyFailing
+		case p.status != "green" && r.status == "green":
+			change = changeNewlyPassing
+		case r.status != "green":
+			change = changeStillFailing
+		default:
+			continue
+		}
+		counts[change]++
+		csvData = append(csvData, []string{r.hostname, r.href, p.status, r.status, change, strings.Join(diff(r.categories, p.categories), ";"), strings.Join(diff(p.categories, r.categories), ";")})
+	}
+
+	// Hosts in the previous run that are no longer idle or were not processed
+	notInCurrent := []result{}
+	for href, p := range previous {
+		if !current[href] {
+			notInCurrent = append(notInCurrent, p)
+		}
+	}
+	sort.Slice(notInCurrent, func(i, j int) bool { return notInCurrent[i].hostname < notInCurrent[j].hostname })
+	for _, p := range notInCurrent {
+		counts[changeNotInCurrent]++
+		csvData = append(csvData, []string{p.hostname, p.href, p.status, "", changeNotInCurrent, "", ""})
+	}
+
+	for _, change := range []string{changeNewlyFailing, changeNewlyPassing, changeStillFailing, changeNewHost, changeNotInCurrent} {
+		utils.LogInfof(true, "%d workloads %s", counts[change], change)
+	}
+	if len(csvData) == 1 {
+		utils.LogInfo("no changes from the previous run.", true)
+		return
+	}
+	utils.WriteOutput(csvData, csvData, fileName)
+	utils.LogInfof(true, "trend with %d workloads created - %s", len(csvData)-1, fileName)
+}
+
+// diff returns the entries in a that are not in b
+func diff(a, b []string) []string {
+	inB := make(map[string]bool)
+	for _, s := range b {
+		inB[s] = true
+	}
+	d := []string{}
+	for _, s := range a {
+		if s != "" && !inB[s] {
+			d = append(d, s)
+		}
+	}
+	return d
+}
+
+// rollup is the readiness of a label group
+type rollup struct {
+	values     []string
+	statuses   map[string]int
+	total      int
+	categories map[string]int
+}
+
+// writeReadiness writes the readiness percentage for each combination of the rollup keys
+func writeReadiness(results []result, keys []string, fileName string) {
+	all := &rollup{statuses: make(map[string]int), categories: make(map[string]int)}
+	rollups := make(map[string]*rollup)
+	for _, r := range results {
+		values := []string{}
+		for _, k := range keys {
+			values = append(values, r.labels[k])
+		}
+		key := strings.Join(values, "|")
+		if _, ok := rollups[key]; !ok {
+			rollups[key] = &rollup{values: values, statuses: make(map[string]int), categories: make(map[string]int)}
+		}
+		for _, ru := range []*rollup{rollups[key], all} {
+			ru.total++
+			ru.statuses[r.status]++
+			for _, c := range r.categories {
+				ru.categories[c]++
+			}
+		}
+	}
+
+	rollupSlice := []*rollup{}
+	for _, ru := range rollups {
+		rollupSlice = append(rollupSlice, ru)
+	}
+	sort.Slice(rollupSlice, func(i, j int) bool {
+		return strings.Join(rollupSlice[i].values, "|") < strings.Join(rollupSlice[j].values, "|")
+	})
+
+	csvData := [][]string{append(append([]string{}, keys...), "workloads", "green", "yellow", "red", "ready_pct", "issue_categories")}
+	for _, ru := range append([]*rollup{all}, rollupSlice...) {
+		row := []string{}
+		for i := range keys {
+			if ru == all {
+				row = append(row, "all")
+			} else {
+				row = append(row, ru.values[i])
+			}
+		}
+		row = append(row, strconv.Itoa(ru.total), strconv.Itoa(ru.statuses["green"]), strconv.Itoa(ru.statuses["yellow"]), strconv.Itoa(ru.statuses["red"]), fmt.Sprintf("%.1f", float64(ru.statuses["green"])/float64(ru.total)*100), categoryCounts(ru.categories))
+		csvData = append(csvData, row)
+	}
+	utils.WriteOutput(csvData, csvData, fileName)
+	utils.LogInfof(true, "%s%% of %d workloads are ready - %s", csvData[1][len(keys)+4], all.total, fileName)
+}
+
+// categoryCounts returns the categories sorted by count in category (count) format
+func categoryCounts(counts map[string]int) string {
+	categories := []string{}
+	for c := range counts {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	s := []string{}
+	for _, c := range categories {
+		s = append(s, fmt.Sprintf("%s (%d)", c, counts[c]))
+	}
+	return strings.Join(s, "; ")
+}
@@ -0,0 +1,172 @@
+package containercluster
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var description, pairingProfileName, enforcement, outputFileName string
+
+// newContainerCluster is the create container cluster request
+type newContainerCluster struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// createdContainerCluster is the create container cluster response. The token is only in this response.
+type createdContainerCluster struct {
+	Href                  string `json:"href"`
+	Name                  string `json:"name"`
+	ContainerClusterToken string `json:"container_cluster_token"`
+}
+
+// newPairingProfile is the create pairing profile request
+type newPairingProfile struct {
+	Name            string `json:"name"`
+	Enabled         bool   `json:"enabled"`
+	VenType         string `json:"ven_type"`
+	EnforcementMode string `json:"enforcement_mode"`
+}
+
+func init() {
+	ContainerClusterCreateCmd.Flags().StringVarP(&description, "description", "d", "", "container cluster description.")
+	ContainerClusterCreateCmd.Flags().StringVarP(&pairingProfileName, "pairing-profile", "p", "", "pairing profile for the c-vens. blank value will use same string as the container cluster. created if it does not exist. use \"skip\" to skip the pairing profile and key.")
+	ContainerClusterCreateCmd.Flags().StringVarP(&enforcement, "enforcement", "e", "visibility_only", "enforcement for a new pairing profile. values can be idle, visibility_only, selective, or full.")
+	ContainerClusterCreateCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+
+	ContainerClusterCreateCmd.Flags().SortFlags = false
+}
+
+// ContainerClusterCreateCmd creates a container cluster and gets the tokens to deploy kubelink and c-vens
+var ContainerClusterCreateCmd = &cobra.Command{
+	Use:   "container-cluster-create [name of container cluster]",
+	Short: "Create a container cluster and get the cluster token and pairing key.",
+	Long: `
+Create a container cluster and get the cluster token and pairing key.
+
+The container cluster id, token, and a pairing key from the pairing profile are written to a csv for the kubelink and c-ven deployment. The container cluster token is only available when the cluster is created. The csv contains secrets so protect it accordingly.
+
+If the pairing profile does not exist it is created with the --enforcement value. Use cwp-import to manage the container workload profiles (namespaces) after kubelink is deployed.
+
+Use the --update-pce command to create the cluster with a user prompt confirmation. Use --update-pce and --no-prompt to create with no prompts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			fmt.Println("Command requires 1 argument for the name of the container cluster. See usage help.")
+			os.Exit(0)
+		}
+
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		if enforcement != "idle" && enforcement != "visibility_only" && enforcement != "selective" && enforcement != "full" {
+			utils.LogError("enforcement must be idle, visibility_only, selective, or full.")
+		}
+
+		createContainerCluster(pce, args[0], viper.Get("update_pce").(bool), viper.Get("no_prompt").(bool))
+	},
+}
+
+func createContainerCluster(pce illumioapi.PCE, name string, updatePCE, noPrompt bool) {
+
+	// Check if the container cluster exists
+	api, err := pce.GetContainerClusters(map[string]string{"name": name})
+	utils.LogAPIRespV2("GetContainerClusters", api)
+	if err != nil {
+		utils.LogErrorf("getting container clusters - %s", err)
+	}
+	for _, cc := range pce.ContainerClustersSlice {
+		if cc.Name == name {
+			utils.LogErrorf("%s already exists - %s. the token is only available when a cluster is created.", name, cc.Href)
+		}
+	}
+
+	// Check the pairing profile
+	if pairingProfileName == "" {
+		pairingProfileName = name
+	}
+	var pairingProfile illumioapi.PairingProfile
+	if pairingProfileName != "skip" {
+		pairingProfiles, api, err := pce.GetPairingProfiles(map[string]string{"name": pairingProfileName})
+		utils.LogAPIRespV2("GetPairingProfiles", api)
+		if err != nil {
+			utils.LogErrorf("getting pairing profiles - %s", err)
+		}
+		for _, pp := range pairingProfiles {
+			if pp.Name == pairingProfileName {
+				pairingProfile = pp
+				break
+			}
+		}
+	}
+	logMsg := fmt.Sprintf("workloader will create the %s container cluster", name)
+	if pairingProfileName != "skip" && pairingProfile.Href == "" {
+		logMsg = fmt.Sprintf("%s and the %s pairing profile", logMsg, pairingProfileName)
+	}
+	utils.LogInfo(logMsg, true)
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo("To create the container cluster, run again using --update-pce flag. The --no-prompt flag will bypass the prompt if used with --update-pce.", true)
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if !noPrompt {
+		var prompt string
+		fmt.Printf("[PROMPT] - %s in %s (%s). Do you want to continue (yes/no)? ", logMsg, pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied", true)
+			return
+		}
+	}
+
+	// Create the container cluster
+	var created createdContainerCluster
+	api, err = pce.Post("container_clusters", &newContainerCluster{Name: name, Description: description}, &created)
+	utils.LogAPIRespV2("CreateContainerCluster", api)
+	if err != nil {
+		utils.LogErrorf("creating container cluster - %s", err)
+	}
+	if created.ContainerClusterToken == "" {
+		utils.LogErrorf("create container cluster response for %s does not have a container_cluster_token", created.Href)
+	}
+	cc := illumioapi.ContainerCluster{Href: created.Href, Name: created.Name}
+	utils.LogInfo(fmt.Sprintf("created %s container cluster - %s - %d", cc.Name, cc.Href, api.StatusCode), true)
+	csvData := [][]string{{"container_cluster", "container_cluster_id", "container_cluster_token", "pairing_profile", "pairing_key"}, {cc.Name, cc.ID(), created.ContainerClusterToken, "", ""}}
+
+	// Pairing profile and key
+	if pairingProfileName != "skip" {
+		if pairingProfile.Href == "" {
+			api, err = pce.Post("pairing_profiles", &newPairingProfile{Name: pairingProfileName, Enabled: true, VenType: "server", EnforcementMode: enforcement}, &pairingProfile)
+			utils.LogAPIRespV2("CreatePairingProfile", api)
+			if err != nil {
+				utils.LogErrorf("creating pairing profile - %s", err)
+			}
+			utils.LogInfo(fmt.Sprintf("created %s pairing profile - %s - %d", pairingProfile.Name, pairingProfile.Href, api.StatusCode), true)
+		}
+		pk, api, err := pce.CreatePairingKey(pairingProfile)
+		utils.LogAPIRespV2("CreatePairingKey", api)
+		if err != nil {
+			utils.LogErrorf("creating pairing key - %s", err)
+		}
+		csvData[1][3] = pairingProfile.Name
+		csvData[1][4] = pk.ActivationCode
+	}
+
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-container-cluster-create-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, nil, outputFileName)
+	utils.LogInfo(fmt.Sprintf("container cluster token and pairing key written to %s", outputFileName), true)
+}
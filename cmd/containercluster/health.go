@@ -0,0 +1,154 @@
+package containercluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var healthOutputFileName string
+var detail bool
+
+func init() {
+	ContainerClusterHealthCmd.Flags().BoolVar(&detail, "detail", false, "create a second csv with the health of each c-ven.")
+	ContainerClusterHealthCmd.Flags().StringVar(&healthOutputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. the detail file is the same name with -cvens appended.")
+
+	ContainerClusterHealthCmd.Flags().SortFlags = false
+}
+
+// ContainerClusterHealthCmd reports kubelink and c-ven health for each container cluster
+var ContainerClusterHealthCmd = &cobra.Command{
+	Use:   "container-cluster-health",
+	Short: "Report kubelink and c-ven health for each container cluster.",
+	Long: `
+Report kubelink and c-ven health for each container cluster.
+
+For each container cluster the kubelink status, number of nodes, and c-ven counts by status, version, and health are reported. A c-ven is unhealthy if it has any health conditions. Use --detail for the status of each c-ven.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		containerClusterHealth(pce)
+	},
+}
+
+// clusterHealth is the c-ven summary for a container cluster
+type clusterHealth struct {
+	cvens     int
+	active    int
+	unhealthy int
+	versions  map[string]int
+	messages  map[string]int
+}
+
+func containerClusterHealth(pce illumioapi.PCE) {
+
+	// Load the PCE
+	utils.LogInfo("getting container clusters and vens...", true)
+	apiResps, err := pce.Load(illumioapi.LoadInput{ContainerClusters: true, VENs: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Summarize the c-vens
+	health := make(map[string]*clusterHealth)
+	for _, cc := range pce.ContainerClustersSlice {
+		health[cc.Href] = &clusterHealth{versions: make(map[string]int), messages: make(map[string]int)}
+	}
+	detailData := [][]string{{"container_cluster", "hostname", "ven_href", "status", "version", "health"}}
+	for _, v := range pce.VENsSlice {
+		if v.ContainerCluster == nil {
+			continue
+		}
+		h, ok := health[v.ContainerCluster.Href]
+		if !ok {
+			continue
+		}
+		h.cvens++
+		if v.Status == "active" {
+			h.active++
+		}
+		h.versions[v.Version]++
+		messages := []string{}
+		for _, c := range illumioapi.PtrToVal(v.Conditions) {
+			messages = append(messages, c.LatestEvent.NotificationType)
+			h.messages[c.LatestEvent.NotificationType]++
+		}
+		if len(messages) > 0 {
+			h.unhealthy++
+		}
+		detailData = append(detailData, []string{pce.ContainerClusters[v.ContainerCluster.Href].Name, illumioapi.PtrToVal(v.Hostname), v.Href, v.Status, v.Version, strings.Join(messages, "; ")})
+	}
+
+	// Build the output
+	csvData := [][]string{{"container_cluster", "href", "kubelink_online", "kubelink_version", "last_connected", "nodes", "cvens", "active_cvens", "unhealthy_cvens", "cven_versions", "health_conditions"}}
+	for _, cc := range pce.ContainerClustersSlice {
+		h := health[cc.Href]
+		kubelink, err := getKubelinkStatus(pce, cc.Href)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		online := ""
+		if kubelink.Online != nil {
+			online = strconv.FormatBool(*kubelink.Online)
+		}
+		csvData = append(csvData, []string{cc.Name, cc.Href, online, kubelink.KubelinkVersion, kubelink.LastConnected, strconv.Itoa(len(illumioapi.PtrToVal(cc.Nodes))), strconv.Itoa(h.cvens), strconv.Itoa(h.active), strconv.Itoa(h.unhealthy), countString(h.versions), countString(h.messages)})
+	}
+
+	if len(csvData) == 1 {
+		utils.LogInfo("no container clusters in the pce", true)
+		return
+	}
+	if healthOutputFileName == "" {
+		healthOutputFileName = fmt.Sprintf("workloader-container-cluster-health-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, healthOutputFileName)
+	utils.LogInfo(fmt.Sprintf("%d container clusters exported", len(csvData)-1), true)
+	if detail && len(detailData) > 1 {
+		utils.WriteOutput(detailData, nil, strings.TrimSuffix(healthOutputFileName, ".csv")+"-cvens.csv")
+		utils.LogInfo(fmt.Sprintf("%d c-vens exported", len(detailData)-1), true)
+	}
+}
+
+// kubelinkStatus is the kubelink fields of a container cluster. The illumioapi container cluster does not have all of them.
+type kubelinkStatus struct {
+	Online          *bool  `json:"online"`
+	KubelinkVersion string `json:"kubelink_version"`
+	LastConnected   string `json:"last_connected"`
+}
+
+// getKubelinkStatus gets the kubelink fields of the container cluster
+func getKubelinkStatus(pce illumioapi.PCE, href string) (kubelinkStatus, error) {
+	var status kubelinkStatus
+	api, err := pce.GetHref(href, &status)
+	utils.LogAPIRespV2("GetContainerCluster", api)
+	if err != nil {
+		return status, fmt.Errorf("getting kubelink status for %s - %s", href, err)
+	}
+	return status, nil
+}
+
+// countString returns the map as a sorted list of value (count)
+func countString(counts map[string]int) string {
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s (%d)", k, counts[k])
+	}
+	return strings.Join(keys, "; ")
+}
@@ -13,19 +13,22 @@ import (
 var pce ia.PCE
 var err error
 
-var csp, ipListUrl, fileName, iplName, iplCsvFile, cspFilter string
-var testIPs, includev6, create, provision bool
+var csp, ipListUrl, fileName, iplName, iplCsvFile, cspFilter, sourceFile, snapshotFile string
+var testIPs, includev6, create, provision, offline bool
 
 //var ignoreCase, updatePCE bool
 
 // init initializes the command line flags for the command
 func init() {
-	CspIplistCmd.Flags().StringVarP(&csp, "csp", "", "", "Enter which csp (aws, azure, gcp,file) you want to get the ip list for.")
+	CspIplistCmd.Flags().StringVarP(&csp, "csp", "", "", "Enter which csp (aws, azure, gcp, office365, cloudflare, oracle, github, akamai, file) you want to get the ip list for.")
 	CspIplistCmd.Flags().StringVarP(&ipListUrl, "url", "u", "", "If you want to override the default url for the csp ip list.")
+	CspIplistCmd.Flags().StringVar(&sourceFile, "source-file", "", "Previously downloaded source file in the csp format. Used if the download fails, with --offline, or for akamai without --url.")
+	CspIplistCmd.Flags().BoolVar(&offline, "offline", false, "Do not download. Use the --source-file.")
 	CspIplistCmd.Flags().BoolVarP(&testIPs, "test-ips", "t", false, "After consolidating/merging all the IP ranges validate that original subnets are part of some IP range.")
 	CspIplistCmd.Flags().BoolVarP(&includev6, "ipv6", "", false, "Include ipv6 addresses. By default all ipv6 will be ignored.")
 	CspIplistCmd.Flags().StringVarP(&fileName, "filename", "f", "", "Include filename if you enter \"file\" for as csp option.")
-	CspIplistCmd.Flags().StringVarP(&cspFilter, "csp-filter", "", "", "Filter filename used filter IP ranges by service and/or region.")
+	CspIplistCmd.Flags().StringVarP(&cspFilter, "csp-filter", "", "", "Filter filename used filter IP ranges by service, region, and/or category.")
+	CspIplistCmd.Flags().StringVar(&snapshotFile, "snapshot-file", "", "Snapshot of the source ranges from the previous sync. Default is workloader-csp-iplist-snapshot-<csp>-<ip list name>.json in the current directory.")
 	CspIplistCmd.Flags().BoolVarP(&create, "create", "c", false, "create ip list if it does not exist")
 	CspIplistCmd.Flags().BoolVarP(&provision, "provision", "p", false, "provision ip list after replacing contents.")
 	CspIplistCmd.MarkFlagRequired("csp")
@@ -44,16 +47,27 @@ not include ipv6 addresses. If you want to include ipv6 addresses use the --ipv6
 
  		'workloader csp-iplist --csp gcp <ip listname>'  or 'workloader csp-iplist --csp gcp --ipv6 <ip listname>' or 'workloader csp-iplist --csp gcp --csp-filter <filter filename> <ip listname>'
 The following CSPs are supported:
-- AWS
-- Azure
-- GCP
+- aws
+- azure
+- gcp
+- office365 (service is the service area, e.g., Exchange, and category is Optimize, Allow, or Default)
+- cloudflare
+- oracle (service is the tag, e.g., OCI or OSN)
+- github (service is the meta key, e.g., hooks, web, or actions)
+- akamai (no public list. use --url or --source-file with a cidr in the first column of each line)
 
 You can use the --url flag to override the default url for the csp ip range web location.  You can also use specify 'file' as the CSP and provide the --filename flag to specify a file that contains a set of IP ranges.  It perform the same 
 check for duplicates and consolidate.  
 
+Use --source-file with a previously downloaded file in the csp format for pces without internet access. The file is used if the download fails and instead of downloading with --offline.
+
+Each sync saves a snapshot of the source ranges (see --snapshot-file). Each run logs the source ranges added and removed since the previous snapshot and writes them to a changes file before the PCE is touched. The snapshot is saved when the IP list already matches or the run uses --update-pce.
+
 By default no changes will be made to the PCE.  Please use --update-pce if you want to make changes.  If the IP List is not configured on the PCE, use the --create flag to create it.
 
-* Azure leaves services that span many regions with a blank region.  This command will set those regions to "GLOBAL" so use "GLOBAL" in your filter file.
+The filter file has region, service, and/or category columns. A blank value matches all.
+
+* Azure leaves services that span many regions with a blank region.  This command will set those regions to "GLOBAL" so use "GLOBAL" in your filter file. Office365, cloudflare, github, and akamai ranges are also "GLOBAL".
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -2,7 +2,6 @@ package cspiplist
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -25,159 +24,55 @@ const AZUREURL = "https://www.microsoft.com/en-us/download/details.aspx?id=56519
 const AWSURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
 const GCPURL = "https://www.gstatic.com/ipranges/cloud.json"
 const OFFICE365URL = "https://endpoints.office.com/endpoints/worldwide?clientrequestid=b10c5ed1-bad1-445f-b466-b5b1e171272a"
+const CLOUDFLAREURL = "https://api.cloudflare.com/client/v4/ips"
+const ORACLEURL = "https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json"
+const GITHUBURL = "https://api.github.com/meta"
+
+// defaultURLs are the well-known urls for each source. Akamai does not publish a public list so it requires --url or --source-file.
+var defaultURLs = map[string]string{"aws": AWSURL, "azure": AZUREURL, "gcp": GCPURL, "office365": OFFICE365URL, "cloudflare": CLOUDFLAREURL, "oracle": ORACLEURL, "github": GITHUBURL, "akamai": ""}
+
+// parsers parse the downloaded or offline source data for each source. ipv6 ranges are only included when ipv6 is true.
+var parsers = map[string]func(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error){"aws": awsParse, "azure": azureParse, "gcp": gcpParse, "office365": office365Parse, "cloudflare": cloudflareParse, "oracle": oracleParse, "github": githubParse, "akamai": akamaiParse}
 
 var originalIPRanges []string
 
+// SourceOptions set where the source ranges are read from and which are included
+type SourceOptions struct {
+	// IPv6 includes ipv6 ranges
+	IPv6 bool
+	// Offline reads the SourceFile instead of downloading
+	Offline bool
+	// SourceFile is a previously downloaded source used with Offline, when there is no url, or when the download fails
+	SourceFile string
+}
+
 // ipv6check checks if the ip is ipv6
 func ipv6check(cidr string) bool {
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return false
 	}
-	if includev6 {
-		return false
-	}
 	return ipnet.IP.To4() == nil
 }
 
-// getLastIP calculates the last IP address in a given CIDR range
-func getLastIP(ipNet *net.IPNet) net.IP {
-	ip := ipNet.IP
-	mask := ipNet.Mask
-
-	// Make a copy of IP to avoid modifying original
-	lastIP := make(net.IP, len(ip))
-	copy(lastIP, ip)
-
-	for i := range lastIP {
-		lastIP[i] |= ^mask[i]
-	}
-	return lastIP
-}
-
 // removeSubsetIPs removes any IP ranges that are a subset of another IP range
-func removeSubsetIPs(uniqueIPs map[string]bool) []string {
+func removeSubsetIPs(uniqueIPs map[string][]IPRangeProperties) []string {
 
-	ipNets := []*net.IPNet{}
-	tmpIP := []string{}
+	ips := []string{}
 	for ip := range uniqueIPs {
-		_, ipNet, err := net.ParseCIDR(ip)
-		if testIPs {
-			tmpIP = append(tmpIP, ip)
-		}
-		//only save ipv4 addresses
-		if err != nil {
-			utils.LogWarningf(false, "Invalid CIDR: %s", ip)
-			continue
-		}
-		ipNets = append(ipNets, ipNet)
+		ips = append(ips, ip)
 	}
 	if testIPs {
-		buildCSV(tmpIP, "test-org")
+		buildCSV(ips, "test-org")
 	}
 
-	// Filter out subset IP ranges
-	filteredIPs := []string{}
-	for i, ipNet1 := range ipNets {
-		isSubset := false
-
-		for j, ipNet2 := range ipNets {
-			if i == j {
-				continue
-			}
-
-			// Check if ipNet2 fully contains ipNet1 (start AND end IPs)
-			if ipNet2.Contains(ipNet1.IP) && ipNet2.Contains(getLastIP(ipNet1)) {
-				isSubset = true
-				break
-			}
-		}
-
-		if !isSubset {
-			filteredIPs = append(filteredIPs, ipNet1.String())
-		}
-	}
+	filteredIPs := utils.RemoveSubsetCIDRs(ips)
 	if testIPs {
 		buildCSV(filteredIPs, "removed-subset")
 	}
 	return filteredIPs
 }
 
-// mergeConsecutiveRanges merges consecutive IP ranges
-// loop thorugh the list of ips and merge the consecutive ranges until no more available consecutive IP ranges
-func mergeConsecutiveRanges(ips []string) []string {
-
-	filteredIPs := ips
-	for {
-		tmpIPs := []string{}
-		fmt.Println("starting consolidation loop", len(tmpIPs))
-		ipNets := []*net.IPNet{}
-		for _, ip := range filteredIPs {
-			_, ipNet, err := net.ParseCIDR(ip)
-			if err != nil {
-				utils.LogWarningf(false, "Invalid CIDR: %s", ip)
-				continue
-			}
-			ipNets = append(ipNets, ipNet)
-		}
-
-		// Sort IP networks by IP address
-		sort.Slice(ipNets, func(i, j int) bool {
-			return bytes.Compare(ipNets[i].IP, ipNets[j].IP) < 0
-		})
-
-		//logic to merge consecutive IP ranges
-		for i := 0; i < len(ipNets); i++ {
-			current := ipNets[i]
-			for j := i + 1; j < len(ipNets); j++ {
-				next := ipNets[j]
-				if canMerge(current, next) {
-					current = merge(current, next)
-					i = j // Move index forward to skip merged blocks
-				} else {
-					break
-				}
-			}
-			tmpIPs = append(tmpIPs, current.String())
-		}
-		if len(filteredIPs) == len(tmpIPs) {
-			break
-		} else {
-			filteredIPs = tmpIPs
-		}
-
-	}
-	return filteredIPs
-}
-
-// canMerge checks if two IP networks can be merged
-func canMerge(ipNet1, ipNet2 *net.IPNet) bool {
-	ones1, bits1 := ipNet1.Mask.Size()
-	ones2, bits2 := ipNet2.Mask.Size()
-
-	if bits1 != bits2 || ones1 != ones2 {
-		return false
-	}
-
-	// Check if the two networks are consecutive and properly aligned for merging
-	mask := net.CIDRMask(ones1-1, bits1)
-	baseNetwork := ipNet1.IP.Mask(mask)
-
-	return baseNetwork.Equal(ipNet2.IP.Mask(mask))
-}
-
-// merge performes the merge two IP networks
-func merge(ipNet1, ipNet2 *net.IPNet) *net.IPNet {
-	ones, bits := ipNet1.Mask.Size()
-	newOnes := ones - 1
-	newMask := net.CIDRMask(newOnes, bits)
-	newIP := ipNet1.IP.Mask(newMask)
-	if bytes.Compare(ipNet2.IP, newIP) < 0 {
-		newIP = ipNet2.IP.Mask(newMask)
-	}
-	return &net.IPNet{IP: newIP, Mask: newMask}
-}
-
 func addProps(region, service string) IPRangeProperties {
 	if region == "" {
 		region = "GLOBAL"
@@ -192,11 +87,11 @@ func addProps(region, service string) IPRangeProperties {
 }
 
 // gcpParse parses the GCP IP ranges JSON file
-func gcpParse(data []byte) map[string][]IPRangeProperties {
+func gcpParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
 	// Unmarshal the JSON data into the Go structure
 	var gcpIPRanges GCPIPRanges
 	if err := json.Unmarshal(data, &gcpIPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
@@ -205,7 +100,7 @@ func gcpParse(data []byte) map[string][]IPRangeProperties {
 
 		if gcpIPRange.IPv4Prefix != "" {
 			prefix = gcpIPRange.IPv4Prefix
-		} else if includev6 && gcpIPRange.IPv6Prefix != "" {
+		} else if ipv6 && gcpIPRange.IPv6Prefix != "" {
 			prefix = gcpIPRange.IPv6Prefix
 		} else {
 			continue
@@ -216,16 +111,16 @@ func gcpParse(data []byte) map[string][]IPRangeProperties {
 		uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(gcpIPRange.Scope, gcpIPRange.Service))
 
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
 // awsParse parses the AWS IP ranges JSON file
-func awsParse(data []byte) map[string][]IPRangeProperties {
+func awsParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
 
 	// Unmarshal the JSON data into the Go structure
 	var awsIPRanges AWSIPRanges
 	if err := json.Unmarshal(data, &awsIPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
@@ -241,7 +136,7 @@ func awsParse(data []byte) map[string][]IPRangeProperties {
 		}
 		uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps(awsIPRange.Region, awsIPRange.Service))
 
-		if includev6 {
+		if ipv6 {
 			for _, awsIPRange := range awsIPRanges.IPv6Prefixes {
 				prefix := ""
 				if awsIPRange.IPv6Prefix != "" {
@@ -257,43 +152,154 @@ func awsParse(data []byte) map[string][]IPRangeProperties {
 			}
 		}
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
-func office365Parse(data []byte) map[string][]IPRangeProperties {
+func office365Parse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
 	// Unmarshal the JSON data into the Go structure
 	var azure365IPRanges Azure365IPRanges
 	if err := json.Unmarshal(data, &azure365IPRanges); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
 	for _, officeIPRange := range azure365IPRanges {
 		for _, ip := range officeIPRange.Ips {
-			if !includev6 && ipv6check(ip) {
+			if !ipv6 && ipv6check(ip) {
 				continue
 			}
 			if _, exists := uniqueIPs[ip]; !exists && testIPs {
 				originalIPRanges = append(originalIPRanges, ip)
 			}
-			uniqueIPs[ip] = append(uniqueIPs[ip], addProps("GLOBAL", officeIPRange.ServiceArea))
+			props := addProps("GLOBAL", officeIPRange.ServiceArea)
+			props.Category = officeIPRange.Category
+			uniqueIPs[ip] = append(uniqueIPs[ip], props)
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// cloudflareParse parses the Cloudflare IP ranges JSON from the api
+func cloudflareParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
+	var cloudflareIPRanges CloudflareIPRanges
+	if err := json.Unmarshal(data, &cloudflareIPRanges); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	prefixes := cloudflareIPRanges.Result.IPv4CIDRs
+	if ipv6 {
+		prefixes = append(prefixes, cloudflareIPRanges.Result.IPv6CIDRs...)
+	}
+	for _, prefix := range prefixes {
+		if _, exists := uniqueIPs[prefix]; !exists && testIPs {
+			originalIPRanges = append(originalIPRanges, prefix)
+		}
+		uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps("GLOBAL", "cloudflare"))
+	}
+	return uniqueIPs, nil
+}
+
+// oracleParse parses the Oracle Cloud IP ranges JSON file. Each tag (e.g., OCI, OSN, OBJECT_STORAGE) is a service.
+func oracleParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
+	var oracleIPRanges OracleIPRanges
+	if err := json.Unmarshal(data, &oracleIPRanges); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for _, region := range oracleIPRanges.Regions {
+		for _, cidr := range region.CIDRs {
+			if !ipv6 && ipv6check(cidr.CIDR) {
+				continue
+			}
+			if _, exists := uniqueIPs[cidr.CIDR]; !exists && testIPs {
+				originalIPRanges = append(originalIPRanges, cidr.CIDR)
+			}
+			if len(cidr.Tags) == 0 {
+				uniqueIPs[cidr.CIDR] = append(uniqueIPs[cidr.CIDR], addProps(region.Region, ""))
+			}
+			for _, tag := range cidr.Tags {
+				uniqueIPs[cidr.CIDR] = append(uniqueIPs[cidr.CIDR], addProps(region.Region, tag))
+			}
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// githubParse parses the GitHub meta JSON. Each list of ranges (e.g., hooks, web, actions) is a service and non-range values are ignored.
+func githubParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for service, raw := range meta {
+		var entries []string
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			continue
+		}
+		for _, prefix := range entries {
+			if _, _, err := net.ParseCIDR(prefix); err != nil {
+				continue
+			}
+			if !ipv6 && ipv6check(prefix) {
+				continue
+			}
+			if _, exists := uniqueIPs[prefix]; !exists && testIPs {
+				originalIPRanges = append(originalIPRanges, prefix)
+			}
+			uniqueIPs[prefix] = append(uniqueIPs[prefix], addProps("GLOBAL", service))
+		}
+	}
+	return uniqueIPs, nil
+}
+
+// akamaiParse parses a list of Akamai ranges (e.g., the origin ip acl or siteshield map export) with a cidr in the first column of each line
+func akamaiParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
+	uniqueIPs := make(map[string][]IPRangeProperties)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+		prefix := fields[0]
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			// The first line can be a header
+			if i > 0 {
+				utils.LogWarningf(true, "line %d - %s is not a valid cidr - skipping", i+1, prefix)
+			}
+			continue
+		}
+		if !ipv6 && ipv6check(prefix) {
+			continue
+		}
+		if _, exists := uniqueIPs[ipNet.String()]; !exists && testIPs {
+			originalIPRanges = append(originalIPRanges, ipNet.String())
 		}
+		uniqueIPs[ipNet.String()] = append(uniqueIPs[ipNet.String()], addProps("GLOBAL", "akamai"))
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
 // azurParse unmarshalles the Azure IP ranges JSON file into a list of IP unique IP ranges
-func azureParse(data []byte) map[string][]IPRangeProperties {
+func azureParse(data []byte, ipv6 bool) (map[string][]IPRangeProperties, error) {
 
 	// Unmarshal the JSON data into the Go structure
 	var azserviceTags AzureServiceTags
 	if err := json.Unmarshal(data, &azserviceTags); err != nil {
-		utils.LogErrorf("%s", err)
+		return nil, err
 	}
 	uniqueIPs := make(map[string][]IPRangeProperties)
 	for _, serviceTag := range azserviceTags.Values {
 		for _, addressPrefix := range serviceTag.Properties.AddressPrefixes {
-			if !includev6 && ipv6check(addressPrefix) {
+			if !ipv6 && ipv6check(addressPrefix) {
 				continue
 			}
 			if serviceTag.Properties.Region == "" {
@@ -305,16 +311,15 @@ func azureParse(data []byte) map[string][]IPRangeProperties {
 			uniqueIPs[addressPrefix] = append(uniqueIPs[addressPrefix], addProps(serviceTag.Properties.Region, serviceTag.Name))
 		}
 	}
-	return uniqueIPs
+	return uniqueIPs, nil
 }
 
-func fileIPRangeRead() map[string][]IPRangeProperties {
+func fileIPRangeRead(ipv6 bool) (map[string][]IPRangeProperties, error) {
 
 	uniqueIPs := make(map[string][]IPRangeProperties)
 	file, err := os.Open(fileName)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return nil
+		return nil, fmt.Errorf("opening %s - %s", fileName, err)
 	}
 	defer file.Close()
 
@@ -327,9 +332,9 @@ func fileIPRangeRead() map[string][]IPRangeProperties {
 
 		_, ipNet, err := net.ParseCIDR(line)
 		if err != nil {
-			utils.LogErrorf("invalid CIDR in line: %s: %s", line, err)
+			return nil, fmt.Errorf("invalid CIDR in line: %s: %s", line, err)
 		}
-		if ipv6check(line) {
+		if !ipv6 && ipv6check(line) {
 			continue
 		}
 		// Check if the IP is already in the map
@@ -340,7 +345,7 @@ func fileIPRangeRead() map[string][]IPRangeProperties {
 
 	}
 
-	return uniqueIPs
+	return uniqueIPs, nil
 
 }
 
@@ -380,87 +385,142 @@ func fetchAzureDownloadURL(url string) (string, error) {
 	return string(match), nil
 }
 
-// downloadJSON downloads the JSON file from the given URL
-func downloadJSON(url string) []byte {
+// download downloads the file from the given URL
+func download(url string) ([]byte, error) {
 	resp, err := http.Get(url)
 	if err != nil {
-		utils.LogErrorf("failed to download JSON: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to download %s: %v", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		utils.LogErrorf("unexpected HTTP status: %s", resp.Status)
+		return nil, fmt.Errorf("unexpected HTTP status from %s: %s", url, resp.Status)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		utils.LogErrorf("failed to read JSON data: %v", err)
+		return nil, fmt.Errorf("failed to read data from %s: %v", url, err)
 	}
-	return data
+	return data, nil
 }
 
-// capIPProcessing processes the IP ranges for any of the CSP build today....AWS and Azure today
-func cspIPProcessing(csp, ipListUrl string) []string {
+// sourceData downloads the source. The --source-file is used instead with --offline, when there is no url, or when the download fails.
+func sourceData(url string, opts SourceOptions) ([]byte, error) {
+	if !opts.Offline && url != "" {
+		data, err := download(url)
+		if err == nil {
+			return data, nil
+		}
+		if opts.SourceFile == "" {
+			return nil, err
+		}
+		utils.LogWarningf(true, "%s - using %s", err, opts.SourceFile)
+	}
+	if opts.SourceFile == "" {
+		return nil, fmt.Errorf("--source-file is required with --offline or when there is no url to download")
+	}
+	data, err := os.ReadFile(opts.SourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source file: %s", err)
+	}
+	return data, nil
+}
 
-	var workingIPList []string
-	var uniqueIPs map[string][]IPRangeProperties
-	switch strings.ToLower(csp) {
-	case "aws":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = awsParse(data)
-
-	case "azure":
-		url := ""
-		if ipListUrl == AZUREURL {
-			tmpurl, err := fetchAzureDownloadURL(AZUREURL)
-			if err != nil {
-				utils.LogErrorf("Error finding download URL: %v\n", err)
-			}
-			url = tmpurl
+// cspRanges downloads and parses the IP ranges for the CSP
+func cspRanges(csp, ipListUrl string, opts SourceOptions) (map[string][]IPRangeProperties, error) {
+	csp = strings.ToLower(csp)
+	if csp == "file" {
+		return fileIPRangeRead(opts.IPv6)
+	}
+	parser, ok := parsers[csp]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a supported csp. options are %s, or file", csp, sourceNames())
+	}
+
+	// The azure url is a page with a link to the latest file
+	url := ipListUrl
+	if csp == "azure" && ipListUrl == AZUREURL && !opts.Offline {
+		tmpurl, err := fetchAzureDownloadURL(AZUREURL)
+		if err != nil && opts.SourceFile == "" {
+			return nil, fmt.Errorf("finding azure download url - %s", err)
 		}
-		data := downloadJSON(url)
-		uniqueIPs = azureParse(data)
+		if err != nil {
+			utils.LogWarningf(true, "error finding azure download url: %s - using %s", err, opts.SourceFile)
+		}
+		url = tmpurl
+	}
+	data, err := sourceData(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := parser(data, opts.IPv6)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s source - %s", csp, err)
+	}
+	return ranges, nil
+}
 
-	case "gcp":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = gcpParse(data)
+// sourceNames returns the sources sorted for help and error messages
+func sourceNames() string {
+	names := []string{}
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
 
-	case "office365":
-		data := downloadJSON(ipListUrl)
-		uniqueIPs = office365Parse(data)
+// CloudRanges returns the CIDRs published by the source (e.g., aws, azure, gcp, office365) using the default url.
+// Blank region and service match all. Matching is case insensitive.
+func CloudRanges(csp, region, service string, opts SourceOptions) ([]string, error) {
+	url, ok := defaultURLs[strings.ToLower(csp)]
+	if !ok || url == "" {
+		return nil, fmt.Errorf("%s is not a supported csp. options are %s except akamai", csp, sourceNames())
+	}
+	ranges, err := cspRanges(csp, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	cidrs := []string{}
+	for cidr, propsList := range ranges {
+		for _, props := range propsList {
+			if (region == "" || strings.EqualFold(region, props.Region)) && (service == "" || strings.EqualFold(service, props.Service)) {
+				cidrs = append(cidrs, cidr)
+				break
+			}
+		}
+	}
+	return cidrs, nil
+}
 
-	case "file":
-		uniqueIPs = fileIPRangeRead()
+// capIPProcessing processes the IP ranges for any of the CSP build today. It returns the consolidated ranges and the filtered source ranges.
+func cspIPProcessing(csp, ipListUrl string, opts SourceOptions) ([]string, map[string][]IPRangeProperties) {
 
-	default:
-		fmt.Println("Invalid CSP. Please enter either 'aws' or 'azure'.")
-		return nil
+	var workingIPList []string
+	uniqueIPs, err := cspRanges(csp, ipListUrl, opts)
+	if err != nil {
+		utils.LogErrorf("getting %s ranges - %s", csp, err)
 	}
-	filteredIPs := make(map[string]bool)
+	filteredIPs := uniqueIPs
 	if cspFilter != "" {
 		filteredIPs, err = filterIPsByCSPFilter(uniqueIPs, cspFilter)
 		if err != nil {
 			utils.LogErrorf("Error filtering IPs: %s", err)
 		}
-	} else {
-		for ip := range uniqueIPs {
-			filteredIPs[ip] = true
-		}
 	}
 
 	workingIPList = removeSubsetIPs(filteredIPs)
-	workingIPList = mergeConsecutiveRanges(workingIPList)
+	workingIPList = utils.MergeConsecutiveCIDRs(workingIPList)
 
 	if testIPs {
 		testIPRanges(workingIPList)
 	}
-	return workingIPList
+	return workingIPList, filteredIPs
 }
 
-// filterIPsByCSPFilter filters the input IP map by region and/or service as specified in the cspFilter CSV file.
-// Returns a new map with only the matching IPs.
-func filterIPsByCSPFilter(ipMap map[string][]IPRangeProperties, cspFilterPath string) (map[string]bool, error) {
+// filterIPsByCSPFilter filters the input IP map by region, service, and/or category as specified in the cspFilter CSV file.
+// A blank value in a row matches all. Returns a new map with only the matching IPs and their properties.
+func filterIPsByCSPFilter(ipMap map[string][]IPRangeProperties, cspFilterPath string) (map[string][]IPRangeProperties, error) {
 	file, err := os.Open(cspFilterPath)
 	if err != nil {
 		return nil, err
@@ -473,20 +533,28 @@ func filterIPsByCSPFilter(ipMap map[string][]IPRangeProperties, cspFilterPath st
 		return nil, err
 	}
 
-	regionIdx, serviceIdx := -1, -1
+	regionIdx, serviceIdx, categoryIdx := -1, -1, -1
 	for i, h := range headers {
 		switch strings.ToLower(strings.TrimSpace(h)) {
 		case "region":
 			regionIdx = i
 		case "service":
 			serviceIdx = i
+		case "category":
+			categoryIdx = i
 		}
 	}
-	if regionIdx == -1 && serviceIdx == -1 {
-		return nil, fmt.Errorf("cspFilter must have at least a 'region' or 'service' column")
+	if regionIdx == -1 && serviceIdx == -1 && categoryIdx == -1 {
+		return nil, fmt.Errorf("cspFilter must have at least a 'region', 'service', or 'category' column")
 	}
 
-	allowed := make(map[string]struct{})
+	value := func(record []string, idx int) string {
+		if idx == -1 || idx >= len(record) {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(record[idx]))
+	}
+	allowed := []IPRangeProperties{}
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
@@ -495,31 +563,19 @@ func filterIPsByCSPFilter(ipMap map[string][]IPRangeProperties, cspFilterPath st
 		if err != nil {
 			return nil, err
 		}
-		key := ""
-		if regionIdx != -1 {
-			key += strings.ToLower(strings.TrimSpace(record[regionIdx]))
-		}
-		key += "|"
-		if serviceIdx != -1 {
-			key += strings.ToLower(strings.TrimSpace(record[serviceIdx]))
+		rule := IPRangeProperties{Region: value(record, regionIdx), Service: value(record, serviceIdx), Category: value(record, categoryIdx)}
+		if rule.Region == "" && rule.Service == "" && rule.Category == "" {
+			continue
 		}
-		allowed[key] = struct{}{}
+		allowed = append(allowed, rule)
 	}
 
-	filtered := make(map[string]bool)
+	filtered := make(map[string][]IPRangeProperties)
 	for ip, propsList := range ipMap {
 		for _, props := range propsList {
-			region := strings.ToLower(props.Region)
-			service := strings.ToLower(props.Service)
-			// Try all combinations: both, just region, just service
-			keys := []string{
-				region + "|" + service,
-				region + "|",
-				"|" + service,
-			}
-			for _, key := range keys {
-				if _, ok := allowed[key]; ok {
-					filtered[ip] = true
+			for _, rule := range allowed {
+				if (rule.Region == "" || rule.Region == strings.ToLower(props.Region)) && (rule.Service == "" || rule.Service == strings.ToLower(props.Service)) && (rule.Category == "" || rule.Category == strings.ToLower(props.Category)) {
+					filtered[ip] = append(filtered[ip], props)
 					break
 				}
 			}
@@ -575,19 +631,9 @@ func testIPRanges(consolidatedIPRanges []string) {
 			}
 
 			// Check if the entire original range is within the consolidated range
-			if ipOuter.Contains(ipInner.IP) {
-				// Calculate the last IP of the original range
-				lastIP := make(net.IP, len(ipInner.IP))
-				copy(lastIP, ipInner.IP)
-				for i := len(lastIP) - 1; i >= 0; i-- {
-					lastIP[i] |= ^ipInner.Mask[i]
-				}
-
-				// Check if the last IP is also within the consolidated range
-				if ipOuter.Contains(lastIP) {
-					found = true
-					break
-				}
+			if ipOuter.Contains(ipInner.IP) && ipOuter.Contains(utils.LastIP(ipInner)) {
+				found = true
+				break
 			}
 		}
 
@@ -688,48 +734,48 @@ func getCurrentTimeStamp() string {
 func cspiplist(pce *ia.PCE, updatePCE, noPrompt bool, csp, ipListUrl, iplName string) {
 
 	var consolidatedIPs []string
-	switch strings.ToLower(csp) {
-	case "aws":
-
-		if ipListUrl == "" {
-			ipListUrl = AWSURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-	case "azure":
-		if ipListUrl == "" {
-			ipListUrl = AZUREURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-	case "gcp":
-		if ipListUrl == "" {
-			ipListUrl = GCPURL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-
-	case "office365":
-		if ipListUrl == "" {
-			ipListUrl = OFFICE365URL
-		}
-		consolidatedIPs = cspIPProcessing(csp, ipListUrl)
-
+	var sourceIPs map[string][]IPRangeProperties
+	opts := SourceOptions{IPv6: includev6, Offline: offline, SourceFile: sourceFile}
+	csp = strings.ToLower(csp)
+	switch csp {
 	case "file":
 		if fileName == "" {
 			fmt.Println("Please provide a file name.")
 			return
 		}
-		consolidatedIPs = cspIPProcessing(csp, "")
+		consolidatedIPs, sourceIPs = cspIPProcessing(csp, "", opts)
 	default:
-		fmt.Println("Invalid CSP. Please enter either 'aws' or 'azure'.")
-		return
+		defaultURL, ok := defaultURLs[csp]
+		if !ok {
+			fmt.Printf("Invalid CSP. Please enter one of %s, or file.\n", sourceNames())
+			return
+		}
+		if ipListUrl == "" {
+			ipListUrl = defaultURL
+		}
+		consolidatedIPs, sourceIPs = cspIPProcessing(csp, ipListUrl, opts)
 	}
+
+	// Report the changes since the previous sync before touching the PCE
+	if snapshotFile == "" {
+		snapshotFile = defaultSnapshotFile(csp, iplName)
+	}
+	previous, err := loadSnapshot(snapshotFile)
+	if err != nil {
+		utils.LogErrorf("loading snapshot - %s", err)
+	}
+	reportChanges(previous, sourceIPs, csp)
+	current := snapshot{CSP: csp, URL: ipListUrl, IPList: iplName, Synced: time.Now().Format(time.RFC3339), Ranges: sourceIPs}
+
 	if compareIPList(*pce, iplName, consolidatedIPs) {
 		utils.LogInfof(true, "IPList %s is the same as the consolidated IP ranges. No changes made.", iplName)
+		saveSnapshot(snapshotFile, current)
 		return
 	}
 
 	iplCsvFile = buildCSV(consolidatedIPs, csp)
 
-	iplreplace.IplReplace(iplreplace.Input{
+	replaced := iplreplace.IplReplace(iplreplace.Input{
 		PCE:         *pce,
 		IplCsvFile:  iplCsvFile,
 		FqdnCsvFile: "",
@@ -741,4 +787,8 @@ func cspiplist(pce *ia.PCE, updatePCE, noPrompt bool, csp, ipListUrl, iplName st
 		NoBackup:    false,
 		NoHeaders:   false})
 
+	// The snapshot is the state of the last sync so only save it when the PCE is updated
+	if replaced {
+		saveSnapshot(snapshotFile, current)
+	}
 }
@@ -60,7 +60,28 @@ type GCPIPRanges struct {
 	} `json:"prefixes"`
 }
 
+type CloudflareIPRanges struct {
+	Result struct {
+		IPv4CIDRs []string `json:"ipv4_cidrs"`
+		IPv6CIDRs []string `json:"ipv6_cidrs"`
+		Etag      string   `json:"etag"`
+	} `json:"result"`
+	Success bool `json:"success"`
+}
+
+type OracleIPRanges struct {
+	LastUpdated string `json:"last_updated_timestamp"`
+	Regions     []struct {
+		Region string `json:"region"`
+		CIDRs  []struct {
+			CIDR string   `json:"cidr"`
+			Tags []string `json:"tags"`
+		} `json:"cidrs"`
+	} `json:"regions"`
+}
+
 type IPRangeProperties struct {
-	Region  string `json:"region"`
-	Service string `json:"service"`
+	Region   string `json:"region"`
+	Service  string `json:"service"`
+	Category string `json:"category,omitempty"`
 }
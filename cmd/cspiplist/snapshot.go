@@ -0,0 +1,111 @@
+package cspiplist
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// snapshot is the source ranges from the last sync
+type snapshot struct {
+	CSP    string                         `json:"csp"`
+	URL    string                         `json:"url"`
+	IPList string                         `json:"ip_list"`
+	Synced string                         `json:"synced"`
+	Ranges map[string][]IPRangeProperties `json:"ranges"`
+}
+
+// defaultSnapshotFile returns the snapshot file name for the csp and ip list in the current directory
+func defaultSnapshotFile(csp, iplName string) string {
+	name := regexp.MustCompile(`[^a-zA-Z0-9_.-]+`).ReplaceAllString(iplName, "_")
+	return fmt.Sprintf("workloader-csp-iplist-snapshot-%s-%s.json", csp, name)
+}
+
+// loadSnapshot loads the snapshot file. nil is returned if it does not exist.
+func loadSnapshot(file string) (*snapshot, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s - %s", file, err)
+	}
+	return &s, nil
+}
+
+// saveSnapshot writes the snapshot file
+func saveSnapshot(file string, s snapshot) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		utils.LogErrorf("creating snapshot - %s", err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		utils.LogErrorf("writing snapshot - %s", err)
+	}
+	utils.LogInfof(true, "snapshot of %d source ranges saved - %s", len(s.Ranges), file)
+}
+
+// reportChanges logs and writes the source ranges added and removed since the previous snapshot
+func reportChanges(previous *snapshot, current map[string][]IPRangeProperties, csp string) {
+	if previous == nil {
+		utils.LogInfof(true, "no previous snapshot. %d source ranges will be saved as the first sync.", len(current))
+		return
+	}
+
+	csvData := [][]string{{"change", "cidr", "region", "service", "category"}}
+	changes := map[string]map[string][]IPRangeProperties{"added": {}, "removed": {}}
+	for cidr, props := range current {
+		if _, ok := previous.Ranges[cidr]; !ok {
+			changes["added"][cidr] = props
+		}
+	}
+	for cidr, props := range previous.Ranges {
+		if _, ok := current[cidr]; !ok {
+			changes["removed"][cidr] = props
+		}
+	}
+	for _, change := range []string{"added", "removed"} {
+		cidrs := []string{}
+		for cidr := range changes[change] {
+			cidrs = append(cidrs, cidr)
+		}
+		sort.Strings(cidrs)
+		for _, cidr := range cidrs {
+			regions, services, categories := []string{}, []string{}, []string{}
+			for _, p := range changes[change][cidr] {
+				regions, services, categories = appendUnique(regions, p.Region), appendUnique(services, p.Service), appendUnique(categories, p.Category)
+			}
+			csvData = append(csvData, []string{change, cidr, strings.Join(regions, ";"), strings.Join(services, ";"), strings.Join(categories, ";")})
+		}
+	}
+
+	utils.LogInfof(true, "since the previous sync on %s: %d source ranges added and %d removed.", previous.Synced, len(changes["added"]), len(changes["removed"]))
+	if len(csvData) == 1 {
+		return
+	}
+	outFile := fmt.Sprintf("workloader-csp-iplist-changes-%s-%s.csv", csp, getCurrentTimeStamp())
+	utils.WriteOutput(csvData, csvData, outFile)
+	utils.LogInfof(true, "changes - %s", outFile)
+}
+
+// appendUnique appends the value if it is not blank or already in the slice
+func appendUnique(s []string, v string) []string {
+	if v == "" {
+		return s
+	}
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
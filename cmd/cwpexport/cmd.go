@@ -24,7 +24,7 @@ var ContainerProfileExportCmd = &cobra.Command{
 	Long: `
 Create a CSV export of all container workload profiles in the PCE.
 
-Only label assignments are supported. Label restrictions will not be exported.
+Label assignments are exported as the label value. Label restrictions are exported as "restrict:" followed by the allowed values separated by semicolons (e.g., restrict:prod;staging).
 
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -49,12 +49,20 @@ func ExportContainerProfiles(pce illumioapi.PCE) {
 
 	// Iterate each container cluster and get the container profiles
 	containerWkldProfiles := []illumioapi.ContainerWorkloadProfile{}
+	profileLabels := make(map[string][]CWPLabel)
 	for _, cc := range pce.ContainerClustersSlice {
 		a, err := pce.GetContainerWkldProfiles(nil, cc.ID())
 		utils.LogAPIRespV2("GetContainerWkldProfiles", a)
 		if err != nil {
 			utils.LogError(err.Error())
 		}
+		labels, err := GetProfileLabels(pce, cc.ID())
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for href, l := range labels {
+			profileLabels[href] = l
+		}
 		for _, p := range pce.ContainerWorkloadProfilesSlice {
 			if illumioapi.PtrToVal(p.Name) == "Default Profile" {
 				continue
@@ -112,7 +120,7 @@ func ExportContainerProfiles(pce illumioapi.PCE) {
 		// Write output
 		row := []string{cp.ClusterName, name, desc, cp.Namespace, illumioapi.PtrToVal(cp.EnforcementMode), visLevel, strconv.FormatBool(*cp.Managed)}
 		for _, lk := range labelKeys {
-			row = append(row, cp.GetLabelByKey(lk))
+			row = append(row, LabelCell(profileLabels[cp.Href], lk, pce.Labels))
 		}
 		row = append(row, cp.Href)
 		data = append(data, row)
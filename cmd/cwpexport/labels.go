@@ -0,0 +1,123 @@
+package cwpexport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// RestrictionPrefix starts a label cell that is a restriction instead of an assignment. The allowed values follow separated by semicolons.
+const RestrictionPrefix = "restrict:"
+
+// CWPLabel is the api representation of a container workload profile label. A label is either an assignment or a restriction.
+// The illumioapi label does not have restrictions so container workload profile labels are read and written with this type.
+type CWPLabel struct {
+	Key         string     `json:"key"`
+	Assignment  *LabelRef  `json:"assignment,omitempty"`
+	Restriction []LabelRef `json:"restriction,omitempty"`
+}
+
+// LabelRef is a label in an assignment or restriction
+type LabelRef struct {
+	Href  string `json:"href"`
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// cwpLabels is the href and labels of a container workload profile
+type cwpLabels struct {
+	Href   string     `json:"href,omitempty"`
+	Labels []CWPLabel `json:"labels"`
+}
+
+// GetProfileLabels returns the labels of each container workload profile in the container cluster. The key is the profile href.
+// The first API call does not use the async option. If there are >=500 profiles, it re-runs with async.
+func GetProfileLabels(pce illumioapi.PCE, containerClusterID string) (map[string][]CWPLabel, error) {
+	endpoint := "container_clusters/" + containerClusterID + "/container_workload_profiles"
+	profiles := []cwpLabels{}
+	api, err := pce.GetCollection(endpoint, false, nil, &profiles)
+	utils.LogAPIRespV2("GetContainerWkldProfileLabels", api)
+	if err == nil && len(profiles) >= 500 {
+		profiles = nil
+		api, err = pce.GetCollection(endpoint, true, nil, &profiles)
+		utils.LogAPIRespV2("GetContainerWkldProfileLabels", api)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting container workload profile labels for %s - %s", containerClusterID, err)
+	}
+	labels := make(map[string][]CWPLabel)
+	for _, p := range profiles {
+		labels[p.Href] = p.Labels
+	}
+	return labels, nil
+}
+
+// PutLabels returns the labels with only the label hrefs as the api expects in a put
+func PutLabels(labels []CWPLabel) []CWPLabel {
+	putLabels := []CWPLabel{}
+	for _, l := range labels {
+		p := CWPLabel{Key: l.Key}
+		if l.Assignment != nil {
+			p.Assignment = &LabelRef{Href: l.Assignment.Href}
+		}
+		for _, r := range l.Restriction {
+			p.Restriction = append(p.Restriction, LabelRef{Href: r.Href})
+		}
+		putLabels = append(putLabels, p)
+	}
+	return putLabels
+}
+
+// LabelCell returns the csv value for a label key. An assignment is the label value.
+// A restriction is the restriction prefix followed by the allowed values separated by semicolons.
+func LabelCell(labels []CWPLabel, key string, labelMap map[string]illumioapi.Label) string {
+	for _, l := range labels {
+		if l.Key != key {
+			continue
+		}
+		if l.Assignment != nil {
+			return refValue(*l.Assignment, labelMap)
+		}
+		values := []string{}
+		for _, r := range l.Restriction {
+			values = append(values, refValue(r, labelMap))
+		}
+		return RestrictionPrefix + strings.Join(values, ";")
+	}
+	return ""
+}
+
+// refValue returns the value of a label reference, using the label map if the value is not in the reference
+func refValue(ref LabelRef, labelMap map[string]illumioapi.Label) string {
+	if ref.Value != "" {
+		return ref.Value
+	}
+	return labelMap[ref.Href].Value
+}
+
+// RemoveLabel returns the labels without the label for the key
+func RemoveLabel(labels []CWPLabel, key string) []CWPLabel {
+	updated := []CWPLabel{}
+	for _, l := range labels {
+		if l.Key != key {
+			updated = append(updated, l)
+		}
+	}
+	return updated
+}
+
+// SetAssignment returns the labels with the label for the key replaced by an assignment to the provided label
+func SetAssignment(labels []CWPLabel, label illumioapi.Label) []CWPLabel {
+	return append(RemoveLabel(labels, label.Key), CWPLabel{Key: label.Key, Assignment: &LabelRef{Href: label.Href, Key: label.Key, Value: label.Value}})
+}
+
+// SetRestriction returns the labels with the label for the key replaced by a restriction to the provided labels
+func SetRestriction(labels []CWPLabel, key string, restricted []illumioapi.Label) []CWPLabel {
+	restriction := CWPLabel{Key: key}
+	for _, l := range restricted {
+		restriction.Restriction = append(restriction.Restriction, LabelRef{Href: l.Href, Key: l.Key, Value: l.Value})
+	}
+	return append(RemoveLabel(labels, key), restriction)
+}
@@ -15,8 +15,21 @@ import (
 )
 
 type updateCWP struct {
-	cwp     illumioapi.ContainerWorkloadProfile
-	csvLine int
+	cwp         illumioapi.ContainerWorkloadProfile
+	csvLine     int
+	labels      []cwpexport.CWPLabel
+	labelUpdate bool
+}
+
+// profileUpdate is the container workload profile put body. Labels are only sent when they change.
+type profileUpdate struct {
+	Href            string                `json:"href,omitempty"`
+	Name            *string               `json:"name"` // API expects null for name to remove it. Always sent.
+	Description     *string               `json:"description,omitempty"`
+	EnforcementMode *string               `json:"enforcement_mode,omitempty"`
+	VisibilityLevel *string               `json:"visibility_level,omitempty"`
+	Managed         *bool                 `json:"managed,omitempty"`
+	Labels          *[]cwpexport.CWPLabel `json:"labels,omitempty"`
 }
 
 var importFile, removeValueInput string
@@ -34,9 +47,9 @@ var ContainerProfileImportCmd = &cobra.Command{
 	Long: `
 Update container workload profiles in the PCE.
 
-It's recommended to start with a cwp-export command to get the proper format and the container workload profile HREFs.
+It's recommended to start with a cwp-export command to get the proper format and the container workload profile HREFs. If the href is blank, the profile is matched on the container_cluster and namespace.
 
-Only label assignments are supported. Label restrictions will show as blank in the export. Adding a value to the blank will change the restriction to an assignment.`,
+A label value is an assignment. To set a label restriction, use "restrict:" followed by the allowed values separated by semicolons (e.g., restrict:prod;staging). Labels in assignments and restrictions that do not exist are created. Replacing a restriction with a value changes it to an assignment.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// Set the CSV file
@@ -96,16 +109,28 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 
 	// Iterate each container cluster and get the container profiles
 	cwpMap := make(map[string]illumioapi.ContainerWorkloadProfile)
+	cwpNamespaceMap := make(map[string]illumioapi.ContainerWorkloadProfile)
+	profileLabels := make(map[string][]cwpexport.CWPLabel)
 	for _, cc := range pce.ContainerClustersSlice {
 		a, err := pce.GetContainerWkldProfiles(nil, cc.ID())
 		utils.LogAPIRespV2("GetContainerWkldProfiles", a)
 		if err != nil {
 			utils.LogError(err.Error())
 		}
+		ccLabels, err := cwpexport.GetProfileLabels(pce, cc.ID())
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for href, labels := range ccLabels {
+			profileLabels[href] = labels
+		}
 		for _, p := range pce.ContainerWorkloadProfilesSlice {
 			// if p.Name != nil && *p.Name == "Default Profile" {
 			p.ClusterName = cc.Name
 			cwpMap[p.Href] = p
+			if p.Namespace != "" {
+				cwpNamespaceMap[cc.Name+p.Namespace] = p
+			}
 		}
 	}
 
@@ -115,7 +140,7 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 
 	// Process each csv row
 	for index, row := range csvData {
-		update := false
+		update, labelUpdate := false, false
 		// If it's the first row, process the headers
 		if index == 0 {
 			for col, header := range row {
@@ -125,9 +150,23 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 
 		// Process all other rows
 		if index != 0 {
-			// Get the current pce container workload profile
-			if cwp, exists := cwpMap[row[headers[cwpexport.Href]]]; !exists {
-				utils.LogWarning(fmt.Sprintf("csv row %d - %s does not exist. skipping.", index+1, row[headers[cwpexport.Href]]), true)
+			// Get the current pce container workload profile. If there is no href, match on the container cluster and namespace.
+			rowHref := ""
+			if c, ok := headers[cwpexport.Href]; ok {
+				rowHref = row[c]
+			}
+			cwp, exists := cwpMap[rowHref]
+			if !exists && rowHref == "" {
+				ccCol, ccOK := headers[cwpexport.ContainerCluster]
+				nsCol, nsOK := headers[cwpexport.Namespace]
+				if !ccOK || !nsOK {
+					utils.LogError(fmt.Sprintf("csv row %d - the href is blank and matching on namespace requires the %s and %s headers", index+1, cwpexport.ContainerCluster, cwpexport.Namespace))
+				}
+				cwp, exists = cwpNamespaceMap[row[ccCol]+row[nsCol]]
+				rowHref = fmt.Sprintf("%s namespace in %s", row[nsCol], row[ccCol])
+			}
+			if !exists {
+				utils.LogWarning(fmt.Sprintf("csv row %d - %s does not exist. skipping.", index+1, rowHref), true)
 			} else {
 				logMsgs := []string{}
 
@@ -249,6 +288,7 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 						labelKeys = append(labelKeys, ld.Key)
 					}
 				}
+				labels := profileLabels[cwp.Href]
 				labelValues := []string{}
 				removeAllLabelsCount := 0
 				for _, lk := range labelKeys {
@@ -263,14 +303,32 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 					if labelValues[i] == "" {
 						continue
 					} else if removeAllLabelsCount == len(labelKeys) {
-						update = true
-						cwp.Labels = &[]illumioapi.Label{}
+						update, labelUpdate = true, true
+						labels = []cwpexport.CWPLabel{}
 						logMsgs = append(logMsgs, "all labels to be removed")
 						break
 					} else if labelValues[i] == removeValue {
-						logMsgs = append(logMsgs, fmt.Sprintf("%s label %s to be removed", key, cwp.GetLabelByKey(key)))
-						cwp.RemoveLabel(key)
-						update = true
+						logMsgs = append(logMsgs, fmt.Sprintf("%s label %s to be removed", key, cwpexport.LabelCell(labels, key, pce.Labels)))
+						labels = cwpexport.RemoveLabel(labels, key)
+						update, labelUpdate = true, true
+						// Process restrictions
+					} else if strings.HasPrefix(labelValues[i], cwpexport.RestrictionPrefix) {
+						restricted := []illumioapi.Label{}
+						for _, v := range strings.Split(strings.TrimPrefix(labelValues[i], cwpexport.RestrictionPrefix), ";") {
+							if strings.TrimSpace(v) == "" {
+								continue
+							}
+							csvLabel := checkLabel(pce, illumioapi.Label{Key: key, Value: strings.TrimSpace(v)})
+							if csvLabel.Href == "" {
+								logMsgs = append(logMsgs, fmt.Sprintf("%s label %s to be created", csvLabel.Key, csvLabel.Value))
+							}
+							restricted = append(restricted, csvLabel)
+						}
+						if current := cwpexport.LabelCell(labels, key, pce.Labels); !sameRestriction(current, restricted) {
+							logMsgs = append(logMsgs, fmt.Sprintf("%s label to be updated from %s to %s", key, current, labelValues[i]))
+							labels = cwpexport.SetRestriction(labels, key, restricted)
+							update, labelUpdate = true, true
+						}
 						// Process everything else
 					} else {
 						// Get the label
@@ -279,10 +337,10 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 						if csvLabel.Href == "" {
 							logMsgs = append(logMsgs, fmt.Sprintf("%s label %s to be created", csvLabel.Key, csvLabel.Value))
 						}
-						if cwp.GetLabelByKey(key) != csvLabel.Value {
-							logMsgs = append(logMsgs, fmt.Sprintf("%s label to be updated from %s to %s", key, cwp.GetLabelByKey(key), csvLabel.Value))
-							cwp.SetLabel(csvLabel, &pce)
-							update = true
+						if current := cwpexport.LabelCell(labels, key, pce.Labels); current != csvLabel.Value {
+							logMsgs = append(logMsgs, fmt.Sprintf("%s label to be updated from %s to %s", key, current, csvLabel.Value))
+							labels = cwpexport.SetAssignment(labels, csvLabel)
+							update, labelUpdate = true, true
 						}
 					}
 				}
@@ -290,7 +348,7 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 				// Log Message
 				if update {
 					utils.LogInfo(fmt.Sprintf("csv line %d - %s", index+1, strings.Join(logMsgs, "; ")), true)
-					updatedCWPs = append(updatedCWPs, updateCWP{cwp: cwp, csvLine: index + 1})
+					updatedCWPs = append(updatedCWPs, updateCWP{cwp: cwp, csvLine: index + 1, labels: labels, labelUpdate: labelUpdate})
 				}
 			}
 		}
@@ -336,19 +394,28 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 		utils.LogInfo(fmt.Sprintf("created %s %s label - %d", newLabel.Value, newLabel.Key, api.StatusCode), true)
 	}
 
-	// Update CWPs that have place holder labels
-	for i, update := range updatedCWPs {
-		for _, label := range *update.cwp.Labels {
-			if label.Assignment.Value != "" && label.Assignment.Href == "" {
-				update.cwp.SetLabel(pce.Labels[label.Key+label.Assignment.Value], &pce)
+	// Update CWPs that have place holder labels now that all labels have hrefs
+	for _, update := range updatedCWPs {
+		for _, label := range update.labels {
+			if label.Assignment != nil && label.Assignment.Href == "" {
+				label.Assignment.Href = pce.Labels[label.Key+label.Assignment.Value].Href
+			}
+			for j, r := range label.Restriction {
+				if r.Href == "" {
+					label.Restriction[j].Href = pce.Labels[label.Key+r.Value].Href
+				}
 			}
 		}
-		updatedCWPs[i] = updateCWP{cwp: update.cwp, csvLine: update.csvLine}
 	}
 
 	// Update the CWPs
 	for _, update := range updatedCWPs {
-		api, err := pce.UpdateContainerWkldProfiles(update.cwp)
+		put := profileUpdate{Href: update.cwp.Href, Name: update.cwp.Name, Description: update.cwp.Description, EnforcementMode: update.cwp.EnforcementMode, VisibilityLevel: update.cwp.VisibilityLevel, Managed: update.cwp.Managed}
+		if update.labelUpdate {
+			labels := cwpexport.PutLabels(update.labels)
+			put.Labels = &labels
+		}
+		api, err := pce.Put(&put)
 		utils.LogAPIRespV2("UpdateContainerWorkloadProfiles", api)
 		if err != nil {
 			utils.LogError(fmt.Sprintf("csv line %d - %s", update.csvLine, err.Error()))
@@ -357,3 +424,23 @@ func ImportContainerProfiles(pce illumioapi.PCE, importFile, removeValue string,
 	}
 
 }
+
+// sameRestriction returns true if the current csv label cell is a restriction to the same label values
+func sameRestriction(current string, labels []illumioapi.Label) bool {
+	if !strings.HasPrefix(current, cwpexport.RestrictionPrefix) {
+		return false
+	}
+	currentValues := make(map[string]bool)
+	for _, v := range strings.Split(strings.TrimPrefix(current, cwpexport.RestrictionPrefix), ";") {
+		currentValues[v] = true
+	}
+	if len(currentValues) != len(labels) {
+		return false
+	}
+	for _, l := range labels {
+		if !currentValues[l.Value] {
+			return false
+		}
+	}
+	return true
+}
@@ -122,7 +122,7 @@ type IPTags struct {
 var pce illumioapi.PCE
 var err error
 var noPrompt, addIPv6, update, insecure, clean, removeOld, changePersistent, noHref bool
-var panURL, panKey, panVsys, filterFile, timeout string
+var panURL, panKey, panVsys, filterFile, selectExpr, timeout string
 
 func init() {
 	DAGSyncCmd.Flags().StringVarP(&panURL, "url", "u", "", "URL required to reach Panorama or PAN FW(requires https://).")
@@ -131,7 +131,8 @@ func init() {
 	DAGSyncCmd.Flags().BoolVarP(&addIPv6, "ipv6", "6", false, "Include IPv6 addresses in the syncing of PCE IP and labels/tags with PAN DAGs")
 	DAGSyncCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Ignore SSL certificate validation when communicating with PAN.")
 	DAGSyncCmd.Flags().BoolVarP(&update, "update-panos", "", false, "Implement identified changes on PanOS (versus just logging by default).")
-	DAGSyncCmd.Flags().StringVarP(&filterFile, "file", "f", "", "Optional CSV file with labels to filter PCE workloads. CSV requires role, app, env, and loc headers on row. Each subsequent row is a unique combination of labels to filter on. Blank values = all.")
+	DAGSyncCmd.Flags().StringVarP(&filterFile, "file", "f", "", "Optional CSV file with labels to filter PCE workloads. The header row is label keys (any label dimension). Each subsequent row is a unique combination of labels to filter on. Blank values = all.")
+	DAGSyncCmd.Flags().StringVar(&selectExpr, "select", "", "Optional selector expression to filter PCE workloads. Can be combined with --file. See description below.")
 	DAGSyncCmd.Flags().StringVarP(&timeout, "timeout", "t", "0", "Timeout value")
 	DAGSyncCmd.Flags().BoolVarP(&removeOld, "remove-stale", "r", false, "Remove all Registered IPs that don't have IP on the PCE.")
 	DAGSyncCmd.Flags().BoolVar(&changePersistent, "non-persistent", false, "RegisterIPs are persistent by default.")
@@ -153,6 +154,8 @@ The PANOS_URL, PANOS_KEY, and PANOS_VSYS environment variables can be used inste
 
 All ipv4 or ipv6 link local addresses will always be ignored (169.254.0.0/16 or FE80::/10).
 
+` + utils.SelectorHelp + `
+
 The --update-pce flag is ignored for this command. The --update-panos flag is used instead.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -286,7 +289,7 @@ func ipCheck(ip, href string) string {
 }
 
 // workloadIPMap - Build a map of all workloads IPs and their corresponding labels.
-func workloadIPMap(filterList []map[string]string) map[string]IPTags {
+func workloadIPMap(filterList []map[string]string, selector *utils.Selector) map[string]IPTags {
 	var pceIpMap = make(map[string]IPTags)
 
 	wklds, a, err := pce.GetWklds(nil)
@@ -328,7 +331,7 @@ func workloadIPMap(filterList []map[string]string) map[string]IPTags {
 				}
 			}
 			//found match
-			if numMatch == 4 {
+			if numMatch == len(filterList[i]) {
 				match = true
 				break
 			}
@@ -336,7 +339,7 @@ func workloadIPMap(filterList []map[string]string) map[string]IPTags {
 		if filterFile == "" {
 			match = true
 		}
-		if match {
+		if match && selector.Match(utils.SelectorTargetV1(w, pce.Labels)) {
 			for _, ip := range w.Interfaces {
 				if ipCheck(ip.Address, w.Href) != "" {
 					pceIpMap[ip.Address] = IPTags{Labels: labels, Found: false, HrefLabel: w.Href}
@@ -588,9 +591,14 @@ func dagSync() {
 		utils.LogError(fmt.Sprintf("URL entered is trying to use backup HA device. URL - %s", panURL))
 	}
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Parse the CSV File if there is one.
 	fileData := [][]string{}
-	var err error
 	if filterFile != "" {
 		fileData, err = utils.ParseCSV(filterFile)
 		if err != nil {
@@ -612,8 +620,14 @@ func dagSync() {
 		if totLen == 0 {
 			utils.LogInfo(fmt.Sprintf("Workload filter file : row %d does not have ANY entries..This will cause everything to match", i), true)
 		}
-		//Build filter structure to be used when getting PCE workloads.
-		filter = append(filter, map[string]string{"role": row[0], "app": row[1], "env": row[2], "loc": row[3]})
+		//Build filter structure to be used when getting PCE workloads. The header row provides the label keys.
+		rowFilter := make(map[string]string)
+		for c, key := range fileData[0] {
+			if c < len(row) {
+				rowFilter[key] = row[c]
+			}
+		}
+		filter = append(filter, rowFilter)
 	}
 
 	//Get PAN registered IPs and Workload IPs from PAN/PCE
@@ -624,7 +638,7 @@ func dagSync() {
 	workloadsMap := make(map[string]IPTags)
 	if !clean {
 		utils.LogInfo(fmt.Sprintf("Calling PCE get ALL Workloads - %s", pce.FQDN), true)
-		workloadsMap = workloadIPMap(filter)
+		workloadsMap = workloadIPMap(filter, selector)
 		utils.LogInfo(fmt.Sprintf("%d Workloads IPs on PCE.", len(workloadsMap)), true)
 	}
 
@@ -94,6 +94,9 @@ func (i *Input) getHrefs(userInput string) {
 				utils.LogInfo(fmt.Sprintf("csv Line - %d - first row is header - skipping", i+1), true)
 				continue
 			}
+			if line[col] == "" {
+				continue
+			}
 			input.Hrefs = append(input.Hrefs, line[col])
 		}
 	}
@@ -33,6 +33,8 @@ Identifies unmanaged workloads with hostnames, names, or IP addresses also assig
 
 Interfaces with a default gateway are used on managed workloads.
 
+Use wkld-reconcile to also match by external data and cloud instance id with confidence scores and act on the matches.
+
 The --update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -0,0 +1,329 @@
+package enforcementplan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/rulecoverage"
+	"github.com/brian1917/workloader/cmd/wkldexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var selectExpr, targetMode, policyVersion, start, end, outputFileName string
+var maxResults, maxBlockedFlows, heartbeatHours, batchSize int
+var allowNoTraffic, allowLowVisibility bool
+var pce ia.PCE
+var err error
+
+func init() {
+	EnforcementPlanCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression for the workloads to plan. default is all managed workloads. see description below.")
+	EnforcementPlanCmd.Flags().StringVar(&targetMode, "target-mode", "full", "target enforcement mode. must be selective or full.")
+	EnforcementPlanCmd.Flags().StringVarP(&policyVersion, "policy-version", "p", "draft", "policy version to evaluate flows against. must be active or draft.")
+	EnforcementPlanCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -30).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	EnforcementPlanCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	EnforcementPlanCmd.Flags().IntVarP(&maxResults, "max-results", "m", 200000, "max results in explorer. maximum value is 200000.")
+	EnforcementPlanCmd.Flags().IntVar(&batchSize, "batch-size", 50, "number of workloads in each explorer query. a query that reaches the max results is split in half until it has one workload.")
+	EnforcementPlanCmd.Flags().IntVar(&maxBlockedFlows, "max-blocked-flows", 0, "maximum number of flows that would be blocked for a workload to be ready.")
+	EnforcementPlanCmd.Flags().IntVar(&heartbeatHours, "heartbeat-hours", 24, "maximum hours since the last heartbeat for a workload to be ready.")
+	EnforcementPlanCmd.Flags().BoolVar(&allowNoTraffic, "allow-no-traffic", false, "workloads with no flows in the time window can be ready.")
+	EnforcementPlanCmd.Flags().BoolVar(&allowLowVisibility, "allow-low-visibility", false, "workloads with visibility set to off or blocked can be ready.")
+	EnforcementPlanCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. the wkld-import file is the same name with -wkld-import appended.")
+
+	EnforcementPlanCmd.Flags().SortFlags = false
+}
+
+// EnforcementPlanCmd estimates the impact of moving workloads to selective or full enforcement
+var EnforcementPlanCmd = &cobra.Command{
+	Use:   "enforcement-plan",
+	Short: "Estimate blocked flows for moving workloads to selective or full enforcement and create a wkld-import file for the workloads that are ready.",
+	Long: `
+Estimate blocked flows for moving workloads to selective or full enforcement and create a wkld-import file for the workloads that are ready.
+
+Managed workloads matching --select that are not already in the target mode are planned. Recent traffic to and from the workloads is retrieved from explorer and evaluated locally against the draft or active policy (see the rule-coverage command for how rules are evaluated):
+  - full: a flow would be blocked if no allow rule covers it or an override deny rule matches it. inbound and outbound flows are evaluated.
+  - selective: an inbound flow would be blocked if a deny rule or enforcement boundary matches it and no allow rule covers it, or an override deny rule matches it.
+
+A workload is ready if all of the following are true:
+  - would-be-blocked flows are at or below --max-blocked-flows.
+  - the workload is online and the last heartbeat is within --heartbeat-hours.
+  - visibility is not off or blocked (low detail means flows are missing). use --allow-low-visibility to ignore.
+  - there is at least one flow in the time window. use --allow-no-traffic to ignore.
+  - the explorer results for the workload are complete. traffic is queried for --batch-size workloads at a time and a query that reaches --max-results is split in half. a single workload that still reaches --max-results is not ready since flows are missing.
+
+` + utils.SelectorHelp + `
+
+Two files are created:
+  1. A report of every planned workload with flow counts, the top services that would be blocked, and blockers.
+  2. A wkld-import file with the target enforcement for ready workloads. Review it and run wkld-import with --allow-enforcement-changes to apply.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		enforcementPlan()
+	},
+}
+
+// plan is the evaluation of a workload
+type plan struct {
+	wkld               ia.Workload
+	flows              int
+	truncated          bool
+	blockedFlows       int
+	blockedConnections int
+	blockedServices    map[string]int
+}
+
+func enforcementPlan() {
+
+	// Validate the input
+	targetMode = strings.ToLower(targetMode)
+	if targetMode != "selective" && targetMode != "full" {
+		utils.LogError("target-mode must be selective or full")
+	}
+	policyVersion = strings.ToLower(policyVersion)
+	if policyVersion != "active" && policyVersion != "draft" {
+		utils.LogError("policy-version must be active or draft")
+	}
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Load the PCE
+	utils.LogInfo("getting labels, label groups, ip lists, services, enforcement boundaries, and managed workloads...", true)
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, LabelGroups: true, IPLists: true, Services: true, EnforcementBoundaries: true, Workloads: true, WorkloadsQueryParameters: map[string]string{"managed": "true"}, ProvisionStatus: policyVersion}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Get the rulesets and compile the policy
+	utils.LogInfo(fmt.Sprintf("getting %s rulesets...", policyVersion), true)
+	a, err := pce.GetRulesets(nil, policyVersion)
+	utils.LogAPIRespV2("GetRulesets", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	allowRules := rulecoverage.NewEvaluator(&pce, pce.RuleSetsSlice)
+	denyRules := rulecoverage.NewDenyEvaluator(&pce, pce.RuleSetsSlice, pce.EnforcementBoundariesSlice)
+	utils.LogInfo(fmt.Sprintf("%d allow rules and %d deny rules and enforcement boundaries to evaluate", len(allowRules.Rules), len(denyRules.Rules)), true)
+
+	// Get the workloads to plan
+	plans := make(map[string]*plan)
+	wkldHrefs := []string{}
+	for _, w := range selector.FilterV2(pce.WorkloadsSlice, pce.Labels) {
+		if ia.PtrToVal(w.Deleted) || ia.PtrToVal(w.EnforcementMode) == targetMode || (targetMode == "selective" && ia.PtrToVal(w.EnforcementMode) == "full") {
+			continue
+		}
+		plans[w.Href] = &plan{wkld: w, blockedServices: make(map[string]int)}
+		wkldHrefs = append(wkldHrefs, w.Href)
+	}
+	if len(plans) == 0 {
+		utils.LogInfo(fmt.Sprintf("no workloads to move to %s", targetMode), true)
+		return
+	}
+	sort.Strings(wkldHrefs)
+	utils.LogInfo(fmt.Sprintf("%d workloads to plan for %s enforcement", len(plans), targetMode), true)
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{"allowed", "potentially_blocked", "blocked"},
+		MaxFLows:                        maxResults,
+		ExcludeWorkloadsFromIPListQuery: true,
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// Inbound traffic
+	traffic := []ia.TrafficAnalysis{}
+	truncated := make(map[string]bool)
+	for i := 0; i < len(wkldHrefs); i += batchSize {
+		traffic = append(traffic, queryTraffic(tq, batch(wkldHrefs, i), true, truncated)...)
+	}
+	utils.LogInfo(fmt.Sprintf("inbound traffic query result count: %d", len(traffic)), true)
+
+	// Outbound traffic is only enforced in full. Flows to planned workloads are in the inbound queries so skip them the second time unless the inbound query was truncated.
+	if targetMode == "full" {
+		outbound := []ia.TrafficAnalysis{}
+		for i := 0; i < len(wkldHrefs); i += batchSize {
+			outbound = append(outbound, queryTraffic(tq, batch(wkldHrefs, i), false, truncated)...)
+		}
+		utils.LogInfo(fmt.Sprintf("outbound traffic query result count: %d", len(outbound)), true)
+		for _, t := range outbound {
+			if t.Dst.Workload != nil && plans[t.Dst.Workload.Href] != nil && !truncated[t.Dst.Workload.Href] {
+				continue
+			}
+			traffic = append(traffic, t)
+		}
+	}
+	for href := range truncated {
+		plans[href].truncated = true
+	}
+	if len(truncated) > 0 {
+		utils.LogWarningf(true, "%d workloads reached the max results of %d in a single query and are not ready. narrow the time window to get complete results.", len(truncated), maxResults)
+	}
+
+	// Evaluate the flows
+	protoMap := ia.ProtocolList()
+	for _, t := range traffic {
+		f := rulecoverage.FlowFromTraffic(t)
+		blocked := wouldBlock(f, allowRules, denyRules)
+		for _, p := range []*plan{plans[f.DstWkldHref], plans[f.SrcWkldHref]} {
+			if p == nil {
+				continue
+			}
+			// Outbound flows only count against the source in full enforcement
+			if p.wkld.Href == f.SrcWkldHref && p.wkld.Href != f.DstWkldHref && targetMode != "full" {
+				continue
+			}
+			p.flows++
+			if blocked {
+				p.blockedFlows++
+				p.blockedConnections = p.blockedConnections + int(t.NumConnections)
+				p.blockedServices[fmt.Sprintf("%d %s", t.ExpSrv.Port, protoMap[t.ExpSrv.Proto])]++
+			}
+		}
+	}
+
+	// Build the output
+	reportData := [][]string{{wkldexport.HeaderHostname, wkldexport.HeaderHref, "current_enforcement", "target_enforcement", wkldexport.HeaderVisibility, wkldexport.HeaderOnline, wkldexport.HeaderHoursSinceLastHeartbeat, "flows", "flows_would_block", "connections_would_block", "top_blocked_services", "ready", "blockers"}}
+	importData := [][]string{{wkldexport.HeaderHref, wkldexport.HeaderHostname, wkldexport.HeaderEnforcement}}
+	for _, href := range wkldHrefs {
+		p := plans[href]
+		w := p.wkld
+		blockers := []string{}
+		if p.blockedFlows > maxBlockedFlows {
+			blockers = append(blockers, fmt.Sprintf("%d flows would be blocked", p.blockedFlows))
+		}
+		if !ia.PtrToVal(w.Online) {
+			blockers = append(blockers, "offline")
+		}
+		hoursSinceHeartbeat := w.HoursSinceLastHeartBeat()
+		if hoursSinceHeartbeat > float64(heartbeatHours) {
+			blockers = append(blockers, fmt.Sprintf("no heartbeat in %d hours", int(hoursSinceHeartbeat)))
+		}
+		if v := w.GetVisibilityLevel(); !allowLowVisibility && (v == "off" || v == "blocked") {
+			blockers = append(blockers, fmt.Sprintf("low detail logging - visibility is %s", v))
+		}
+		if p.truncated {
+			blockers = append(blockers, fmt.Sprintf("explorer results truncated at %d - flows are missing", maxResults))
+		}
+		if p.flows == 0 && !allowNoTraffic {
+			blockers = append(blockers, "no flows in time window")
+		}
+
+		reportData = append(reportData, []string{ia.PtrToVal(w.Hostname), w.Href, ia.PtrToVal(w.EnforcementMode), targetMode, w.GetVisibilityLevel(), strconv.FormatBool(ia.PtrToVal(w.Online)), fmt.Sprintf("%.1f", hoursSinceHeartbeat), strconv.Itoa(p.flows), strconv.Itoa(p.blockedFlows), strconv.Itoa(p.blockedConnections), topServices(p.blockedServices, 5), strconv.FormatBool(len(blockers) == 0), strings.Join(blockers, "; ")})
+		if len(blockers) == 0 {
+			importData = append(importData, []string{w.Href, ia.PtrToVal(w.Hostname), targetMode})
+		}
+	}
+
+	// Write the output
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-enforcement-plan-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(reportData, reportData, outputFileName)
+	utils.LogInfo(fmt.Sprintf("%d of %d workloads are ready for %s enforcement", len(importData)-1, len(reportData)-1, targetMode), true)
+	if len(importData) > 1 {
+		importFileName := strings.TrimSuffix(outputFileName, ".csv") + "-wkld-import.csv"
+		utils.WriteOutput(importData, nil, importFileName)
+		utils.LogInfo(fmt.Sprintf("review %s and run wkld-import with --allow-enforcement-changes to apply.", importFileName), true)
+	}
+}
+
+// batch returns the batch of hrefs starting at i
+func batch(hrefs []string, i int) []string {
+	end := i + batchSize
+	if end > len(hrefs) {
+		end = len(hrefs)
+	}
+	return hrefs[i:end]
+}
+
+// queryTraffic gets the inbound or outbound traffic for the workloads. A query that reaches the max results is split in half.
+// A single workload that reaches the max results is added to truncated.
+func queryTraffic(tq ia.TrafficQuery, hrefs []string, inbound bool, truncated map[string]bool) []ia.TrafficAnalysis {
+	include := [][]string{}
+	for _, href := range hrefs {
+		include = append(include, []string{href})
+	}
+	if inbound {
+		tq.DestinationsInclude = include
+	} else {
+		tq.SourcesInclude = include
+	}
+	traffic, a, err := pce.GetTrafficAnalysis(tq)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	utils.LogInfo(fmt.Sprintf("explorer query body: %s", a.ReqBody), false)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if len(traffic) < maxResults {
+		return traffic
+	}
+	if len(hrefs) == 1 {
+		truncated[hrefs[0]] = true
+		return traffic
+	}
+	utils.LogInfo(fmt.Sprintf("query for %d workloads reached the max results of %d - splitting in half", len(hrefs), maxResults), true)
+	half := len(hrefs) / 2
+	return append(queryTraffic(tq, hrefs[:half], inbound, truncated), queryTraffic(tq, hrefs[half:], inbound, truncated)...)
+}
+
+// wouldBlock returns true if the flow would be blocked in the target mode
+func wouldBlock(f rulecoverage.Flow, allowRules, denyRules *rulecoverage.Evaluator) bool {
+	denied := false
+	for _, i := range denyRules.Covering(f) {
+		if ia.PtrToVal(denyRules.Rules[i].Rule.Override) {
+			return true
+		}
+		denied = true
+	}
+	if targetMode == "selective" && !denied {
+		return false
+	}
+	return len(allowRules.Covering(f)) == 0
+}
+
+// topServices returns the services with the most blocked flows
+func topServices(services map[string]int, n int) string {
+	keys := []string{}
+	for k := range services {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if services[keys[i]] != services[keys[j]] {
+			return services[keys[i]] > services[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s (%d)", k, services[k])
+	}
+	return strings.Join(keys, "; ")
+}
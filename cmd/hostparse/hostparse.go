@@ -17,7 +17,7 @@ import (
 )
 
 // Set up global variables
-var parserFile, hostFile, appFlag, roleFlag, envFlag, locFlag, outputFileName string
+var parserFile, hostFile, appFlag, roleFlag, envFlag, locFlag, selectExpr, outputFileName string
 var debug, noPrompt, updatePCE, allWklds bool
 var capitalize int
 var pce illumioapi.PCE
@@ -31,6 +31,7 @@ func init() {
 	HostnameCmd.Flags().StringVarP(&envFlag, "env", "e", "", "Environment label to identify workloads to parse hostnames. No value will look for workloads with no environment label.")
 	HostnameCmd.Flags().StringVarP(&locFlag, "loc", "l", "", "Location label to identify workloads to parse hostnames. No value will look for workloads with no location label.")
 	HostnameCmd.Flags().BoolVar(&allWklds, "all", false, "Parse all PCE workloads no matter what labels are assigned. Individual label flags are ignored if set.")
+	HostnameCmd.Flags().StringVar(&selectExpr, "select", "", "Selector expression to identify workloads to parse hostnames. Label flags and --all are ignored if set. See description below.")
 	HostnameCmd.Flags().IntVar(&capitalize, "capitalize", 1, "Set 1 for uppercase labels(default), 2 for lowercase labels or 0 to leave capitalization as is in parsed hostname.")
 	HostnameCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
@@ -57,7 +58,7 @@ An input CSV specifics the regex functions to use to assign labels. An example i
 | (h)(6)-(\w*)-([sd])(\d+)                            | DB   | ${3} | SITE${5}  | Amazon    |
 +-----------------------------------------------------+------+------+-----------+-----------+
 
-
+` + utils.SelectorHelp + `
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -308,6 +309,12 @@ func changeCase(str string) string {
 // hostnameParser - Main function to parse hostnames either on the PCE on in a hostfile using regex file and created labels from results.
 func hostnameParser() {
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Set output file
 	if outputFileName == "" {
 		outputFileName = "workloader-hostparse-" + time.Now().Format("20060102_150405") + ".csv"
@@ -436,7 +443,11 @@ func hostnameParser() {
 		//Check to see
 
 		updateLabels(&w, lblshref)
-		if w.LabelsMatch(roleFlag, appFlag, envFlag, locFlag, lblshref) || allWklds {
+		targeted := w.LabelsMatch(roleFlag, appFlag, envFlag, locFlag, lblshref) || allWklds
+		if selector != nil {
+			targeted = selector.Match(utils.SelectorTargetV1(w, lblshref))
+		}
+		if targeted {
 
 			match, labeledwrkld := data.RelabelFromHostname(failedPCE, w, lblskv, nolabels, outputFile)
 			orgRole, orgApp, orgEnv, orgLoc := labelvalues(*w.Labels)
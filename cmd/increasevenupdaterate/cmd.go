@@ -13,7 +13,7 @@ import (
 	"github.com/spf13/viper"
 )
 
-var role, app, env, loc string
+var role, app, env, loc, selectExpr string
 var forMinutes int
 var pce illumioapi.PCE
 var err error
@@ -24,6 +24,7 @@ func init() {
 	IncreaseVENUpdateRateCmd.Flags().StringVarP(&app, "app", "a", "", "Application Label. Blank means all applications.")
 	IncreaseVENUpdateRateCmd.Flags().StringVarP(&env, "env", "e", "", "Environment Label. Blank means all environments.")
 	IncreaseVENUpdateRateCmd.Flags().StringVarP(&loc, "loc", "l", "", "Location Label. Blank means all locations.")
+	IncreaseVENUpdateRateCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to target workloads. can be combined with label flags. see description below.")
 	IncreaseVENUpdateRateCmd.Flags().IntVarP(&forMinutes, "for-minutes", "f", 0, "Minutes to issue increase command every 10 minutes (e.g., 60 will run the process for 60 minutes with the command running 6 total times.")
 
 }
@@ -37,6 +38,9 @@ Increase the VEN update rate to every 30 seconds for a period of 10 minutes.
 
 Use the role, app, env, and loc labels to specify workloads. One label can be provided for each key and they are combined with the "AND" operator.
 
+Use --select for other label dimensions and attributes. Only online managed workloads are targeted.
+` + utils.SelectorHelp + `
+
 The forMinutes flag can be used to have workloader run the command every 10 minutes for the specified forMinutes value. You'll need to keep your shell open (or run in the background).`,
 
 	Example: `# Increase frequency for all workloads in the CRM (app) PROD (env) app group for the default 10 mins:
@@ -61,6 +65,12 @@ The forMinutes flag can be used to have workloader run the command every 10 minu
 
 func increaseVENUpdateRate() {
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Get the labels
 	apiResps, err := pce.Load(illumioapi.LoadInput{Labels: true})
 	utils.LogMultiAPIResp(apiResps)
@@ -91,6 +101,7 @@ func increaseVENUpdateRate() {
 
 	// Get the workloads
 	pce.Load(illumioapi.LoadInput{Workloads: true, WorkloadsQueryParameters: qp})
+	pce.WorkloadsSlice = selector.FilterV1(pce.WorkloadsSlice, pce.Labels)
 	utils.LogInfo(fmt.Sprintf("%d workloads identified", len(pce.WorkloadsSlice)), true)
 
 	// If we have zero workloads, we are done.
@@ -0,0 +1,440 @@
+package iplcompose
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/cspiplist"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Declare local global variables
+var pce ia.PCE
+var err error
+var includeV6, provision, updatePCE, noPrompt bool
+var outputFileName string
+
+// Statuses
+const (
+	statusCreate    = "create"
+	statusUpdate    = "update"
+	statusUnchanged = "unchanged"
+)
+
+func init() {
+	IplComposeCmd.Flags().BoolVar(&includeV6, "include-v6", false, "include ipv6 ranges from cloud terms.")
+	IplComposeCmd.Flags().BoolVarP(&provision, "provision", "p", false, "provision the created and updated ip lists.")
+	IplComposeCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+
+	IplComposeCmd.Flags().SortFlags = false
+}
+
+// IplComposeCmd builds ip lists from expressions over other ip lists, csv files, and cloud ranges
+var IplComposeCmd = &cobra.Command{
+	Use:   "ipl-compose [yaml file]",
+	Short: "Create and update IP lists defined as expressions over other IP lists, CSV files, and cloud ranges.",
+	Long: `
+Create and update IP lists defined as expressions over other IP lists, CSV files, and cloud ranges.
+
+The input is a yaml file with a list of ip lists to build:
+
+lists:
+  - name: corp-egress
+    description: corp networks without the lab
+    expression: 'ipl:"Corp Networks" - ipl:Lab - 10.99.0.0/16'
+  - name: aws-east-s3
+    expression: 'cloud:aws:us-east-1:S3 & csv:approved.csv'
+
+Terms:
+  - ipl:name - an ip list in the pce (draft) or another list in the file. exclusions are removed and fqdns are ignored.
+  - csv:file - the first column of a csv file. entries starting with "!" are removed. a header row is skipped.
+  - cloud:csp[:region[:service]] - the published ranges for any csp-iplist source except akamai (e.g., aws, azure, gcp, office365, github). region and service are optional.
+  - an ip address, cidr, or range (e.g., 10.0.0.1-10.0.0.9).
+
+Operators (must be separated by spaces):
+  - "+" union
+  - "&" intersection. evaluated before union and difference.
+  - "-" difference. use it for exclusions.
+Parentheses group terms and double quotes are required for names with spaces.
+
+The result is reduced to the minimum set of cidrs. A list that references another list in the file uses the computed value so lists can be layered. Circular references are an error.
+
+An output file shows each list with the status (create, update, or unchanged) and the cidrs added and removed. Lists are only updated when the addresses or description change. Existing fqdns are kept.
+
+Run on a schedule with --update-pce and --no-prompt to keep the lists current as the sources change.
+
+Recommended to run without --update-pce first to log what will change. If --update-pce is used, ipl-compose will create and update the ip lists with a user prompt. To disable the prompt, use --no-prompt.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err = utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		// Set the yaml file
+		if len(args) != 1 {
+			fmt.Println("command requires 1 argument for the yaml file. See usage help.")
+			os.Exit(0)
+		}
+
+		// Get the viper values
+		updatePCE = viper.Get("update_pce").(bool)
+		noPrompt = viper.Get("no_prompt").(bool)
+
+		iplCompose(args[0])
+	},
+}
+
+// definition is an ip list in the yaml file
+type definition struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Expression  string `yaml:"expression"`
+	tree        *node
+}
+
+// parseDefinitions parses and validates the yaml file
+func parseDefinitions(file string) ([]*definition, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Lists []*definition `yaml:"lists"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s - %s", file, err)
+	}
+	if len(doc.Lists) == 0 {
+		return nil, fmt.Errorf("%s has no lists", file)
+	}
+	names := make(map[string]bool)
+	for i, d := range doc.Lists {
+		if d.Name == "" {
+			return nil, fmt.Errorf("list %d does not have a name", i+1)
+		}
+		if names[strings.ToLower(d.Name)] {
+			return nil, fmt.Errorf("%s is defined more than once", d.Name)
+		}
+		names[strings.ToLower(d.Name)] = true
+		if d.tree, err = parseExpression(d.Expression); err != nil {
+			return nil, fmt.Errorf("%s - %s", d.Name, err)
+		}
+	}
+	return doc.Lists, nil
+}
+
+// result is the computed value of a definition compared to the pce
+type result struct {
+	def            *definition
+	set            *utils.IPSet
+	existing       ia.IPList
+	status         string
+	added, removed []string
+}
+
+func iplCompose(file string) {
+
+	defs, err := parseDefinitions(file)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Get the draft ip lists
+	a, err := pce.GetIPLists(nil, "draft")
+	utils.LogAPIRespV2("GetIPLists", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	pceIPLs := make(map[string]ia.IPList)
+	for _, ipl := range pce.IPListsSlice {
+		pceIPLs[strings.ToLower(ipl.Name)] = ipl
+	}
+
+	// Compute each list and compare to the pce
+	r := newResolver(defs, pceIPLs)
+	results := []result{}
+	for _, d := range defs {
+		set, err := r.evalDefinition(d)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		if set.Empty() {
+			utils.LogWarningf(true, "%s has no addresses", d.Name)
+		}
+		res := result{def: d, set: set, status: statusUnchanged}
+		existing, ok := pceIPLs[strings.ToLower(d.Name)]
+		if !ok {
+			res.status = statusCreate
+			res.added = set.CIDRs()
+		} else {
+			res.existing = existing
+			current := iplSet(existing)
+			res.added = set.Subtract(current).CIDRs()
+			res.removed = current.Subtract(set).CIDRs()
+			if len(res.added) > 0 || len(res.removed) > 0 || (d.Description != "" && d.Description != ia.PtrToVal(existing.Description)) {
+				res.status = statusUpdate
+			}
+		}
+		results = append(results, res)
+	}
+
+	// Write the output
+	csvData := [][]string{{"name", "href", "status", "expression", "entries", "added", "removed", "added_entries", "removed_entries"}}
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[res.status]++
+		csvData = append(csvData, []string{res.def.Name, res.existing.Href, res.status, res.def.Expression, strconv.Itoa(len(res.set.CIDRs())), strconv.Itoa(len(res.added)), strconv.Itoa(len(res.removed)), strings.Join(res.added, ";"), strings.Join(res.removed, ";")})
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-ipl-compose-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, outputFileName)
+	utils.LogInfof(true, "%d ip lists to create, %d to update, and %d unchanged - %s", counts[statusCreate], counts[statusUpdate], counts[statusUnchanged], outputFileName)
+
+	if counts[statusCreate]+counts[statusUpdate] == 0 {
+		utils.LogInfo("nothing to be done.", true)
+		return
+	}
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo("see the output file for the changes. to do the create and update, run again using --update-pce flag.", true)
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if updatePCE && !noPrompt {
+		var prompt string
+		fmt.Printf("[PROMPT] - workloader will create %d ip lists and update %d ip lists in %s (%s). Do you want to run the update (yes/no)? ", counts[statusCreate], counts[statusUpdate], pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied", true)
+			return
+		}
+	}
+
+	// Create and update
+	provisionHrefs := []string{}
+	for _, res := range results {
+		if res.status == statusUnchanged {
+			continue
+		}
+		ranges := []ia.IPRange{}
+		for _, cidr := range res.set.CIDRs() {
+			ranges = append(ranges, ia.IPRange{FromIP: cidr})
+		}
+		if res.status == statusCreate {
+			ipl := ia.IPList{Name: res.def.Name, IPRanges: &ranges, FQDNs: &[]ia.FQDN{}}
+			if res.def.Description != "" {
+				ipl.Description = ia.Ptr(res.def.Description)
+			}
+			ipl, a, err := pce.CreateIPList(ipl)
+			utils.LogAPIRespV2("CreateIPList", a)
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+			utils.LogInfof(true, "%s created with %d entries - status code %d", ipl.Name, len(ranges), a.StatusCode)
+			provisionHrefs = append(provisionHrefs, ipl.Href)
+			continue
+		}
+		ipl := res.existing
+		ipl.IPRanges = &ranges
+		if res.def.Description != "" {
+			ipl.Description = ia.Ptr(res.def.Description)
+		}
+		a, err := pce.UpdateIPList(ipl)
+		utils.LogAPIRespV2("UpdateIPList", a)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(true, "%s updated with %d added and %d removed entries - status code %d", ipl.Name, len(res.added), len(res.removed), a.StatusCode)
+		provisionHrefs = append(provisionHrefs, ipl.Href)
+	}
+
+	// Provision
+	if provision {
+		a, err := pce.ProvisionHref(provisionHrefs, "workloader ipl-compose")
+		utils.LogAPIRespV2("ProvisionHrefs", a)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfof(true, "provisioning %d ip lists - status code %d", len(provisionHrefs), a.StatusCode)
+	}
+}
+
+// iplSet returns the addresses in the ip list. exclusions are removed and fqdns are ignored.
+func iplSet(ipl ia.IPList) *utils.IPSet {
+	include, exclude := &utils.IPSet{}, &utils.IPSet{}
+	for _, r := range ia.PtrToVal(ipl.IPRanges) {
+		entry := r.FromIP
+		if r.ToIP != "" {
+			entry = r.FromIP + "-" + r.ToIP
+		}
+		set := include
+		if r.Exclusion {
+			set = exclude
+		}
+		if err := set.Add(entry); err != nil {
+			utils.LogWarningf(true, "%s - %s - skipping", ipl.Name, err)
+		}
+	}
+	return include.Subtract(exclude)
+}
+
+// resolver evaluates terms and definitions and caches the results
+type resolver struct {
+	defs    map[string]*definition
+	pceIPLs map[string]ia.IPList
+	cache   map[string]*utils.IPSet
+	done    map[string]*utils.IPSet
+	stack   []string
+}
+
+func newResolver(defs []*definition, pceIPLs map[string]ia.IPList) *resolver {
+	r := &resolver{defs: make(map[string]*definition), pceIPLs: pceIPLs, cache: make(map[string]*utils.IPSet), done: make(map[string]*utils.IPSet)}
+	for _, d := range defs {
+		r.defs[strings.ToLower(d.Name)] = d
+	}
+	return r
+}
+
+// evalDefinition returns the addresses of a definition. a definition already on the stack is a circular reference.
+func (r *resolver) evalDefinition(d *definition) (*utils.IPSet, error) {
+	key := strings.ToLower(d.Name)
+	if set, ok := r.done[key]; ok {
+		return set, nil
+	}
+	for i, name := range r.stack {
+		if strings.EqualFold(name, d.Name) {
+			return nil, fmt.Errorf("circular reference - %s", strings.Join(append(r.stack[i:], d.Name), " -> "))
+		}
+	}
+	r.stack = append(r.stack, d.Name)
+	set, err := r.eval(d.tree)
+	r.stack = r.stack[:len(r.stack)-1]
+	if err != nil {
+		return nil, fmt.Errorf("%s - %s", d.Name, err)
+	}
+	r.done[key] = set
+	return set, nil
+}
+
+// eval evaluates the expression tree
+func (r *resolver) eval(n *node) (*utils.IPSet, error) {
+	if n.op == "" {
+		return r.term(n.term)
+	}
+	left, err := r.eval(n.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := r.eval(n.right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case opUnion:
+		return left.Union(right), nil
+	case opIntersect:
+		return left.Intersect(right), nil
+	}
+	return left.Subtract(right), nil
+}
+
+// term returns the addresses of a term
+func (r *resolver) term(term string) (*utils.IPSet, error) {
+	lower := strings.ToLower(term)
+
+	// Lists in the file are evaluated so they reflect the latest sources
+	if strings.HasPrefix(lower, "ipl:") {
+		name := term[len("ipl:"):]
+		if d, ok := r.defs[strings.ToLower(name)]; ok {
+			return r.evalDefinition(d)
+		}
+	}
+
+	if set, ok := r.cache[lower]; ok {
+		return set, nil
+	}
+	var set *utils.IPSet
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "ipl:"):
+		ipl, ok := r.pceIPLs[lower[len("ipl:"):]]
+		if !ok {
+			return nil, fmt.Errorf("%s is not an ip list in the pce or the file", term[len("ipl:"):])
+		}
+		if len(ia.PtrToVal(ipl.FQDNs)) > 0 {
+			utils.LogWarningf(true, "%s has fqdns that are ignored", ipl.Name)
+		}
+		set = iplSet(ipl)
+	case strings.HasPrefix(lower, "csv:"):
+		set, err = csvSet(term[len("csv:"):])
+	case strings.HasPrefix(lower, "cloud:"):
+		set, err = cloudSet(term[len("cloud:"):])
+	default:
+		set = &utils.IPSet{}
+		err = set.Add(term)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cache[lower] = set
+	return set, nil
+}
+
+// csvSet returns the addresses in the first column of the csv. entries starting with ! are removed.
+func csvSet(file string) (*utils.IPSet, error) {
+	csvData, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	include, exclude := &utils.IPSet{}, &utils.IPSet{}
+	for i, row := range csvData {
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		entry, set := strings.TrimSpace(row[0]), include
+		if strings.HasPrefix(entry, "!") {
+			entry, set = entry[1:], exclude
+		}
+		if err := set.Add(entry); err != nil {
+			// The first row can be a header
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("%s csv line %d - %s", file, i+1, err)
+		}
+	}
+	return include.Subtract(exclude), nil
+}
+
+// cloudSet returns the published ranges for csp[:region[:service]]
+func cloudSet(spec string) (*utils.IPSet, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	utils.LogInfof(true, "getting %s ranges", spec)
+	cidrs, err := cspiplist.CloudRanges(parts[0], parts[1], parts[2], cspiplist.SourceOptions{IPv6: includeV6})
+	if err != nil {
+		return nil, err
+	}
+	if len(cidrs) == 0 {
+		utils.LogWarningf(true, "no %s ranges match", spec)
+	}
+	set := &utils.IPSet{}
+	if err := set.Add(cidrs...); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
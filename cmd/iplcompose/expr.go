@@ -0,0 +1,155 @@
+package iplcompose
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators
+const (
+	opUnion      = "+"
+	opIntersect  = "&"
+	opDifference = "-"
+)
+
+// node is a term or an operation on two nodes
+type node struct {
+	op          string
+	term        string
+	left, right *node
+}
+
+// tokenize splits the expression into terms, operators, and parentheses.
+// Operators must be surrounded by spaces so ranges (10.0.0.1-10.0.0.9) and names with dashes are one term.
+// Double quotes group characters, including spaces, into one term (e.g., ipl:"Corp Networks").
+func tokenize(expr string) ([]string, error) {
+	tokens := []string{}
+	current := strings.Builder{}
+	inQuotes := false
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+			current.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unclosed quote")
+	}
+	flush()
+	return tokens, nil
+}
+
+// parser is a recursive descent parser. Intersection binds tighter than union and difference, which are evaluated left to right.
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+// parseExpression parses the expression into a tree
+func parseExpression(expr string) (*node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return n, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// parseSum parses terms joined by union or difference
+func (p *parser) parseSum() (*node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == opUnion || p.peek() == opDifference {
+		op := p.tokens[p.pos]
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct parses terms joined by intersection
+func (p *parser) parseProduct() (*node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == opIntersect {
+		p.pos++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: opIntersect, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parsePrimary parses a term or an expression in parentheses
+func (p *parser) parsePrimary() (*node, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("expression ends with an operator")
+	case "(":
+		p.pos++
+		n, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return n, nil
+	case ")", opUnion, opIntersect, opDifference:
+		return nil, fmt.Errorf("unexpected %s", token)
+	}
+	p.pos++
+	return &node{term: token}, nil
+}
+
+// terms returns the terms in the tree
+func (n *node) terms() []string {
+	if n.op == "" {
+		return []string{n.term}
+	}
+	return append(n.left.terms(), n.right.terms()...)
+}
@@ -0,0 +1,179 @@
+package iplcompose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// treeString returns the tree with each operation in parentheses
+func treeString(n *node) string {
+	if n.op == "" {
+		return n.term
+	}
+	return "(" + treeString(n.left) + " " + n.op + " " + treeString(n.right) + ")"
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []string
+		wantErr bool
+	}{
+		{expr: "a + b", want: []string{"a", "+", "b"}},
+		{expr: "(a+b)", want: []string{"(", "a+b", ")"}},
+		{expr: "10.0.0.1-10.0.0.9 - ipl:corp-dmz", want: []string{"10.0.0.1-10.0.0.9", "-", "ipl:corp-dmz"}},
+		{expr: `ipl:"Corp Networks" & (csv:a.csv)`, want: []string{"ipl:Corp Networks", "&", "(", "csv:a.csv", ")"}},
+		{expr: `ipl:"a (b) + c"`, want: []string{"ipl:a (b) + c"}},
+		{expr: "a\t+\nb", want: []string{"a", "+", "b"}},
+		{expr: `ipl:"Corp`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tokenize(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("tokenize(%q) = %q, want an error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tokenize(%q) returned %s", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{expr: "a", want: "a"},
+		{expr: "a + b - c", want: "((a + b) - c)"},
+		{expr: "a - b + c", want: "((a - b) + c)"},
+		{expr: "a + b & c", want: "(a + (b & c))"},
+		{expr: "a & b - c & d", want: "((a & b) - (c & d))"},
+		{expr: "(a + b) & c", want: "((a + b) & c)"},
+		{expr: "a - (b - c)", want: "(a - (b - c))"},
+		{expr: `ipl:"Corp Networks" - 10.0.0.0/8`, want: "(ipl:Corp Networks - 10.0.0.0/8)"},
+		{expr: "", wantErr: "empty expression"},
+		{expr: "a +", wantErr: "expression ends with an operator"},
+		{expr: "+ a", wantErr: "unexpected +"},
+		{expr: "(a + b", wantErr: "missing closing parenthesis"},
+		{expr: "a + b)", wantErr: "unexpected )"},
+		{expr: "a b", wantErr: "unexpected b"},
+		{expr: `"a`, wantErr: "unclosed quote"},
+	}
+	for _, tt := range tests {
+		n, err := parseExpression(tt.expr)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseExpression(%q) error = %v, want %s", tt.expr, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseExpression(%q) returned %s", tt.expr, err)
+			continue
+		}
+		if got := treeString(n); got != tt.want {
+			t.Errorf("parseExpression(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		defs    map[string]string
+		eval    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "precedence",
+			defs: map[string]string{"a": "10.0.0.0/24 + 10.0.1.0/24 & 10.0.1.0/25"},
+			eval: "a",
+			want: []string{"10.0.0.0/24", "10.0.1.0/25"},
+		},
+		{
+			name: "mixed v4 and v6",
+			defs: map[string]string{"a": "10.0.0.0/25 + 2001:db8::/33 + 10.0.0.128/25 + 2001:db8:8000::/33 - 2001:db8:8000::/34"},
+			eval: "a",
+			want: []string{"10.0.0.0/24", "2001:db8::/33", "2001:db8:c000::/34"},
+		},
+		{
+			name: "layered lists with quoted names",
+			defs: map[string]string{"Corp Networks": "10.0.0.0/16 + 10.1.0.0/16", "corp-dmz": "10.1.0.0/16", "internal": `ipl:"Corp Networks" - ipl:CORP-DMZ`},
+			eval: "internal",
+			want: []string{"10.0.0.0/16"},
+		},
+		{
+			name: "pce ip list",
+			defs: map[string]string{"a": "ipl:pce-list & 10.0.0.0/8"},
+			eval: "a",
+			want: []string{"10.2.0.0/16"},
+		},
+		{
+			name:    "unknown ip list",
+			defs:    map[string]string{"a": "ipl:missing"},
+			eval:    "a",
+			wantErr: "a - missing is not an ip list in the pce or the file",
+		},
+		{
+			name:    "self reference",
+			defs:    map[string]string{"a": "10.0.0.0/8 + ipl:a"},
+			eval:    "a",
+			wantErr: "a - circular reference - a -> a",
+		},
+		{
+			name:    "cycle",
+			defs:    map[string]string{"a": "ipl:b", "b": "10.0.0.0/8 - ipl:c", "c": "ipl:A"},
+			eval:    "a",
+			wantErr: "a - b - c - circular reference - a -> b -> c -> a",
+		},
+		{
+			name:    "invalid address",
+			defs:    map[string]string{"a": "10.0.0.0/8 + 10.0.0.300"},
+			eval:    "a",
+			wantErr: "a - invalid ip 10.0.0.300",
+		},
+	}
+	pceIPLs := map[string]ia.IPList{"pce-list": {Name: "pce-list", IPRanges: &[]ia.IPRange{{FromIP: "10.2.0.0/16"}, {FromIP: "192.168.0.0/16"}}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := []*definition{}
+			var eval *definition
+			for name, expr := range tt.defs {
+				d := &definition{Name: name, Expression: expr}
+				var err error
+				if d.tree, err = parseExpression(expr); err != nil {
+					t.Fatal(err)
+				}
+				if strings.EqualFold(name, tt.eval) {
+					eval = d
+				}
+				defs = append(defs, d)
+			}
+			set, err := newResolver(defs, pceIPLs).evalDefinition(eval)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := set.CIDRs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CIDRs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -97,7 +97,8 @@ Recommended to run without --update-pce first to log of what will change. If --u
 	},
 }
 
-func IplReplace(input Input) {
+// IplReplace replaces the entries of the ip list and returns true if the ip list was created or updated in the PCE.
+func IplReplace(input Input) bool {
 
 	// Offset the columns by 1
 	ipCol--
@@ -195,7 +196,7 @@ func IplReplace(input Input) {
 			utils.LogInfo(fmt.Sprintf("workloader identified %d ip entries and %d fqdn entries to replace the existing %d ip entries and %d fqdn entries in %s ip list. to do the replace, run again using --update-pce flag", ipCount, fqdnCount, len(*pceIPL.IPRanges), len(*pceIPL.FQDNs), pceIPL.Name), true)
 		}
 
-		return
+		return false
 	}
 
 	// If updatePCE is set, but not noPrompt, we will prompt the user.
@@ -210,7 +211,7 @@ func IplReplace(input Input) {
 		if strings.ToLower(prompt) != "yes" {
 			utils.LogInfo("prompt denied", true)
 
-			return
+			return false
 		}
 	}
 
@@ -250,4 +251,5 @@ func IplReplace(input Input) {
 		utils.LogInfo(fmt.Sprintf("provisioning - status code %d", a.StatusCode), true)
 	}
 
+	return true
 }
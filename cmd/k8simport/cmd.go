@@ -0,0 +1,328 @@
+package k8simport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/workloader/cmd/cwpexport"
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var mappingFile, cluster, enforcement, visibility, outputFileName string
+
+func init() {
+	K8sImportCmd.Flags().StringVarP(&mappingFile, "mapping", "m", "", "required json file mapping kubernetes labels and annotations to illumio labels. see help for the format.")
+	K8sImportCmd.Flags().StringVarP(&cluster, "cluster", "c", "", "required name of the container cluster in the pce.")
+	K8sImportCmd.Flags().StringVarP(&enforcement, "enforcement", "e", "visibility_only", "enforcement for the container workload profiles. values can be idle, visibility_only, selective, or full.")
+	K8sImportCmd.Flags().StringVarP(&visibility, "visibility", "v", "blocked_allowed", "visibility for the container workload profiles. values can be blocked_allowed, blocked, off, or enhanced_data_collection.")
+	K8sImportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the cwp-import output file. default is current location with a timestamped filename. the other files are the same name with -annotations, -rulesets, -rules, and -iplists appended.")
+
+	K8sImportCmd.MarkFlagRequired("mapping")
+	K8sImportCmd.MarkFlagRequired("cluster")
+	K8sImportCmd.Flags().SortFlags = false
+}
+
+// K8sImportCmd creates cwp-import and rule-import files from kubernetes manifests
+var K8sImportCmd = &cobra.Command{
+	Use:   "k8s-import [manifest files or directories]",
+	Short: "Create cwp-import, ruleset-import, rule-import, and ipl-import files from kubernetes manifests.",
+	Long: `
+Create cwp-import, ruleset-import, rule-import, and ipl-import files from kubernetes manifests.
+
+The manifests are read offline. Files can be yaml (multiple documents are supported) or json, including the output of kubectl get -o json. Directories are searched for .yaml, .yml, and .json files. For helm charts, run helm template first and use the rendered output. Namespace, Deployment, StatefulSet, DaemonSet, ReplicaSet, Job, CronJob, Pod, and NetworkPolicy objects are used.
+
+The mapping file is json that maps illumio label keys to an ordered list of sources. The first source with a value is used. Sources can be label:<kubernetes label>, annotation:<kubernetes annotation>, static:<value>, name, or namespace. The optional values section translates kubernetes values to illumio values for a label key. Example:
+{
+  "namespace_labels": {"env": ["label:environment", "static:dev"], "app": ["label:app.kubernetes.io/part-of", "namespace"]},
+  "workload_labels": {"role": ["label:app.kubernetes.io/component", "name"]},
+  "values": {"env": {"production": "prod"}}
+}
+
+The following files are created:
+- cwp-import file with a profile for each namespace. namespace_labels are assignments. workload_labels keys are restrictions to the values found in the namespace. Profiles are matched on the container cluster and namespace.
+- annotations file with the com.illumio annotations to add to each pod template for the workload_labels.
+- ruleset-import file with a ruleset for each namespace scoped to its namespace labels.
+- rule-import file with rules from the NetworkPolicy objects. Ingress rules use the pod selector as the destination. Pod peers are intra-scope and namespace peers are extra-scope. Egress rules are only created for ipBlock peers. Named ports are resolved with the container ports of the workloads the policy podSelector selects.
+- ipl-import file for the ipBlock peers if there are any.
+
+Import the files in order: ipl-import, cwp-import, ruleset-import, then rule-import. matchExpressions in selectors are not supported and are ignored with a warning.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) == 0 {
+			fmt.Println("Command requires at least 1 argument for the manifest files or directories. See usage help.")
+			os.Exit(0)
+		}
+
+		if enforcement != "idle" && enforcement != "visibility_only" && enforcement != "selective" && enforcement != "full" {
+			utils.LogError("enforcement must be idle, visibility_only, selective, or full.")
+		}
+		if visibility != "blocked_allowed" && visibility != "blocked" && visibility != "off" && visibility != "enhanced_data_collection" {
+			utils.LogError("visibility must be blocked_allowed, blocked, off, or enhanced_data_collection.")
+		}
+
+		k8sImport(args)
+	},
+}
+
+// mapping maps illumio label keys to kubernetes sources
+type mapping struct {
+	NamespaceLabels map[string][]string          `json:"namespace_labels"`
+	WorkloadLabels  map[string][]string          `json:"workload_labels"`
+	Values          map[string]map[string]string `json:"values"`
+}
+
+// namespace is a kubernetes namespace with its illumio labels, workloads, and network policies
+type namespace struct {
+	name      string
+	k8sLabels map[string]string
+	labels    map[string]string
+	workloads []workload
+	policies  []k8sObject
+}
+
+// workload is a kubernetes workload with its illumio labels
+type workload struct {
+	obj    k8sObject
+	labels map[string]string
+}
+
+// generator holds the state for building the import files
+type generator struct {
+	m           mapping
+	namespaces  map[string]*namespace
+	ipLists     map[string]string
+	ipListCount map[string]int
+	ipListRows  [][]string
+}
+
+func k8sImport(paths []string) {
+
+	// Read the mapping
+	var m mapping
+	mappingBytes, err := os.ReadFile(mappingFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if err := json.Unmarshal(mappingBytes, &m); err != nil {
+		utils.LogErrorf("parsing %s - %s", mappingFile, err)
+	}
+	if len(m.NamespaceLabels) == 0 && len(m.WorkloadLabels) == 0 {
+		utils.LogError("mapping file must have namespace_labels or workload_labels")
+	}
+
+	// Parse the manifests
+	files, err := manifestFiles(paths)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	objects, err := parseManifests(files)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("parsed %d files with %d supported objects", len(files), len(objects)), true)
+
+	g := generator{m: m, namespaces: make(map[string]*namespace), ipLists: make(map[string]string), ipListCount: make(map[string]int)}
+	g.load(objects)
+	if len(g.namespaces) == 0 {
+		utils.LogInfo("no namespaces or workloads in the manifests", true)
+		return
+	}
+
+	// Build the cwp-import and annotations files
+	labelKeys := []string{}
+	for _, labelMap := range []map[string][]string{m.NamespaceLabels, m.WorkloadLabels} {
+		for k := range labelMap {
+			if !containsString(labelKeys, k) {
+				labelKeys = append(labelKeys, k)
+			}
+		}
+	}
+	sort.Strings(labelKeys)
+	cwpData := [][]string{append(append([]string{cwpexport.ContainerCluster, cwpexport.Name, cwpexport.Description, cwpexport.Namespace, cwpexport.Enforcement, cwpexport.Visibility, cwpexport.Managed}, labelKeys...), cwpexport.Href)}
+	annotationData := [][]string{{"namespace", "kind", "name", "annotation", "value"}}
+	for _, name := range g.namespaceNames() {
+		ns := g.namespaces[name]
+		row := []string{cluster, ns.name, "created by workloader k8s-import", ns.name, enforcement, visibility, "true"}
+		for _, key := range labelKeys {
+			if ns.labels[key] != "" {
+				row = append(row, ns.labels[key])
+				continue
+			}
+			values := make(map[string]bool)
+			for _, w := range ns.workloads {
+				if w.labels[key] != "" {
+					values[w.labels[key]] = true
+				}
+			}
+			if len(values) == 0 {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, cwpexport.RestrictionPrefix+strings.Join(sortedKeys(values), ";"))
+		}
+		cwpData = append(cwpData, append(row, ""))
+
+		for _, w := range ns.workloads {
+			for _, key := range sortedKeys(keySet(w.labels)) {
+				if w.labels[key] != "" && ns.labels[key] == "" {
+					annotationData = append(annotationData, []string{ns.name, w.obj.kind, w.obj.name, "com.illumio." + key, w.labels[key]})
+				}
+			}
+		}
+	}
+
+	// Build the ruleset and rule files
+	rulesetData := [][]string{{"name", "enabled", "description", "scope"}}
+	ruleData := [][]string{{ruleexport.HeaderRulesetName, ruleexport.HeaderRuleEnabled, ruleexport.HeaderRuleType, ruleexport.HeaderUnscopedConsumers, ruleexport.HeaderSrcAllWorkloads, ruleexport.HeaderSrcLabels, ruleexport.HeaderSrcIplists, ruleexport.HeaderDstAllWorkloads, ruleexport.HeaderDstLabels, ruleexport.HeaderDstIplists, ruleexport.HeaderServices, ruleexport.HeaderSrcResolveLabelsAs, ruleexport.HeaderDstResolveLabelsAs, ruleexport.HeaderRuleDescription}}
+	for _, name := range g.namespaceNames() {
+		ns := g.namespaces[name]
+		scope := labelString(ns.labels)
+		if scope == "" {
+			if len(ns.policies) > 0 {
+				utils.LogWarningf(true, "%s namespace has no mapped namespace labels for a ruleset scope. skipping %d network policies.", ns.name, len(ns.policies))
+			}
+			continue
+		}
+		rulesetName := fmt.Sprintf("k8s-%s-%s", cluster, ns.name)
+		rulesetData = append(rulesetData, []string{rulesetName, "true", fmt.Sprintf("created by workloader k8s-import for the %s namespace", ns.name), scope})
+		for _, policy := range ns.policies {
+			for _, r := range g.policyRules(ns, policy) {
+				ruleData = append(ruleData, []string{rulesetName, "true", "allow", strconv.FormatBool(r.unscoped), strconv.FormatBool(r.srcAll), r.srcLabels, r.srcIPLists, strconv.FormatBool(r.dstAll), r.dstLabels, r.dstIPLists, r.svcs, "workloads", "workloads", r.description})
+			}
+		}
+	}
+
+	// Write the output
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-k8s-import-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	baseName := strings.TrimSuffix(outputFileName, ".csv")
+	utils.WriteOutput(cwpData, nil, outputFileName)
+	utils.LogInfo(fmt.Sprintf("%d container workload profiles exported to %s", len(cwpData)-1, outputFileName), true)
+	if len(annotationData) > 1 {
+		utils.WriteOutput(annotationData, nil, baseName+"-annotations.csv")
+		utils.LogInfo(fmt.Sprintf("%d workload annotations exported to %s", len(annotationData)-1, baseName+"-annotations.csv"), true)
+	}
+	if len(rulesetData) > 1 {
+		utils.WriteOutput(rulesetData, nil, baseName+"-rulesets.csv")
+		utils.LogInfo(fmt.Sprintf("%d rulesets exported to %s", len(rulesetData)-1, baseName+"-rulesets.csv"), true)
+	}
+	if len(ruleData) > 1 {
+		utils.WriteOutput(ruleData, nil, baseName+"-rules.csv")
+		utils.LogInfo(fmt.Sprintf("%d rules exported to %s", len(ruleData)-1, baseName+"-rules.csv"), true)
+	}
+	if len(g.ipListRows) > 0 {
+		utils.WriteOutput(append([][]string{{iplimport.HeaderName, iplimport.HeaderDescription, iplimport.HeaderInclude, iplimport.HeaderExclude}}, g.ipListRows...), nil, baseName+"-iplists.csv")
+		utils.LogInfo(fmt.Sprintf("%d ip lists exported to %s", len(g.ipListRows), baseName+"-iplists.csv"), true)
+	}
+}
+
+// load groups the objects by namespace and resolves the illumio labels
+func (g *generator) load(objects []k8sObject) {
+	getNamespace := func(name string) *namespace {
+		if _, ok := g.namespaces[name]; !ok {
+			g.namespaces[name] = &namespace{name: name, k8sLabels: make(map[string]string)}
+		}
+		return g.namespaces[name]
+	}
+
+	// Namespaces first so the labels are set for the workloads
+	for _, obj := range objects {
+		if obj.kind == "Namespace" {
+			ns := getNamespace(obj.name)
+			ns.k8sLabels = obj.labels
+			ns.labels = g.resolveLabels(g.m.NamespaceLabels, obj.labels, obj.annotations, obj.name, obj.name)
+		}
+	}
+	for _, obj := range objects {
+		switch obj.kind {
+		case "Namespace":
+			continue
+		case "NetworkPolicy":
+			ns := getNamespace(obj.namespace)
+			ns.policies = append(ns.policies, obj)
+		default:
+			ns := getNamespace(obj.namespace)
+			labels := g.resolveLabels(g.m.WorkloadLabels, mergeMaps(obj.labels, obj.podLabels), mergeMaps(obj.annotations, obj.podAnnotations), obj.name, obj.namespace)
+			ns.workloads = append(ns.workloads, workload{obj: obj, labels: labels})
+		}
+	}
+
+	// Namespaces that are only referenced by workloads or policies use the name and namespace sources
+	for _, ns := range g.namespaces {
+		if ns.labels == nil {
+			ns.labels = g.resolveLabels(g.m.NamespaceLabels, nil, nil, ns.name, ns.name)
+		}
+	}
+}
+
+// resolveLabels returns the illumio labels using the first source with a value for each key
+func (g *generator) resolveLabels(sources map[string][]string, labels, annotations map[string]string, name, ns string) map[string]string {
+	resolved := make(map[string]string)
+	for key, keySources := range sources {
+		value := ""
+		for _, s := range keySources {
+			switch {
+			case strings.HasPrefix(s, "label:"):
+				value = labels[strings.TrimPrefix(s, "label:")]
+			case strings.HasPrefix(s, "annotation:"):
+				value = annotations[strings.TrimPrefix(s, "annotation:")]
+			case strings.HasPrefix(s, "static:"):
+				value = strings.TrimPrefix(s, "static:")
+			case s == "name":
+				value = name
+			case s == "namespace":
+				value = ns
+			default:
+				utils.LogWarningf(false, "%s is not a valid mapping source for %s", s, key)
+			}
+			if value != "" {
+				break
+			}
+		}
+		if translated, ok := g.m.Values[key][value]; ok {
+			value = translated
+		}
+		if value != "" {
+			resolved[key] = value
+		}
+	}
+	return resolved
+}
+
+// namespaceNames returns the namespace names sorted
+func (g *generator) namespaceNames() []string {
+	names := []string{}
+	for name := range g.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func keySet(m map[string]string) map[string]bool {
+	set := make(map[string]bool)
+	for k := range m {
+		set[k] = true
+	}
+	return set
+}
+
+func containsString(s []string, value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package k8simport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// k8sObject is a kubernetes namespace, workload, or network policy from the manifests
+type k8sObject struct {
+	kind        string
+	name        string
+	namespace   string
+	labels      map[string]string
+	annotations map[string]string
+	// podLabels and podAnnotations are from the pod template for workload kinds
+	podLabels      map[string]string
+	podAnnotations map[string]string
+	// ports maps container port names to "port protocol" for resolving named ports in network policies
+	ports map[string]string
+	spec  map[string]interface{}
+}
+
+// workloadKinds maps the supported workload kinds to the path of the pod template in the object
+var workloadKinds = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+	"Pod":         {},
+}
+
+// manifestFiles returns the yaml and json files for the provided files and directories
+func manifestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".yaml", ".yml", ".json":
+				if !f.IsDir() {
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseManifests reads all documents in the files. JSON is parsed as YAML. List kinds from kubectl get -o json are expanded.
+func parseManifests(files []string) ([]k8sObject, error) {
+	objects := []k8sObject{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(f)
+		for {
+			doc := make(map[string]interface{})
+			err := decoder.Decode(&doc)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s - %s", file, err)
+			}
+			objects = append(objects, docObjects(doc)...)
+		}
+		f.Close()
+		utils.LogInfo(fmt.Sprintf("parsed %s", file), false)
+	}
+	return objects, nil
+}
+
+// docObjects converts a manifest document into objects, expanding lists and skipping unsupported kinds
+func docObjects(doc map[string]interface{}) []k8sObject {
+	kind := getString(doc, "kind")
+	if strings.HasSuffix(kind, "List") {
+		objects := []k8sObject{}
+		for _, item := range getSlice(doc, "items") {
+			if m, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, docObjects(m)...)
+			}
+		}
+		return objects
+	}
+
+	obj := k8sObject{
+		kind:        kind,
+		name:        getString(doc, "metadata", "name"),
+		namespace:   getString(doc, "metadata", "namespace"),
+		labels:      getStringMap(doc, "metadata", "labels"),
+		annotations: getStringMap(doc, "metadata", "annotations"),
+		spec:        getMap(doc, "spec"),
+	}
+	if obj.namespace == "" && kind != "Namespace" {
+		obj.namespace = "default"
+	}
+
+	switch kind {
+	case "Namespace", "NetworkPolicy":
+		return []k8sObject{obj}
+	}
+	templatePath, ok := workloadKinds[kind]
+	if !ok {
+		if kind != "" {
+			utils.LogInfo(fmt.Sprintf("skipping %s %s - unsupported kind", kind, obj.name), false)
+		}
+		return nil
+	}
+
+	// Pods use their own metadata and spec. Other workloads use the pod template.
+	template := doc
+	if len(templatePath) > 0 {
+		template = getMap(doc, templatePath...)
+	}
+	obj.podLabels = getStringMap(template, "metadata", "labels")
+	obj.podAnnotations = getStringMap(template, "metadata", "annotations")
+	obj.ports = make(map[string]string)
+	for _, c := range getSlice(template, "spec", "containers") {
+		container, _ := c.(map[string]interface{})
+		for _, p := range getSlice(container, "ports") {
+			port, _ := p.(map[string]interface{})
+			if getString(port, "name") == "" {
+				continue
+			}
+			protocol := getString(port, "protocol")
+			if protocol == "" {
+				protocol = "TCP"
+			}
+			obj.ports[getString(port, "name")] = fmt.Sprintf("%s %s", getString(port, "containerPort"), strings.ToLower(protocol))
+		}
+	}
+	return []k8sObject{obj}
+}
+
+// getMap returns the nested map at the path or an empty map
+func getMap(m map[string]interface{}, path ...string) map[string]interface{} {
+	current := m
+	for _, p := range path {
+		next, ok := current[p].(map[string]interface{})
+		if !ok {
+			return make(map[string]interface{})
+		}
+		current = next
+	}
+	return current
+}
+
+// getSlice returns the nested slice at the path or nil
+func getSlice(m map[string]interface{}, path ...string) []interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+	s, _ := getMap(m, path[:len(path)-1]...)[path[len(path)-1]].([]interface{})
+	return s
+}
+
+// getString returns the nested value at the path as a string. Numbers and bools are formatted.
+func getString(m map[string]interface{}, path ...string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return toString(getMap(m, path[:len(path)-1]...)[path[len(path)-1]])
+}
+
+// getStringMap returns the nested map at the path with string values
+func getStringMap(m map[string]interface{}, path ...string) map[string]string {
+	stringMap := make(map[string]string)
+	for k, v := range getMap(m, path...) {
+		stringMap[k] = toString(v)
+	}
+	return stringMap
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case int:
+		return strconv.Itoa(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
@@ -0,0 +1,316 @@
+package k8simport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// anyIPList is the default ip list in the PCE used for peers outside the cluster
+const anyIPList = "Any (0.0.0.0/0 and ::/0)"
+
+// ruleRow is a rule derived from a network policy
+type ruleRow struct {
+	unscoped, srcAll, dstAll                           bool
+	srcLabels, srcIPLists, dstLabels, dstIPLists, svcs string
+	description                                        string
+}
+
+// peer is a consumer or provider of a rule. all is all workloads in the scope or, if unscoped, all workloads.
+type peer struct {
+	all      bool
+	labels   string
+	ipList   string
+	unscoped bool
+}
+
+// policyRules converts a network policy to rules. Ingress rules use the pod selector as the provider.
+// Egress rules are only converted for ip blocks with the pod selector as the consumer.
+func (g *generator) policyRules(ns *namespace, policy k8sObject) []ruleRow {
+	rows := []ruleRow{}
+	podSelector := getMap(policy.spec, "podSelector")
+	targets, ok := g.podPeers(ns, podSelector, policy)
+	if !ok {
+		return rows
+	}
+
+	// Policy types default to ingress and egress if egress rules are present
+	ingress, egress := true, policy.spec["egress"] != nil
+	if types := getSlice(policy.spec, "policyTypes"); len(types) > 0 {
+		ingress, egress = false, false
+		for _, t := range types {
+			switch toString(t) {
+			case "Ingress":
+				ingress = true
+			case "Egress":
+				egress = true
+			}
+		}
+	}
+
+	if ingress {
+		for i, r := range getSlice(policy.spec, "ingress") {
+			rule, _ := r.(map[string]interface{})
+			desc := fmt.Sprintf("k8s networkpolicy %s/%s ingress %d", ns.name, policy.name, i+1)
+			svcs := g.services(ns, podSelector, getSlice(rule, "ports"), desc)
+			if svcs == "" {
+				continue
+			}
+			sources := []peer{}
+			from := getSlice(rule, "from")
+			if len(from) == 0 {
+				sources = append(sources, peer{all: true, ipList: anyIPList, unscoped: true})
+			}
+			for j, f := range from {
+				sources = append(sources, g.policyPeer(ns, policy, f, j+1, desc)...)
+			}
+			for _, src := range sources {
+				for _, dst := range targets {
+					rows = append(rows, ruleRow{unscoped: src.unscoped, srcAll: src.all, srcLabels: src.labels, srcIPLists: src.ipList, dstAll: dst.all, dstLabels: dst.labels, svcs: svcs, description: desc})
+				}
+			}
+		}
+	}
+
+	if egress {
+		for i, r := range getSlice(policy.spec, "egress") {
+			rule, _ := r.(map[string]interface{})
+			desc := fmt.Sprintf("k8s networkpolicy %s/%s egress %d", ns.name, policy.name, i+1)
+			for j, t := range getSlice(rule, "to") {
+				to, _ := t.(map[string]interface{})
+				if _, ok := to["ipBlock"]; !ok {
+					utils.LogWarningf(true, "%s - only ipBlock egress peers are converted. egress to pods in the cluster is covered by the ingress rules of the destination. skipping peer %d.", desc, j+1)
+					continue
+				}
+				svcs := g.services(ns, podSelector, getSlice(rule, "ports"), desc)
+				if svcs == "" {
+					continue
+				}
+				ipList := g.ipList(ns, policy, getMap(to, "ipBlock"))
+				for _, src := range targets {
+					rows = append(rows, ruleRow{srcAll: src.all, srcLabels: src.labels, dstIPLists: ipList, svcs: svcs, description: desc})
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// policyPeer converts a from peer of an ingress rule to consumers
+func (g *generator) policyPeer(ns *namespace, policy k8sObject, f interface{}, n int, desc string) []peer {
+	from, _ := f.(map[string]interface{})
+
+	// IP block
+	if _, ok := from["ipBlock"]; ok {
+		return []peer{{ipList: g.ipList(ns, policy, getMap(from, "ipBlock"))}}
+	}
+
+	// Pods in the same namespace are intra-scope
+	_, hasNS := from["namespaceSelector"]
+	podSelector := getMap(from, "podSelector")
+	if !hasNS {
+		peers, _ := g.podPeers(ns, podSelector, policy)
+		return peers
+	}
+
+	// Pods in other namespaces are extra-scope with the namespace labels
+	nsSelector := getMap(from, "namespaceSelector")
+	if hasExpressions(nsSelector) {
+		utils.LogWarningf(true, "%s - peer %d - namespaceSelector matchExpressions are not supported and are ignored.", desc, n)
+	}
+	if len(getMap(nsSelector, "matchLabels")) == 0 && len(getMap(podSelector, "matchLabels")) == 0 {
+		return []peer{{all: true, unscoped: true}}
+	}
+	peers := []peer{}
+	for _, name := range g.namespaceNames() {
+		peerNS := g.namespaces[name]
+		if !selectorMatch(nsSelector, peerNS.k8sLabels) {
+			continue
+		}
+		nsLabels := labelString(peerNS.labels)
+		if nsLabels == "" {
+			utils.LogWarningf(true, "%s - peer %d - %s namespace has no mapped labels. skipping.", desc, n, peerNS.name)
+			continue
+		}
+		if len(getMap(podSelector, "matchLabels")) == 0 {
+			peers = append(peers, peer{labels: nsLabels, unscoped: true})
+			continue
+		}
+		podPeers, _ := g.podPeers(peerNS, podSelector, policy)
+		for _, p := range podPeers {
+			labels := nsLabels
+			if !p.all {
+				labels = nsLabels + ";" + p.labels
+			}
+			peers = append(peers, peer{labels: labels, unscoped: true})
+		}
+	}
+	if len(peers) == 0 {
+		utils.LogWarningf(true, "%s - peer %d - namespaceSelector does not match any namespace in the manifests. skipping.", desc, n)
+	}
+	return peers
+}
+
+// podPeers returns the workload label sets for the pods matched by the selector in the namespace.
+// If no workloads in the manifests match, the selector labels are mapped directly. ok is false if nothing could be mapped.
+func (g *generator) podPeers(ns *namespace, selector map[string]interface{}, policy k8sObject) (peers []peer, ok bool) {
+	if hasExpressions(selector) {
+		utils.LogWarningf(true, "%s/%s - podSelector matchExpressions are not supported and are ignored.", ns.name, policy.name)
+	}
+	matchLabels := getStringMap(selector, "matchLabels")
+	if len(matchLabels) == 0 {
+		return []peer{{all: true}}, true
+	}
+
+	labelSets := make(map[string]bool)
+	for _, w := range ns.workloads {
+		if !selectorMatch(selector, mergeMaps(w.obj.labels, w.obj.podLabels)) {
+			continue
+		}
+		labels := labelString(w.labels)
+		if labels == "" {
+			utils.LogWarningf(true, "%s/%s - %s %s has no mapped workload labels so the rule applies to all workloads in the scope.", ns.name, policy.name, w.obj.kind, w.obj.name)
+			return []peer{{all: true}}, true
+		}
+		labelSets[labels] = true
+	}
+	if len(labelSets) == 0 {
+		labels := labelString(g.resolveLabels(g.m.WorkloadLabels, matchLabels, nil, "", ns.name))
+		if labels == "" {
+			utils.LogWarningf(true, "%s/%s - podSelector does not match a workload in the manifests and its labels do not map to illumio labels. skipping.", ns.name, policy.name)
+			return nil, false
+		}
+		labelSets[labels] = true
+	}
+	for _, l := range sortedKeys(labelSets) {
+		peers = append(peers, peer{labels: l})
+	}
+	return peers, true
+}
+
+// services converts network policy ports to rule-import services. No ports is all services.
+// Named ports are resolved with the container ports of the workloads the pod selector of the policy selects.
+func (g *generator) services(ns *namespace, podSelector map[string]interface{}, ports []interface{}, desc string) string {
+	if len(ports) == 0 {
+		return "All Services"
+	}
+	svcs := []string{}
+	for _, p := range ports {
+		port, _ := p.(map[string]interface{})
+		protocol := strings.ToLower(getString(port, "protocol"))
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		if protocol != "tcp" && protocol != "udp" {
+			utils.LogWarningf(true, "%s - %s protocol is not supported. skipping port.", desc, protocol)
+			continue
+		}
+		value := getString(port, "port")
+		switch {
+		case value == "":
+			svcs = append(svcs, "1-65535 "+protocol)
+		case getString(port, "endPort") != "":
+			svcs = append(svcs, fmt.Sprintf("%s-%s %s", value, getString(port, "endPort"), protocol))
+		case isNumber(value):
+			svcs = append(svcs, value+" "+protocol)
+		default:
+			// Named port from the container specs of the selected workloads
+			named := make(map[string]bool)
+			for _, w := range ns.workloads {
+				if !selectorMatch(podSelector, mergeMaps(w.obj.labels, w.obj.podLabels)) {
+					continue
+				}
+				if svc, ok := w.obj.ports[value]; ok {
+					named[svc] = true
+				}
+			}
+			if len(named) == 0 {
+				utils.LogWarningf(true, "%s - named port %s is not a container port of a workload the podSelector selects. skipping port.", desc, value)
+				continue
+			}
+			if len(named) > 1 {
+				utils.LogWarningf(true, "%s - named port %s is a different port on the selected workloads (%s). all are used.", desc, value, strings.Join(sortedKeys(named), ", "))
+			}
+			svcs = append(svcs, sortedKeys(named)...)
+		}
+	}
+	if len(svcs) == 0 {
+		utils.LogWarningf(true, "%s - no supported ports. skipping rule.", desc)
+	}
+	return strings.Join(svcs, ";")
+}
+
+// ipList returns the name of the generated ip list for the ip block. Identical ip blocks share an ip list.
+func (g *generator) ipList(ns *namespace, policy k8sObject, ipBlock map[string]interface{}) string {
+	exclude := []string{}
+	for _, e := range getSlice(ipBlock, "except") {
+		exclude = append(exclude, toString(e))
+	}
+	key := getString(ipBlock, "cidr") + "|" + strings.Join(exclude, ";")
+	if name, ok := g.ipLists[key]; ok {
+		return name
+	}
+	g.ipListCount[ns.name+policy.name]++
+	name := fmt.Sprintf("k8s-%s-%s-%d", ns.name, policy.name, g.ipListCount[ns.name+policy.name])
+	g.ipLists[key] = name
+	g.ipListRows = append(g.ipListRows, []string{name, fmt.Sprintf("k8s networkpolicy %s/%s ipBlock", ns.name, policy.name), getString(ipBlock, "cidr"), strings.Join(exclude, ";")})
+	return name
+}
+
+// selectorMatch checks if the labels have all the matchLabels of the selector
+func selectorMatch(selector map[string]interface{}, labels map[string]string) bool {
+	for k, v := range getStringMap(selector, "matchLabels") {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func hasExpressions(selector map[string]interface{}) bool {
+	return len(getSlice(selector, "matchExpressions")) > 0
+}
+
+// labelString returns the labels as sorted key:value pairs separated by semicolons
+func labelString(labels map[string]string) string {
+	pairs := []string{}
+	for k, v := range labels {
+		if v != "" {
+			pairs = append(pairs, k+":"+v)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// mergeMaps returns a new map with the values of the later maps taking precedence
+func mergeMaps(maps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,281 @@
+package labellint
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/wkldexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var pce illumioapi.PCE
+var err error
+var rulesFile, outputFileName string
+var relabel bool
+
+func init() {
+	LabelLintCmd.Flags().StringVarP(&rulesFile, "rules", "r", "", "json file with the label rules. see help for the format.")
+	LabelLintCmd.Flags().BoolVar(&relabel, "relabel", false, "create a wkld-import csv that moves workloads from labels with a merge suggestion to the canonical label.")
+	LabelLintCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. merge and relabel files are the same name with -merges and -relabel appended.")
+	LabelLintCmd.MarkFlagRequired("rules")
+	LabelLintCmd.Flags().SortFlags = false
+}
+
+// LabelLintCmd checks labels and workloads against a naming policy
+var LabelLintCmd = &cobra.Command{
+	Use:   "label-lint",
+	Short: "Check labels and workload labeling against naming rules and suggest merges of near-duplicate labels.",
+	Long: `
+Check labels and workload labeling against naming rules and suggest merges of near-duplicate labels.
+
+The rules file is json. All fields are optional. Example:
+{
+  "case": "lower",
+  "dimensions": {
+    "env": {"allowed": ["prod", "dev", "test"]},
+    "app": {"regex": "^[a-z0-9-]+$"},
+    "loc": {"case": "upper"}
+  },
+  "required": {
+    "managed": ["role", "app", "env", "loc"],
+    "unmanaged": ["env"]
+  },
+  "forbidden": [["env:prod", "loc:lab"]],
+  "merge_distance": 2
+}
+
+  - case: default case policy for all dimensions (lower, upper, title, or any). a dimension can override it.
+  - dimensions: allowed values and/or a regex each label value must match.
+  - required: label keys each managed or unmanaged workload must have.
+  - forbidden: label combinations that cannot be on the same workload.
+  - merge_distance: max edit distance (case-insensitive) to suggest two labels of the same key be merged. default is 2. case variants are distance 0.
+
+Labels using a key that is not a label dimension and label dimensions with no labels are reported as orphaned.
+
+Merge suggestions pick a canonical label for each near-duplicate. The canonical label is the one with no rule violations, then the most workloads. If a label only violates the case policy and there is no near-duplicate, the canonical label is the value in the correct case (wkld-import will create it).
+
+Three files can be created:
+  1. Violations for labels and workloads.
+  2. Merge suggestions.
+  3. With --relabel, a wkld-import csv that moves workloads onto canonical labels. Review it and run wkld-import to apply.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		labelLint()
+	},
+}
+
+// merge is a suggestion to move a label to a canonical value
+type merge struct {
+	label     illumioapi.Label
+	canonical string
+	distance  int
+}
+
+func labelLint() {
+
+	// Parse the rules
+	rules, err := parseRules(rulesFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Load the PCE
+	utils.LogInfo("getting label dimensions, labels, and workloads...", true)
+	apiResps, err := pce.Load(illumioapi.LoadInput{LabelDimensions: true, Labels: true, Workloads: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Count workloads per label
+	wkldCount := make(map[string]int)
+	workloads := []illumioapi.Workload{}
+	for _, w := range pce.WorkloadsSlice {
+		if illumioapi.PtrToVal(w.Deleted) {
+			continue
+		}
+		workloads = append(workloads, w)
+		for _, l := range illumioapi.PtrToVal(w.Labels) {
+			wkldCount[l.Href]++
+		}
+	}
+
+	// Start the violations
+	violations := [][]string{{"object_type", "key", "value", "hostname", "name", "href", "violation"}}
+
+	// Orphaned dimensions
+	dimensions := make(map[string]bool)
+	for _, ld := range pce.LabelDimensionsSlice {
+		dimensions[ld.Key] = true
+	}
+	labelsByKey := make(map[string][]illumioapi.Label)
+	for _, l := range pce.LabelsSlice {
+		labelsByKey[l.Key] = append(labelsByKey[l.Key], l)
+	}
+	for _, ld := range pce.LabelDimensionsSlice {
+		if len(labelsByKey[ld.Key]) == 0 {
+			violations = append(violations, []string{"label_dimension", ld.Key, "", "", "", ld.Href, "orphaned - no labels use this dimension"})
+		}
+	}
+	for key := range rules.Dimensions {
+		if len(dimensions) > 0 && !dimensions[key] {
+			violations = append(violations, []string{"rules_file", key, "", "", "", "", "dimension in rules file does not exist in pce"})
+		}
+	}
+
+	// Label violations
+	labelHasViolation := make(map[string]bool)
+	for _, l := range pce.LabelsSlice {
+		if len(dimensions) > 0 && !dimensions[l.Key] {
+			violations = append(violations, []string{"label", l.Key, l.Value, "", "", l.Href, "orphaned - key is not a label dimension"})
+		}
+		for _, v := range rules.labelViolations(l.Key, l.Value) {
+			violations = append(violations, []string{"label", l.Key, l.Value, "", "", l.Href, v})
+			labelHasViolation[l.Href] = true
+		}
+	}
+
+	// Workload violations
+	for _, w := range workloads {
+		wkldType := "unmanaged"
+		if (w.Agent != nil && w.Agent.Href != "") || (w.VEN != nil && w.VEN.Href != "") {
+			wkldType = "managed"
+		}
+		hostname, name := illumioapi.PtrToVal(w.Hostname), illumioapi.PtrToVal(w.Name)
+		for _, key := range rules.Required[wkldType] {
+			if w.GetLabelByKey(key, pce.Labels).Value == "" {
+				violations = append(violations, []string{wkldType + "_workload", key, "", hostname, name, w.Href, fmt.Sprintf("missing required %s label", key)})
+			}
+		}
+		for _, combo := range rules.Forbidden {
+			matches := 0
+			for _, kv := range combo {
+				x := strings.SplitN(kv, ":", 2)
+				if w.GetLabelByKey(x[0], pce.Labels).Value == x[1] {
+					matches++
+				}
+			}
+			if matches == len(combo) {
+				violations = append(violations, []string{wkldType + "_workload", "", "", hostname, name, w.Href, fmt.Sprintf("forbidden label combination %s", strings.Join(combo, ";"))})
+			}
+		}
+	}
+
+	// Merge suggestions
+	merges := make(map[string]merge)
+	for key, labels := range labelsByKey {
+		for _, l := range labels {
+			best := l
+			bestDistance := 0
+			for _, candidate := range labels {
+				if candidate.Href == l.Href {
+					continue
+				}
+				distance := editDistance(strings.ToLower(l.Value), strings.ToLower(candidate.Value))
+				if distance > *rules.MergeDistance || !preferred(candidate, best, labelHasViolation, wkldCount) {
+					continue
+				}
+				best = candidate
+				bestDistance = distance
+			}
+			if best.Href != l.Href {
+				merges[l.Href] = merge{label: l, canonical: best.Value, distance: bestDistance}
+				continue
+			}
+			if c := rules.caseOf(key); c != "" && c != "any" && applyCase(l.Value, c) != l.Value {
+				merges[l.Href] = merge{label: l, canonical: applyCase(l.Value, c)}
+			}
+		}
+	}
+
+	// Output the files
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-label-lint-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	baseName := strings.TrimSuffix(outputFileName, ".csv")
+	if len(violations) > 1 {
+		utils.WriteOutput(violations, nil, outputFileName)
+		utils.LogInfo(fmt.Sprintf("%d violations exported", len(violations)-1), true)
+	} else {
+		utils.LogInfo("no violations found", true)
+	}
+
+	mergeHrefs := []string{}
+	for href := range merges {
+		mergeHrefs = append(mergeHrefs, href)
+	}
+	sort.Slice(mergeHrefs, func(i, j int) bool {
+		a, b := merges[mergeHrefs[i]].label, merges[mergeHrefs[j]].label
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Value < b.Value
+	})
+	mergeData := [][]string{{"key", "value", "href", "canonical_value", "canonical_exists", "distance", "workloads"}}
+	for _, href := range mergeHrefs {
+		m := merges[href]
+		_, exists := pce.Labels[m.label.Key+m.canonical]
+		mergeData = append(mergeData, []string{m.label.Key, m.label.Value, href, m.canonical, strconv.FormatBool(exists), strconv.Itoa(m.distance), strconv.Itoa(wkldCount[href])})
+	}
+	if len(mergeData) > 1 {
+		utils.WriteOutput(mergeData, nil, baseName+"-merges.csv")
+		utils.LogInfo(fmt.Sprintf("%d merge suggestions exported", len(mergeData)-1), true)
+	} else {
+		utils.LogInfo("no merge suggestions", true)
+	}
+
+	if !relabel {
+		return
+	}
+
+	// Build the wkld-import file. Blank cells leave the current label in place.
+	keys := []string{}
+	for _, ld := range pce.LabelDimensionsSlice {
+		keys = append(keys, ld.Key)
+	}
+	relabelData := [][]string{append([]string{wkldexport.HeaderHref, wkldexport.HeaderHostname}, keys...)}
+	for _, w := range workloads {
+		row := []string{w.Href, illumioapi.PtrToVal(w.Hostname)}
+		changed := false
+		for _, key := range keys {
+			value := ""
+			if m, ok := merges[w.GetLabelByKey(key, pce.Labels).Href]; ok {
+				value = m.canonical
+				changed = true
+			}
+			row = append(row, value)
+		}
+		if changed {
+			relabelData = append(relabelData, row)
+		}
+	}
+	if len(relabelData) > 1 {
+		utils.WriteOutput(relabelData, nil, baseName+"-relabel.csv")
+		utils.LogInfo(fmt.Sprintf("%d workloads in relabel file. review and run wkld-import to apply.", len(relabelData)-1), true)
+	} else {
+		utils.LogInfo("no workloads need to be relabeled", true)
+	}
+}
+
+// preferred returns true if label a should be canonical over label b
+func preferred(a, b illumioapi.Label, hasViolation map[string]bool, wkldCount map[string]int) bool {
+	if hasViolation[a.Href] != hasViolation[b.Href] {
+		return !hasViolation[a.Href]
+	}
+	if wkldCount[a.Href] != wkldCount[b.Href] {
+		return wkldCount[a.Href] > wkldCount[b.Href]
+	}
+	return a.Value < b.Value
+}
@@ -0,0 +1,169 @@
+package labellint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rules is the label-lint rules file
+type Rules struct {
+	// Case is the default case policy for all dimensions: lower, upper, title, or any.
+	Case       string                   `json:"case"`
+	Dimensions map[string]DimensionRule `json:"dimensions"`
+	// Required is the list of required label keys by workload type (managed or unmanaged).
+	Required map[string][]string `json:"required"`
+	// Forbidden is a list of label combinations in key:value format that cannot be on the same workload.
+	Forbidden [][]string `json:"forbidden"`
+	// MergeDistance is the maximum edit distance to suggest merging two labels. Default is 2.
+	MergeDistance *int `json:"merge_distance"`
+}
+
+// DimensionRule is the policy for a label dimension
+type DimensionRule struct {
+	Allowed []string `json:"allowed"`
+	Regex   string   `json:"regex"`
+	Case    string   `json:"case"`
+	regex   *regexp.Regexp
+}
+
+// parseRules reads and validates the rules file
+func parseRules(filename string) (Rules, error) {
+	var rules Rules
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("parsing %s - %s", filename, err)
+	}
+	if err := validCase(rules.Case); err != nil {
+		return rules, err
+	}
+	for key, d := range rules.Dimensions {
+		if err := validCase(d.Case); err != nil {
+			return rules, fmt.Errorf("%s - %s", key, err)
+		}
+		if d.Regex != "" {
+			d.regex, err = regexp.Compile(d.Regex)
+			if err != nil {
+				return rules, fmt.Errorf("%s regex - %s", key, err)
+			}
+		}
+		rules.Dimensions[key] = d
+	}
+	for wkldType := range rules.Required {
+		if wkldType != "managed" && wkldType != "unmanaged" {
+			return rules, fmt.Errorf("required workload type %s is not valid. must be managed or unmanaged", wkldType)
+		}
+	}
+	for _, combo := range rules.Forbidden {
+		for _, kv := range combo {
+			if !strings.Contains(kv, ":") {
+				return rules, fmt.Errorf("forbidden entry %s must be in key:value format", kv)
+			}
+		}
+	}
+	if rules.MergeDistance == nil {
+		distance := 2
+		rules.MergeDistance = &distance
+	}
+	return rules, nil
+}
+
+// validCase checks the case policy
+func validCase(c string) error {
+	switch strings.ToLower(c) {
+	case "", "any", "lower", "upper", "title":
+		return nil
+	}
+	return fmt.Errorf("case %s is not valid. must be lower, upper, title, or any", c)
+}
+
+// caseOf returns the case policy for a key
+func (r Rules) caseOf(key string) string {
+	if d, ok := r.Dimensions[key]; ok && d.Case != "" {
+		return strings.ToLower(d.Case)
+	}
+	return strings.ToLower(r.Case)
+}
+
+// applyCase returns the value in the provided case
+func applyCase(value, c string) string {
+	switch c {
+	case "lower":
+		return strings.ToLower(value)
+	case "upper":
+		return strings.ToUpper(value)
+	case "title":
+		words := strings.Fields(strings.ToLower(value))
+		for i, w := range words {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+		return strings.Join(words, " ")
+	}
+	return value
+}
+
+// labelViolations returns the rule violations for a label value
+func (r Rules) labelViolations(key, value string) []string {
+	violations := []string{}
+	if c := r.caseOf(key); c != "" && c != "any" && applyCase(value, c) != value {
+		violations = append(violations, fmt.Sprintf("not %s case", c))
+	}
+	d, ok := r.Dimensions[key]
+	if !ok {
+		return violations
+	}
+	if len(d.Allowed) > 0 {
+		allowed := false
+		for _, a := range d.Allowed {
+			if a == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, "not an allowed value")
+		}
+	}
+	if d.regex != nil && !d.regex.MatchString(value) {
+		violations = append(violations, fmt.Sprintf("does not match regex %s", d.Regex))
+	}
+	return violations
+}
+
+// editDistance returns the levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+// min returns the smallest value
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -10,12 +10,13 @@ import (
 	"time"
 
 	"github.com/brian1917/illumioapi"
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var appFlag, exclWkldFile, exclPortFile, exclAppFile, outputFileName string
+var appFlag, exclWkldFile, exclPortFile, exclAppFile, fromStore, outputFileName string
 var debug, ignoreLoc, inclUnmanagedAppGroups bool
 var pce illumioapi.PCE
 var err error
@@ -27,6 +28,7 @@ func init() {
 	MisLabelCmd.Flags().StringVarP(&exclAppFile, "aExclude", "x", "", "File location of app labels to exclude as orphans.")
 	MisLabelCmd.Flags().StringVarP(&exclPortFile, "pExclude", "p", "", "File location of ports to exclude in traffic query.")
 	MisLabelCmd.Flags().BoolVar(&ignoreLoc, "ignore-location", false, "Do not use location in comparing app groups.")
+	MisLabelCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory.")
 	MisLabelCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	MisLabelCmd.Flags().SortFlags = false
@@ -44,6 +46,8 @@ Workloads will not be identified as orphans if they are part of an app group wit
 The default Explorer query will look at all data. Explorer API has a max of 100,000 records. If you're query will exceed this, use the app flag to work through application labels. The app flag will get all traffic where that app is the source or destination.
 	
 The explorer query will ignore traffic on UDP ports 5355 (DNSCache) and 137, 138, 139 (NETBIOS). To customize this list, use the --pExclude (-p) flag to pass in a CSV with no headers and two columns. First column is port number and second column is protocol number (TCP is 6 and UDP is 17). If using the CSV option, UDP 5355, 137, 138, and 139 are not exlucded by default; you must add them to the list.
+
+Use --from-store to query a local traffic store populated by traffic-sync instead of explorer. The store does not have the explorer max results.
 	
 The --update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -151,26 +155,14 @@ func misLabel() {
 	}
 
 	// Get traffic
-	traffic, apiResp, err := pce.GetTrafficAnalysis(tq)
-	if debug {
-		utils.LogAPIResp("GetTrafficAnalysis", apiResp)
-	}
-	if err != nil {
-		utils.LogError(fmt.Sprintf("error making traffic api call - %s", err))
-	}
+	traffic := getTraffic(tq)
 
 	// If app flag is set, edit tq stuct, run again and append.
 	// We will have duplicate entries here, but it won't matter with logic.
 	if appFlag != "" {
 		tq.DestinationsInclude = tq.SourcesInclude
 		tq.SourcesInclude = [][]string{}
-		traffic2, apiResp, err := pce.GetTrafficAnalysis(tq)
-		if debug {
-			utils.LogAPIResp("GetTrafficAnalysis", apiResp)
-		}
-		if err != nil {
-			utils.LogError(fmt.Sprintf("error making traffic api call - %s", err))
-		}
+		traffic2 := getTraffic(tq)
 		traffic = append(traffic, traffic2...)
 	}
 
@@ -306,3 +298,22 @@ func appGroupManagedCounter(allWklds []illumioapi.Workload) map[string]int {
 	return managedWkldCounter
 
 }
+
+// getTraffic runs the query against the traffic store if provided or explorer
+func getTraffic(tq illumioapi.TrafficQuery) []illumioapi.TrafficAnalysis {
+	if fromStore != "" {
+		traffic, err := trafficsync.QueryV1(fromStore, tq)
+		if err != nil {
+			utils.LogError(fmt.Sprintf("error querying traffic store - %s", err))
+		}
+		return traffic
+	}
+	traffic, apiResp, err := pce.GetTrafficAnalysis(tq)
+	if debug {
+		utils.LogAPIResp("GetTrafficAnalysis", apiResp)
+	}
+	if err != nil {
+		utils.LogError(fmt.Sprintf("error making traffic api call - %s", err))
+	}
+	return traffic
+}
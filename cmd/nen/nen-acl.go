@@ -3,12 +3,12 @@ package nen
 import (
 	"fmt"
 	"hash/crc64"
-	"html/template"
 	"net"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/brian1917/illumioapi/v2"
@@ -18,21 +18,24 @@ import (
 
 var err error
 var pce illumioapi.PCE
-var templateFile string
+var templateFile, templateName string
 var networkDeviceName, outFile string
 var days, timeout int
+var listTemplates bool
 
 func init() {
 	NENACLCmd.Flags().IntVarP(&days, "days", "d", 7, "How old can the switch ACL be before rebuilding( use =0 to rebuild)?")
 	NENACLCmd.Flags().IntVarP(&timeout, "timeout", "t", 10, "How many minutes to wait for ACL to be built before timeout and exit?")
 	NENACLCmd.Flags().StringVarP(&outFile, "output-file", "o", "", "Enter the output file for the template processing.")
 	NENACLCmd.Flags().StringVarP(&networkDeviceName, "name", "n", "", "Name of the NEN switch device you want to create an ACL file for")
+	NENACLCmd.Flags().StringVarP(&templateName, "template", "T", "", "Name of a built-in template to use instead of a template file. See --list-templates for options.")
+	NENACLCmd.Flags().BoolVar(&listTemplates, "list-templates", false, "List the built-in templates and exit.")
 }
 
 // NenCmd builds a file with ACL information
 var NENACLCmd = &cobra.Command{
 	Use:   "nen-acl",
-	Short: "Create NEN ACL file.  Requires a golang template file.",
+	Short: "Create NEN ACL file.  Requires a golang template file or a built-in template.",
 	Long: `
 Create output file for different types of enforcement network equipment using devices native syntax.  Requires a template files using Golang templating language
 
@@ -40,12 +43,37 @@ Requires the name of the Switch configured on the NEN using --name or -n <switch
 Can select a smaller time frame or use -d or --days 0 to re-create a new ACL. Will build the ACL based on the template file included as an argument.  
 Additionally, you can send the output to stdout or to a file using --output-file or -o <filename>.
 
+Instead of a template file you can use a built-in template with --template or -T <name>:
+cisco-ios       Cisco IOS extended ACLs with network object-groups.
+cisco-nxos      Cisco NX-OS ACLs with address object-groups.
+arista-eos      Arista EOS ACLs (no object-groups so each IP is expanded).
+juniper-junos   Juniper Junos firewall filters with prefix-lists.
+nftables        Linux nftables table with named sets (separate IPv4 and IPv6 sets and rules).
+Each built-in template creates an "IN" ACL applied inbound on the switch interface (traffic from the workload) and an "OUT" ACL 
+applied outbound (traffic to the workload). Both end with a deny. Rules with no IPs match any address. Use --list-templates to list them.
+IPv4 and IPv6 addresses are never mixed. IPv6 addresses go in separate object-groups, prefix-lists, or sets and in separate "-V6" ACLs
+or inet6 filters that are only created for workloads with IPv6 addresses. icmp rules are IPv4 only.
+
+Templates are processed with text/template so output is not HTML escaped (e.g., "<" and "&" are written as is). 
+Template files written for earlier versions that relied on HTML escaping need to be updated.
+
 Golang template has been extended to include some basic functions like:
 {{ add <value A> <value B>}} so you can create incrementing values.  
 included in the ip value.  The mask can be traditional notation of 255.255.255.0 = /24 or you can invert 0.255.255.255 by setting inv = true.  {{mask "10.0.0.0/8" true}}.  
 {{mask <ip with mask> boolean}} To calulate the mask of the IP address.  setting boolean to true inverses the mask.
 {{ipclean string}} To remove the prefix from the IP address. 
 {{splitrange string boolean}} To split a range of IPs and return the first or second value. 
+{{portmatch <protocol> <port>}} To convert a port to " eq 80" or a port range to " range 80 90". icmp returns the icmp type.
+{{hasport <protocol> <port>}} To check if a rule is limited to a port or icmp type.
+{{aclproto <protocol>}} To return "ip" for any protocol. {{ip6proto <protocol>}} returns "ipv6" for IPv6 ACLs.
+{{cidrs <ip>}} To convert an IP, CIDR, or IP range to a list of CIDRs. {{cidrlist <list>}} does the same for a list.
+{{ipv4list <list>}} and {{ipv6list <list>}} To return only the IPv4 or IPv6 entries of a list of CIDRs.
+{{ciscoaddr <cidr> boolean}} To return "host x.x.x.x" or the network and mask. setting boolean to true inverses the mask.
+{{hostprefix <cidr>}} To return "host x.x.x.x" or the CIDR.
+{{groupname <prefix> <hash>}} To create an object-group name from the hash of an IP list.
+{{aclname <prefix> <interface> <direction>}} To create an ACL name with characters switches do not allow replaced.
+{{counter <start> <step>}} To create a line number counter. {{$seq := counter 10 10}} then {{$seq.Next}} returns 10, 20, 30...
+{{join <list> <separator>}} To join a list into a single string.
 
 The Nen Switch configuration and policy data structure is what the template uses to create the output.  
 
@@ -81,18 +109,29 @@ type SwitchACLData struct {        //array of ACLs for switch configured on NEN
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
+		// List the built-in templates
+		if listTemplates {
+			fmt.Println(strings.Join(templateNames(), "\n"))
+			return
+		}
+
 		// Get the PCE
 		pce, err = utils.GetTargetPCEV2(true)
 		if err != nil {
 			utils.LogError(err.Error())
 		}
 
-		// Set the CSV file
-		if len(args) != 1 {
-			fmt.Println("Command requires 1 argument for the golang template file. See usage help.")
+		// Set the template file or built-in template
+		if (len(args) != 1 && templateName == "") || (len(args) == 1 && templateName != "") {
+			fmt.Println("Command requires 1 argument for the golang template file or the --template flag. See usage help.")
 			os.Exit(0)
 		}
-		templateFile = args[0]
+		if len(args) == 1 {
+			templateFile = args[0]
+		}
+		if _, err := parseTemplate(); err != nil {
+			utils.LogError(err.Error())
+		}
 
 		// Get the services
 		pce.Load(illumioapi.LoadInput{Workloads: true, NetworkEnforcementNode: true}, utils.UseMulti())
@@ -334,10 +373,38 @@ func SetFuncMap() template.FuncMap {
 			}
 
 		},
+		"portmatch":  PortMatch,
+		"hasport":    HasPort,
+		"aclproto":   ACLProto,
+		"ip6proto":   ACLProto6,
+		"cidrs":      CIDRs,
+		"cidrlist":   CIDRList,
+		"ipv4list":   IPv4List,
+		"ipv6list":   IPv6List,
+		"ciscoaddr":  CiscoAddr,
+		"hostprefix": HostPrefix,
+		"groupname":  GroupName,
+		"aclname":    ACLName,
+		"join":       strings.Join,
+		"counter": func(start, step int) *Counter {
+			return &Counter{value: start, step: step}
+		},
 	}
 	return funcMap
 }
 
+// parseTemplate - Parses the template file or the built-in template with the functions from SetFuncMap()
+func parseTemplate() (*template.Template, error) {
+	if templateName != "" {
+		name, data, err := builtInTemplate(templateName)
+		if err != nil {
+			return nil, err
+		}
+		return template.New(name).Funcs(SetFuncMap()).Parse(data)
+	}
+	return template.New(filepath.Base(templateFile)).Funcs(SetFuncMap()).ParseFiles(templateFile)
+}
+
 // TranslateSwitchPolicy - Takes a PCE created policy and translates that to a specific format that the users specifies
 func TranslateSwitchPolicy() {
 
@@ -369,7 +436,7 @@ func TranslateSwitchPolicy() {
 
 				//Found I needed just the base filename for part of the Template parsing command
 				//Parse template file and load template functions from SetFuncMap() to build the output
-				tmpl, err := template.New(filepath.Base(templateFile)).Funcs(SetFuncMap()).ParseFiles(templateFile)
+				tmpl, err := parseTemplate()
 				if err != nil {
 					utils.LogError(err.Error())
 				}
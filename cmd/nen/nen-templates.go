@@ -0,0 +1,203 @@
+package nen
+
+import (
+	"embed"
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// builtInTemplates are the ACL templates shipped with workloader. Select one with --template <name>.
+//
+//go:embed templates/*.tmpl
+var builtInTemplates embed.FS
+
+// templateNames - Returns the names of the built-in templates (file name without the .tmpl extension).
+func templateNames() []string {
+	entries, _ := builtInTemplates.ReadDir("templates")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tmpl"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtInTemplate - Returns the file name and contents of a built-in template.
+func builtInTemplate(name string) (string, string, error) {
+	fileName := path.Join("templates", name+".tmpl")
+	data, err := builtInTemplates.ReadFile(fileName)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not a built-in template. options are %s", name, strings.Join(templateNames(), ", "))
+	}
+	return path.Base(fileName), string(data), nil
+}
+
+// Counter is used in templates to number ACL lines. {{$seq := counter 10 10}} then {{$seq.Next}} returns 10, 20, 30...
+type Counter struct {
+	value int
+	step  int
+}
+
+// Next - Returns the current value and increments the counter.
+func (c *Counter) Next() int {
+	current := c.value
+	c.value = c.value + c.step
+	return current
+}
+
+// PortMatch - Returns the port portion of an ACL line with a leading space. tcp and udp single ports become "eq 80"
+// and port ranges become "range 80 90". icmp returns the icmp type. Any port or protocol returns an empty string.
+func PortMatch(proto, port string) string {
+	if port == "" || port == "*" {
+		return ""
+	}
+	switch proto {
+	case "tcp", "udp":
+		if strings.Contains(port, "-") {
+			ports := strings.Split(port, "-")
+			return fmt.Sprintf(" range %s %s", ports[0], ports[1])
+		}
+		return " eq " + port
+	case "icmp":
+		return " " + port
+	}
+	return ""
+}
+
+// HasPort - Returns true if the rule is limited to a tcp or udp port or an icmp type.
+func HasPort(proto, port string) bool {
+	return PortMatch(proto, port) != ""
+}
+
+// ACLProto - Returns the protocol keyword for Cisco and Arista style ACLs where any protocol is "ip".
+func ACLProto(proto string) string {
+	if proto == "any" || proto == "" {
+		return "ip"
+	}
+	return proto
+}
+
+// ACLProto6 - Returns the protocol keyword for Cisco and Arista style IPv6 ACLs where any protocol is "ipv6".
+func ACLProto6(proto string) string {
+	if proto == "any" || proto == "" {
+		return "ipv6"
+	}
+	return proto
+}
+
+// ACLName - Builds an ACL or filter name from a prefix, the interface name, and a direction. Characters switches
+// do not allow in names are replaced with underscores.
+func ACLName(prefix, intfName, direction string) string {
+	replacer := strings.NewReplacer("/", "_", " ", "_", ":", "_", ".", "_")
+	return fmt.Sprintf("%s-%s-%s", prefix, replacer.Replace(intfName), direction)
+}
+
+// GroupName - Builds an object-group, prefix-list, or set name from the hash of the IP list.
+func GroupName(prefix string, hash uint64) string {
+	return fmt.Sprintf("%s_%X", prefix, hash)
+}
+
+// rangeToPrefixes - Returns the smallest set of prefixes that covers the range from start to end.
+func rangeToPrefixes(start, end netip.Addr) []string {
+	var prefixes []string
+	for start.IsValid() && start.Compare(end) <= 0 {
+		bits := start.BitLen()
+		for bits > 0 {
+			candidate := netip.PrefixFrom(start, bits-1)
+			if candidate.Masked().Addr() != start || utils.LastAddr(candidate).Compare(end) > 0 {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix.String())
+		start = utils.LastAddr(prefix).Next()
+	}
+	return prefixes
+}
+
+// CIDRs - Converts an IP address, CIDR, or IP range (10.0.0.1-10.0.0.10) into a list of CIDRs. Single IPs are
+// returned with a /32 or /128. Values that cannot be parsed are returned unchanged.
+func CIDRs(ip string) []string {
+	ip = strings.TrimSpace(ip)
+	if strings.Contains(ip, "-") {
+		bounds := strings.Split(ip, "-")
+		start, startErr := netip.ParseAddr(strings.TrimSpace(bounds[0]))
+		end, endErr := netip.ParseAddr(strings.TrimSpace(bounds[1]))
+		if startErr != nil || endErr != nil || start.BitLen() != end.BitLen() || start.Compare(end) > 0 {
+			return []string{ip}
+		}
+		return rangeToPrefixes(start, end)
+	}
+	if prefix, err := netip.ParsePrefix(ip); err == nil {
+		return []string{prefix.Masked().String()}
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return []string{netip.PrefixFrom(addr, addr.BitLen()).String()}
+	}
+	return []string{ip}
+}
+
+// CIDRList - Runs CIDRs on each entry of a list and returns the combined list.
+func CIDRList(ips []string) []string {
+	var cidrs []string
+	for _, ip := range ips {
+		cidrs = append(cidrs, CIDRs(ip)...)
+	}
+	return cidrs
+}
+
+// IPv4List - Returns the IPv4 entries of a list of CIDRs.
+func IPv4List(cidrs []string) []string {
+	var v4 []string
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, ":") {
+			v4 = append(v4, cidr)
+		}
+	}
+	return v4
+}
+
+// IPv6List - Returns the IPv6 entries of a list of CIDRs.
+func IPv6List(cidrs []string) []string {
+	var v6 []string
+	for _, cidr := range cidrs {
+		if strings.Contains(cidr, ":") {
+			v6 = append(v6, cidr)
+		}
+	}
+	return v6
+}
+
+// CiscoAddr - Returns a CIDR in Cisco IOS notation. Host addresses become "host 10.0.0.1". Networks become
+// "10.0.0.0 0.0.0.255" when inv is true (wildcard for ACL entries) or "10.0.0.0 255.255.255.0" for object-groups.
+func CiscoAddr(cidr string, inv bool) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	if prefix.Bits() == prefix.Addr().BitLen() {
+		return "host " + prefix.Addr().String()
+	}
+	if !prefix.Addr().Is4() {
+		return prefix.String()
+	}
+	return fmt.Sprintf("%s %s", prefix.Addr().String(), GetMask(prefix.String(), inv))
+}
+
+// HostPrefix - Returns a CIDR in NX-OS and Arista notation. Host addresses become "host 10.0.0.1" and networks stay as CIDRs.
+func HostPrefix(cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	if prefix.Bits() == prefix.Addr().BitLen() {
+		return "host " + prefix.Addr().String()
+	}
+	return prefix.String()
+}
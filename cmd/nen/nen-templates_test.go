@@ -0,0 +1,142 @@
+package nen
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestBuiltInTemplates renders each built-in template with testdata/switch.json and compares it to testdata/<template>.golden.
+// testdata/mixed.json has workloads and rules with only one address family and is compared to testdata/<template>.mixed.golden.
+// Run go test ./cmd/nen -update to rewrite the golden files after changing a template.
+func TestBuiltInTemplates(t *testing.T) {
+	for input, suffix := range map[string]string{"switch.json": ".golden", "mixed.json": ".mixed.golden"} {
+		testBuiltInTemplates(t, input, suffix)
+	}
+}
+
+func testBuiltInTemplates(t *testing.T, input, suffix string) {
+	b, err := os.ReadFile(filepath.Join("testdata", input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data SwitchACLData
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range templateNames() {
+		t.Run(name+suffix, func(t *testing.T) {
+			templateName = name
+			defer func() { templateName = "" }()
+			tmpl, err := parseTemplate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := tmpl.Execute(&got, data); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+suffix)
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", golden, got.String(), want)
+			}
+		})
+	}
+}
+
+func TestCIDRList(t *testing.T) {
+	tests := []struct {
+		name string
+		ips  []string
+		want []string
+	}{
+		{"host v4", []string{"10.0.0.1"}, []string{"10.0.0.1/32"}},
+		{"host v6", []string{"2001:db8::1"}, []string{"2001:db8::1/128"}},
+		{"unmasked cidr", []string{"10.0.0.5/24"}, []string{"10.0.0.0/24"}},
+		{"aligned range", []string{"10.0.0.0-10.0.0.255"}, []string{"10.0.0.0/24"}},
+		{"unaligned range", []string{"10.0.0.5-10.0.0.9"}, []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/31"}},
+		{"v6 range", []string{"2001:db8::-2001:db8::3"}, []string{"2001:db8::/126"}},
+		{"mixed list", []string{"10.0.0.1", "2001:db8::/64"}, []string{"10.0.0.1/32", "2001:db8::/64"}},
+		{"mixed family range", []string{"10.0.0.1-2001:db8::1"}, []string{"10.0.0.1-2001:db8::1"}},
+		{"reversed range", []string{"10.0.0.9-10.0.0.1"}, []string{"10.0.0.9-10.0.0.1"}},
+		{"not an ip", []string{"bad"}, []string{"bad"}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CIDRList(tt.ips); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CIDRList(%v) = %v, want %v", tt.ips, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortMatch(t *testing.T) {
+	tests := []struct {
+		proto, port, want string
+	}{
+		{"tcp", "443", " eq 443"},
+		{"udp", "8000-8010", " range 8000 8010"},
+		{"icmp", "8", " 8"},
+		{"icmp", "", ""},
+		{"tcp", "*", ""},
+		{"any", "", ""},
+		{"any", "80", ""},
+	}
+	for _, tt := range tests {
+		if got := PortMatch(tt.proto, tt.port); got != tt.want {
+			t.Errorf("PortMatch(%q, %q) = %q, want %q", tt.proto, tt.port, got, tt.want)
+		}
+		if got := HasPort(tt.proto, tt.port); got != (tt.want != "") {
+			t.Errorf("HasPort(%q, %q) = %t, want %t", tt.proto, tt.port, got, tt.want != "")
+		}
+	}
+}
+
+func TestCiscoAddr(t *testing.T) {
+	tests := []struct {
+		cidr string
+		inv  bool
+		want string
+	}{
+		{"10.0.0.1/32", false, "host 10.0.0.1"},
+		{"10.0.0.1/32", true, "host 10.0.0.1"},
+		{"10.0.0.0/24", false, "10.0.0.0 255.255.255.0"},
+		{"10.0.0.0/24", true, "10.0.0.0 0.0.0.255"},
+		{"10.0.0.0/8", true, "10.0.0.0 0.255.255.255"},
+		{"2001:db8::1/128", false, "host 2001:db8::1"},
+		{"2001:db8::/64", true, "2001:db8::/64"},
+		{"bad", false, "bad"},
+	}
+	for _, tt := range tests {
+		if got := CiscoAddr(tt.cidr, tt.inv); got != tt.want {
+			t.Errorf("CiscoAddr(%q, %t) = %q, want %q", tt.cidr, tt.inv, got, tt.want)
+		}
+	}
+}
+
+func TestIPFamilyLists(t *testing.T) {
+	cidrs := []string{"10.0.0.1/32", "2001:db8::/64", "10.1.0.0/16", "2001:db8::1/128"}
+	if got, want := IPv4List(cidrs), []string{"10.0.0.1/32", "10.1.0.0/16"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv4List = %v, want %v", got, want)
+	}
+	if got, want := IPv6List(cidrs), []string{"2001:db8::/64", "2001:db8::1/128"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv6List = %v, want %v", got, want)
+	}
+}
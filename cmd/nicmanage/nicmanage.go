@@ -16,23 +16,52 @@ import (
 var updatePCE, noPrompt bool
 var pce illumioapi.PCE
 var err error
-var outputFileName, csvFile string
+var outputFileName, csvFile, policyFile string
 
 func init() {
+	NICManageCmd.Flags().StringVar(&policyFile, "policy", "", "yaml policy file of rules to ignore interfaces. the csv file is not used with a policy. see description below.")
 	NICManageCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 }
 
 // NICManageCmd produces a report of all network interfaces
 var NICManageCmd = &cobra.Command{
-	Use:   "nic-manage [csv file to import]",
+	Use:   "nic-manage [csv file to import or --policy file]",
 	Short: "Manage interfaces for managed or unmanaged workloads by setting ignored field to true or false.",
 	Long: `
 Manage interfaces for managed or unmanaged workloads by setting ignored field to true or false.
 
-Head input CSV requires a header row with at least two headers: wkld_href and ignored. Other columns can be present as well. It is recommended to run worklodaer nic-export and  modify the ignored column in that output.`,
+Head input CSV requires a header row with at least two headers: wkld_href and ignored. Other columns can be present as well. It is recommended to run worklodaer nic-export and  modify the ignored column in that output.
+
+Instead of a csv, use --policy with a yaml file of rules to set the ignored field on all workloads. Run it on a schedule so new workloads (e.g., hosts with container bridges) are handled automatically. Each interface is set by the first rule it matches. All conditions in a rule must match:
+  - select: selector expression for the workloads (see below).
+  - os: case-insensitive regex on the os id or os detail (e.g., win or "centos|rhel|ubuntu").
+  - interface: regex on the interface name.
+  - cidrs: list of cidrs. at least one address of the interface is in one of them.
+  - link_local: true if all addresses are link-local (169.254.0.0/16 or fe80::/10).
+  - no_default_gateway: true if the interface has no default gateway.
+A rule requires at least one of interface, cidrs, link_local, or no_default_gateway. The action is ignore (default) or manage.
+Interfaces that match no rule are unchanged unless default is manage. A workload is skipped if the policy would ignore all its interfaces.
+
+Example:
+  default: keep
+  rules:
+    - name: keep docker0 on build servers
+      action: manage
+      select: app=build
+      interface: ^docker0$
+    - name: container bridges
+      interface: ^(docker|veth|cni|flannel|cali|br-)
+    - name: link-local without gateway
+      link_local: true
+      no_default_gateway: true
+
+The changes are written to a csv that can be reviewed and used as a nic-manage csv input.
+
+` + utils.SelectorHelp,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		pce, err = utils.GetTargetPCE(false)
+		// Labels are needed for policy selectors
+		pce, err = utils.GetTargetPCE(policyFile != "")
 		if err != nil {
 			utils.LogError(err.Error())
 		}
@@ -41,6 +70,12 @@ Head input CSV requires a header row with at least two headers: wkld_href and ig
 		updatePCE = viper.Get("update_pce").(bool)
 		noPrompt = viper.Get("no_prompt").(bool)
 
+		// Run the policy
+		if policyFile != "" {
+			nicPolicyManage()
+			return
+		}
+
 		// Set the CSV file
 		if len(args) != 1 {
 			fmt.Println("Command requires 1 argument for the csv file. See usage help.")
@@ -158,6 +193,12 @@ func nicManage() {
 		updatedWklds = append(updatedWklds, w)
 	}
 
+	applyUpdates(updatedWklds, interfaceChangeCount)
+}
+
+// applyUpdates bulk updates the workloads with the update-pce and no-prompt logic
+func applyUpdates(updatedWklds []illumioapi.Workload, interfaceChangeCount int) {
+
 	// End run there are no updates required
 	if interfaceChangeCount == 0 {
 		utils.LogInfo("no changes identified", true)
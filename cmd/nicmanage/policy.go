@@ -0,0 +1,267 @@
+package nicmanage
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi"
+	"github.com/brian1917/workloader/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// nicPolicy is the interface policy file
+type nicPolicy struct {
+	Default string    `yaml:"default"`
+	Rules   []nicRule `yaml:"rules"`
+}
+
+// nicRule ignores or manages the interfaces that match all of its conditions
+type nicRule struct {
+	Name             string   `yaml:"name"`
+	Action           string   `yaml:"action"`
+	Select           string   `yaml:"select"`
+	OS               string   `yaml:"os"`
+	Interface        string   `yaml:"interface"`
+	CIDRs            []string `yaml:"cidrs"`
+	LinkLocal        *bool    `yaml:"link_local"`
+	NoDefaultGateway *bool    `yaml:"no_default_gateway"`
+
+	selector *utils.Selector
+	osRegex  *regexp.Regexp
+	nameRe   *regexp.Regexp
+	prefixes []netip.Prefix
+}
+
+// parsePolicy reads and validates the policy file
+func parsePolicy(file string) (nicPolicy, error) {
+	policy := nicPolicy{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return policy, err
+	}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("%s - %s", file, err)
+	}
+
+	policy.Default = strings.ToLower(policy.Default)
+	if policy.Default == "" {
+		policy.Default = "keep"
+	}
+	if policy.Default != "keep" && policy.Default != "manage" {
+		return policy, fmt.Errorf("default must be keep or manage")
+	}
+	if len(policy.Rules) == 0 {
+		return policy, fmt.Errorf("%s has no rules", file)
+	}
+
+	for i := range policy.Rules {
+		r := &policy.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		r.Action = strings.ToLower(r.Action)
+		if r.Action == "" {
+			r.Action = "ignore"
+		}
+		if r.Action != "ignore" && r.Action != "manage" {
+			return policy, fmt.Errorf("%s - action must be ignore or manage", r.Name)
+		}
+		if r.Interface == "" && len(r.CIDRs) == 0 && r.LinkLocal == nil && r.NoDefaultGateway == nil {
+			return policy, fmt.Errorf("%s - requires at least one interface condition (interface, cidrs, link_local, or no_default_gateway)", r.Name)
+		}
+		if r.selector, err = utils.ParseSelector(r.Select); err != nil {
+			return policy, fmt.Errorf("%s - select - %s", r.Name, err)
+		}
+		if r.OS != "" {
+			if r.osRegex, err = regexp.Compile("(?i)" + r.OS); err != nil {
+				return policy, fmt.Errorf("%s - os - %s", r.Name, err)
+			}
+		}
+		if r.Interface != "" {
+			if r.nameRe, err = regexp.Compile(r.Interface); err != nil {
+				return policy, fmt.Errorf("%s - interface - %s", r.Name, err)
+			}
+		}
+		for _, c := range r.CIDRs {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(c))
+			if err != nil {
+				return policy, fmt.Errorf("%s - cidrs - %s", r.Name, err)
+			}
+			r.prefixes = append(r.prefixes, prefix.Masked())
+		}
+	}
+	return policy, nil
+}
+
+// matchWorkload returns true if the workload matches the select and os conditions
+func (r *nicRule) matchWorkload(w illumioapi.Workload) bool {
+	if !r.selector.Match(utils.SelectorTargetV1(w, pce.Labels)) {
+		return false
+	}
+	if r.osRegex != nil && !r.osRegex.MatchString(w.OsID) && !r.osRegex.MatchString(w.OsDetail) {
+		return false
+	}
+	return true
+}
+
+// matchInterface returns true if the interface matches the interface conditions. The entries are all the addresses of the interface.
+func (r *nicRule) matchInterface(name string, entries []*illumioapi.Interface) bool {
+	if r.nameRe != nil && !r.nameRe.MatchString(name) {
+		return false
+	}
+
+	inCIDR, allLinkLocal, hasGateway := false, true, false
+	for _, e := range entries {
+		addr, err := netip.ParseAddr(e.Address)
+		if err != nil {
+			allLinkLocal = false
+			continue
+		}
+		for _, p := range r.prefixes {
+			if p.Contains(addr) {
+				inCIDR = true
+			}
+		}
+		if !addr.IsLinkLocalUnicast() {
+			allLinkLocal = false
+		}
+		if e.DefaultGatewayAddress != "" {
+			hasGateway = true
+		}
+	}
+	if len(r.prefixes) > 0 && !inCIDR {
+		return false
+	}
+	if r.LinkLocal != nil && *r.LinkLocal != allLinkLocal {
+		return false
+	}
+	if r.NoDefaultGateway != nil && *r.NoDefaultGateway == hasGateway {
+		return false
+	}
+	return true
+}
+
+// nicPolicyManage applies the policy file to the interfaces of all workloads
+func nicPolicyManage() {
+
+	// Parse the policy
+	policy, err := parsePolicy(policyFile)
+	if err != nil {
+		utils.LogErrorf("parsing policy - %s", err)
+	}
+
+	// Get all the workloads from the PCE
+	wklds, a, err := pce.GetWklds(nil)
+	utils.LogAPIResp("GetAllWorkloadsQP", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Evaluate each interface
+	csvData := [][]string{{"wkld_hostname", "wkld_href", "nic_name", "addresses", "default_gw", "current_ignored", "ignored", "rule"}}
+	updatedWklds := []illumioapi.Workload{}
+	interfaceChangeCount := 0
+	for _, w := range wklds {
+		// Group the addresses by interface name
+		names := []string{}
+		entries := make(map[string][]*illumioapi.Interface)
+		for _, i := range w.Interfaces {
+			if _, ok := entries[i.Name]; !ok {
+				names = append(names, i.Name)
+			}
+			entries[i.Name] = append(entries[i.Name], i)
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		ignored := make(map[string]bool)
+		if w.IgnoredInterfaceNames != nil {
+			for _, n := range *w.IgnoredInterfaceNames {
+				ignored[n] = true
+			}
+		}
+
+		// The first matching rule sets the interface state
+		rows := [][]string{}
+		desired := make(map[string]bool)
+		for _, name := range names {
+			desired[name] = ignored[name]
+			ruleName := ""
+			for i := range policy.Rules {
+				r := &policy.Rules[i]
+				if r.matchWorkload(w) && r.matchInterface(name, entries[name]) {
+					desired[name] = r.Action == "ignore"
+					ruleName = r.Name
+					break
+				}
+			}
+			if ruleName == "" && policy.Default == "manage" {
+				desired[name] = false
+				ruleName = "default manage"
+			}
+			if desired[name] != ignored[name] {
+				addresses, gateways := []string{}, []string{}
+				for _, e := range entries[name] {
+					addresses = append(addresses, e.Address)
+					if e.DefaultGatewayAddress != "" {
+						gateways = append(gateways, e.DefaultGatewayAddress)
+					}
+				}
+				rows = append(rows, []string{w.Hostname, w.Href, name, strings.Join(addresses, ";"), strings.Join(gateways, ";"), strconv.FormatBool(ignored[name]), strconv.FormatBool(desired[name]), ruleName})
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		// Don't ignore every interface on a workload
+		allIgnored := true
+		for _, name := range names {
+			if !desired[name] {
+				allIgnored = false
+			}
+		}
+		if allIgnored {
+			utils.LogWarningf(true, "%s - %s - the policy ignores all interfaces. skipping.", w.Hostname, w.Href)
+			continue
+		}
+
+		// Set the new ignored interfaces. Ignored names not on the workload are kept.
+		newIgnored := []string{}
+		for n := range ignored {
+			if _, ok := entries[n]; !ok {
+				newIgnored = append(newIgnored, n)
+			}
+		}
+		for _, name := range names {
+			if desired[name] {
+				newIgnored = append(newIgnored, name)
+			}
+		}
+		sort.Strings(newIgnored)
+		w.IgnoredInterfaceNames = &newIgnored
+		updatedWklds = append(updatedWklds, w)
+		interfaceChangeCount = interfaceChangeCount + len(rows)
+		for _, row := range rows {
+			utils.LogInfo(fmt.Sprintf("%s - interface %s needs to be updated from ignored %s to %s by %s", row[1], row[2], row[5], row[6], row[7]), false)
+		}
+		csvData = append(csvData, rows...)
+	}
+
+	// Write the diff
+	if len(csvData) > 1 {
+		if outputFileName == "" {
+			outputFileName = fmt.Sprintf("workloader-nic-manage-policy-%s.csv", time.Now().Format("20060102_150405"))
+		}
+		utils.WriteOutput(csvData, csvData, outputFileName)
+	}
+
+	applyUpdates(updatedWklds, interfaceChangeCount)
+}
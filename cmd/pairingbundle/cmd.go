@@ -0,0 +1,390 @@
+package pairingbundle
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// CSV headers. Any other header that is a label key is a label.
+const (
+	HeaderName              = "name"
+	HeaderDescription       = "description"
+	HeaderVenType           = "ven_type"
+	HeaderEnabled           = "enabled"
+	HeaderEnforcement       = "enforcement"
+	HeaderVisibility        = "visibility"
+	HeaderKeyLifespan       = "key_lifespan"
+	HeaderAllowedUsesPerKey = "allowed_uses_per_key"
+)
+
+var pce illumioapi.PCE
+var err error
+var proxy, managementServer, outputDir, outputFileName string
+var noScripts bool
+
+func init() {
+	PairingBundleCmd.Flags().StringVar(&proxy, "proxy", "", "proxy for the hosts to download the pairing script and pair (e.g., http://proxy.company.com:8080).")
+	PairingBundleCmd.Flags().StringVar(&managementServer, "management-server", "", "management server in fqdn:port format used in the scripts. default is the target pce fqdn and port.")
+	PairingBundleCmd.Flags().StringVar(&outputDir, "output-dir", "pairing-bundle", "directory for the pairing scripts.")
+	PairingBundleCmd.Flags().BoolVar(&noScripts, "no-scripts", false, "create and update pairing profiles without generating keys and scripts.")
+	PairingBundleCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+
+	PairingBundleCmd.Flags().SortFlags = false
+}
+
+// PairingBundleCmd creates pairing profiles and pairing scripts from a csv
+var PairingBundleCmd = &cobra.Command{
+	Use:   "pairing-bundle [csv file]",
+	Short: "Create or update pairing profiles from a csv and generate pairing keys and linux and windows pairing scripts for each.",
+	Long: `
+Create or update pairing profiles from a csv and generate pairing keys and linux and windows pairing scripts for each.
+
+The csv requires a name header. Optional headers:
+  - description
+  - ven_type: server or endpoint. default is server.
+  - enabled: true or false. default is true.
+  - enforcement: idle, visibility_only, selective, or full.
+  - visibility: blocked_allowed, blocked, enhanced_data_collection, or off.
+  - key_lifespan: seconds a key is valid. blank or unlimited for no limit.
+  - allowed_uses_per_key: number of pairings per key. blank or unlimited for no limit.
+Any other header that is a label key is the label applied to workloads paired with the profile. Labels that do not exist are created. Headers that are not a field above or a label key are ignored with a warning.
+
+Profiles that exist (matched on name) are updated with the values in the csv. Blank values are not changed on existing profiles. Labels of keys that are not in the csv or are blank are kept.
+
+For each profile a new pairing key is generated and two scripts are created in --output-dir:
+  - <profile>-pair.sh for linux.
+  - <profile>-pair.ps1 for windows.
+The scripts download the pairing script from the pce and pair with the activation code. The --proxy and --management-server values are used in the scripts. The scripts contain the activation code so protect them accordingly.
+
+Recommended to run without --update-pce first to log what will change. If --update-pce is used, workloader will create and update the profiles with a user prompt. To disable the prompt, use --no-prompt.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		// Set the CSV file
+		if len(args) != 1 {
+			fmt.Println("Command requires 1 argument for the csv file. See usage help.")
+			os.Exit(0)
+		}
+
+		pairingBundle(args[0], viper.Get("update_pce").(bool), viper.Get("no_prompt").(bool))
+	},
+}
+
+// profileEntry is a pairing profile from the csv
+type profileEntry struct {
+	csvLine  int
+	name     string
+	existing *illumioapi.PairingProfile
+	body     profileBody
+	labels   []illumioapi.Label
+}
+
+// profileBody is the create and update pairing profile request. Only the csv values are sent.
+// Key lifespan and allowed uses per key are a number or "unlimited".
+type profileBody struct {
+	Href              string       `json:"href,omitempty"`
+	Name              string       `json:"name,omitempty"`
+	Description       *string      `json:"description,omitempty"`
+	Enabled           *bool        `json:"enabled,omitempty"`
+	VenType           string       `json:"ven_type,omitempty"`
+	EnforcementMode   string       `json:"enforcement_mode,omitempty"`
+	VisibilityLevel   string       `json:"visibility_level,omitempty"`
+	KeyLifespan       interface{}  `json:"key_lifespan,omitempty"`
+	AllowedUsesPerKey interface{}  `json:"allowed_uses_per_key,omitempty"`
+	Labels            *[]labelHref `json:"labels,omitempty"`
+}
+
+// labelHref is a label in a pairing profile request
+type labelHref struct {
+	Href string `json:"href"`
+}
+
+func pairingBundle(csvFile string, updatePCE, noPrompt bool) {
+
+	// Parse the csv
+	csvData, err := utils.ParseCSV(csvFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if len(csvData) < 2 {
+		utils.LogError("csv must have a header row and at least one pairing profile")
+	}
+	headers := make(map[string]int)
+	for i, h := range csvData[0] {
+		headers[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := headers[HeaderName]; !ok {
+		utils.LogError("csv requires a name header")
+	}
+
+	// Ignore headers that are not a pairing profile field or a label key
+	labelKeys := map[string]bool{"role": true, "app": true, "env": true, "loc": true}
+	api, err := pce.GetLabelDimensions(nil)
+	utils.LogAPIRespV2("GetLabelDimensions", api)
+	if err != nil {
+		utils.LogWarningf(true, "getting label dimensions - %s - will use 4 default keys", err)
+	} else {
+		labelKeys = make(map[string]bool)
+		for _, ld := range pce.LabelDimensionsSlice {
+			labelKeys[ld.Key] = true
+		}
+	}
+	knownHeaders := map[string]bool{HeaderName: true, HeaderDescription: true, HeaderVenType: true, HeaderEnabled: true, HeaderEnforcement: true, HeaderVisibility: true, HeaderKeyLifespan: true, HeaderAllowedUsesPerKey: true}
+	for header := range headers {
+		if !knownHeaders[header] && !labelKeys[header] {
+			utils.LogWarningf(true, "%s header is not a pairing profile field or label key. ignoring.", header)
+			delete(headers, header)
+		}
+	}
+
+	// Get the existing pairing profiles
+	pairingProfiles, api, err := pce.GetPairingProfiles(nil)
+	utils.LogAPIRespV2("GetPairingProfiles", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	existing := make(map[string]illumioapi.PairingProfile)
+	for _, pp := range pairingProfiles {
+		existing[pp.Name] = pp
+	}
+
+	// Build the entries
+	entries := []profileEntry{}
+	labelsToCreate := make(map[string]illumioapi.Label)
+	for i, row := range csvData[1:] {
+		csvLine := i + 2
+		entry := profileEntry{csvLine: csvLine, name: row[headers[HeaderName]]}
+		if entry.name == "" {
+			utils.LogWarningf(true, "csv line %d - name is blank. skipping.", csvLine)
+			continue
+		}
+		if pp, ok := existing[entry.name]; ok {
+			entry.existing = &pp
+		} else {
+			entry.body = profileBody{Name: entry.name, Enabled: illumioapi.Ptr(true), VenType: "server"}
+		}
+
+		valid := true
+		for header, c := range headers {
+			if c >= len(row) || row[c] == "" || header == HeaderName {
+				continue
+			}
+			value := strings.TrimSpace(row[c])
+			switch header {
+			case HeaderDescription:
+				entry.body.Description = illumioapi.Ptr(value)
+			case HeaderVenType:
+				if value != "server" && value != "endpoint" {
+					utils.LogWarningf(true, "csv line %d - ven_type must be server or endpoint. skipping.", csvLine)
+					valid = false
+				}
+				entry.body.VenType = value
+			case HeaderEnabled:
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					utils.LogWarningf(true, "csv line %d - %s is not a valid enabled value. skipping.", csvLine, value)
+					valid = false
+				}
+				entry.body.Enabled = illumioapi.Ptr(enabled)
+			case HeaderEnforcement:
+				if value != "idle" && value != "visibility_only" && value != "selective" && value != "full" {
+					utils.LogWarningf(true, "csv line %d - enforcement must be idle, visibility_only, selective, or full. skipping.", csvLine)
+					valid = false
+				}
+				entry.body.EnforcementMode = value
+			case HeaderVisibility:
+				visLevels := map[string]string{"blocked_allowed": "flow_summary", "blocked": "flow_drops", "off": "flow_off", "enhanced_data_collection": "enhanced_data_collection"}
+				if _, ok := visLevels[value]; !ok {
+					utils.LogWarningf(true, "csv line %d - visibility must be blocked_allowed, blocked, enhanced_data_collection, or off. skipping.", csvLine)
+					valid = false
+				}
+				entry.body.VisibilityLevel = visLevels[value]
+			case HeaderKeyLifespan, HeaderAllowedUsesPerKey:
+				var limit interface{} = "unlimited"
+				if strings.ToLower(value) != "unlimited" {
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						utils.LogWarningf(true, "csv line %d - %s must be a positive number or unlimited. skipping.", csvLine, header)
+						valid = false
+					}
+					limit = n
+				}
+				if header == HeaderKeyLifespan {
+					entry.body.KeyLifespan = limit
+				} else {
+					entry.body.AllowedUsesPerKey = limit
+				}
+			default:
+				label := illumioapi.Label{Key: header, Value: value}
+				if l, ok := pce.Labels[header+value]; ok {
+					label = l
+				} else {
+					labelsToCreate[header+value] = label
+				}
+				entry.labels = append(entry.labels, label)
+			}
+		}
+		if !valid {
+			continue
+		}
+		if entry.existing != nil {
+			utils.LogInfof(false, "csv line %d - %s exists and will be updated", csvLine, entry.name)
+		} else {
+			utils.LogInfof(false, "csv line %d - %s will be created", csvLine, entry.name)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Summarize
+	createCount := 0
+	for _, e := range entries {
+		if e.existing == nil {
+			createCount++
+		}
+	}
+	utils.LogInfo(fmt.Sprintf("workloader identified %d pairing profiles to create, %d to update, and %d labels to create.", createCount, len(entries)-createCount, len(labelsToCreate)), true)
+	if len(entries) == 0 {
+		return
+	}
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo("See workloader.log for details. To create and update the pairing profiles and generate scripts, run again using --update-pce flag. The --no-prompt flag will bypass the prompt if used with --update-pce.", true)
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if !noPrompt {
+		var prompt string
+		fmt.Printf("[PROMPT] - workloader will create %d pairing profiles, update %d pairing profiles, and create %d labels in %s (%s). Do you want to run the import (yes/no)? ", createCount, len(entries)-createCount, len(labelsToCreate), pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied", true)
+			return
+		}
+	}
+
+	// Create the labels
+	for key, label := range labelsToCreate {
+		newLabel, api, err := pce.CreateLabel(label)
+		utils.LogAPIRespV2("CreateLabel", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		pce.Labels[key] = newLabel
+		utils.LogInfo(fmt.Sprintf("created %s %s label - %d", newLabel.Value, newLabel.Key, api.StatusCode), true)
+	}
+
+	// Set up the scripts
+	if managementServer == "" {
+		managementServer = fmt.Sprintf("%s:%d", pce.FQDN, pce.Port)
+	}
+	if !noScripts {
+		if err := os.MkdirAll(outputDir, 0700); err != nil {
+			utils.LogError(err.Error())
+		}
+	}
+
+	// Create or update the profiles
+	csvOut := [][]string{{"name", "href", "action", "linux_script", "windows_script"}}
+	for _, e := range entries {
+		if len(e.labels) > 0 {
+			// The put replaces all labels so keep the existing labels of the keys not in the csv
+			labelHrefs := []labelHref{}
+			csvKeys := make(map[string]bool)
+			for _, l := range e.labels {
+				labelHrefs = append(labelHrefs, labelHref{Href: pce.Labels[l.Key+l.Value].Href})
+				csvKeys[l.Key] = true
+			}
+			if e.existing != nil {
+				for _, l := range illumioapi.PtrToVal(e.existing.Labels) {
+					if !csvKeys[pce.Labels[l.Href].Key] {
+						labelHrefs = append(labelHrefs, labelHref{Href: l.Href})
+					}
+				}
+			}
+			e.body.Labels = &labelHrefs
+		}
+
+		var pp illumioapi.PairingProfile
+		action := "updated"
+		if e.existing == nil {
+			action = "created"
+			api, err = pce.Post("pairing_profiles", &e.body, &pp)
+			utils.LogAPIRespV2("CreatePairingProfile", api)
+			if err != nil {
+				utils.LogError(fmt.Sprintf("csv line %d - creating %s - %s", e.csvLine, e.name, err))
+			}
+		} else {
+			pp = *e.existing
+			e.body.Href = pp.Href
+			api, err = pce.Put(&e.body)
+			utils.LogAPIRespV2("UpdatePairingProfile", api)
+			if err != nil {
+				utils.LogError(fmt.Sprintf("csv line %d - updating %s - %s", e.csvLine, e.name, err))
+			}
+		}
+		utils.LogInfo(fmt.Sprintf("csv line %d - %s %s - %d", e.csvLine, action, e.name, api.StatusCode), true)
+
+		if noScripts {
+			csvOut = append(csvOut, []string{e.name, pp.Href, action, "", ""})
+			continue
+		}
+
+		// Generate the key and scripts
+		pk, api, err := pce.CreatePairingKey(pp)
+		utils.LogAPIRespV2("CreatePairingKey", api)
+		if err != nil {
+			utils.LogError(fmt.Sprintf("csv line %d - creating pairing key for %s - %s", e.csvLine, e.name, err))
+		}
+		data := scriptData{Profile: e.name, ProfileID: path.Base(pp.Href), ManagementServer: managementServer, ActivationCode: pk.ActivationCode, Proxy: proxy}
+		linuxFile := filepath.Join(outputDir, safeFileName(e.name)+"-pair.sh")
+		windowsFile := filepath.Join(outputDir, safeFileName(e.name)+"-pair.ps1")
+		writeScript(linuxScript, data, linuxFile, 0700)
+		writeScript(windowsScript, data, windowsFile, 0600)
+		csvOut = append(csvOut, []string{e.name, pp.Href, action, linuxFile, windowsFile})
+	}
+
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-pairing-bundle-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvOut, nil, outputFileName)
+	utils.LogInfo(fmt.Sprintf("%d pairing profiles processed. see %s for details.", len(csvOut)-1, outputFileName), true)
+}
+
+// unsafeChars matches characters that should not be in a file name
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// safeFileName converts a profile name to a file name
+func safeFileName(name string) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(name, "_"), "_")
+}
+
+// writeScript renders a script template to a file
+func writeScript(t *template.Template, data scriptData, filename string, perm os.FileMode) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	defer file.Close()
+	if err := t.Execute(file, data); err != nil {
+		utils.LogError(err.Error())
+	}
+}
@@ -0,0 +1,38 @@
+package pairingbundle
+
+import "text/template"
+
+// scriptData is the data used to render the pairing scripts
+type scriptData struct {
+	Profile          string
+	ProfileID        string
+	ManagementServer string
+	ActivationCode   string
+	Proxy            string
+}
+
+// linuxScript is the pairing script for linux. It matches the script in the PCE UI with the proxy and activation code added.
+var linuxScript = template.Must(template.New("linux").Parse(`#!/bin/sh
+# Illumio VEN pairing script for pairing profile "{{.Profile}}" on {{.ManagementServer}}
+# Generated by workloader pairing-bundle
+{{- if .Proxy}}
+export https_proxy="{{.Proxy}}"
+{{- end}}
+rm -fr /opt/illumio_ven_data/tmp && umask 026 && mkdir -p /opt/illumio_ven_data/tmp && \
+curl --tlsv1{{if .Proxy}} --proxy "{{.Proxy}}"{{end}} "https://{{.ManagementServer}}/api/v25/software/ven/image?pair_script=pair.sh&profile_id={{.ProfileID}}" -o /opt/illumio_ven_data/tmp/pair.sh && \
+chmod +x /opt/illumio_ven_data/tmp/pair.sh && \
+/opt/illumio_ven_data/tmp/pair.sh --management-server {{.ManagementServer}} --activation-code {{.ActivationCode}}
+`))
+
+// windowsScript is the pairing script for windows. It matches the script in the PCE UI with the proxy and activation code added.
+var windowsScript = template.Must(template.New("windows").Parse(`# Illumio VEN pairing script for pairing profile "{{.Profile}}" on {{.ManagementServer}}
+# Generated by workloader pairing-bundle
+Set-ExecutionPolicy -Scope Process RemoteSigned -Force
+[System.Net.ServicePointManager]::SecurityProtocol = [Enum]::ToObject([System.Net.SecurityProtocolType], 3072)
+$wc = New-Object System.Net.WebClient
+{{- if .Proxy}}
+$wc.Proxy = New-Object System.Net.WebProxy('{{.Proxy}}')
+{{- end}}
+$wc.DownloadFile('https://{{.ManagementServer}}/api/v25/software/ven/image?pair_script=pair.ps1&profile_id={{.ProfileID}}', "$env:windir\temp\pair.ps1")
+& "$env:windir\temp\pair.ps1" -management-server {{.ManagementServer}} -activation-code {{.ActivationCode}}
+`))
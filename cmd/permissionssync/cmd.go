@@ -0,0 +1,377 @@
+package permissionssync
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Declare local global variables
+var outputFileName string
+var allPrincipals, noDelete, allowGlobalRoleDelete bool
+
+// Statuses in the access review
+const (
+	statusInSync    = "in_sync"
+	statusCreate    = "create"
+	statusUpdate    = "update"
+	statusDelete    = "delete"
+	statusDrift     = "drift"
+	statusUnmanaged = "unmanaged"
+)
+
+func init() {
+	PermissionsSyncCmd.Flags().BoolVar(&allPrincipals, "all-principals", false, "manage all principals in the pce. permissions of principals not in the desired state file are deleted. by default, only principals in the file are managed.")
+	PermissionsSyncCmd.Flags().BoolVar(&noDelete, "no-delete", false, "do not delete permissions that are not in the desired state file. they are reported with a drift status.")
+	PermissionsSyncCmd.Flags().BoolVar(&allowGlobalRoleDelete, "allow-global-role-delete", false, "allow deleting and changing the role of global owner and admin permissions. by default they are reported with a drift status.")
+	PermissionsSyncCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the access review file. default is current location with a timestamped filename.")
+	PermissionsSyncCmd.Flags().SortFlags = false
+}
+
+// syncEntry is an existing or desired permission with its sync status
+type syncEntry struct {
+	status     string
+	permission illumioapi.Permission
+	desired    *desiredPermission
+	oldRole    string
+}
+
+// PermissionsSyncCmd runs the permissions-sync command
+var PermissionsSyncCmd = &cobra.Command{
+	Use:   "permissions-sync [csv or yaml file]",
+	Short: "Sync scoped permissions in the PCE to a desired state csv or yaml file and create an access review report.",
+	Long: `
+Sync scoped permissions in the PCE to a desired state csv or yaml file and create an access review report.
+
+The desired state is the complete list of permissions for the principals in the file. Permissions are matched on principal, role, and scope (the order of the scope does not matter):
+  - desired permissions that don't exist are created.
+  - an existing permission with the same principal and scope but a different role is updated.
+  - existing permissions not in the file are deleted (use --no-delete to only report them as drift).
+Only the principals in the file are managed unless --all-principals is used. Permissions of other principals are reported as unmanaged.
+
+Global owner and admin permissions (owner or admin role with no scope) are not deleted or changed unless --allow-global-role-delete is used. They are reported as drift. The last global owner is never removed.
+
+The csv uses the permissions-export headers (other headers are ignored, so an export can be edited and used):
+  - auth_security_principal_name (group name or display name)
+  - role (see below for valid options)
+  - scope (key:value entries semi-colon separated with a "-lg" suffix for label groups. for example, app:erp;env:non-prod-lg. any label dimension can be used. blank is all workloads.)
+
+The yaml is a list of permissions (or a map with a permissions key) with principal, role, and scope. Scope can be a string or a list:
+  - principal: erp-owners
+    role: ruleset_manager
+    scope: [app:erp, env:non-prod-lg]
+  - principal: auditors
+    role: read_only
+
+The access review csv maps each principal to its role, scope, and effective scope (label groups expanded to labels) with the sync status of each permission (in_sync, create, update, delete, drift, or unmanaged). Run without --update-pce for a drift report.
+
+Valid role options include the following:
+` + strings.Join(illumioapi.AvailableRolesSlice(), ", "),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		// Set the desired state file
+		if len(args) != 1 {
+			fmt.Println("Command requires 1 argument for the csv or yaml file. See usage help.")
+			os.Exit(0)
+		}
+
+		syncPermissions(pce, args[0], viper.Get("update_pce").(bool), viper.Get("no_prompt").(bool))
+	},
+}
+
+func syncPermissions(pce illumioapi.PCE, file string, updatePCE, noPrompt bool) {
+
+	// Get permissions, auth security principals, labels, and label groups
+	apiResps, err := pce.Load(illumioapi.LoadInput{Permissions: true, AuthSecurityPrincipals: true, Labels: true, LabelGroups: true, ProvisionStatus: "active"}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogErrorf("loading pce - %s", err)
+	}
+
+	// Parse the desired state
+	desired, err := parseDesired(file)
+	if err != nil {
+		utils.LogErrorf("parsing desired state - %s", err)
+	}
+
+	// Principals are in the map by name. Add the display names for files built from permissions-export.
+	principals := make(map[string]illumioapi.AuthSecurityPrincipal)
+	for key, p := range pce.AuthSecurityPrincipals {
+		if key == p.Href {
+			principals[p.DisplayName] = p
+		}
+	}
+	for key, p := range pce.AuthSecurityPrincipals {
+		if key != p.Href {
+			principals[key] = p
+		}
+	}
+
+	// Resolve the desired permissions. An invalid entry stops the sync so permissions are not deleted by mistake.
+	desiredMap := make(map[string]*syncEntry)
+	desiredEntries := []*syncEntry{}
+	managed := make(map[string]bool)
+	for i := range desired {
+		d := &desired[i]
+		principal, exists := principals[d.Principal]
+		if !exists {
+			utils.LogErrorf("line %d - %s does not exist as an authorized security principal", d.line, d.Principal)
+		}
+		if !illumioapi.AvailableRoles[d.Role] {
+			utils.LogErrorf("line %d - %s is an invalid role", d.line, d.Role)
+		}
+		scope, scopeKey, err := resolveScope(pce, d.Scope)
+		if err != nil {
+			utils.LogErrorf("line %d - %s", d.line, err)
+		}
+		roleHref := fmt.Sprintf("/orgs/%d/roles/%s", pce.Org, d.Role)
+		key := principal.Href + "|" + roleHref + "|" + scopeKey
+		if _, exists := desiredMap[key]; exists {
+			utils.LogWarningf(true, "line %d - duplicate permission - skipping", d.line)
+			continue
+		}
+		entry := &syncEntry{desired: d, permission: illumioapi.Permission{
+			Role:                  &illumioapi.Role{Href: roleHref},
+			AuthSecurityPrincipal: &illumioapi.AuthSecurityPrincipal{Href: principal.Href},
+			Scope:                 &scope}}
+		desiredMap[key] = entry
+		desiredEntries = append(desiredEntries, entry)
+		managed[principal.Href] = true
+	}
+
+	// Match the existing permissions on principal, role, and scope
+	existingEntries := []*syncEntry{}
+	for _, p := range pce.PermissionsSlice {
+		entry := &syncEntry{permission: p, status: statusDelete}
+		key := p.AuthSecurityPrincipal.Href + "|" + p.Role.Href + "|" + permissionScopeKey(p)
+		if d, exists := desiredMap[key]; exists && d.status == "" {
+			d.status = statusInSync
+			entry.status = statusInSync
+			entry.desired = d.desired
+		}
+		existingEntries = append(existingEntries, entry)
+	}
+
+	// Unmatched desired permissions update the role of an unmatched existing permission with the same principal and scope or are created
+	for _, d := range desiredEntries {
+		if d.status != "" {
+			continue
+		}
+		d.status = statusCreate
+		for _, e := range existingEntries {
+			if e.status != statusDelete || e.permission.AuthSecurityPrincipal.Href != d.permission.AuthSecurityPrincipal.Href || permissionScopeKey(e.permission) != permissionScopeKey(d.permission) {
+				continue
+			}
+			if isGlobalAdmin(e.permission) && !allowGlobalRoleDelete {
+				continue
+			}
+			d.status = statusUpdate
+			e.status = statusUpdate
+			e.desired = d.desired
+			e.oldRole = e.permission.Role.Href
+			e.permission.Role = d.permission.Role
+			break
+		}
+	}
+
+	// Remaining existing permissions are deleted if the principal is managed
+	for _, e := range existingEntries {
+		if e.status != statusDelete {
+			continue
+		}
+		if !allPrincipals && !managed[e.permission.AuthSecurityPrincipal.Href] {
+			e.status = statusUnmanaged
+		} else if noDelete {
+			e.status = statusDrift
+		} else if isGlobalAdmin(e.permission) && !allowGlobalRoleDelete {
+			utils.LogWarningf(true, "%s is a global %s permission and will not be deleted. use --allow-global-role-delete to delete it.", e.permission.Href, roleName(e.permission.Role.Href))
+			e.status = statusDrift
+		}
+	}
+
+	// Refuse to remove the last global owner
+	owners, remainingOwners := 0, 0
+	for _, e := range existingEntries {
+		if isGlobalOwner(e.permission.Role.Href, e.permission) || (e.status == statusUpdate && isGlobalOwner(e.oldRole, e.permission)) {
+			owners++
+		}
+		if e.status != statusDelete && isGlobalOwner(e.permission.Role.Href, e.permission) {
+			remainingOwners++
+		}
+	}
+	for _, d := range desiredEntries {
+		if d.status == statusCreate && isGlobalOwner(d.permission.Role.Href, d.permission) {
+			remainingOwners++
+		}
+	}
+	if owners > 0 && remainingOwners == 0 {
+		utils.LogError("the sync would remove the last global owner permission. add a global owner to the desired state file.")
+	}
+
+	// Build the list of changes and the access review
+	creates, updates, deletes := []*syncEntry{}, []*syncEntry{}, []*syncEntry{}
+	reviewEntries := []*syncEntry{}
+	for _, e := range existingEntries {
+		reviewEntries = append(reviewEntries, e)
+		switch e.status {
+		case statusUpdate:
+			updates = append(updates, e)
+		case statusDelete:
+			deletes = append(deletes, e)
+		case statusDrift:
+			utils.LogInfof(false, "drift - %s is not in the desired state", e.permission.Href)
+		}
+	}
+	for _, d := range desiredEntries {
+		if d.status == statusCreate {
+			creates = append(creates, d)
+			reviewEntries = append(reviewEntries, d)
+		}
+	}
+	for _, e := range updates {
+		utils.LogInfof(false, "line %d - %s to be updated from %s to %s", e.desired.line, e.permission.Href, e.oldRole, e.permission.Role.Href)
+	}
+	for _, e := range creates {
+		utils.LogInfof(false, "line %d - %s with %s to be created", e.desired.line, e.desired.Principal, e.desired.Role)
+	}
+	for _, e := range deletes {
+		utils.LogInfof(false, "%s to be deleted", e.permission.Href)
+	}
+
+	// Write the access review
+	writeAccessReview(pce, reviewEntries)
+	utils.LogInfof(true, "%d permissions in sync, %d to create, %d to update, %d to delete, %d drift, and %d unmanaged", countStatus(reviewEntries, statusInSync), len(creates), len(updates), len(deletes), countStatus(reviewEntries, statusDrift), countStatus(reviewEntries, statusUnmanaged))
+
+	// End run of nothing to do
+	if len(creates) == 0 && len(updates) == 0 && len(deletes) == 0 {
+		utils.LogInfo("nothing to be done.", true)
+		return
+	}
+
+	if !updatePCE {
+		utils.LogInfof(true, "workloader identified %d permissions to create, %d permissions to update, and %d permissions to delete. See workloader.log for all identified changes. To do the sync, run again using --update-pce flag", len(creates), len(updates), len(deletes))
+		return
+	}
+
+	if !noPrompt {
+		var prompt string
+		fmt.Printf("[PROMPT] - workloader will create %d permissions, update %d permissions, and delete %d permissions in %s (%s). Do you want to run the sync (yes/no)? ", len(creates), len(updates), len(deletes), pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("Prompt denied.", true)
+			return
+		}
+	}
+
+	// Update permissions
+	for _, e := range updates {
+		api, err := pce.UpdatePermission(e.permission)
+		utils.LogAPIRespV2("UpdatePermission", api)
+		if err != nil {
+			utils.LogErrorf("line %d - error - api status code: %d, api resp: %s", e.desired.line, api.StatusCode, api.RespBody)
+		}
+		utils.LogInfof(true, "line %d - updated %s - %d", e.desired.line, e.permission.Href, api.StatusCode)
+	}
+
+	// Create the permissions
+	for _, e := range creates {
+		createdPermission, api, err := pce.CreatePermission(e.permission)
+		utils.LogAPIRespV2("CreatePermission", api)
+		if err != nil {
+			utils.LogErrorf("line %d - error - api status code: %d, api resp: %s", e.desired.line, api.StatusCode, api.RespBody)
+		}
+		utils.LogInfof(true, "line %d - created %s - %d", e.desired.line, createdPermission.Href, api.StatusCode)
+	}
+
+	// Delete permissions
+	for _, e := range deletes {
+		api, err := pce.DeleteHref(e.permission.Href)
+		utils.LogAPIRespV2("DeleteHref", api)
+		if err != nil {
+			utils.LogErrorf("deleting %s - error - api status code: %d, api resp: %s", e.permission.Href, api.StatusCode, api.RespBody)
+		}
+		utils.LogInfof(true, "deleted %s - %d", e.permission.Href, api.StatusCode)
+	}
+}
+
+// writeAccessReview writes each permission with the principal, the effective scope, and the sync status
+func writeAccessReview(pce illumioapi.PCE, entries []*syncEntry) {
+	type reviewRow struct {
+		principal string
+		row       []string
+	}
+	rows := []reviewRow{}
+	for _, e := range entries {
+		principal := pce.AuthSecurityPrincipals[e.permission.AuthSecurityPrincipal.Href]
+		currentRole, desiredRole := roleName(e.permission.Role.Href), roleName(e.permission.Role.Href)
+		switch e.status {
+		case statusUpdate:
+			currentRole = roleName(e.oldRole)
+		case statusCreate:
+			currentRole = ""
+		case statusDelete, statusDrift, statusUnmanaged:
+			desiredRole = ""
+		}
+		line := ""
+		if e.desired != nil {
+			line = fmt.Sprintf("%d", e.desired.line)
+		}
+		scope := illumioapi.PtrToVal(e.permission.Scope)
+		rows = append(rows, reviewRow{principal: principal.Name, row: []string{principal.Name, principal.DisplayName, principal.Type, currentRole, desiredRole, scopeString(pce, scope), effectiveScope(pce, scope), e.status, e.permission.Href, line}})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].principal != rows[j].principal {
+			return rows[i].principal < rows[j].principal
+		}
+		return strings.Join(rows[i].row[3:6], "|") < strings.Join(rows[j].row[3:6], "|")
+	})
+
+	csvData := [][]string{{"principal_name", "principal_display_name", "principal_type", "current_role", "desired_role", "scope", "effective_scope", "status", "href", "desired_state_line"}}
+	for _, r := range rows {
+		csvData = append(csvData, r.row)
+	}
+	if len(csvData) == 1 {
+		utils.LogInfo("no permissions in the pce or the desired state.", true)
+		return
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-permissions-sync-access-review-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, outputFileName)
+	utils.LogInfof(true, "access review with %d permissions created - %s", len(csvData)-1, outputFileName)
+}
+
+// isGlobalAdmin returns true if the permission is the owner or admin role with no scope
+func isGlobalAdmin(p illumioapi.Permission) bool {
+	return isGlobalOwner(p.Role.Href, p) || (roleName(p.Role.Href) == "admin" && len(illumioapi.PtrToVal(p.Scope)) == 0)
+}
+
+// isGlobalOwner returns true if the role is owner and the permission has no scope
+func isGlobalOwner(roleHref string, p illumioapi.Permission) bool {
+	return roleName(roleHref) == "owner" && len(illumioapi.PtrToVal(p.Scope)) == 0
+}
+
+// countStatus returns the number of entries with the status
+func countStatus(entries []*syncEntry, status string) int {
+	count := 0
+	for _, e := range entries {
+		if e.status == status {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,258 @@
+package permissionssync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/permissionsexport"
+	"github.com/brian1917/workloader/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// desiredPermission is an entry from the desired state file
+type desiredPermission struct {
+	Principal string    `yaml:"principal"`
+	Role      string    `yaml:"role"`
+	Scope     scopeList `yaml:"scope"`
+	line      int
+}
+
+// scopeList is a scope as a semi-colon separated string or a list of key:value entries
+type scopeList []string
+
+// UnmarshalYAML accepts a string or a list of strings
+func (s *scopeList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = splitScope(value.Value)
+		return nil
+	}
+	entries := []string{}
+	if err := value.Decode(&entries); err != nil {
+		return err
+	}
+	*s = scopeList{}
+	for _, e := range entries {
+		*s = append(*s, splitScope(e)...)
+	}
+	return nil
+}
+
+// splitScope splits a semi-colon separated scope into its entries
+func splitScope(scope string) []string {
+	entries := []string{}
+	for _, e := range strings.Split(scope, ";") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// parseDesired parses the desired state csv or yaml file
+func parseDesired(file string) ([]desiredPermission, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return parseDesiredYAML(file)
+	}
+	return parseDesiredCSV(file)
+}
+
+// parseDesiredYAML parses a list of permissions or a map with a permissions list
+func parseDesiredYAML(file string) ([]desiredPermission, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s - %s", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.MappingNode {
+		var wrapper struct {
+			Permissions yaml.Node `yaml:"permissions"`
+		}
+		if err := root.Decode(&wrapper); err != nil {
+			return nil, fmt.Errorf("%s - %s", file, err)
+		}
+		root = &wrapper.Permissions
+	}
+	if root.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s - expected a list of permissions or a permissions key with a list", file)
+	}
+
+	desired := []desiredPermission{}
+	for _, n := range root.Content {
+		d := desiredPermission{}
+		if err := n.Decode(&d); err != nil {
+			return nil, fmt.Errorf("%s line %d - %s", file, n.Line, err)
+		}
+		d.line = n.Line
+		desired = append(desired, d)
+	}
+	return desired, nil
+}
+
+// parseDesiredCSV parses a csv with the permissions-export headers
+func parseDesiredCSV(file string) ([]desiredPermission, error) {
+	csvData, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(csvData) == 0 {
+		return nil, nil
+	}
+
+	headers := make(map[string]int)
+	for i, h := range csvData[0] {
+		headers[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := headers[permissionsexport.HeaderAuthSecPrincipalName]; !ok {
+		return nil, fmt.Errorf("%s - %s header is required", file, permissionsexport.HeaderAuthSecPrincipalName)
+	}
+	if _, ok := headers[permissionsexport.HeaderRole]; !ok {
+		return nil, fmt.Errorf("%s - %s header is required", file, permissionsexport.HeaderRole)
+	}
+
+	desired := []desiredPermission{}
+	for rowIndex, row := range csvData[1:] {
+		d := desiredPermission{line: rowIndex + 2}
+		d.Principal = row[headers[permissionsexport.HeaderAuthSecPrincipalName]]
+		d.Role = row[headers[permissionsexport.HeaderRole]]
+		if i, ok := headers[permissionsexport.HeaderScope]; ok {
+			d.Scope = splitScope(row[i])
+		}
+		desired = append(desired, d)
+	}
+	return desired, nil
+}
+
+// resolveScope converts the scope entries to the api scope and the normalized scope key.
+// Entries are key:value for labels and key:name-lg for label groups.
+func resolveScope(pce illumioapi.PCE, entries []string) ([]illumioapi.Scopes, string, error) {
+	scope := []illumioapi.Scopes{}
+	hrefs := []string{}
+	for _, entry := range entries {
+		entrySlice := strings.Split(entry, ":")
+		if len(entrySlice) == 1 {
+			return nil, "", fmt.Errorf("%s is an invalid scope entry", entry)
+		}
+		key := strings.TrimSpace(entrySlice[0])
+		value := strings.TrimSpace(strings.Join(entrySlice[1:], ":"))
+		if strings.HasSuffix(value, "-lg") {
+			lg, exists := pce.LabelGroups[key+strings.TrimSuffix(value, "-lg")]
+			if !exists {
+				return nil, "", fmt.Errorf("%s:%s does not exist as a label group", key, strings.TrimSuffix(value, "-lg"))
+			}
+			scope = append(scope, illumioapi.Scopes{LabelGroup: &illumioapi.LabelGroup{Href: lg.Href}})
+			hrefs = append(hrefs, lg.Href)
+			continue
+		}
+		label, exists := pce.Labels[key+value]
+		if !exists {
+			return nil, "", fmt.Errorf("%s:%s does not exist as a label", key, value)
+		}
+		scope = append(scope, illumioapi.Scopes{Label: &illumioapi.Label{Href: label.Href}})
+		hrefs = append(hrefs, label.Href)
+	}
+	return scope, scopeKey(hrefs), nil
+}
+
+// permissionScopeKey returns the normalized scope key of an existing permission
+func permissionScopeKey(p illumioapi.Permission) string {
+	hrefs := []string{}
+	for _, s := range illumioapi.PtrToVal(p.Scope) {
+		if s.Label != nil {
+			hrefs = append(hrefs, s.Label.Href)
+		}
+		if s.LabelGroup != nil {
+			hrefs = append(hrefs, s.LabelGroup.Href)
+		}
+	}
+	return scopeKey(hrefs)
+}
+
+// scopeKey sorts and dedupes the hrefs so the order of the scope doesn't matter
+func scopeKey(hrefs []string) string {
+	unique := make(map[string]bool)
+	keys := []string{}
+	for _, h := range hrefs {
+		if !unique[h] {
+			unique[h] = true
+			keys = append(keys, h)
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// scopeString returns the scope in the permissions-export format
+func scopeString(pce illumioapi.PCE, scope []illumioapi.Scopes) string {
+	entries := []string{}
+	for _, s := range scope {
+		if s.Label != nil {
+			label := pce.Labels[s.Label.Href]
+			entries = append(entries, fmt.Sprintf("%s:%s", label.Key, label.Value))
+		}
+		if s.LabelGroup != nil {
+			labelGroup := pce.LabelGroups[s.LabelGroup.Href]
+			entries = append(entries, fmt.Sprintf("%s:%s-lg", labelGroup.Key, labelGroup.Name))
+		}
+	}
+	return strings.Join(entries, "; ")
+}
+
+// effectiveScope returns the labels a scope grants access to by key with label groups expanded.
+// Values within a key are ORed and keys are ANDed.
+func effectiveScope(pce illumioapi.PCE, scope []illumioapi.Scopes) string {
+	if len(scope) == 0 {
+		return "all"
+	}
+	values := make(map[string]map[string]bool)
+	add := func(href string) {
+		label := pce.Labels[href]
+		if values[label.Key] == nil {
+			values[label.Key] = make(map[string]bool)
+		}
+		values[label.Key][label.Value] = true
+	}
+	for _, s := range scope {
+		if s.Label != nil {
+			add(s.Label.Href)
+		}
+		if s.LabelGroup != nil {
+			for _, href := range pce.ExpandLabelGroup(s.LabelGroup.Href) {
+				add(href)
+			}
+		}
+	}
+
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := []string{}
+	for _, k := range keys {
+		v := []string{}
+		for value := range values[k] {
+			v = append(v, value)
+		}
+		sort.Strings(v)
+		entries = append(entries, fmt.Sprintf("%s: %s", k, strings.Join(v, ", ")))
+	}
+	return strings.Join(entries, "; ")
+}
+
+// roleName returns the last segment of a role href
+func roleName(href string) string {
+	s := strings.Split(href, "/")
+	return s[len(s)-1]
+}
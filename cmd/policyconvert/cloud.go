@@ -0,0 +1,394 @@
+package policyconvert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/brian1917/workloader/cmd/awslabel"
+)
+
+// instance is a cloud vm with the same hostname and tags the cloud label commands use
+type instance struct {
+	id       string
+	hostname string
+	tags     map[string]string
+}
+
+// cloudRule is a security group, nsg, or firewall rule normalized across the clouds
+type cloudRule struct {
+	group     string
+	name      string
+	egress    bool
+	deny      bool
+	priority  string
+	protocol  string
+	ports     []string
+	cidrs     []string
+	peers     []instance
+	targets   []instance
+	skipped   []string
+	reviewMsg []string
+}
+
+// readJSON unmarshals the json file into v
+func readJSON(file string, v interface{}) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s - %s", file, err)
+	}
+	return nil
+}
+
+// normalizeProtocol returns tcp, udp, icmp, icmpv6, or all for the cloud protocol names and numbers
+func normalizeProtocol(p string) string {
+	switch strings.ToLower(p) {
+	case "-1", "*", "all":
+		return "all"
+	case "tcp", "6":
+		return "tcp"
+	case "udp", "17":
+		return "udp"
+	case "icmp", "1":
+		return "icmp"
+	case "icmpv6", "58":
+		return "icmpv6"
+	}
+	return strings.ToLower(p)
+}
+
+// ******************** AWS ********************
+
+// awsRules converts the output of aws ec2 describe-security-groups. The instances are the output of aws ec2 describe-instances.
+func awsRules(ruleFiles []string, instanceFile string) ([]cloudRule, []instance, error) {
+	var reservations awslabel.AwsCLIResponse
+	if err := readJSON(instanceFile, &reservations); err != nil {
+		return nil, nil, err
+	}
+
+	// Same hostname and metadata as aws-label
+	instances := []instance{}
+	members := make(map[string][]instance)
+	for _, r := range reservations.Reservations {
+		for _, ec2Instance := range r.Instance {
+			inst := instance{id: aws.StringValue(ec2Instance.InstanceId), tags: make(map[string]string)}
+			if ec2Instance.Placement != nil && ec2Instance.Placement.AvailabilityZone != nil {
+				az := *ec2Instance.Placement.AvailabilityZone
+				inst.tags["availability_zone"] = az
+				inst.tags["region"] = az[0 : len(az)-1]
+			}
+			inst.tags["subnet_id"] = aws.StringValue(ec2Instance.SubnetId)
+			inst.tags["vpc_id"] = aws.StringValue(ec2Instance.VpcId)
+			for _, tag := range ec2Instance.Tags {
+				inst.tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			inst.hostname = inst.tags["Name"]
+			if inst.hostname == "" {
+				inst.hostname = inst.id
+			}
+			instances = append(instances, inst)
+			for _, sg := range ec2Instance.SecurityGroups {
+				members[aws.StringValue(sg.GroupId)] = append(members[aws.StringValue(sg.GroupId)], inst)
+			}
+		}
+	}
+
+	rules := []cloudRule{}
+	for _, file := range ruleFiles {
+		var sgs ec2.DescribeSecurityGroupsOutput
+		if err := readJSON(file, &sgs); err != nil {
+			return nil, nil, err
+		}
+		for _, sg := range sgs.SecurityGroups {
+			group := fmt.Sprintf("%s (%s)", aws.StringValue(sg.GroupName), aws.StringValue(sg.GroupId))
+			for direction, permissions := range [][]*ec2.IpPermission{sg.IpPermissions, sg.IpPermissionsEgress} {
+				for i, p := range permissions {
+					rule := cloudRule{group: group, name: strconv.Itoa(i + 1), egress: direction == 1, protocol: normalizeProtocol(aws.StringValue(p.IpProtocol)), targets: members[aws.StringValue(sg.GroupId)]}
+					if rule.protocol == "tcp" || rule.protocol == "udp" {
+						from, to := aws.Int64Value(p.FromPort), aws.Int64Value(p.ToPort)
+						if from == to {
+							rule.ports = []string{strconv.FormatInt(from, 10)}
+						} else if !(from <= 0 && (to <= 0 || to == 65535)) {
+							rule.ports = []string{fmt.Sprintf("%d-%d", from, to)}
+						}
+					}
+					for _, r := range p.IpRanges {
+						rule.cidrs = append(rule.cidrs, aws.StringValue(r.CidrIp))
+					}
+					for _, r := range p.Ipv6Ranges {
+						rule.cidrs = append(rule.cidrs, aws.StringValue(r.CidrIpv6))
+					}
+					for _, pl := range p.PrefixListIds {
+						rule.skipped = append(rule.skipped, fmt.Sprintf("prefix list %s is not supported", aws.StringValue(pl.PrefixListId)))
+					}
+					for _, pair := range p.UserIdGroupPairs {
+						peers, ok := members[aws.StringValue(pair.GroupId)]
+						if !ok {
+							rule.skipped = append(rule.skipped, fmt.Sprintf("referenced security group %s has no instances", aws.StringValue(pair.GroupId)))
+						}
+						rule.peers = append(rule.peers, peers...)
+					}
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+	return rules, instances, nil
+}
+
+// ******************** Azure ********************
+
+// azureNSG is an nsg from az network nsg list
+type azureNSG struct {
+	ID                string          `json:"id"`
+	Name              string          `json:"name"`
+	SecurityRules     []azureRule     `json:"securityRules"`
+	NetworkInterfaces []azureResource `json:"networkInterfaces"`
+	Subnets           []azureResource `json:"subnets"`
+}
+
+type azureRule struct {
+	Name                                 string          `json:"name"`
+	Access                               string          `json:"access"`
+	Direction                            string          `json:"direction"`
+	Priority                             int             `json:"priority"`
+	Protocol                             string          `json:"protocol"`
+	SourceAddressPrefix                  string          `json:"sourceAddressPrefix"`
+	SourceAddressPrefixes                []string        `json:"sourceAddressPrefixes"`
+	DestinationAddressPrefix             string          `json:"destinationAddressPrefix"`
+	DestinationAddressPrefixes           []string        `json:"destinationAddressPrefixes"`
+	DestinationPortRange                 string          `json:"destinationPortRange"`
+	DestinationPortRanges                []string        `json:"destinationPortRanges"`
+	SourceApplicationSecurityGroups      []azureResource `json:"sourceApplicationSecurityGroups"`
+	DestinationApplicationSecurityGroups []azureResource `json:"destinationApplicationSecurityGroups"`
+}
+
+type azureResource struct {
+	ID string `json:"id"`
+}
+
+// azureVM is a vm from az vm list with the network interfaces for nsg membership
+type azureVM struct {
+	Name           string            `json:"name"`
+	Tags           map[string]string `json:"tags"`
+	NetworkProfile struct {
+		NetworkInterfaces []azureResource `json:"networkInterfaces"`
+	} `json:"networkProfile"`
+}
+
+// azureGroup returns the nsg name followed by the resource group in parentheses so nsgs with the same name in different resource groups are different groups
+func azureGroup(nsg azureNSG) string {
+	parts := strings.Split(nsg.ID, "/")
+	for i := range parts {
+		if strings.EqualFold(parts[i], "resourceGroups") && i+1 < len(parts) {
+			return fmt.Sprintf("%s (%s)", nsg.Name, parts[i+1])
+		}
+	}
+	return nsg.Name
+}
+
+// azureRules converts the output of az network nsg list. The instances are the output of az vm list.
+func azureRules(ruleFiles []string, instanceFile string) ([]cloudRule, []instance, error) {
+	var vms []azureVM
+	if err := readJSON(instanceFile, &vms); err != nil {
+		return nil, nil, err
+	}
+
+	// Same hostname as azure-label
+	instances := []instance{}
+	nicMap := make(map[string]instance)
+	for _, vm := range vms {
+		inst := instance{id: vm.Name, hostname: vm.Name, tags: vm.Tags}
+		instances = append(instances, inst)
+		for _, nic := range vm.NetworkProfile.NetworkInterfaces {
+			nicMap[strings.ToLower(nic.ID)] = inst
+		}
+	}
+
+	rules := []cloudRule{}
+	for _, file := range ruleFiles {
+		var nsgs []azureNSG
+		if err := readJSON(file, &nsgs); err != nil {
+			return nil, nil, err
+		}
+		for _, nsg := range nsgs {
+			targets := []instance{}
+			for _, nic := range nsg.NetworkInterfaces {
+				if inst, ok := nicMap[strings.ToLower(nic.ID)]; ok {
+					targets = append(targets, inst)
+				}
+			}
+			for _, r := range nsg.SecurityRules {
+				rule := cloudRule{group: azureGroup(nsg), name: r.Name, egress: strings.EqualFold(r.Direction, "outbound"), deny: strings.EqualFold(r.Access, "deny"), priority: strconv.Itoa(r.Priority), protocol: normalizeProtocol(r.Protocol), targets: targets}
+				if len(nsg.Subnets) > 0 {
+					rule.reviewMsg = append(rule.reviewMsg, "nsg is associated to subnets. only vms with the nsg on their network interface are used.")
+				}
+				for _, p := range append([]string{r.DestinationPortRange}, r.DestinationPortRanges...) {
+					if p != "" && p != "*" {
+						rule.ports = append(rule.ports, p)
+					}
+				}
+				peerPrefixes, peerASGs := append([]string{r.SourceAddressPrefix}, r.SourceAddressPrefixes...), r.SourceApplicationSecurityGroups
+				if rule.egress {
+					peerPrefixes, peerASGs = append([]string{r.DestinationAddressPrefix}, r.DestinationAddressPrefixes...), r.DestinationApplicationSecurityGroups
+				}
+				for _, p := range peerPrefixes {
+					switch {
+					case p == "":
+					case p == "*" || strings.EqualFold(p, "internet"):
+						rule.cidrs = append(rule.cidrs, "0.0.0.0/0")
+					case strings.ContainsAny(p, ".:"):
+						rule.cidrs = append(rule.cidrs, p)
+					default:
+						rule.skipped = append(rule.skipped, fmt.Sprintf("service tag %s is not supported", p))
+					}
+				}
+				for _, asg := range peerASGs {
+					rule.skipped = append(rule.skipped, fmt.Sprintf("application security group %s is not supported", path.Base(asg.ID)))
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, instances, nil
+}
+
+// ******************** GCP ********************
+
+// gcpFirewall is a rule from gcloud compute firewall-rules list --format=json
+type gcpFirewall struct {
+	Name                  string       `json:"name"`
+	Network               string       `json:"network"`
+	Direction             string       `json:"direction"`
+	Priority              int          `json:"priority"`
+	Disabled              bool         `json:"disabled"`
+	SourceRanges          []string     `json:"sourceRanges"`
+	DestinationRanges     []string     `json:"destinationRanges"`
+	SourceTags            []string     `json:"sourceTags"`
+	TargetTags            []string     `json:"targetTags"`
+	SourceServiceAccounts []string     `json:"sourceServiceAccounts"`
+	TargetServiceAccounts []string     `json:"targetServiceAccounts"`
+	Allowed               []gcpAllowed `json:"allowed"`
+	Denied                []gcpAllowed `json:"denied"`
+}
+
+type gcpAllowed struct {
+	IPProtocol string   `json:"IPProtocol"`
+	Ports      []string `json:"ports"`
+}
+
+// gcpInstance is an instance from gcloud compute instances list --format=json with the network tags and service accounts
+type gcpInstance struct {
+	Name   string            `json:"name"`
+	ID     string            `json:"id"`
+	Labels map[string]string `json:"labels"`
+	Tags   struct {
+		Items []string `json:"items"`
+	} `json:"tags"`
+	NetworkInterfaces []struct {
+		Network string `json:"network"`
+	} `json:"networkInterfaces"`
+	ServiceAccounts []struct {
+		Email string `json:"email"`
+	} `json:"serviceAccounts"`
+}
+
+// gcpNetwork returns the network name followed by the project in parentheses so networks with the same name in different projects are different groups
+func gcpNetwork(network string) string {
+	parts := strings.Split(network, "/")
+	for i := range parts {
+		if parts[i] == "projects" && i+1 < len(parts) {
+			return fmt.Sprintf("%s (%s)", path.Base(network), parts[i+1])
+		}
+	}
+	return path.Base(network)
+}
+
+// gcpRules converts the output of gcloud compute firewall-rules list. The instances are the output of gcloud compute instances list.
+func gcpRules(ruleFiles []string, instanceFile string) ([]cloudRule, []instance, error) {
+	var gcpInstances []gcpInstance
+	if err := readJSON(instanceFile, &gcpInstances); err != nil {
+		return nil, nil, err
+	}
+
+	// Same hostname as gcp-label
+	instances := []instance{}
+	for _, g := range gcpInstances {
+		inst := instance{id: g.ID, hostname: g.Labels["Name"], tags: g.Labels}
+		if inst.hostname == "" {
+			inst.hostname = g.Name
+		}
+		instances = append(instances, inst)
+	}
+
+	// match returns the instances in the network with any of the tags or service accounts. No tags or service accounts is all instances in the network.
+	match := func(network string, tags, serviceAccounts []string) []instance {
+		matches := []instance{}
+		for i, g := range gcpInstances {
+			inNetwork := false
+			for _, n := range g.NetworkInterfaces {
+				if gcpNetwork(n.Network) == gcpNetwork(network) {
+					inNetwork = true
+				}
+			}
+			if !inNetwork {
+				continue
+			}
+			matched := len(tags) == 0 && len(serviceAccounts) == 0
+			for _, t := range g.Tags.Items {
+				matched = matched || containsString(tags, t)
+			}
+			for _, sa := range g.ServiceAccounts {
+				matched = matched || containsString(serviceAccounts, sa.Email)
+			}
+			if matched {
+				matches = append(matches, instances[i])
+			}
+		}
+		return matches
+	}
+
+	rules := []cloudRule{}
+	for _, file := range ruleFiles {
+		var firewalls []gcpFirewall
+		if err := readJSON(file, &firewalls); err != nil {
+			return nil, nil, err
+		}
+		for _, fw := range firewalls {
+			base := cloudRule{group: gcpNetwork(fw.Network), name: fw.Name, egress: strings.EqualFold(fw.Direction, "egress"), priority: strconv.Itoa(fw.Priority), targets: match(fw.Network, fw.TargetTags, fw.TargetServiceAccounts)}
+			if fw.Disabled {
+				base.skipped = append(base.skipped, "firewall rule is disabled")
+			}
+			if base.egress {
+				base.cidrs = fw.DestinationRanges
+			} else {
+				base.cidrs = fw.SourceRanges
+				if len(fw.SourceTags) > 0 || len(fw.SourceServiceAccounts) > 0 {
+					base.peers = match(fw.Network, fw.SourceTags, fw.SourceServiceAccounts)
+				}
+			}
+
+			// Each protocol is a rule since the ports are per protocol
+			entries, deny := fw.Allowed, false
+			if len(fw.Denied) > 0 {
+				entries, deny = fw.Denied, true
+			}
+			for _, e := range entries {
+				rule := base
+				rule.deny = deny
+				rule.protocol = normalizeProtocol(e.IPProtocol)
+				rule.ports = e.Ports
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, instances, nil
+}
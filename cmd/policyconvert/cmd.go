@@ -0,0 +1,335 @@
+package policyconvert
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/iplimport"
+	"github.com/brian1917/workloader/cmd/ruleexport"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// anyIPList is the default ip list in the PCE used for 0.0.0.0/0
+const anyIPList = "Any (0.0.0.0/0 and ::/0)"
+
+var source, instanceFile, labelMapping, outputFileName string
+
+func init() {
+	PolicyConvertCmd.Flags().StringVarP(&source, "source", "s", "", "required cloud of the json exports. values can be aws, azure, or gcp.")
+	PolicyConvertCmd.Flags().StringVarP(&instanceFile, "instances", "i", "", "required json export of the cloud vms. see help for the cli command for each cloud.")
+	PolicyConvertCmd.Flags().StringVarP(&labelMapping, "mapping", "m", "", "required mappings of cloud tags to illumio labels. the format is the same as aws-label, azure-label, and gcp-label: a comma-separated list of cloud-tag:illumio-label.")
+	PolicyConvertCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the rule-import output file. default is current location with a timestamped filename. the other files are the same name with -rulesets, -iplists, -members, and -flagged appended.")
+
+	PolicyConvertCmd.MarkFlagRequired("source")
+	PolicyConvertCmd.MarkFlagRequired("instances")
+	PolicyConvertCmd.MarkFlagRequired("mapping")
+	PolicyConvertCmd.Flags().SortFlags = false
+}
+
+// PolicyConvertCmd converts cloud security groups to rule-import files
+var PolicyConvertCmd = &cobra.Command{
+	Use:   "policy-convert [cloud rule json files]",
+	Short: "Convert AWS security groups, Azure NSGs, or GCP firewall rules to ruleset-import, rule-import, and ipl-import files.",
+	Long: `
+Convert AWS security groups, Azure NSGs, or GCP firewall rules to ruleset-import, rule-import, and ipl-import files.
+
+The rules and vms are read from saved json exports of the cloud cli:
+- aws: aws ec2 describe-security-groups and aws ec2 describe-instances
+- azure: az network nsg list and az vm list
+- gcp: gcloud compute firewall-rules list --format=json and gcloud compute instances list --format=json
+
+The member vms of each rule are converted to illumio labels using the --mapping in the same format and with the same hostnames as aws-label, azure-label, and gcp-label. Run those commands to label the workloads before importing the rules. Each distinct label set is a rule. CIDR sources and destinations are ip lists in the ipl-import file. 0.0.0.0/0 uses the Any (0.0.0.0/0 and ::/0) ip list.
+
+A global ruleset is created for each aws security group, azure nsg, or gcp network. The ruleset name includes the aws group id, azure resource group, or gcp project (e.g., aws-default-sg-0123456789abcdef0) so groups with the same name are not combined. Inbound rules use the members as the destination. Outbound rules use the members as the source.
+
+The flagged file lists rules that cannot be expressed and are skipped (prefix lists, service tags, application security groups, protocols other than tcp and udp, and rules without member vms) and rules to review (deny rules, since illumio deny rules are evaluated before allow rules regardless of cloud priority, and vms left out because they have no mapped labels). The members file maps each vm to its labels and pce workload.
+
+Import the files in order: ipl-import, ruleset-import, then rule-import. For kubernetes NetworkPolicy objects, use k8s-import.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) == 0 {
+			fmt.Println("Command requires at least 1 argument for the cloud rule json files. See usage help.")
+			os.Exit(0)
+		}
+
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		policyConvert(pce, args)
+	},
+}
+
+// converter holds the state for building the import files
+type converter struct {
+	mapping       map[string]string
+	ipLists       map[string]string
+	ipListRows    [][]string
+	ruleData      [][]string
+	flaggedData   [][]string
+	rulesetGroups map[string]bool
+}
+
+func policyConvert(pce illumioapi.PCE, ruleFiles []string) {
+
+	// Parse the mapping the same as the cloud label commands. The illumio label is the key.
+	c := converter{mapping: make(map[string]string), ipLists: make(map[string]string), rulesetGroups: make(map[string]bool)}
+	for _, lm := range strings.Split(strings.Replace(labelMapping, ", ", ",", -1), ",") {
+		s := strings.Split(lm, ":")
+		if len(s) != 2 {
+			utils.LogError(fmt.Sprintf("%s is an invalid mapping", lm))
+		}
+		c.mapping[s[1]] = s[0]
+	}
+
+	// Parse the cloud exports
+	var rules []cloudRule
+	var instances []instance
+	var err error
+	source = strings.ToLower(source)
+	switch source {
+	case "aws":
+		rules, instances, err = awsRules(ruleFiles, instanceFile)
+	case "azure":
+		rules, instances, err = azureRules(ruleFiles, instanceFile)
+	case "gcp":
+		rules, instances, err = gcpRules(ruleFiles, instanceFile)
+	default:
+		utils.LogError("source must be aws, azure, or gcp")
+	}
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("parsed %d %s rules and %d vms", len(rules), source, len(instances)), true)
+
+	// Get the workloads to map the vms
+	apiResps, err := pce.Load(illumioapi.LoadInput{Workloads: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	memberData := [][]string{{"instance_id", "hostname", "labels", "pce_workload_href"}}
+	for _, inst := range instances {
+		href := ""
+		if wkld, ok := pce.Workloads[inst.hostname]; ok {
+			href = wkld.Href
+		} else {
+			utils.LogWarningf(false, "%s (%s) is not a workload in the pce", inst.hostname, inst.id)
+		}
+		memberData = append(memberData, []string{inst.id, inst.hostname, c.labelSet(inst), href})
+	}
+
+	// Convert the rules
+	c.ruleData = [][]string{{ruleexport.HeaderRulesetName, ruleexport.HeaderRuleEnabled, ruleexport.HeaderRuleType, ruleexport.HeaderUnscopedConsumers, ruleexport.HeaderSrcAllWorkloads, ruleexport.HeaderSrcLabels, ruleexport.HeaderSrcIplists, ruleexport.HeaderDstLabels, ruleexport.HeaderDstIplists, ruleexport.HeaderServices, ruleexport.HeaderSrcResolveLabelsAs, ruleexport.HeaderDstResolveLabelsAs, ruleexport.HeaderRuleDescription}}
+	c.flaggedData = [][]string{{"group", "rule", "direction", "status", "reason"}}
+	for _, rule := range rules {
+		c.convert(rule)
+	}
+
+	// Write the output
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-policy-convert-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	baseName := strings.TrimSuffix(outputFileName, ".csv")
+	if len(c.ruleData) > 1 {
+		rulesetData := [][]string{{"name", "enabled", "description", "scope"}}
+		rulesetGroups := make(map[string]string)
+		for _, group := range sortedKeys(c.rulesetGroups) {
+			name := rulesetName(group)
+			if other, ok := rulesetGroups[name]; ok {
+				utils.LogErrorf("%s and %s have the same ruleset name %s", other, group, name)
+			}
+			rulesetGroups[name] = group
+			rulesetData = append(rulesetData, []string{name, "true", fmt.Sprintf("converted from %s %s by workloader policy-convert", source, group), ""})
+		}
+		utils.WriteOutput(rulesetData, nil, baseName+"-rulesets.csv")
+		utils.LogInfo(fmt.Sprintf("%d rulesets exported to %s", len(rulesetData)-1, baseName+"-rulesets.csv"), true)
+		utils.WriteOutput(c.ruleData, nil, outputFileName)
+		utils.LogInfo(fmt.Sprintf("%d rules exported to %s", len(c.ruleData)-1, outputFileName), true)
+	} else {
+		utils.LogInfo("no rules could be converted", true)
+	}
+	if len(c.ipListRows) > 0 {
+		utils.WriteOutput(append([][]string{{iplimport.HeaderName, iplimport.HeaderDescription, iplimport.HeaderInclude}}, c.ipListRows...), nil, baseName+"-iplists.csv")
+		utils.LogInfo(fmt.Sprintf("%d ip lists exported to %s", len(c.ipListRows), baseName+"-iplists.csv"), true)
+	}
+	if len(memberData) > 1 {
+		utils.WriteOutput(memberData, nil, baseName+"-members.csv")
+		utils.LogInfo(fmt.Sprintf("%d vms exported to %s", len(memberData)-1, baseName+"-members.csv"), true)
+	}
+	if len(c.flaggedData) > 1 {
+		utils.WriteOutput(c.flaggedData, nil, baseName+"-flagged.csv")
+		utils.LogWarningf(true, "%d rules flagged in %s", len(c.flaggedData)-1, baseName+"-flagged.csv")
+	}
+}
+
+// convert adds the rule-import rows for the cloud rule or flags it
+func (c *converter) convert(rule cloudRule) {
+	direction := "inbound"
+	if rule.egress {
+		direction = "outbound"
+	}
+	flag := func(status, reason string) {
+		c.flaggedData = append(c.flaggedData, []string{rule.group, rule.name, direction, status, reason})
+	}
+
+	// Rules that cannot be expressed
+	reasons := append([]string{}, rule.skipped...)
+	svcs := services(rule)
+	if svcs == "" {
+		reasons = append(reasons, fmt.Sprintf("%s protocol is not supported", rule.protocol))
+	}
+	targets, unmapped := c.labelSets(rule.targets)
+	peers, unmappedPeers := c.labelSets(rule.peers)
+	unmapped = append(unmapped, unmappedPeers...)
+	if len(targets) == 0 {
+		reasons = append(reasons, "no member vms with mapped labels")
+	}
+	if len(rule.cidrs) == 0 && len(peers) == 0 {
+		reasons = append(reasons, "no supported sources or destinations")
+	}
+	if len(reasons) > 0 {
+		flag("skipped", strings.Join(reasons, "; "))
+		return
+	}
+
+	// Rules to review
+	ruleType := "allow"
+	if rule.deny {
+		ruleType = "deny"
+		flag("review", fmt.Sprintf("deny rule with priority %s. illumio deny rules are evaluated before allow rules.", rule.priority))
+	}
+	for _, msg := range rule.reviewMsg {
+		flag("review", msg)
+	}
+	if len(unmapped) > 0 {
+		flag("review", fmt.Sprintf("vms without mapped labels are not in the rule: %s", strings.Join(unmapped, "; ")))
+	}
+
+	// The members are the destination for inbound and the source for outbound
+	ipList := c.ipList(rule)
+	desc := fmt.Sprintf("%s %s rule %s %s", source, rule.group, rule.name, direction)
+	c.rulesetGroups[rule.group] = true
+	for _, target := range targets {
+		if ipList != "" {
+			if rule.egress {
+				c.addRow(rule.group, ruleType, target, "", "", ipList, svcs, desc)
+			} else {
+				c.addRow(rule.group, ruleType, "", ipList, target, "", svcs, desc)
+			}
+		}
+		for _, peer := range peers {
+			if rule.egress {
+				c.addRow(rule.group, ruleType, target, "", peer, "", svcs, desc)
+			} else {
+				c.addRow(rule.group, ruleType, peer, "", target, "", svcs, desc)
+			}
+		}
+	}
+}
+
+func (c *converter) addRow(group, ruleType, srcLabels, srcIPList, dstLabels, dstIPList, svcs, desc string) {
+	c.ruleData = append(c.ruleData, []string{rulesetName(group), "true", ruleType, "true", "false", srcLabels, srcIPList, dstLabels, dstIPList, svcs, "workloads", "workloads", desc})
+}
+
+// labelSet returns the mapped labels of the vm as sorted key:value pairs separated by semicolons
+func (c *converter) labelSet(inst instance) string {
+	pairs := []string{}
+	for illumioKey, cloudKey := range c.mapping {
+		if inst.tags[cloudKey] != "" {
+			pairs = append(pairs, illumioKey+":"+inst.tags[cloudKey])
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// labelSets returns the distinct label sets of the vms and the hostnames of vms without mapped labels
+func (c *converter) labelSets(instances []instance) (labelSets, unmapped []string) {
+	sets := make(map[string]bool)
+	for _, inst := range instances {
+		set := c.labelSet(inst)
+		if set == "" {
+			unmapped = append(unmapped, inst.hostname)
+			continue
+		}
+		sets[set] = true
+	}
+	return sortedKeys(sets), unmapped
+}
+
+// ipList returns the ip list name for the cidrs of the rule. Rules with the same cidrs share an ip list.
+func (c *converter) ipList(rule cloudRule) string {
+	if len(rule.cidrs) == 0 {
+		return ""
+	}
+	cidrs := append([]string{}, rule.cidrs...)
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		if cidr == "0.0.0.0/0" || cidr == "::/0" {
+			return anyIPList
+		}
+	}
+	key := strings.Join(cidrs, ";")
+	if name, ok := c.ipLists[key]; ok {
+		return name
+	}
+	name := fmt.Sprintf("%s-%d", rulesetName(rule.group), len(c.ipListRows)+1)
+	c.ipLists[key] = name
+	c.ipListRows = append(c.ipListRows, []string{name, fmt.Sprintf("converted from %s %s rule %s by workloader policy-convert", source, rule.group, rule.name), key})
+	return name
+}
+
+// services returns the rule-import services for the rule. Blank means the protocol is not supported.
+func services(rule cloudRule) string {
+	switch rule.protocol {
+	case "all":
+		return "All Services"
+	case "tcp", "udp":
+	default:
+		return ""
+	}
+	if len(rule.ports) == 0 {
+		return "1-65535 " + rule.protocol
+	}
+	svcs := []string{}
+	for _, p := range rule.ports {
+		if s := strings.Split(p, "-"); len(s) == 2 && s[0] == s[1] {
+			p = s[0]
+		}
+		svcs = append(svcs, p+" "+rule.protocol)
+	}
+	return strings.Join(svcs, ";")
+}
+
+// rulesetName returns the ruleset for the group. Groups are the name followed by the aws group id, azure resource group, or gcp project
+// in parentheses. The parentheses are kept in the name as a dash so groups with the same name are different rulesets.
+func rulesetName(group string) string {
+	return fmt.Sprintf("%s-%s", source, strings.NewReplacer(" (", "-", ")", "").Replace(group))
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(s []string, value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -8,12 +8,13 @@ import (
 
 	"github.com/brian1917/illumioapi/v2"
 
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 )
 
 // Global variables
-var wkldInputFile, labelInputFile, outputFileName, queryDuration, exclHrefSrcFile, ignorePorts, resultsFile string
+var wkldInputFile, labelInputFile, outputFileName, queryDuration, exclHrefSrcFile, ignorePorts, resultsFile, fromStore string
 var maxFlows int
 var pce illumioapi.PCE
 var err error
@@ -27,6 +28,7 @@ func init() {
 	PortUsageCmd.Flags().StringVarP(&exclHrefSrcFile, "excl-src-file", "x", "", "file with hrefs on separate lines to be used in as a consumer exclude. can be a csv with hrefs in first column. no headers")
 	PortUsageCmd.Flags().StringVarP(&ignorePorts, "ignore-ports", "p", "49152-65535", "comma-separated list of port numbers or ranges to exclude.")
 	PortUsageCmd.Flags().StringVarP(&resultsFile, "results", "r", "", "fileoutput from step 1 to get the traffic results.")
+	PortUsageCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory. step 2 is not needed.")
 	PortUsageCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	PortUsageCmd.Flags().SortFlags = false
@@ -45,6 +47,8 @@ The command is run in two step:
 
 Step 2 must be run within 24 hours of step 1 to ensure explorer queries do not expire.
 
+Use --from-store to count flows from a local traffic store populated by traffic-sync instead of creating async explorer queries. The flows are counted in one step and the async_query_status is from-store. The max-flows flag does not apply to the store.
+
 If no input file or label file are used all workloads are processed. The header row should be label keys. The workload query uses an AND operator for entries on the same row and an OR operator for the separate rows. An example label file is below:
 +------+-----+-----+-----+----+
 | role | app | env | loc | bu |
@@ -131,6 +135,16 @@ func unusedPorts() {
 		utils.LogError(err.Error())
 	}
 
+	// Load the traffic store once for all the workloads
+	var flows trafficsync.Flows
+	if fromStore != "" {
+		flows, err = trafficsync.Load(fromStore, startTime, endTime)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("loaded %d flows from traffic store %s", len(flows), fromStore), true)
+	}
+
 	// Create slice for target workloads
 	wklds := []illumioapi.Workload{}
 
@@ -227,6 +241,21 @@ func unusedPorts() {
 				continue
 			}
 
+			// Count the flows in the traffic store
+			if fromStore != "" {
+				count := len(flows.Filter(trafficsync.Filter{
+					StartTime:            startTime,
+					EndTime:              endTime,
+					SourcesExclude:       exclSources,
+					DestinationsInclude:  [][]string{{w.Href}},
+					PortProtoInclude:     [][2]int{{servicePort.Port, servicePort.Protocol}},
+					TransmissionExcludes: []string{"broadcast", "multicast"},
+				}))
+				utils.LogInfo(fmt.Sprintf("workload %s - %s - port %d of %d - %d %s - %d flows", illumioapi.PtrToVal(w.Hostname), w.Href, serviceCounter+1, len(illumioapi.PtrToVal(wkld.Services.OpenServicePorts)), servicePort.Port, illumioapi.ProtocolList()[servicePort.Protocol], count), true)
+				utils.WriteLineOutput([]string{illumioapi.PtrToVal(w.Hostname), w.Href, strconv.Itoa(servicePort.Port), illumioapi.ProtocolList()[servicePort.Protocol], "", "from-store", strconv.Itoa(count)}, outputFileName)
+				continue
+			}
+
 			tr := illumioapi.TrafficAnalysisRequest{
 				QueryName:                       illumioapi.Ptr(fmt.Sprintf("%s - %d %d", w.Href, servicePort.Port, servicePort.Protocol)),
 				Sources:                         &illumioapi.SrcOrDst{Exclude: sources},
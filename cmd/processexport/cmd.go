@@ -15,12 +15,13 @@ import (
 // Declare local global variables
 var pce ia.PCE
 var err error
-var hrefFile, labelFile, enforcementMode, outputFileName string
+var hrefFile, labelFile, enforcementMode, selectExpr, outputFileName string
 var single bool
 
 func init() {
 	ProcessExportCmd.Flags().StringVar(&labelFile, "label-file", "", "csv file with labels to filter query. the file should have 4 headers: role, app, env, and loc. The four columns in each row is an \"AND\" operation. Each row is an \"OR\" operation.")
 	ProcessExportCmd.Flags().StringVar(&hrefFile, "href-file", "", "csv file with hrefs.")
+	ProcessExportCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to filter workloads. can be combined with label-file or href-file. see description below.")
 	ProcessExportCmd.Flags().BoolVar(&single, "single", false, "only used with --host-file. gets hosts by individual api calls vs. getting all workloads and filtering after.")
 	ProcessExportCmd.Flags().StringVar(&enforcementMode, "enforcement-mode", "", "optionally specify an enforcement mode filter. acceptable values are idle, visibility_only, selective, and full. ignored if href file is provided")
 	ProcessExportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
@@ -49,6 +50,8 @@ This example queries all idle workloads that are
 - OR bos(loc) AND it (bu)
 - OR CRM (app)
 
+` + utils.SelectorHelp + `
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -69,6 +72,12 @@ func ExportProcesses(pce ia.PCE, outputFileName string) {
 		utils.LogError("invalid enforcement mode. must be blank, idle, visibility_only, selective, or full.")
 	}
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Get labels and label dimensions
 	apiResps, err := pce.Load(ia.LoadInput{LabelDimensions: true, Labels: true}, utils.UseMulti())
 	utils.LogMultiAPIRespV2(apiResps)
@@ -125,6 +134,9 @@ func ExportProcesses(pce ia.PCE, outputFileName string) {
 		}
 	}
 
+	// Filter with the selector
+	pce.WorkloadsSlice = selector.FilterV2(pce.WorkloadsSlice, pce.Labels)
+
 	// Process file name
 	if outputFileName == "" {
 		outputFileName = fmt.Sprintf("workloader-process-export-%s.csv", time.Now().Format("20060102_150405"))
@@ -17,6 +17,7 @@ import (
 	"github.com/brian1917/workloader/cmd/ccupdate"
 	"github.com/brian1917/workloader/cmd/checkversion"
 	"github.com/brian1917/workloader/cmd/compatibility"
+	"github.com/brian1917/workloader/cmd/containercluster"
 	"github.com/brian1917/workloader/cmd/containmentswitch"
 	"github.com/brian1917/workloader/cmd/cspiplist"
 	"github.com/brian1917/workloader/cmd/cwpexport"
@@ -27,6 +28,7 @@ import (
 	"github.com/brian1917/workloader/cmd/denyruleexport"
 	"github.com/brian1917/workloader/cmd/denyruleimport"
 	"github.com/brian1917/workloader/cmd/dupecheck"
+	"github.com/brian1917/workloader/cmd/enforcementplan"
 	"github.com/brian1917/workloader/cmd/extract"
 	"github.com/brian1917/workloader/cmd/findfqdn"
 	"github.com/brian1917/workloader/cmd/flowimport"
@@ -34,26 +36,33 @@ import (
 	"github.com/brian1917/workloader/cmd/getpairingkey"
 	"github.com/brian1917/workloader/cmd/hostparse"
 	"github.com/brian1917/workloader/cmd/increasevenupdaterate"
+	"github.com/brian1917/workloader/cmd/iplcompose"
 	"github.com/brian1917/workloader/cmd/iplexport"
 	"github.com/brian1917/workloader/cmd/iplimport"
 	"github.com/brian1917/workloader/cmd/iplreplace"
+	"github.com/brian1917/workloader/cmd/k8simport"
 	"github.com/brian1917/workloader/cmd/labeldimension"
 	"github.com/brian1917/workloader/cmd/labelexport"
 	"github.com/brian1917/workloader/cmd/labelgroupexport"
 	"github.com/brian1917/workloader/cmd/labelgroupimport"
 	"github.com/brian1917/workloader/cmd/labelimport"
+	"github.com/brian1917/workloader/cmd/labellint"
 	explorer "github.com/brian1917/workloader/cmd/legacy-explorer"
 	"github.com/brian1917/workloader/cmd/mislabel"
 	"github.com/brian1917/workloader/cmd/nen"
 	"github.com/brian1917/workloader/cmd/netscalersync"
 	"github.com/brian1917/workloader/cmd/nicexport"
 	"github.com/brian1917/workloader/cmd/nicmanage"
+	"github.com/brian1917/workloader/cmd/pairingbundle"
 	"github.com/brian1917/workloader/cmd/pairingprofileexport"
 	"github.com/brian1917/workloader/cmd/pcemgmt"
 	"github.com/brian1917/workloader/cmd/permissionsexport"
 	"github.com/brian1917/workloader/cmd/permissionsimport"
+	"github.com/brian1917/workloader/cmd/permissionssync"
+	"github.com/brian1917/workloader/cmd/policyconvert"
 	"github.com/brian1917/workloader/cmd/portusage"
 	"github.com/brian1917/workloader/cmd/processexport"
+	"github.com/brian1917/workloader/cmd/rulecoverage"
 	"github.com/brian1917/workloader/cmd/ruleexport"
 	"github.com/brian1917/workloader/cmd/ruleimport"
 	"github.com/brian1917/workloader/cmd/rulesetexport"
@@ -61,19 +70,24 @@ import (
 	"github.com/brian1917/workloader/cmd/secprincipalexport"
 	"github.com/brian1917/workloader/cmd/secprincipalimport"
 	"github.com/brian1917/workloader/cmd/servicefinder"
+	"github.com/brian1917/workloader/cmd/serviceinfer"
 	"github.com/brian1917/workloader/cmd/subnet"
 	"github.com/brian1917/workloader/cmd/svcexport"
 	"github.com/brian1917/workloader/cmd/svcimport"
 	"github.com/brian1917/workloader/cmd/templateimport"
 	"github.com/brian1917/workloader/cmd/templatelist"
 	"github.com/brian1917/workloader/cmd/traffic"
+	"github.com/brian1917/workloader/cmd/trafficgraph"
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/cmd/umwlcleanup"
 	"github.com/brian1917/workloader/cmd/unpair"
+	"github.com/brian1917/workloader/cmd/unusedobjects"
 	"github.com/brian1917/workloader/cmd/unusedumwl"
 	"github.com/brian1917/workloader/cmd/upgrade"
 	"github.com/brian1917/workloader/cmd/venexport"
 	"github.com/brian1917/workloader/cmd/venhealth"
 	"github.com/brian1917/workloader/cmd/venimport"
+	"github.com/brian1917/workloader/cmd/venreport"
 	"github.com/brian1917/workloader/cmd/virtualserviceexport"
 	"github.com/brian1917/workloader/cmd/vmsync"
 	"github.com/brian1917/workloader/cmd/wkldcleanup"
@@ -81,6 +95,7 @@ import (
 	"github.com/brian1917/workloader/cmd/wkldimport"
 	"github.com/brian1917/workloader/cmd/wkldiplmapping"
 	"github.com/brian1917/workloader/cmd/wkldlabel"
+	"github.com/brian1917/workloader/cmd/wkldreconcile"
 	"github.com/brian1917/workloader/cmd/wkldreplicate"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -159,10 +174,12 @@ func init() {
 	RootCmd.AddCommand(wkldexport.WkldExportCmd)
 	RootCmd.AddCommand(wkldimport.WkldImportCmd)
 	RootCmd.AddCommand(venexport.VenExportCmd)
+	RootCmd.AddCommand(venreport.VenReportCmd)
 	RootCmd.AddCommand(venimport.VenImportCmd)
 	RootCmd.AddCommand(iplexport.IplExportCmd)
 	RootCmd.AddCommand(iplimport.IplImportCmd)
 	RootCmd.AddCommand(iplreplace.IplReplaceCmd)
+	RootCmd.AddCommand(iplcompose.IplComposeCmd)
 	RootCmd.AddCommand(labelexport.LabelExportCmd)
 	RootCmd.AddCommand(labelimport.LabelImportCmd)
 	RootCmd.AddCommand(labelgroupexport.LabelGroupExportCmd)
@@ -177,12 +194,15 @@ func init() {
 	RootCmd.AddCommand(ruleimport.RuleImportCmd)
 	RootCmd.AddCommand(denyruleexport.DenyRuleExportCmd)
 	RootCmd.AddCommand(denyruleimport.DenyRuleImportCmd)
+	RootCmd.AddCommand(policyconvert.PolicyConvertCmd)
 	RootCmd.AddCommand(cwpexport.ContainerProfileExportCmd)
 	RootCmd.AddCommand(cwpimport.ContainerProfileImportCmd)
+	RootCmd.AddCommand(k8simport.K8sImportCmd)
 	RootCmd.AddCommand(adgroupexport.ADGroupExportCmd)
 	RootCmd.AddCommand(adgroupimport.AdGroupImportCmd)
 	RootCmd.AddCommand(permissionsexport.PermissionsExportCmd)
 	RootCmd.AddCommand(permissionsimport.PermissionsImportCmd)
+	RootCmd.AddCommand(permissionssync.PermissionsSyncCmd)
 	RootCmd.AddCommand(secprincipalexport.SecPrincipalExportCmd)
 	RootCmd.AddCommand(secprincipalimport.SecPrincipalImportCmd)
 	RootCmd.AddCommand(pairingprofileexport.PairingProfileExportCmd)
@@ -204,15 +224,20 @@ func init() {
 	RootCmd.AddCommand(nen.NENSWITCHCmd)
 	RootCmd.AddCommand(nen.NENACLCmd)
 	RootCmd.AddCommand(ccupdate.ContainerClusterUpdateCmd)
+	RootCmd.AddCommand(containercluster.ContainerClusterCreateCmd)
+	RootCmd.AddCommand(containercluster.ContainerClusterHealthCmd)
 	RootCmd.AddCommand(cspiplist.CspIplistCmd)
 
 	// Workload management
 	RootCmd.AddCommand(wkldcleanup.WkldCleanUpCmd)
+	RootCmd.AddCommand(wkldreconcile.WkldReconcileCmd)
 	RootCmd.AddCommand(compatibility.CompatibilityCmd)
 	RootCmd.AddCommand(upgrade.UpgradeCmd)
 	RootCmd.AddCommand(getpairingkey.GetPairingKey)
+	RootCmd.AddCommand(pairingbundle.PairingBundleCmd)
 	RootCmd.AddCommand(unpair.UnpairCmd)
 	RootCmd.AddCommand(deletehrefs.DeleteCmd)
+	RootCmd.AddCommand(unusedobjects.UnusedObjectsCmd)
 	RootCmd.AddCommand(umwlcleanup.UMWLCleanUpCmd)
 	RootCmd.AddCommand(nicmanage.NICManageCmd)
 	RootCmd.AddCommand(containmentswitch.ContainmentSwitchCmd)
@@ -222,6 +247,7 @@ func init() {
 
 	// Label management
 	RootCmd.AddCommand(deleteunusedlabels.LabelsDeleteUnusedCmd)
+	RootCmd.AddCommand(labellint.LabelLintCmd)
 
 	// Reporting
 	RootCmd.AddCommand(findfqdn.FindFQDNCmd)
@@ -231,13 +257,18 @@ func init() {
 	RootCmd.AddCommand(dupecheck.DupeCheckCmd)
 	RootCmd.AddCommand(appgroupflowsummary.AppGroupFlowSummaryCmd)
 	RootCmd.AddCommand(traffic.TrafficCmd)
+	RootCmd.AddCommand(trafficsync.TrafficSyncCmd)
+	RootCmd.AddCommand(trafficgraph.TrafficGraphCmd)
 	RootCmd.AddCommand(explorer.ExplorerCmd)
 	RootCmd.AddCommand(nicexport.NICExportCmd)
 	RootCmd.AddCommand(servicefinder.ServiceFinderCmd)
 	RootCmd.AddCommand(processexport.ProcessExportCmd)
+	RootCmd.AddCommand(serviceinfer.ServiceInferCmd)
 	RootCmd.AddCommand(wkldiplmapping.WkldIPLMappingCmd)
 	RootCmd.AddCommand(venhealth.VenHealthCmd)
 	RootCmd.AddCommand(unusedumwl.UnusedUmwlCmd)
+	RootCmd.AddCommand(rulecoverage.RuleCoverageCmd)
+	RootCmd.AddCommand(enforcementplan.EnforcementPlanCmd)
 
 	// Version Commands
 	RootCmd.AddCommand(versionCmd)
@@ -0,0 +1,259 @@
+package rulecoverage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var policyVersion, scope, start, end, outputFileName string
+var maxResults int
+var pce ia.PCE
+var err error
+
+func init() {
+	RuleCoverageCmd.Flags().StringVarP(&policyVersion, "policy-version", "p", "active", "policy version to evaluate flows against. must be active or draft.")
+	RuleCoverageCmd.Flags().StringVar(&scope, "scope", "", "semi-colon separated list of key:value labels to limit flows to a scope. flows with the scope as a source or destination are included. example: \"app:erp;env:prod\". default is all flows.")
+	RuleCoverageCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -88).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	RuleCoverageCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	RuleCoverageCmd.Flags().IntVarP(&maxResults, "max-results", "m", 200000, "max results in explorer. maximum value is 200000.")
+	RuleCoverageCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. the unused rules file is the same name with -unused-rules appended.")
+
+	RuleCoverageCmd.Flags().SortFlags = false
+}
+
+// RuleCoverageCmd evaluates traffic against rules
+var RuleCoverageCmd = &cobra.Command{
+	Use:   "rule-coverage",
+	Short: "Find flows not covered by any rule and rules with no matching flows.",
+	Long: `
+Find flows not covered by any rule and rules with no matching flows.
+
+Flows are retrieved from explorer once (twice if --scope is used - once with the scope as the source and once as the destination) and evaluated locally against the active or draft rules. No per-rule explorer queries are made.
+
+Two files are created:
+  1. Uncovered flows aggregated by source app group, destination app group, and service. Endpoints that are not workloads are shown by IP address.
+  2. Rules that match no flows. When --scope is used, only rules in rulesets that can apply to the scope are included.
+
+Rules are evaluated locally using labels, label groups, ip lists, workloads, all workloads, and services (including windows services and processes). Rules with virtual services, virtual servers, or ad groups cannot be fully evaluated and are noted in the unused rules output. Only enabled allow rules in enabled rulesets are evaluated.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		ruleCoverage()
+	},
+}
+
+// uncoveredKey is the aggregation of uncovered flows
+type uncoveredKey struct {
+	srcAppGroup string
+	dstAppGroup string
+	port        int
+	proto       int
+}
+
+// uncoveredValue holds the counts for an uncovered flow aggregation
+type uncoveredValue struct {
+	flows       int
+	connections int
+	decisions   map[string]bool
+}
+
+func ruleCoverage() {
+
+	// Validate the policy version
+	policyVersion = strings.ToLower(policyVersion)
+	if policyVersion != "active" && policyVersion != "draft" {
+		utils.LogError("policy-version must be active or draft")
+	}
+
+	// Load the PCE
+	utils.LogInfo("getting labels, label groups, ip lists, and services...", true)
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, LabelGroups: true, IPLists: true, Services: true, ProvisionStatus: policyVersion}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Get the rulesets
+	utils.LogInfo(fmt.Sprintf("getting %s rulesets...", policyVersion), true)
+	a, err := pce.GetRulesets(nil, policyVersion)
+	utils.LogAPIRespV2("GetRulesets", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	evaluator := NewEvaluator(&pce, pce.RuleSetsSlice)
+	utils.LogInfo(fmt.Sprintf("%d enabled allow rules to evaluate", len(evaluator.Rules)), true)
+
+	// Parse the scope
+	scopeLabels := make(map[string]string)
+	scopeHrefs := []string{}
+	if scope != "" {
+		for _, entry := range strings.Split(scope, ";") {
+			kv := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+			if len(kv) != 2 {
+				utils.LogError(fmt.Sprintf("invalid scope entry %s. format should be key:value", entry))
+			}
+			label, a, err := pce.GetLabelByKeyValue(kv[0], kv[1])
+			utils.LogAPIRespV2("GetLabelByKeyValue", a)
+			if err != nil {
+				utils.LogError(fmt.Sprintf("getting label href - %s", err))
+			}
+			if label.Href == "" {
+				utils.LogError(fmt.Sprintf("%s:%s does not exist as a label", kv[0], kv[1]))
+			}
+			scopeLabels[label.Key] = label.Href
+			scopeHrefs = append(scopeHrefs, label.Href)
+		}
+	}
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{"allowed", "potentially_blocked", "blocked"},
+		MaxFLows:                        maxResults,
+		ExcludeWorkloadsFromIPListQuery: true,
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+	if len(scopeHrefs) > 0 {
+		tq.SourcesInclude = [][]string{scopeHrefs}
+	}
+
+	// Run the traffic query
+	traffic, a, err := pce.GetTrafficAnalysis(tq)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	utils.LogInfo(fmt.Sprintf("explorer query body: %s", a.ReqBody), false)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	utils.LogInfo(fmt.Sprintf("first traffic query result count: %d", len(traffic)), true)
+
+	// If a scope is provided, run again with the scope as the destination. Flows within the scope are returned by both queries so remove duplicates.
+	if len(scopeHrefs) > 0 {
+		tq.DestinationsInclude = tq.SourcesInclude
+		tq.SourcesInclude = [][]string{}
+		traffic2, a, err := pce.GetTrafficAnalysis(tq)
+		utils.LogAPIRespV2("GetTrafficAnalysis", a)
+		utils.LogInfo(fmt.Sprintf("explorer query body: %s", a.ReqBody), false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("second traffic query result count: %d", len(traffic2)), true)
+		for _, t := range traffic2 {
+			if hasAllLabels(FlowFromTraffic(t).SrcLabels, scopeHrefs) {
+				continue
+			}
+			traffic = append(traffic, t)
+		}
+		utils.LogInfo(fmt.Sprintf("combined traffic query result count: %d", len(traffic)), true)
+	}
+
+	// Evaluate each flow
+	ruleHits := make([]int, len(evaluator.Rules))
+	uncovered := make(map[uncoveredKey]*uncoveredValue)
+	uncoveredCount := 0
+	for _, t := range traffic {
+		matches := evaluator.Covering(FlowFromTraffic(t))
+		for _, m := range matches {
+			ruleHits[m]++
+		}
+		if len(matches) > 0 {
+			continue
+		}
+		uncoveredCount++
+
+		key := uncoveredKey{srcAppGroup: t.Src.IP, dstAppGroup: t.Dst.IP, port: t.ExpSrv.Port, proto: t.ExpSrv.Proto}
+		if t.Src.Workload != nil {
+			key.srcAppGroup = t.Src.Workload.GetAppGroup(pce.Labels)
+		}
+		if t.Dst.Workload != nil {
+			key.dstAppGroup = t.Dst.Workload.GetAppGroup(pce.Labels)
+		}
+		if _, ok := uncovered[key]; !ok {
+			uncovered[key] = &uncoveredValue{decisions: make(map[string]bool)}
+		}
+		uncovered[key].flows++
+		uncovered[key].connections = uncovered[key].connections + int(t.NumConnections)
+		uncovered[key].decisions[t.PolicyDecision] = true
+	}
+	utils.LogInfo(fmt.Sprintf("%d of %d flows are not covered by a rule", uncoveredCount, len(traffic)), true)
+
+	// Build the uncovered output sorted by connections
+	keys := []uncoveredKey{}
+	for k := range uncovered {
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return uncovered[keys[i]].connections > uncovered[keys[j]].connections
+	})
+	protoMap := ia.ProtocolList()
+	uncoveredData := [][]string{{"src_app_group", "dst_app_group", "port", "proto", "flows", "connections", "reported_policy_decisions"}}
+	for _, k := range keys {
+		decisions := []string{}
+		for d := range uncovered[k].decisions {
+			decisions = append(decisions, d)
+		}
+		sort.Strings(decisions)
+		uncoveredData = append(uncoveredData, []string{k.srcAppGroup, k.dstAppGroup, strconv.Itoa(k.port), protoMap[k.proto], strconv.Itoa(uncovered[k].flows), strconv.Itoa(uncovered[k].connections), strings.Join(decisions, ";")})
+	}
+
+	// Build the unused rules output
+	unusedData := [][]string{{"ruleset_name", "ruleset_href", "rule_href", "rule_description", "not_evaluated"}}
+	for i, cr := range evaluator.Rules {
+		if ruleHits[i] > 0 || (len(scopeLabels) > 0 && !cr.InScope(scopeLabels)) {
+			continue
+		}
+		unusedData = append(unusedData, []string{cr.RuleSet.Name, cr.RuleSet.Href, cr.Rule.Href, ia.PtrToVal(cr.Rule.Description), strings.Join(cr.NotEvaluated, ";")})
+	}
+
+	// Write the output
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-rule-coverage-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	if len(uncoveredData) > 1 {
+		utils.WriteOutput(uncoveredData, uncoveredData, outputFileName)
+		utils.LogInfo(fmt.Sprintf("%d uncovered flow summaries exported", len(uncoveredData)-1), true)
+	} else {
+		utils.LogInfo("all flows are covered by a rule", true)
+	}
+	if len(unusedData) > 1 {
+		unusedFileName := strings.TrimSuffix(outputFileName, ".csv") + "-unused-rules.csv"
+		utils.WriteOutput(unusedData, unusedData, unusedFileName)
+		utils.LogInfo(fmt.Sprintf("%d rules with no matching flows exported", len(unusedData)-1), true)
+	} else {
+		utils.LogInfo("all evaluated rules have matching flows", true)
+	}
+}
+
+// hasAllLabels returns true if the workload labels include every provided href
+func hasAllLabels(labels map[string]bool, hrefs []string) bool {
+	if len(labels) == 0 {
+		return false
+	}
+	for _, href := range hrefs {
+		if !labels[href] {
+			return false
+		}
+	}
+	return true
+}
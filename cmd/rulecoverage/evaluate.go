@@ -0,0 +1,379 @@
+package rulecoverage
+
+import (
+	"net/netip"
+	"path/filepath"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Flow is the part of an explorer result needed to evaluate it against rules.
+type Flow struct {
+	SrcIP, DstIP             string
+	SrcWkldHref, DstWkldHref string
+	SrcLabels, DstLabels     map[string]bool
+	Port, Proto              int
+	Process, WindowsService  string
+}
+
+// FlowFromTraffic converts an explorer result to a Flow.
+func FlowFromTraffic(t ia.TrafficAnalysis) Flow {
+	f := Flow{SrcIP: t.Src.IP, DstIP: t.Dst.IP, Port: t.ExpSrv.Port, Proto: t.ExpSrv.Proto, Process: t.ExpSrv.Process, WindowsService: t.ExpSrv.WindowsService}
+	if t.Src.Workload != nil {
+		f.SrcWkldHref = t.Src.Workload.Href
+		f.SrcLabels = make(map[string]bool)
+		for _, l := range ia.PtrToVal(t.Src.Workload.Labels) {
+			f.SrcLabels[l.Href] = true
+		}
+	}
+	if t.Dst.Workload != nil {
+		f.DstWkldHref = t.Dst.Workload.Href
+		f.DstLabels = make(map[string]bool)
+		for _, l := range ia.PtrToVal(t.Dst.Workload.Labels) {
+			f.DstLabels[l.Href] = true
+		}
+	}
+	return f
+}
+
+// ipRange is an inclusive range of addresses from an ip list.
+type ipRange struct {
+	from, to netip.Addr
+}
+
+// labelMatcher holds label hrefs by key. An endpoint matches if it has one of the labels for every key and none of the exclusions.
+type labelMatcher struct {
+	keys       map[string]map[string]bool
+	exclusions map[string]bool
+}
+
+// actorMatcher is a compiled list of consumers or providers.
+type actorMatcher struct {
+	ams       bool
+	labels    labelMatcher
+	workloads map[string]bool
+	include   []ipRange
+	exclude   []ipRange
+}
+
+// serviceMatcher is a single port range, protocol, process, or windows service from a rule.
+type serviceMatcher struct {
+	port, toPort, proto int
+	anyPort             bool
+	process, service    string
+}
+
+// CompiledRule is a rule prepared for local evaluation.
+type CompiledRule struct {
+	RuleSet  ia.RuleSet
+	Rule     ia.Rule
+	scopes   []labelMatcher
+	unscoped bool
+	cons     actorMatcher
+	prov     actorMatcher
+	services []serviceMatcher
+	// NotEvaluated lists rule parts that cannot be evaluated locally (e.g., virtual services or ad groups).
+	NotEvaluated []string
+}
+
+// Evaluator evaluates flows against the allow rules in the provided rulesets.
+type Evaluator struct {
+	Rules []CompiledRule
+}
+
+// NewEvaluator compiles the enabled allow rules. The PCE must have labels, label groups, ip lists, and services loaded.
+func NewEvaluator(pce *ia.PCE, ruleSets []ia.RuleSet) *Evaluator {
+	return newEvaluator(pce, ruleSets, func(ruleType string) bool { return ruleType == "" || ruleType == "allow" })
+}
+
+// NewDenyEvaluator compiles the enabled deny rules in the rulesets and the enforcement boundaries.
+// Enforcement boundaries are compiled as unscoped deny rules in a ruleset named for the boundary.
+func NewDenyEvaluator(pce *ia.PCE, ruleSets []ia.RuleSet, boundaries []ia.EnforcementBoundary) *Evaluator {
+	e := newEvaluator(pce, ruleSets, func(ruleType string) bool { return ruleType == "deny" })
+	for _, eb := range boundaries {
+		rule := ia.Rule{Href: eb.Href, RuleType: "deny", Enabled: ia.Ptr(true), UnscopedConsumers: ia.Ptr(true), Consumers: eb.Consumers, Providers: eb.Providers, IngressServices: eb.IngressServices}
+		e.Rules = append(e.Rules, compileRule(pce, ia.RuleSet{Name: "enforcement boundary - " + eb.Name, Href: eb.Href}, rule, nil))
+	}
+	return e
+}
+
+// newEvaluator compiles the enabled rules of the types accepted by includeType
+func newEvaluator(pce *ia.PCE, ruleSets []ia.RuleSet, includeType func(ruleType string) bool) *Evaluator {
+	e := &Evaluator{}
+	for _, rs := range ruleSets {
+		if !ia.PtrToVal(rs.Enabled) {
+			continue
+		}
+
+		// Compile the scopes
+		scopes := []labelMatcher{}
+		for _, scope := range ia.PtrToVal(rs.Scopes) {
+			scopeMatcher := labelMatcher{keys: make(map[string]map[string]bool), exclusions: make(map[string]bool)}
+			for _, scopeEntity := range scope {
+				if scopeEntity.Label != nil {
+					scopeMatcher.add(pce, scopeEntity.Label.Href, false)
+				}
+				if scopeEntity.LabelGroup != nil {
+					for _, labelHref := range pce.ExpandLabelGroup(scopeEntity.LabelGroup.Href) {
+						scopeMatcher.add(pce, labelHref, false)
+					}
+				}
+			}
+			scopes = append(scopes, scopeMatcher)
+		}
+
+		for _, rule := range rs.AllRules {
+			if !ia.PtrToVal(rule.Enabled) || !includeType(rule.RuleType) {
+				continue
+			}
+			e.Rules = append(e.Rules, compileRule(pce, rs, rule, scopes))
+		}
+	}
+	return e
+}
+
+// compileRule compiles a single rule with the ruleset scopes
+func compileRule(pce *ia.PCE, rs ia.RuleSet, rule ia.Rule, scopes []labelMatcher) CompiledRule {
+	cr := CompiledRule{RuleSet: rs, Rule: rule, scopes: scopes, unscoped: ia.PtrToVal(rule.UnscopedConsumers)}
+	cr.cons, cr.NotEvaluated = compileActors(pce, ia.PtrToVal(rule.Consumers), "consumer", cr.NotEvaluated)
+	cr.prov, cr.NotEvaluated = compileActors(pce, ia.PtrToVal(rule.Providers), "provider", cr.NotEvaluated)
+	if len(ia.PtrToVal(rule.ConsumingSecurityPrincipals)) > 0 {
+		cr.NotEvaluated = append(cr.NotEvaluated, "consumer ad groups")
+	}
+	cr.services = compileServices(pce, ia.PtrToVal(rule.IngressServices))
+	return cr
+}
+
+// add adds a label href to the matcher
+func (lm *labelMatcher) add(pce *ia.PCE, labelHref string, exclusion bool) {
+	if exclusion {
+		lm.exclusions[labelHref] = true
+		return
+	}
+	key := pce.Labels[labelHref].Key
+	if lm.keys[key] == nil {
+		lm.keys[key] = make(map[string]bool)
+	}
+	lm.keys[key][labelHref] = true
+}
+
+// empty returns true if the matcher has no labels or exclusions
+func (lm labelMatcher) empty() bool {
+	return len(lm.keys) == 0 && len(lm.exclusions) == 0
+}
+
+// match returns true if the workload labels satisfy the matcher
+func (lm labelMatcher) match(labels map[string]bool) bool {
+	for href := range lm.exclusions {
+		if labels[href] {
+			return false
+		}
+	}
+	for _, hrefs := range lm.keys {
+		found := false
+		for href := range hrefs {
+			if labels[href] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// compileActors compiles the consumers or providers of a rule
+func compileActors(pce *ia.PCE, actors []ia.ConsumerOrProvider, side string, notEvaluated []string) (actorMatcher, []string) {
+	am := actorMatcher{labels: labelMatcher{keys: make(map[string]map[string]bool), exclusions: make(map[string]bool)}, workloads: make(map[string]bool)}
+	for _, a := range actors {
+		exclusion := a.Exclusion != nil && *a.Exclusion
+		if ia.PtrToVal(a.Actors) == "ams" {
+			am.ams = true
+		}
+		if a.Label != nil {
+			am.labels.add(pce, a.Label.Href, exclusion)
+		}
+		if a.LabelGroup != nil {
+			for _, labelHref := range pce.ExpandLabelGroup(a.LabelGroup.Href) {
+				am.labels.add(pce, labelHref, exclusion)
+			}
+		}
+		if a.Workload != nil {
+			am.workloads[a.Workload.Href] = true
+		}
+		if a.IPList != nil {
+			include, exclude := ipListRanges(pce.IPLists[a.IPList.Href])
+			am.include = append(am.include, include...)
+			am.exclude = append(am.exclude, exclude...)
+		}
+		if a.VirtualService != nil {
+			notEvaluated = append(notEvaluated, side+" virtual services")
+		}
+		if a.VirtualServer != nil {
+			notEvaluated = append(notEvaluated, side+" virtual servers")
+		}
+	}
+	return am, notEvaluated
+}
+
+// ipListRanges converts the ip list entries to address ranges. FQDNs are ignored.
+func ipListRanges(ipl ia.IPList) (include, exclude []ipRange) {
+	for _, r := range ia.PtrToVal(ipl.IPRanges) {
+		var ipr ipRange
+		if prefix, err := netip.ParsePrefix(r.FromIP); err == nil {
+			ipr = ipRange{from: prefix.Masked().Addr(), to: utils.LastAddr(prefix)}
+		} else if from, err := netip.ParseAddr(r.FromIP); err == nil {
+			ipr = ipRange{from: from, to: from}
+			if to, err := netip.ParseAddr(r.ToIP); err == nil {
+				ipr.to = to
+			}
+		} else {
+			continue
+		}
+		if r.Exclusion {
+			exclude = append(exclude, ipr)
+		} else {
+			include = append(include, ipr)
+		}
+	}
+	return include, exclude
+}
+
+// inRanges returns true if the ip is in one of the ranges
+func inRanges(addr netip.Addr, ranges []ipRange) bool {
+	for _, r := range ranges {
+		if r.from.BitLen() == addr.BitLen() && addr.Compare(r.from) >= 0 && addr.Compare(r.to) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compileServices compiles the ingress services of a rule. No services means all services.
+func compileServices(pce *ia.PCE, ingressServices []ia.IngressServices) []serviceMatcher {
+	services := []serviceMatcher{}
+	for _, is := range ingressServices {
+		if is.Href != "" {
+			svc := pce.Services[is.Href]
+			for _, sp := range ia.PtrToVal(svc.ServicePorts) {
+				services = append(services, serviceMatcher{port: ia.PtrToVal(sp.Port), toPort: sp.ToPort, proto: sp.Protocol, anyPort: sp.Port == nil})
+			}
+			for _, ws := range ia.PtrToVal(svc.WindowsServices) {
+				services = append(services, serviceMatcher{port: ia.PtrToVal(ws.Port), toPort: ws.ToPort, proto: ws.Protocol, anyPort: ws.Port == nil, process: ws.ProcessName, service: ws.ServiceName})
+			}
+			continue
+		}
+		services = append(services, serviceMatcher{port: ia.PtrToVal(is.Port), toPort: ia.PtrToVal(is.ToPort), proto: ia.PtrToVal(is.Protocol), anyPort: is.Port == nil})
+	}
+	return services
+}
+
+// match returns true if the flow service matches
+func (sm serviceMatcher) match(f Flow) bool {
+	if sm.proto > 0 && sm.proto != f.Proto {
+		return false
+	}
+	if !sm.anyPort && sm.proto > 0 {
+		if sm.toPort == 0 && sm.port != f.Port {
+			return false
+		}
+		if sm.toPort != 0 && (f.Port < sm.port || f.Port > sm.toPort) {
+			return false
+		}
+	}
+	if sm.process != "" && !strings.EqualFold(filepath.Base(strings.ReplaceAll(sm.process, "\\", "/")), filepath.Base(strings.ReplaceAll(f.Process, "\\", "/"))) {
+		return false
+	}
+	if sm.service != "" && !strings.EqualFold(sm.service, f.WindowsService) {
+		return false
+	}
+	return true
+}
+
+// matchEndpoint returns true if the endpoint matches the actors. If scope is not nil, workload based actors must also be in the scope.
+func (am actorMatcher) matchEndpoint(ip, wkldHref string, labels map[string]bool, scope *labelMatcher) bool {
+	if addr, err := netip.ParseAddr(ip); err == nil && inRanges(addr, am.include) && !inRanges(addr, am.exclude) {
+		return true
+	}
+	if wkldHref == "" || (scope != nil && !scope.match(labels)) {
+		return false
+	}
+	if am.ams || am.workloads[wkldHref] {
+		return true
+	}
+	return !am.labels.empty() && am.labels.match(labels)
+}
+
+// Match returns true if the rule applies to the flow (allows it for allow rules and blocks it for deny rules)
+func (cr CompiledRule) Match(f Flow) bool {
+
+	// Check services first since it is the cheapest
+	if len(cr.services) > 0 {
+		svcMatch := false
+		for _, sm := range cr.services {
+			if sm.match(f) {
+				svcMatch = true
+				break
+			}
+		}
+		if !svcMatch {
+			return false
+		}
+	}
+
+	// No scopes is the same as a single scope of all workloads
+	scopes := cr.scopes
+	if len(scopes) == 0 {
+		scopes = []labelMatcher{{}}
+	}
+	for i := range scopes {
+		scope := &scopes[i]
+		if !cr.prov.matchEndpoint(f.DstIP, f.DstWkldHref, f.DstLabels, scope) {
+			continue
+		}
+		consumerScope := scope
+		if cr.unscoped {
+			consumerScope = nil
+		}
+		if cr.cons.matchEndpoint(f.SrcIP, f.SrcWkldHref, f.SrcLabels, consumerScope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covering returns the indexes of the rules that apply to the flow
+func (e *Evaluator) Covering(f Flow) []int {
+	var matches []int
+	for i, cr := range e.Rules {
+		if cr.Match(f) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// InScope returns true if the ruleset of the rule can apply to workloads with the provided labels (key to href).
+// Keys not used in a ruleset scope are ignored.
+func (cr CompiledRule) InScope(scopeLabels map[string]string) bool {
+	if len(cr.scopes) == 0 {
+		return true
+	}
+	for _, scope := range cr.scopes {
+		overlaps := true
+		for key, href := range scopeLabels {
+			if hrefs, ok := scope.keys[key]; ok && !hrefs[href] {
+				overlaps = false
+				break
+			}
+		}
+		if overlaps {
+			return true
+		}
+	}
+	return false
+}
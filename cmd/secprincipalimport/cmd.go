@@ -4,16 +4,25 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/brian1917/illumioapi/v2"
 
+	"github.com/brian1917/workloader/cmd/adgroupimport"
 	"github.com/brian1917/workloader/cmd/secprincipalexport"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-func init() {}
+var ldifFile, searchFilter, nameAttribute string
+
+func init() {
+	SecPrincipalImportCmd.Flags().StringVar(&ldifFile, "ldif", "", "ldif export of the directory to create groups from instead of a csv. see below for details.")
+	SecPrincipalImportCmd.Flags().StringVar(&searchFilter, "filter", "(objectClass=group)", "ldap search filter to select groups from the ldif.")
+	SecPrincipalImportCmd.Flags().StringVar(&nameAttribute, "name-attribute", "sAMAccountName", "ldif attribute for the group name. cn is used if the attribute is blank.")
+	SecPrincipalImportCmd.Flags().SortFlags = false
+}
 
 type newSecAuthPrincipal struct {
 	secAuthPrincipal illumioapi.AuthSecurityPrincipal
@@ -22,7 +31,7 @@ type newSecAuthPrincipal struct {
 
 // SecPrincipalExportCmd runs the label-dimension-export command
 var SecPrincipalImportCmd = &cobra.Command{
-	Use:   "sec-principal-import",
+	Use:   "sec-principal-import [csv file to import or --ldif]",
 	Short: "Create external users or groups from a csv file.",
 	Long: `
 Create external users or groups from a csv file. 
@@ -31,6 +40,12 @@ The following headers are required:
 - display_name
 - name
 - type (user or group)
+
+Security principals that already exist are skipped.
+
+Use --ldif instead of a csv to create groups from an LDIF export of Active Directory or another directory. The --filter and --name-attribute work the same as adgroup-import. Each group is created with the name and display name of the --name-attribute. The groups are written to a csv that is then imported the same as a csv input. Group security principals in the PCE that are not in the ldif are written to a stale csv for review. Stale groups are not deleted.
+
+Recommended to run without --update-pce first to log of what will change. If --update-pce is used, workloader will create the security principals with a user prompt. To disable the prompt, use --no-prompt.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -40,6 +55,12 @@ The following headers are required:
 			utils.LogError(err.Error())
 		}
 
+		// Use the ldif if provided
+		if ldifFile != "" {
+			importLDIF(pce, viper.Get("update_pce").(bool), viper.Get("no_prompt").(bool))
+			return
+		}
+
 		// Set the CSV file
 		if len(args) != 1 {
 			fmt.Println("Command requires 1 argument for the csv file. See usage help.")
@@ -58,6 +79,70 @@ func importSecPrincipals(pce illumioapi.PCE, csvFile string, updatePCE, noPrompt
 		utils.LogErrorf("parsing csv - %s", err)
 	}
 
+	// Get the existing security principals
+	apiResps, err := pce.Load(illumioapi.LoadInput{AuthSecurityPrincipals: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogErrorf("loading pce - %s", err)
+	}
+
+	importSecPrincipalData(pce, csvData, updatePCE, noPrompt)
+}
+
+// importLDIF creates group security principals from the groups in an LDIF export and reports PCE groups not in the export
+func importLDIF(pce illumioapi.PCE, updatePCE, noPrompt bool) {
+
+	// Read the directory
+	directory, err := adgroupimport.ReadLDIF(ldifFile, searchFilter, nameAttribute)
+	if err != nil {
+		utils.LogErrorf("reading ldif - %s", err)
+	}
+	utils.LogInfof(true, "%d groups in %s match %s", len(directory.Groups), ldifFile, searchFilter)
+
+	// Get the existing security principals
+	apiResps, err := pce.Load(illumioapi.LoadInput{AuthSecurityPrincipals: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogErrorf("loading pce - %s", err)
+	}
+
+	// Write the groups to a csv for the import
+	timestamp := time.Now().Format("20060102_150405")
+	csvData := [][]string{{secprincipalexport.HeaderName, secprincipalexport.HeaderDisplayName, secprincipalexport.HeaderType}}
+	for _, g := range directory.Groups {
+		csvData = append(csvData, []string{g.Name, g.Name, "group"})
+	}
+	if len(csvData) > 1 {
+		utils.WriteOutput(csvData, nil, fmt.Sprintf("workloader-sec-principal-import-ldif-%s.csv", timestamp))
+	}
+
+	// Report groups in the PCE that are not in the directory
+	staleData := [][]string{{secprincipalexport.HeaderName, secprincipalexport.HeaderDisplayName, secprincipalexport.HeaderHref}}
+	for _, asp := range pce.AuthSecurityPrincipalsSlices {
+		if asp.Type != "group" || asp.Name == "" {
+			continue
+		}
+		if !directory.Names[asp.Name] {
+			staleData = append(staleData, []string{asp.Name, asp.DisplayName, asp.Href})
+			utils.LogInfof(false, "%s is not in %s", asp.Name, ldifFile)
+		}
+	}
+	if len(staleData) > 1 {
+		staleFile := fmt.Sprintf("workloader-sec-principal-import-stale-%s.csv", timestamp)
+		utils.WriteOutput(staleData, nil, staleFile)
+		utils.LogInfof(true, "%d group security principals in the pce are not in %s. see %s", len(staleData)-1, ldifFile, staleFile)
+	}
+
+	if len(csvData) == 1 {
+		utils.LogInfo("nothing to be done.", true)
+		return
+	}
+	importSecPrincipalData(pce, csvData, updatePCE, noPrompt)
+}
+
+// importSecPrincipalData creates the security principals in the csv data. The PCE must be loaded with the security principals.
+func importSecPrincipalData(pce illumioapi.PCE, csvData [][]string, updatePCE, noPrompt bool) {
+
 	// Create the slice for new groups
 	secPrincipals := []newSecAuthPrincipal{}
 
@@ -0,0 +1,316 @@
+package serviceinfer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/svcexport"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Match types
+const (
+	matchProcess = "process"
+	matchPorts   = "ports"
+	matchNew     = "new"
+)
+
+type portProto struct {
+	port  int
+	proto int
+}
+
+func (pp portProto) String() string {
+	return fmt.Sprintf("%d/%s", pp.port, protoName(pp.proto))
+}
+
+// cluster is a process and port set shared by workloads
+type cluster struct {
+	id          string
+	process     string
+	winService  string
+	ports       []portProto
+	windows     bool
+	workloads   []ia.Workload
+	matchType   string
+	serviceName string
+	serviceHref string
+}
+
+// portString returns the ports in port/proto format separated by a semicolon
+func (c *cluster) portString() string {
+	ports := []string{}
+	for _, pp := range c.ports {
+		ports = append(ports, pp.String())
+	}
+	return strings.Join(ports, ";")
+}
+
+// baseName returns the file name of a windows or linux process path
+func baseName(process string) string {
+	return process[strings.LastIndexAny(process, `/\`)+1:]
+}
+
+// buildClusters groups the workloads with the same process, windows service, and ports
+func buildClusters(records []record, selected map[string]ia.Workload) []*cluster {
+
+	// Get the ports for each process on each workload
+	type wkldProcess struct {
+		href       string
+		process    string
+		winService string
+		ports      map[portProto]bool
+	}
+	wkldProcesses := make(map[string]*wkldProcess)
+	keys := []string{}
+	for _, r := range records {
+		if r.port == 0 || r.port > maxPort {
+			continue
+		}
+		process := baseName(r.process)
+		key := r.href + "|" + strings.ToLower(process) + "|" + strings.ToLower(r.winService)
+		if _, ok := wkldProcesses[key]; !ok {
+			wkldProcesses[key] = &wkldProcess{href: r.href, process: process, winService: r.winService, ports: make(map[portProto]bool)}
+			keys = append(keys, key)
+		}
+		wkldProcesses[key].ports[portProto{port: r.port, proto: r.proto}] = true
+	}
+
+	// Group the workload processes with the same ports
+	clusterMap := make(map[string]*cluster)
+	clusterKeys := []string{}
+	for _, key := range keys {
+		wp := wkldProcesses[key]
+		c := &cluster{process: wp.process, winService: wp.winService}
+		for pp := range wp.ports {
+			c.ports = append(c.ports, pp)
+		}
+		sort.Slice(c.ports, func(i, j int) bool {
+			if c.ports[i].port != c.ports[j].port {
+				return c.ports[i].port < c.ports[j].port
+			}
+			return c.ports[i].proto < c.ports[j].proto
+		})
+		clusterKey := strings.ToLower(c.process) + "|" + strings.ToLower(c.winService) + "|" + c.portString()
+		if existing, ok := clusterMap[clusterKey]; ok {
+			c = existing
+		} else {
+			clusterMap[clusterKey] = c
+			clusterKeys = append(clusterKeys, clusterKey)
+		}
+		w := selected[wp.href]
+		c.workloads = append(c.workloads, w)
+		if strings.Contains(strings.ToLower(ia.PtrToVal(w.OsID)), "win") || strings.HasSuffix(strings.ToLower(c.process), ".exe") {
+			c.windows = true
+		}
+	}
+
+	// Keep the clusters with the minimum workloads
+	clusters := []*cluster{}
+	skipped := 0
+	for _, key := range clusterKeys {
+		if len(clusterMap[key].workloads) < minWorkloads {
+			skipped++
+			continue
+		}
+		clusters = append(clusters, clusterMap[key])
+	}
+	if skipped > 0 {
+		utils.LogInfof(true, "skipped %d process and port sets on fewer than %d workloads.", skipped, minWorkloads)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].workloads) != len(clusters[j].workloads) {
+			return len(clusters[i].workloads) > len(clusters[j].workloads)
+		}
+		return strings.ToLower(clusters[i].process) < strings.ToLower(clusters[j].process)
+	})
+	for i, c := range clusters {
+		c.id = fmt.Sprintf("c%03d", i+1)
+	}
+	return clusters
+}
+
+// matchServices matches each cluster to an existing service or proposes a new service name
+func matchServices(clusters []*cluster) {
+	services := []ia.Service{}
+	for _, s := range pce.ServicesSlice {
+		if s.Name != "All Services" {
+			services = append(services, s)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	usedNames := make(map[string]bool)
+	for _, s := range services {
+		usedNames[strings.ToLower(s.Name)] = true
+	}
+
+	for _, c := range clusters {
+		// Process match
+		if c.windows {
+			for _, s := range services {
+				if processMatch(c, s) {
+					c.matchType, c.serviceName, c.serviceHref = matchProcess, s.Name, s.Href
+					break
+				}
+			}
+		}
+		if c.matchType != "" {
+			continue
+		}
+
+		// Ports match
+		for _, s := range services {
+			if portsMatch(c, s) {
+				c.matchType, c.serviceName, c.serviceHref = matchPorts, s.Name, s.Href
+				break
+			}
+		}
+		if c.matchType != "" {
+			continue
+		}
+
+		// Propose a new service
+		c.matchType = matchNew
+		base := "port"
+		if c.winService != "" && c.windows {
+			base = c.winService
+		} else if c.process != "" {
+			base = c.process
+			if strings.HasSuffix(strings.ToLower(base), ".exe") {
+				base = base[:len(base)-4]
+			}
+		}
+		ports := []string{}
+		for _, pp := range c.ports {
+			if pp.proto == 6 {
+				ports = append(ports, strconv.Itoa(pp.port))
+			} else {
+				ports = append(ports, strconv.Itoa(pp.port)+protoName(pp.proto))
+			}
+		}
+		for _, name := range []string{namePrefix + base, namePrefix + base + "-" + strings.Join(ports, "-"), namePrefix + base + "-" + strings.Join(ports, "-") + "-" + c.id} {
+			if !usedNames[strings.ToLower(name)] {
+				c.serviceName = name
+				usedNames[strings.ToLower(name)] = true
+				break
+			}
+		}
+	}
+}
+
+// processMatch returns true if the service has windows service entries for the process or service name that cover all the cluster ports
+func processMatch(c *cluster, s ia.Service) bool {
+	for _, pp := range c.ports {
+		covered := false
+		for _, ws := range ia.PtrToVal(s.WindowsServices) {
+			nameMatch := (ws.ServiceName != "" && strings.EqualFold(ws.ServiceName, c.winService)) || (ws.ProcessName != "" && strings.EqualFold(baseName(ws.ProcessName), c.process))
+			if nameMatch && covers(ia.PtrToVal(ws.Port), ws.ToPort, ws.Protocol, pp) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// covers returns true if the port entry is blank or includes the port and protocol
+func covers(port, toPort, proto int, pp portProto) bool {
+	if port == 0 && proto == 0 {
+		return true
+	}
+	if proto != 0 && proto != pp.proto {
+		return false
+	}
+	if port == 0 {
+		return true
+	}
+	if toPort == 0 {
+		return port == pp.port
+	}
+	return pp.port >= port && pp.port <= toPort
+}
+
+// portsMatch returns true if the service has exactly the cluster ports and no process restrictions
+func portsMatch(c *cluster, s ia.Service) bool {
+	entries := make(map[string]bool)
+	for _, sp := range ia.PtrToVal(s.ServicePorts) {
+		if sp.ToPort != 0 {
+			return false
+		}
+		entries[portProto{port: ia.PtrToVal(sp.Port), proto: sp.Protocol}.String()] = true
+	}
+	for _, ws := range ia.PtrToVal(s.WindowsServices) {
+		if ws.ProcessName != "" || ws.ServiceName != "" || ws.ToPort != 0 {
+			return false
+		}
+		entries[portProto{port: ia.PtrToVal(ws.Port), proto: ws.Protocol}.String()] = true
+	}
+	if len(entries) != len(c.ports) {
+		return false
+	}
+	for _, pp := range c.ports {
+		if !entries[pp.String()] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOutputs writes the svc-import, clusters, and mapping files
+func writeOutputs(clusters []*cluster, base string) {
+
+	// Proposed services in svc-import format
+	svcData := [][]string{{svcexport.HeaderName, svcexport.HeaderDescription, svcexport.HeaderWinService, svcexport.HeaderPort, svcexport.HeaderProto, svcexport.HeaderProcess, svcexport.HeaderService}}
+	for _, c := range clusters {
+		if c.matchType != matchNew {
+			continue
+		}
+		isWinSvc := c.windows && (c.process != "" || c.winService != "")
+		description := fmt.Sprintf("inferred by workloader from %s on %d workloads", strings.TrimSpace(c.process+" "+c.winService), len(c.workloads))
+		for _, pp := range c.ports {
+			row := []string{c.serviceName, description, strconv.FormatBool(isWinSvc), strconv.Itoa(pp.port), protoName(pp.proto), "", ""}
+			if isWinSvc {
+				row[5], row[6] = c.process, c.winService
+			}
+			svcData = append(svcData, row)
+		}
+	}
+
+	// Clusters and mapping
+	clusterData := [][]string{{"cluster_id", "process", "windows_service", "ports", "windows", "workloads", "match_type", "pce_service", "pce_service_href"}}
+	mappingHeaders := []string{"hostname", "href"}
+	for _, ld := range pce.LabelDimensionsSlice {
+		mappingHeaders = append(mappingHeaders, ld.Key)
+	}
+	mappingData := [][]string{append(mappingHeaders, "cluster_id", "process", "windows_service", "ports", "match_type", "pce_service", "pce_service_href")}
+	counts := make(map[string]int)
+	for _, c := range clusters {
+		counts[c.matchType]++
+		clusterData = append(clusterData, []string{c.id, c.process, c.winService, c.portString(), strconv.FormatBool(c.windows), strconv.Itoa(len(c.workloads)), c.matchType, c.serviceName, c.serviceHref})
+		for _, w := range c.workloads {
+			row := []string{ia.PtrToVal(w.Hostname), w.Href}
+			for _, ld := range pce.LabelDimensionsSlice {
+				row = append(row, w.GetLabelByKey(ld.Key, pce.Labels).Value)
+			}
+			mappingData = append(mappingData, append(row, c.id, c.process, c.winService, c.portString(), c.matchType, c.serviceName, c.serviceHref))
+		}
+	}
+
+	utils.LogInfof(true, "%d clusters - %d match existing services by process, %d match by ports, %d new services proposed", len(clusters), counts[matchProcess], counts[matchPorts], counts[matchNew])
+	if len(svcData) > 1 {
+		utils.WriteOutput(svcData, svcData, base+"-svc-import.csv")
+		utils.LogInfof(true, "proposed services - %s", base+"-svc-import.csv")
+	}
+	utils.WriteOutput(clusterData, clusterData, base+"-clusters.csv")
+	utils.LogInfof(true, "clusters - %s", base+"-clusters.csv")
+	utils.WriteOutput(mappingData, mappingData, base+"-mapping.csv")
+	utils.LogInfof(true, "workload mapping - %s", base+"-mapping.csv")
+}
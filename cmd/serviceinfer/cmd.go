@@ -0,0 +1,222 @@
+package serviceinfer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var pce ia.PCE
+var err error
+var processFile, selectExpr, namePrefix, outputFileName string
+var minWorkloads, maxPort int
+
+func init() {
+	ServiceInferCmd.Flags().StringVar(&processFile, "process-file", "", "output of process-export to use instead of getting the open ports from the pce.")
+	ServiceInferCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to filter workloads. see description below.")
+	ServiceInferCmd.Flags().IntVar(&minWorkloads, "min-workloads", 2, "minimum number of workloads with the same process and ports to infer a service.")
+	ServiceInferCmd.Flags().IntVar(&maxPort, "max-port", 49151, "ignore ports above this value. the default ignores the dynamic port range.")
+	ServiceInferCmd.Flags().StringVar(&namePrefix, "name-prefix", "", "prefix for the names of proposed services.")
+	ServiceInferCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the svc-import file. the clusters and mapping files use the same name with a suffix. default is current location with a timestamped filename.")
+
+	ServiceInferCmd.Flags().SortFlags = false
+}
+
+// ServiceInferCmd infers services from the listening processes on workloads
+var ServiceInferCmd = &cobra.Command{
+	Use:   "service-infer",
+	Short: "Infer services from the listening processes and ports on workloads.",
+	Long: `
+Infer services from the listening processes and ports on workloads.
+
+The open ports come from the pce for the managed workloads that match --select or from a process-export file with --process-file. When a file is used, --select filters the rows by the workload href.
+
+Workloads listening with the same process (and windows service) on the same set of ports are grouped into a cluster. For example, sqlservr.exe (MSSQLSERVER) on 1433/tcp. Clusters on fewer than --min-workloads workloads are ignored.
+
+Each cluster is matched to an existing service:
+  - process: a service with a windows service entry for the same process or service name that covers the ports.
+  - ports: a service with exactly the same ports and protocols and no process restriction.
+Clusters without a match get a proposed service. Windows clusters use the process and service name with the ports. Other clusters use the ports only since process-based services are windows only.
+
+Three files are created:
+  - svc-import: the proposed services. review and import with svc-import.
+  - clusters: one row per cluster with the workload count and the existing or proposed service.
+  - mapping: one row per workload and cluster with the existing or proposed service.
+
+` + utils.SelectorHelp + `
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err = utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		serviceInfer()
+	},
+}
+
+// record is a listening process on a workload
+type record struct {
+	hostname   string
+	href       string
+	process    string
+	winService string
+	port       int
+	proto      int
+}
+
+func serviceInfer() {
+
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Load the pce
+	utils.LogInfo("getting managed workloads, labels, label dimensions, and services...", true)
+	apiResps, err := pce.Load(ia.LoadInput{
+		Workloads:                true,
+		WorkloadsQueryParameters: map[string]string{"managed": "true"},
+		Labels:                   true,
+		LabelDimensions:          true,
+		Services:                 true,
+	}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Filter with the selector
+	pce.WorkloadsSlice = selector.FilterV2(pce.WorkloadsSlice, pce.Labels)
+	selected := make(map[string]ia.Workload)
+	for _, w := range pce.WorkloadsSlice {
+		selected[w.Href] = w
+	}
+
+	// Get the records
+	var records []record
+	if processFile != "" {
+		records, err = parseProcessFile(processFile, selected)
+		if err != nil {
+			utils.LogErrorf("parsing process file - %s", err)
+		}
+	} else {
+		records = getRecords()
+	}
+	if len(records) == 0 {
+		utils.LogInfo("no listening processes for the selected workloads.", true)
+		return
+	}
+
+	// Cluster, match, and write the outputs
+	clusters := buildClusters(records, selected)
+	if len(clusters) == 0 {
+		utils.LogInfof(true, "no process and port sets on %d or more workloads.", minWorkloads)
+		return
+	}
+	base := fmt.Sprintf("workloader-service-infer-%s", time.Now().Format("20060102_150405"))
+	if outputFileName != "" {
+		base = strings.TrimSuffix(outputFileName, ".csv")
+	}
+	matchServices(clusters)
+	writeOutputs(clusters, base)
+}
+
+// getRecords gets the open service ports of the selected workloads from the pce
+func getRecords() []record {
+	records := []record{}
+	for i, wkld := range pce.WorkloadsSlice {
+		utils.LogInfof(true, "getting open ports for %s - %d of %d", ia.PtrToVal(wkld.Hostname), i+1, len(pce.WorkloadsSlice))
+		w, a, err := pce.GetWkldByHref(wkld.Href)
+		utils.LogAPIRespV2("GetWkldByHref", a)
+		if err != nil {
+			utils.LogWarningf(true, "error getting %s - skipping", wkld.Href)
+			continue
+		}
+		if w.Services == nil || w.Services.OpenServicePorts == nil {
+			continue
+		}
+		for _, osp := range ia.PtrToVal(w.Services.OpenServicePorts) {
+			records = append(records, record{hostname: ia.PtrToVal(w.Hostname), href: w.Href, process: osp.ProcessName, winService: osp.WinServiceName, port: osp.Port, proto: osp.Protocol})
+		}
+	}
+	return records
+}
+
+// parseProcessFile parses a process-export file and keeps the rows for the selected workloads
+func parseProcessFile(file string, selected map[string]ia.Workload) ([]record, error) {
+	csvData, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(csvData) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	cols := make(map[string]int)
+	for i, h := range csvData[0] {
+		cols[strings.ToLower(h)] = i
+	}
+	for _, required := range []string{"hostname", "href", "process_path", "service_name", "port", "proto"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("%s does not have a %s header", file, required)
+		}
+	}
+
+	records := []record{}
+	notSelected := make(map[string]bool)
+	for i, row := range csvData[1:] {
+		if _, ok := selected[row[cols["href"]]]; !ok {
+			notSelected[row[cols["href"]]] = true
+			continue
+		}
+		port, err := strconv.Atoi(row[cols["port"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d - invalid port %s", i+2, row[cols["port"]])
+		}
+		proto, err := parseProto(row[cols["proto"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d - %s", i+2, err)
+		}
+		records = append(records, record{hostname: row[cols["hostname"]], href: row[cols["href"]], process: row[cols["process_path"]], winService: row[cols["service_name"]], port: port, proto: proto})
+	}
+	if len(notSelected) > 0 {
+		utils.LogInfof(true, "skipped %d workloads in %s that are not managed workloads matching the selector.", len(notSelected), file)
+	}
+	return records, nil
+}
+
+// parseProto returns the protocol number for tcp, udp, or a number
+func parseProto(proto string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(proto)) {
+	case "tcp":
+		return 6, nil
+	case "udp":
+		return 17, nil
+	}
+	p, err := strconv.Atoi(proto)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol %s", proto)
+	}
+	return p, nil
+}
+
+// protoName returns tcp, udp, or the protocol number
+func protoName(proto int) string {
+	switch proto {
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	}
+	return strconv.Itoa(proto)
+}
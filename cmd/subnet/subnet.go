@@ -13,7 +13,7 @@ import (
 	"github.com/spf13/viper"
 )
 
-var csvFile, labelFile, outputFileName string
+var csvFile, labelFile, selectExpr, outputFileName string
 var inclUmwl, updatePCE, noPrompt bool
 var pce illumioapi.PCE
 var err error
@@ -22,6 +22,7 @@ func init() {
 	SubnetCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 	SubnetCmd.Flags().BoolVar(&inclUmwl, "incl-umwl", false, "include unmanaged workloads.")
 	SubnetCmd.Flags().StringVar(&labelFile, "label-file", "", "csv file with labels to filter query. the file should have 4 headers: role, app, env, and loc. The four columns in each row is an \"AND\" operation. Each row is an \"OR\" operation.")
+	SubnetCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to filter workloads. can be combined with label-file. see description below.")
 	SubnetCmd.Flags().SortFlags = false
 
 }
@@ -59,6 +60,8 @@ This example queries all workloads that are
 - OR bos(loc) AND it (bu)
 - OR CRM (app)
 
+` + utils.SelectorHelp + `
+
 Recommended to run without --update-pce first to log of what will change in a csv file. To disable the prompt for updates, use --no-prompt.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -93,6 +96,12 @@ func subnetParser() {
 	userNetworks := []userProvidedNetwork{}
 	labelKeySlice := []string{}
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Parse the input CSV
 	inputData, err := utils.ParseCSV(csvFile)
 	if err != nil {
@@ -169,6 +178,9 @@ func subnetParser() {
 		utils.LogErrorf("GetWklds - %s", err)
 	}
 
+	// Filter with the selector
+	pce.WorkloadsSlice = selector.FilterV2(pce.WorkloadsSlice, pce.Labels)
+
 	// Create a slice to store our results
 	csvData := [][]string{{"hostname", "href", "ip", "network", "csv_line_from_input"}}
 	csvData[0] = append(csvData[0], labelKeySlice...)
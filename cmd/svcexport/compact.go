@@ -0,0 +1,298 @@
+package svcexport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brian1917/illumioapi/v2"
+)
+
+// The compact syntax is one cell per service. Entries are separated by a semicolon and the parts of an entry by a comma.
+// For example: tcp/443;udp/53;icmp/8/0;tcp/8000-8010,proc:C:\app\x.exe;svc:W32Time
+// Windows egress services use egress-svc: and egress-proc: (e.g., egress-proc:C:\app\x.exe,egress-svc:AppSvc).
+// Names with a comma, semicolon, or double quote are in double quotes with inner double quotes doubled (e.g., proc:"C:\app\a,b.exe").
+const (
+	compactServicePrefix       = "svc:"
+	compactProcessPrefix       = "proc:"
+	compactEgressServicePrefix = "egress-svc:"
+	compactEgressProcessPrefix = "egress-proc:"
+)
+
+// protoNames are the protocols with names in the compact syntax
+var protoNames = map[int]string{1: "icmp", 6: "tcp", 17: "udp", 58: "icmpv6"}
+
+// FormatCompact returns the service in the compact syntax and if it is a windows service
+func FormatCompact(s illumioapi.Service, egress []WindowsEgressService) (bool, string) {
+	entries := []string{}
+	for _, sp := range illumioapi.PtrToVal(s.ServicePorts) {
+		entries = append(entries, formatEntry(illumioapi.WindowsService{Port: sp.Port, ToPort: sp.ToPort, Protocol: sp.Protocol, IcmpType: sp.IcmpType, IcmpCode: sp.IcmpCode}))
+	}
+	for _, ws := range illumioapi.PtrToVal(s.WindowsServices) {
+		entries = append(entries, formatEntry(ws))
+	}
+	for _, e := range egress {
+		parts := []string{}
+		if e.ServiceName != "" {
+			parts = append(parts, compactEgressServicePrefix+quoteName(e.ServiceName))
+		}
+		if e.ProcessName != "" {
+			parts = append(parts, compactEgressProcessPrefix+quoteName(e.ProcessName))
+		}
+		entries = append(entries, strings.Join(parts, ","))
+	}
+	return len(illumioapi.PtrToVal(s.WindowsServices)) > 0, strings.Join(entries, ";")
+}
+
+func formatEntry(ws illumioapi.WindowsService) string {
+	parts := []string{}
+	port := illumioapi.PtrToVal(ws.Port)
+	switch {
+	case ws.Protocol == 6 || ws.Protocol == 17:
+		p := protoNames[ws.Protocol]
+		if ws.ToPort != 0 {
+			p = fmt.Sprintf("%s/%d-%d", p, port, ws.ToPort)
+		} else if port != 0 {
+			p = fmt.Sprintf("%s/%d", p, port)
+		}
+		parts = append(parts, p)
+	case ws.Protocol == 1 || ws.Protocol == 58:
+		p := protoNames[ws.Protocol]
+		if ws.IcmpType != 0 || ws.IcmpCode != 0 {
+			p = fmt.Sprintf("%s/%d", p, ws.IcmpType)
+		}
+		if ws.IcmpCode != 0 {
+			p = fmt.Sprintf("%s/%d", p, ws.IcmpCode)
+		}
+		parts = append(parts, p)
+	case ws.Protocol != 0:
+		parts = append(parts, fmt.Sprintf("proto/%d", ws.Protocol))
+	}
+	if ws.ServiceName != "" {
+		parts = append(parts, compactServicePrefix+quoteName(ws.ServiceName))
+	}
+	if ws.ProcessName != "" {
+		parts = append(parts, compactProcessPrefix+quoteName(ws.ProcessName))
+	}
+	return strings.Join(parts, ",")
+}
+
+// quoteName puts a name in double quotes if it has a separator or a double quote
+func quoteName(name string) string {
+	if !strings.ContainsAny(name, ",;\"") {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// unquoteName returns the name without the surrounding double quotes
+func unquoteName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !strings.HasPrefix(name, `"`) {
+		if strings.Contains(name, `"`) {
+			return "", fmt.Errorf("%s has a double quote. put the name in double quotes and double the inner double quotes", name)
+		}
+		return name, nil
+	}
+	if len(name) < 2 || !strings.HasSuffix(name, `"`) || strings.Contains(strings.ReplaceAll(name[1:len(name)-1], `""`, ""), `"`) {
+		return "", fmt.Errorf("%s is not a valid quoted name", name)
+	}
+	return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`), nil
+}
+
+// splitCompact splits on the separator outside of double quotes
+func splitCompact(s string, sep rune) ([]string, error) {
+	fields := []string{}
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("%s has an unterminated double quote", s)
+	}
+	return append(fields, s[start:]), nil
+}
+
+// ParseCompact parses the compact syntax. The port and windows service entries are returned as windows services and the bool is true if any entry has a process or service name.
+// Windows egress service entries are returned separately and cannot be mixed with other entries.
+func ParseCompact(compact string) ([]illumioapi.WindowsService, []WindowsEgressService, bool, error) {
+	entries := []illumioapi.WindowsService{}
+	egress := []WindowsEgressService{}
+	hasNames := false
+	compactEntries, err := splitCompact(compact, ';')
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for _, entry := range compactEntries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		ws := illumioapi.WindowsService{}
+		e := WindowsEgressService{}
+		hasPort, isEgress := false, false
+		parts, err := splitCompact(entry, ',')
+		if err != nil {
+			return nil, nil, false, err
+		}
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			var name string
+			for _, prefix := range []string{compactEgressServicePrefix, compactEgressProcessPrefix, compactServicePrefix, compactProcessPrefix} {
+				if strings.HasPrefix(strings.ToLower(part), prefix) {
+					if name, err = unquoteName(part[len(prefix):]); err != nil {
+						return nil, nil, false, fmt.Errorf("%s - %s", entry, err)
+					}
+					break
+				}
+			}
+			switch {
+			case strings.HasPrefix(strings.ToLower(part), compactEgressServicePrefix):
+				if e.ServiceName != "" {
+					return nil, nil, false, fmt.Errorf("%s has more than one egress service name", entry)
+				}
+				e.ServiceName = name
+				isEgress = true
+			case strings.HasPrefix(strings.ToLower(part), compactEgressProcessPrefix):
+				if e.ProcessName != "" {
+					return nil, nil, false, fmt.Errorf("%s has more than one egress process name", entry)
+				}
+				e.ProcessName = name
+				isEgress = true
+			case strings.HasPrefix(strings.ToLower(part), compactServicePrefix):
+				if ws.ServiceName != "" {
+					return nil, nil, false, fmt.Errorf("%s has more than one service name", entry)
+				}
+				ws.ServiceName = name
+				hasNames = true
+			case strings.HasPrefix(strings.ToLower(part), compactProcessPrefix):
+				if ws.ProcessName != "" {
+					return nil, nil, false, fmt.Errorf("%s has more than one process name", entry)
+				}
+				ws.ProcessName = name
+				hasNames = true
+			default:
+				if hasPort {
+					return nil, nil, false, fmt.Errorf("%s has more than one port or protocol", entry)
+				}
+				if err := parsePortPart(part, &ws); err != nil {
+					return nil, nil, false, fmt.Errorf("%s - %s", entry, err)
+				}
+				hasPort = true
+			}
+		}
+		if isEgress {
+			if hasPort || ws.ProcessName != "" || ws.ServiceName != "" {
+				return nil, nil, false, fmt.Errorf("%s - egress entries cannot have ports, protocols, svc:, or proc:", entry)
+			}
+			egress = append(egress, e)
+			continue
+		}
+		if err := ValidateEntry(ws); err != nil {
+			return nil, nil, false, fmt.Errorf("%s - %s", entry, err)
+		}
+		entries = append(entries, ws)
+	}
+	if len(entries) == 0 && len(egress) == 0 {
+		return nil, nil, false, fmt.Errorf("no entries")
+	}
+	if len(entries) > 0 && len(egress) > 0 {
+		return nil, nil, false, fmt.Errorf("egress entries cannot be mixed with port or windows service entries")
+	}
+	return entries, egress, hasNames, nil
+}
+
+// parsePortPart parses tcp/443, udp/8000-8010, icmp/3/4, or proto/47
+func parsePortPart(part string, ws *illumioapi.WindowsService) error {
+	tokens := strings.Split(part, "/")
+	proto := strings.ToLower(tokens[0])
+	switch proto {
+	case "tcp", "udp":
+		ws.Protocol = 6
+		if proto == "udp" {
+			ws.Protocol = 17
+		}
+		if len(tokens) > 2 {
+			return fmt.Errorf("invalid port %s", part)
+		}
+		if len(tokens) == 2 {
+			ports := strings.Split(tokens[1], "-")
+			if len(ports) > 2 {
+				return fmt.Errorf("invalid port range %s", tokens[1])
+			}
+			port, err := strconv.Atoi(ports[0])
+			if err != nil {
+				return fmt.Errorf("invalid port %s", ports[0])
+			}
+			ws.Port = &port
+			if len(ports) == 2 {
+				if ws.ToPort, err = strconv.Atoi(ports[1]); err != nil {
+					return fmt.Errorf("invalid port %s", ports[1])
+				}
+			}
+		}
+	case "icmp", "icmpv6":
+		ws.Protocol = 1
+		if proto == "icmpv6" {
+			ws.Protocol = 58
+		}
+		if len(tokens) > 3 {
+			return fmt.Errorf("invalid icmp %s. use icmp/type/code", part)
+		}
+		var err error
+		if len(tokens) > 1 {
+			if ws.IcmpType, err = strconv.Atoi(tokens[1]); err != nil {
+				return fmt.Errorf("invalid icmp type %s", tokens[1])
+			}
+		}
+		if len(tokens) > 2 {
+			if ws.IcmpCode, err = strconv.Atoi(tokens[2]); err != nil {
+				return fmt.Errorf("invalid icmp code %s", tokens[2])
+			}
+		}
+	case "proto":
+		if len(tokens) != 2 {
+			return fmt.Errorf("invalid protocol %s. use proto/number", part)
+		}
+		var err error
+		if ws.Protocol, err = strconv.Atoi(tokens[1]); err != nil {
+			return fmt.Errorf("invalid protocol %s", tokens[1])
+		}
+	default:
+		return fmt.Errorf("invalid entry %s. use tcp/port, udp/port, icmp/type/code, proto/number, svc:name, proc:path, egress-svc:name, or egress-proc:path", part)
+	}
+	return nil
+}
+
+// ValidateEntry checks the port, protocol, and icmp values of a service entry
+func ValidateEntry(ws illumioapi.WindowsService) error {
+	port := illumioapi.PtrToVal(ws.Port)
+	if ws.Protocol < 0 || ws.Protocol > 255 {
+		return fmt.Errorf("protocol %d is not between 0 and 255", ws.Protocol)
+	}
+	if port < 0 || port > 65535 || ws.ToPort < 0 || ws.ToPort > 65535 {
+		return fmt.Errorf("ports must be between 0 and 65535")
+	}
+	if ws.ToPort != 0 && ws.ToPort < port {
+		return fmt.Errorf("port range %d-%d is invalid", port, ws.ToPort)
+	}
+	if (port != 0 || ws.ToPort != 0) && ws.Protocol != 6 && ws.Protocol != 17 {
+		return fmt.Errorf("ports require tcp or udp")
+	}
+	if (ws.IcmpType != 0 || ws.IcmpCode != 0) && ws.Protocol != 1 && ws.Protocol != 58 {
+		return fmt.Errorf("icmp type and code require icmp or icmpv6")
+	}
+	if ws.IcmpType < 0 || ws.IcmpType > 255 || ws.IcmpCode < 0 || ws.IcmpCode > 255 {
+		return fmt.Errorf("icmp type and code must be between 0 and 255")
+	}
+	if ws.Protocol == 0 && ws.ProcessName == "" && ws.ServiceName == "" {
+		return fmt.Errorf("requires a protocol, process name, or service name")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package svcexport
+
+import (
+	"fmt"
+
+	"github.com/brian1917/illumioapi/v2"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// WindowsEgressService is a process or windows service name that a service matches on outbound traffic.
+// The illumioapi service object does not include windows egress services so they are read and written with EgressService.
+type WindowsEgressService struct {
+	ProcessName string `json:"process_name,omitempty"`
+	ServiceName string `json:"service_name,omitempty"`
+}
+
+// EgressService is the api representation of a service with windows egress services
+type EgressService struct {
+	Href                  string                 `json:"href,omitempty"`
+	Name                  string                 `json:"name,omitempty"`
+	Description           string                 `json:"description,omitempty"`
+	WindowsEgressServices []WindowsEgressService `json:"windows_egress_services"`
+}
+
+// IsEgressCandidate returns true if the service has no ports or windows services so it might have windows egress services
+func IsEgressCandidate(s illumioapi.Service) bool {
+	return len(illumioapi.PtrToVal(s.ServicePorts)) == 0 && len(illumioapi.PtrToVal(s.WindowsServices)) == 0
+}
+
+// GetEgressServices returns the windows egress services of the service
+func GetEgressServices(pce illumioapi.PCE, href string) ([]WindowsEgressService, error) {
+	var s EgressService
+	api, err := pce.GetHref(href, &s)
+	utils.LogAPIRespV2("GetEgressServices", api)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s - %s", href, err)
+	}
+	return s.WindowsEgressServices, nil
+}
+
+// CreateEgressService creates a service with windows egress services and returns the href
+func CreateEgressService(pce illumioapi.PCE, s EgressService) (string, illumioapi.APIResponse, error) {
+	var created EgressService
+	api, err := pce.Post("sec_policy/draft/services", &s, &created)
+	return created.Href, api, err
+}
+
+// UpdateEgressService replaces the name, description, and windows egress services of the service
+func UpdateEgressService(pce illumioapi.PCE, s EgressService) (illumioapi.APIResponse, error) {
+	return pce.Put(&s)
+}
+
+// ValidateEgressEntry checks a windows egress service has a process or service name
+func ValidateEgressEntry(e WindowsEgressService) error {
+	if e.ProcessName == "" && e.ServiceName == "" {
+		return fmt.Errorf("windows egress services require a process name or service name")
+	}
+	return nil
+}
@@ -9,8 +9,10 @@ const (
 	HeaderProcess               = "process_name"
 	HeaderService               = "service_name"
 	HeaderWinService            = "is_windows_service"
+	HeaderWinEgress             = "is_windows_egress_service"
 	HeaderICMPCode              = "icmp_code"
 	HeaderICMPType              = "icmp_type"
+	HeaderServices              = "services"
 	HeaderRansomwareCategory    = "ransomware_category"
 	HeaderRansomwareSeverity    = "ransomware_severity"
 	HeaderRansomWareOs          = "ransomware_os_platform"
@@ -28,8 +30,10 @@ func ImportHeaders() []string {
 		HeaderProcess,
 		HeaderService,
 		HeaderWinService,
+		HeaderWinEgress,
 		HeaderICMPCode,
 		HeaderICMPType,
+		HeaderServices,
 		HeaderRansomwareCategory,
 		HeaderRansomwareSeverity,
 		HeaderRansomWareOs,
@@ -16,11 +16,12 @@ import (
 var pce illumioapi.PCE
 var err error
 var outputFileName string
-var riskData, noHref, compressed bool
+var riskData, noHref, compressed, compact bool
 
 func init() {
 	SvcExportCmd.Flags().BoolVar(&noHref, "no-href", false, "do not export href column. use this when exporting data to import into different pce. ignored with compressed flag.")
 	SvcExportCmd.Flags().BoolVar(&compressed, "compressed", false, "compress the output to one service per line. this output is not compatible with the svc-import command.")
+	SvcExportCmd.Flags().BoolVar(&compact, "compact", false, "export one service per line with the ports, protocols, icmp, process names, windows service names, and windows egress services in a single services column. this output is compatible with the svc-import command.")
 	SvcExportCmd.Flags().BoolVar(&riskData, "risk", false, "include risk info.")
 	SvcExportCmd.Flags().MarkHidden("risk")
 	SvcExportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
@@ -33,6 +34,22 @@ var SvcExportCmd = &cobra.Command{
 	Long: `
 Create a CSV export of all services in the PCE.
 
+The default output has one row per port, protocol, windows service, or windows egress service entry. Windows services include the process_name, service_name, and icmp values.
+Windows egress services match outbound traffic from a process or windows service. Their rows have is_windows_egress_service set to true with the process_name and service_name.
+
+The --compact output has one row per service with all entries in the services column. Entries are separated by a semicolon and the parts of an entry by a comma:
+  - tcp/443, udp/53, tcp/8000-8010: protocol and port or range. tcp or udp without a port is all ports.
+  - icmp, icmp/8, icmp/3/4, icmpv6/128: icmp or icmpv6 with an optional type and code.
+  - proto/47: any other protocol number.
+  - svc:W32Time: windows service name.
+  - proc:C:\app\x.exe: process name.
+  - egress-svc:AppSvc, egress-proc:C:\app\x.exe: windows egress service name and process name. An entry can have both (egress-proc:C:\app\x.exe,egress-svc:AppSvc).
+For example, tcp/443;udp/53;svc:W32Time;proc:C:\app\x.exe or tcp/8080,proc:C:\app\x.exe for a process on a port.
+Names with a comma, semicolon, or double quote are in double quotes with inner double quotes doubled (e.g., proc:"C:\app\a,b.exe").
+A service has port entries, windows service entries, or windows egress service entries.
+
+PCE services do not have FQDNs. FQDN-based egress policy uses FQDN entries in ip lists (see ipl-export and ipl-import).
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -42,6 +59,10 @@ The update-pce and --no-prompt flags are ignored for this command.`,
 			utils.LogError(err.Error())
 		}
 
+		if compact && compressed {
+			utils.LogError("compact and compressed cannot be used together.")
+		}
+
 		ExportServices(pce, noHref, outputFileName, []string{})
 	},
 }
@@ -76,6 +97,20 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 		targetSvcs = allSvcs
 	}
 
+	// Get the windows egress services. The service list does not include them so services without ports or windows services are checked individually.
+	egress := make(map[string][]WindowsEgressService)
+	if !compressed {
+		for _, s := range targetSvcs {
+			if !IsEgressCandidate(s) {
+				continue
+			}
+			egress[s.Href], err = GetEgressServices(pce, s.Href)
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+		}
+	}
+
 	csvData := [][]string{}
 
 	if compressed {
@@ -101,10 +136,29 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 
 	}
 
-	if !compressed {
+	if compact {
 
 		// Start the data slice with headers
-		headers := []string{HeaderName, HeaderDescription, HeaderWinService, HeaderPort, HeaderProto, HeaderProcess, HeaderService, HeaderICMPCode, HeaderICMPType}
+		headers := []string{HeaderName, HeaderDescription, HeaderWinService, HeaderServices}
+		if !templateFormat {
+			headers = append(headers, HeaderHref)
+		}
+		csvData = [][]string{headers}
+
+		for _, s := range targetSvcs {
+			isWinSvc, services := FormatCompact(s, egress[s.Href])
+			entry := []string{s.Name, s.Description, strconv.FormatBool(isWinSvc), services}
+			if !templateFormat {
+				entry = append(entry, s.Href)
+			}
+			csvData = append(csvData, entry)
+		}
+	}
+
+	if !compressed && !compact {
+
+		// Start the data slice with headers
+		headers := []string{HeaderName, HeaderDescription, HeaderWinService, HeaderPort, HeaderProto, HeaderProcess, HeaderService, HeaderICMPCode, HeaderICMPType, HeaderWinEgress}
 		if !templateFormat {
 			headers = append(headers, HeaderHref)
 		}
@@ -133,7 +187,7 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 				} else {
 					proto = strconv.Itoa(p.Protocol)
 				}
-				entry := []string{s.Name, s.Description, strconv.FormatBool(isWinSvc), port, proto, "", "", strconv.Itoa(p.IcmpCode), strconv.Itoa(p.IcmpType)}
+				entry := []string{s.Name, s.Description, strconv.FormatBool(isWinSvc), port, proto, "", "", strconv.Itoa(p.IcmpCode), strconv.Itoa(p.IcmpType), "false"}
 				if !templateFormat {
 					entry = append(entry, s.Href)
 				}
@@ -158,7 +212,7 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 				} else {
 					proto = strconv.Itoa(p.Protocol)
 				}
-				entry := []string{s.Name, s.Description, strconv.FormatBool(isWinSvc), port, proto, p.ProcessName, p.ServiceName, strconv.Itoa(p.IcmpCode), strconv.Itoa(p.IcmpType)}
+				entry := []string{s.Name, s.Description, strconv.FormatBool(isWinSvc), port, proto, p.ProcessName, p.ServiceName, strconv.Itoa(p.IcmpCode), strconv.Itoa(p.IcmpType), "false"}
 				if !templateFormat {
 					entry = append(entry, s.Href)
 				}
@@ -171,6 +225,14 @@ func ExportServices(pce illumioapi.PCE, templateFormat bool, outputFileName stri
 				csvData = append(csvData, entry)
 			}
 
+			for _, e := range egress[s.Href] {
+				entry := []string{s.Name, s.Description, "false", "", "", e.ProcessName, e.ServiceName, "", "", "true"}
+				if !templateFormat {
+					entry = append(entry, s.Href)
+				}
+				csvData = append(csvData, entry)
+			}
+
 		}
 
 	}
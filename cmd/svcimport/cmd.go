@@ -36,14 +36,22 @@ It's recommended to start with a svc-export command and edit/add to it. The inpu
 		"- " + svcexport.HeaderProcess + "\r\n" +
 		"- " + svcexport.HeaderService + "\r\n" +
 		"- " + svcexport.HeaderWinService + "\r\n" +
+		"- " + svcexport.HeaderWinEgress + "\r\n" +
 		"- " + svcexport.HeaderICMPCode + "\r\n" +
-		"- " + svcexport.HeaderICMPType + "\r\n" + `	
+		"- " + svcexport.HeaderICMPType + "\r\n" +
+		"- " + svcexport.HeaderServices + "\r\n" + `	
 
 
 Notes on input:
 - The name field is required. If an HREF field is provided the service will updated. No href means a service will be created.
 - Rows that share a common name are the same service. For example, a service that has muliple ports should be separate rows with the same name.
 - Ports can be individual values or a range (e.g., 10-20)
+- Protocols can be tcp, udp, icmp, icmpv6, or a protocol number. icmp_type and icmp_code require icmp or icmpv6.
+- process_name and service_name require is_windows_service to be true. If the is_windows_service column is not provided, rows with a process or service name are windows services. A service cannot have both windows service and port rows.
+- The services column uses the compact syntax from svc-export --compact and replaces the port, protocol, process, service, and icmp columns for that row. Entries are separated by a semicolon and the parts of an entry by a comma (e.g., tcp/443;udp/53;icmp/8;svc:W32Time;tcp/8080,proc:C:\app\x.exe). Entries with svc: or proc: make the service a windows service. Names with a comma, semicolon, or double quote must be in double quotes with inner double quotes doubled (e.g., proc:"C:\app\a,b.exe").
+- Windows egress services match outbound traffic from a process or windows service. Use is_windows_egress_service set to true with a process_name and/or service_name, or egress-proc: and egress-svc: entries in the services column (e.g., egress-proc:C:\app\x.exe,egress-svc:AppSvc). A windows egress service cannot have port or windows service entries.
+- Ports and protocols are validated in the services column. A range can start and end on the same port (e.g., tcp/443-443).
+- PCE services do not have FQDNs. Use FQDN entries in ip lists (ipl-import) for FQDN-based egress policy.
 	
 Recommended to run without --update-pce first to log of what will change. If --update-pce is used, svc-import will create the services with a  user prompt. To disable the prompt, use --no-prompt.`,
 	Run: func(cmd *cobra.Command, args []string) {
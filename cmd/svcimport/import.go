@@ -25,6 +25,7 @@ type Input struct {
 
 type csvService struct {
 	service  illumioapi.Service
+	egress   []svcexport.WindowsEgressService
 	csvLines []int
 }
 
@@ -240,32 +241,35 @@ func ImportServices(input Input) {
 				}
 				// If the service exists already, add to it
 				if csvSvc, ok := csvSvcMap[data[nameCol]]; ok {
-					winSvc, svcPort := processServices(input, data, csvLine)
-					if isWinSvc {
+					winSvcs, svcPorts, egress := rowServices(input, data, csvLine, isWinSvc)
+					if len(egress) > 0 {
+						csvSvc.egress = append(csvSvc.egress, egress...)
+					} else if len(winSvcs) > 0 {
 						if csvSvc.service.WindowsServices == nil {
-							csvSvc.service.WindowsServices = &[]illumioapi.WindowsService{winSvc}
+							csvSvc.service.WindowsServices = &winSvcs
 						} else {
-							*csvSvc.service.WindowsServices = append(*csvSvc.service.WindowsServices, winSvc)
+							*csvSvc.service.WindowsServices = append(*csvSvc.service.WindowsServices, winSvcs...)
 						}
 					} else {
 						if csvSvc.service.ServicePorts == nil {
-							csvSvc.service.ServicePorts = &[]illumioapi.ServicePort{svcPort}
+							csvSvc.service.ServicePorts = &svcPorts
 						} else {
-							*csvSvc.service.ServicePorts = append(*csvSvc.service.ServicePorts, svcPort)
+							*csvSvc.service.ServicePorts = append(*csvSvc.service.ServicePorts, svcPorts...)
 						}
 					}
 					csvSvcMap[data[nameCol]] = csvService{
 						csvLines: append(csvSvc.csvLines, csvLine),
-						service:  csvSvc.service}
+						service:  csvSvc.service,
+						egress:   csvSvc.egress}
 
 				} else {
 					// If the service doesn't already exist, create it.
-					winSvc, svcPort := processServices(input, data, csvLine)
+					winSvcs, svcPorts, egress := rowServices(input, data, csvLine, isWinSvc)
 					svc := illumioapi.Service{Name: data[nameCol]}
-					if isWinSvc {
-						svc.WindowsServices = &[]illumioapi.WindowsService{winSvc}
-					} else {
-						svc.ServicePorts = &[]illumioapi.ServicePort{svcPort}
+					if len(winSvcs) > 0 {
+						svc.WindowsServices = &winSvcs
+					} else if len(svcPorts) > 0 {
+						svc.ServicePorts = &svcPorts
 					}
 
 					// Add the href
@@ -282,7 +286,8 @@ func ImportServices(input Input) {
 
 					csvSvcMap[data[nameCol]] = csvService{
 						csvLines: []int{csvLine},
-						service:  svc}
+						service:  svc,
+						egress:   egress}
 				}
 			}
 		}
@@ -292,6 +297,13 @@ func ImportServices(input Input) {
 	// Conver the CSVMap
 	if !input.Meta {
 		for _, csvSvc := range csvSvcMap {
+			// A service is either windows services, service ports, or windows egress services
+			if csvSvc.service.WindowsServices != nil && csvSvc.service.ServicePorts != nil {
+				utils.LogErrorf("csv line(s) %s - %s - a service cannot have both windows service and port entries. set %s the same on all rows.", strings.Join(intSliceToStrSlice(csvSvc.csvLines), ", "), csvSvc.service.Name, svcexport.HeaderWinService)
+			}
+			if len(csvSvc.egress) > 0 && (csvSvc.service.WindowsServices != nil || csvSvc.service.ServicePorts != nil) {
+				utils.LogErrorf("csv line(s) %s - %s - a service cannot have both windows egress service and port or windows service entries.", strings.Join(intSliceToStrSlice(csvSvc.csvLines), ", "), csvSvc.service.Name)
+			}
 			if csvSvc.service.Href == "" {
 				// Check if the service exists in the PCE.
 				if _, ok := svcNameMap[csvSvc.service.Name]; ok {
@@ -313,6 +325,15 @@ func ImportServices(input Input) {
 					for _, svp := range illumioapi.PtrToVal(pceSvc.ServicePorts) {
 						pceSvcMapSvcs[fmt.Sprintf("%s-%d-%d-%d-%d-%d", pceSvc.Href, illumioapi.PtrToVal(svp.Port), svp.ToPort, svp.Protocol, svp.IcmpCode, svp.IcmpType)] = fmt.Sprintf("Port: %d; To Port: %d; Proto: %d; ICMP Code: %d; ICMP Type: %d", illumioapi.PtrToVal(svp.Port), svp.ToPort, svp.Protocol, svp.IcmpCode, svp.IcmpType)
 					}
+					if svcexport.IsEgressCandidate(pceSvc) {
+						pceEgress, err := svcexport.GetEgressServices(input.PCE, pceSvc.Href)
+						if err != nil {
+							utils.LogError(err.Error())
+						}
+						for _, e := range pceEgress {
+							pceSvcMapSvcs[fmt.Sprintf("%s-egress-%s-%s", pceSvc.Href, e.ProcessName, e.ServiceName)] = fmt.Sprintf("Egress ProcessName: %s; Egress Service: %s", e.ProcessName, e.ServiceName)
+						}
+					}
 
 					// Create a map of csvSvc with the same key
 					csvSvcMapSvcs := make(map[string]string)
@@ -322,6 +343,9 @@ func ImportServices(input Input) {
 					for _, svp := range illumioapi.PtrToVal(csvSvc.service.ServicePorts) {
 						csvSvcMapSvcs[fmt.Sprintf("%s-%d-%d-%d-%d-%d", csvSvc.service.Href, illumioapi.PtrToVal(svp.Port), svp.ToPort, svp.Protocol, svp.IcmpCode, svp.IcmpType)] = fmt.Sprintf("Port: %d; To Port: %d; Proto: %d; ICMP Code: %d; ICMP Type: %d", illumioapi.PtrToVal(svp.Port), svp.ToPort, svp.Protocol, svp.IcmpCode, svp.IcmpType)
 					}
+					for _, e := range csvSvc.egress {
+						csvSvcMapSvcs[fmt.Sprintf("%s-egress-%s-%s", csvSvc.service.Href, e.ProcessName, e.ServiceName)] = fmt.Sprintf("Egress ProcessName: %s; Egress Service: %s", e.ProcessName, e.ServiceName)
+					}
 
 					update := false
 					// Are all the services in the CSV entry in the PCE?
@@ -376,7 +400,15 @@ func ImportServices(input Input) {
 	var createdCount, updatedCount, skippedCount int
 	provisionableSvcs := []string{}
 	for _, newSvc := range newServices {
-		svc, a, err := input.PCE.CreateService(newSvc.service)
+		var svc illumioapi.Service
+		var a illumioapi.APIResponse
+		var err error
+		if len(newSvc.egress) > 0 {
+			svc.Name = newSvc.service.Name
+			svc.Href, a, err = svcexport.CreateEgressService(input.PCE, svcexport.EgressService{Name: newSvc.service.Name, Description: newSvc.service.Description, WindowsEgressServices: newSvc.egress})
+		} else {
+			svc, a, err = input.PCE.CreateService(newSvc.service)
+		}
 		utils.LogAPIRespV2("CreateService", a)
 		if err != nil && a.StatusCode != 406 {
 			utils.LogError(fmt.Sprintf("Ending run - %d services created - %d services Lists updated.", createdCount, updatedCount))
@@ -396,7 +428,13 @@ func ImportServices(input Input) {
 
 	// Update Services
 	for _, updateSvc := range updatedServices {
-		a, err := input.PCE.UpdateService(updateSvc.service)
+		var a illumioapi.APIResponse
+		var err error
+		if len(updateSvc.egress) > 0 {
+			a, err = svcexport.UpdateEgressService(input.PCE, svcexport.EgressService{Href: updateSvc.service.Href, Name: updateSvc.service.Name, Description: updateSvc.service.Description, WindowsEgressServices: updateSvc.egress})
+		} else {
+			a, err = input.PCE.UpdateService(updateSvc.service)
+		}
 		utils.LogAPIRespV2("UpdateService", a)
 		if err != nil && a.StatusCode != 406 {
 			utils.LogError(fmt.Sprintf("Ending run - %d services created - %d services updated.", createdCount, updatedCount))
@@ -45,6 +45,10 @@ func processServices(input Input, data []string, csvLine int) (winSvc illumioapi
 			proto = 6
 		} else if strings.ToLower(data[col]) == "udp" {
 			proto = 17
+		} else if strings.ToLower(data[col]) == "icmp" {
+			proto = 1
+		} else if strings.ToLower(data[col]) == "icmpv6" {
+			proto = 58
 		} else {
 			proto, err = strconv.Atoi(data[col])
 			if err != nil {
@@ -86,3 +90,64 @@ func processServices(input Input, data []string, csvLine int) (winSvc illumioapi
 	return winSvc, svcPort
 
 }
+
+// rowServices returns the windows services, service ports, or windows egress services from the services column or the port, protocol, process, and service columns
+func rowServices(input Input, data []string, csvLine int, isWinSvc bool) ([]illumioapi.WindowsService, []illumioapi.ServicePort, []svcexport.WindowsEgressService) {
+	winSvcs := []illumioapi.WindowsService{}
+	_, winSvcCol := input.Headers[svcexport.HeaderWinService]
+
+	// Process the compact services column
+	if col, ok := input.Headers[svcexport.HeaderServices]; ok && data[col] != "" {
+		entries, egress, hasNames, err := svcexport.ParseCompact(data[col])
+		if err != nil {
+			utils.LogErrorf("csv line %d - %s - %s", csvLine, svcexport.HeaderServices, err)
+		}
+		if len(egress) > 0 {
+			if isWinSvc {
+				utils.LogErrorf("csv line %d - egress-svc: and egress-proc: entries require %s to be false", csvLine, svcexport.HeaderWinService)
+			}
+			return nil, nil, egress
+		}
+		if hasNames && !isWinSvc && winSvcCol {
+			utils.LogErrorf("csv line %d - svc: and proc: entries require %s to be true", csvLine, svcexport.HeaderWinService)
+		}
+		isWinSvc = isWinSvc || hasNames
+		winSvcs = entries
+	} else {
+		winSvc, _ := processServices(input, data, csvLine)
+
+		// Windows egress service rows only have a process name and service name
+		if col, ok := input.Headers[svcexport.HeaderWinEgress]; ok && data[col] != "" {
+			isEgress, err := strconv.ParseBool(data[col])
+			if err != nil {
+				utils.LogErrorf("csv line %d - invalid boolean value for %s", csvLine, svcexport.HeaderWinEgress)
+			}
+			if isEgress {
+				if isWinSvc || winSvc.Protocol != 0 || illumioapi.PtrToVal(winSvc.Port) != 0 {
+					utils.LogErrorf("csv line %d - windows egress services cannot have a port or protocol or %s set to true", csvLine, svcexport.HeaderWinService)
+				}
+				e := svcexport.WindowsEgressService{ProcessName: winSvc.ProcessName, ServiceName: winSvc.ServiceName}
+				if err := svcexport.ValidateEgressEntry(e); err != nil {
+					utils.LogErrorf("csv line %d - %s", csvLine, err)
+				}
+				return nil, nil, []svcexport.WindowsEgressService{e}
+			}
+		}
+
+		hasNames := winSvc.ProcessName != "" || winSvc.ServiceName != ""
+		if hasNames && !isWinSvc && winSvcCol {
+			utils.LogErrorf("csv line %d - %s and %s require %s to be true", csvLine, svcexport.HeaderProcess, svcexport.HeaderService, svcexport.HeaderWinService)
+		}
+		isWinSvc = isWinSvc || hasNames
+		winSvcs = append(winSvcs, winSvc)
+	}
+
+	if isWinSvc {
+		return winSvcs, nil, nil
+	}
+	svcPorts := []illumioapi.ServicePort{}
+	for _, ws := range winSvcs {
+		svcPorts = append(svcPorts, illumioapi.ServicePort{Port: ws.Port, ToPort: ws.ToPort, Protocol: ws.Protocol, IcmpCode: ws.IcmpCode, IcmpType: ws.IcmpType})
+	}
+	return nil, svcPorts, nil
+}
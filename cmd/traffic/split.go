@@ -0,0 +1,467 @@
+package traffic
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/trafficsync"
+	"github.com/brian1917/workloader/utils"
+)
+
+// splitParts is the number of queries a truncated query is split into
+const splitParts = 4
+
+// Split stages in the order they are tried
+const (
+	stageTime = iota
+	stagePort
+	stageSrcLabel
+	stageDstLabel
+	stageDone
+)
+
+// splitQuery is an explorer query in the split tree
+type splitQuery struct {
+	tq     illumioapi.TrafficQuery
+	stage  int
+	desc   string
+	rows   [][]string
+	status string
+}
+
+// runQueries runs the query and splits it until no query reaches the max results or it cannot be split further.
+// It returns the merged and deduplicated csv data.
+func runQueries(tq illumioapi.TrafficQuery, outFileName string) [][]string {
+
+	queue := []*splitQuery{{tq: tq, desc: "full query"}}
+	allQueries := []*splitQuery{}
+	for len(queue) > 0 {
+		if len(allQueries) > 0 {
+			utils.LogInfo(fmt.Sprintf("running %d split explorer queries with up to %d in parallel", len(queue), maxParallel), true)
+		}
+		utils.RunWorkers(len(queue), maxParallel, func(i int) { queue[i].run() })
+		allQueries = append(allQueries, queue...)
+
+		next := []*splitQuery{}
+		for _, q := range queue {
+			if len(q.rows)-1 < maxResults {
+				q.status = "complete"
+				continue
+			}
+			if !autoSplit {
+				q.status = "truncated"
+				continue
+			}
+			children := q.split()
+			if len(children) == 0 {
+				q.status = "truncated"
+				continue
+			}
+			q.status = fmt.Sprintf("split into %d", len(children))
+			utils.LogInfo(fmt.Sprintf("%s reached the max results of %d - split into %d queries", q.desc, maxResults, len(children)), true)
+			next = append(next, children...)
+		}
+		queue = next
+	}
+
+	// Merge the results of the queries that were not split
+	leaves := []*splitQuery{}
+	truncated := []*splitQuery{}
+	for _, q := range allQueries {
+		if strings.HasPrefix(q.status, "split") {
+			continue
+		}
+		leaves = append(leaves, q)
+		if q.status == "truncated" {
+			truncated = append(truncated, q)
+		}
+	}
+	csvData, merged := mergeRows(leaves)
+
+	// Report the completeness
+	if len(allQueries) > 1 {
+		utils.LogInfo(fmt.Sprintf("%d explorer queries run - %d results merged - %d flows in more than one query merged", len(allQueries), len(leaves), merged), true)
+		report := [][]string{{"query", "start", "end", "rows", "status"}}
+		for _, q := range allQueries {
+			report = append(report, []string{q.desc, q.tq.StartTime.Format(time.RFC3339), q.tq.EndTime.Format(time.RFC3339), strconv.Itoa(len(q.rows) - 1), q.status})
+		}
+		utils.WriteOutput(report, nil, strings.TrimSuffix(outFileName, ".csv")+"-queries.csv")
+	}
+	if len(truncated) == 0 {
+		utils.LogInfo(fmt.Sprintf("output is complete - %d of %d queries returned less than the max results", len(leaves), len(leaves)), true)
+		return csvData
+	}
+	for _, q := range truncated {
+		utils.LogWarningf(true, "%s reached the max results of %d and could not be split further. flows may be missing.", q.desc, maxResults)
+	}
+	if !autoSplit {
+		utils.LogWarningf(true, "output is incomplete - the query reached the max results of %d. remove --auto-split=false to split the query.", maxResults)
+	} else {
+		utils.LogWarningf(true, "output is incomplete - %d of %d queries returned less than the max results", len(leaves)-len(truncated), len(leaves))
+	}
+
+	return csvData
+}
+
+// run makes the explorer query
+func (q *splitQuery) run() {
+	utils.LogInfo(fmt.Sprintf("making explorer query - %s", q.desc), false)
+	traffic, a, err := pce.GetTrafficAnalysisCsv(q.tq, draftPolicy)
+	utils.LogInfo(a.ReqBody, false)
+	utils.LogAPIRespV2("GetTrafficAnalysis", a)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	// Use the same headers as the traffic store
+	if len(traffic) > 0 {
+		for i, h := range traffic[0] {
+			traffic[0][i] = trafficsync.NormalizeHeader(h)
+		}
+	}
+	q.rows = traffic
+}
+
+// split returns the queries that divide the query in the first stage that can be split
+func (q *splitQuery) split() []*splitQuery {
+	for stage := q.stage; stage < stageDone; stage++ {
+		var tqs []illumioapi.TrafficQuery
+		var descs []string
+		nextStage := stage
+		switch stage {
+		case stageTime:
+			tqs, descs = splitTime(q.tq)
+		case stagePort:
+			tqs, descs = splitPorts(q.tq, q.rows)
+		case stageSrcLabel:
+			tqs, descs = splitLabels(q.tq, true)
+			nextStage = stage + 1
+		case stageDstLabel:
+			tqs, descs = splitLabels(q.tq, false)
+			nextStage = stage + 1
+		}
+		if len(tqs) < 2 {
+			continue
+		}
+		children := []*splitQuery{}
+		for i, tq := range tqs {
+			children = append(children, &splitQuery{tq: tq, stage: nextStage, desc: fmt.Sprintf("%s > %s", q.desc, descs[i])})
+		}
+		return children
+	}
+	return nil
+}
+
+// splitTime divides the time range into equal slices no shorter than the minimum
+func splitTime(tq illumioapi.TrafficQuery) ([]illumioapi.TrafficQuery, []string) {
+	window := tq.EndTime.Sub(tq.StartTime)
+	minWindow := time.Duration(splitMinHours) * time.Hour
+	parts := splitParts
+	if window/time.Duration(parts) < minWindow {
+		parts = int(window / minWindow)
+	}
+	if parts < 2 {
+		return nil, nil
+	}
+	tqs, descs := []illumioapi.TrafficQuery{}, []string{}
+	slice := window / time.Duration(parts)
+	for i := 0; i < parts; i++ {
+		n := tq
+		n.StartTime = tq.StartTime.Add(slice * time.Duration(i))
+		n.EndTime = n.StartTime.Add(slice)
+		if i == parts-1 {
+			n.EndTime = tq.EndTime
+		}
+		tqs = append(tqs, n)
+		descs = append(descs, fmt.Sprintf("%s to %s", n.StartTime.Format(time.RFC3339), n.EndTime.Format(time.RFC3339)))
+	}
+	return tqs, descs
+}
+
+// splitPorts divides the ports into groups with a similar number of flows in the truncated results.
+// If the query includes ports, the groups are built from the included ports so none are dropped.
+// Otherwise, the groups are built from the ports in the results and a last query excludes them to get the ports not seen yet.
+func splitPorts(tq illumioapi.TrafficQuery, rows [][]string) ([]illumioapi.TrafficQuery, []string) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	portCol, protoCol := -1, -1
+	for i, h := range rows[0] {
+		switch h {
+		case trafficsync.HeaderPort:
+			portCol = i
+		case trafficsync.HeaderProto:
+			protoCol = i
+		}
+	}
+	if portCol == -1 || protoCol == -1 {
+		return nil, nil
+	}
+	protoNums := make(map[string]int)
+	for num, name := range illumioapi.ProtocolList() {
+		protoNums[strings.ToLower(name)] = num
+	}
+
+	// Count the flows for each port
+	counts := make(map[[2]int]int)
+	for _, row := range rows[1:] {
+		port, err := strconv.Atoi(row[portCol])
+		if err != nil {
+			continue
+		}
+		proto, ok := protoNums[strings.ToLower(row[protoCol])]
+		if !ok {
+			if proto, err = strconv.Atoi(row[protoCol]); err != nil {
+				continue
+			}
+		}
+		counts[[2]int{port, proto}]++
+	}
+
+	// Ports to divide. Included ports not in the results have no flows yet.
+	ports := [][2]int{}
+	if len(tq.PortProtoInclude) > 0 {
+		seen := make(map[[2]int]bool)
+		for _, pp := range tq.PortProtoInclude {
+			if !seen[pp] {
+				seen[pp] = true
+				ports = append(ports, pp)
+			}
+		}
+		if len(ports) < 2 {
+			return nil, nil
+		}
+	} else {
+		for pp := range counts {
+			ports = append(ports, pp)
+		}
+	}
+
+	// Assign the busiest ports first to the group with the fewest flows. Ties go to the group with the fewest ports.
+	sort.Slice(ports, func(i, j int) bool {
+		if counts[ports[i]] != counts[ports[j]] {
+			return counts[ports[i]] > counts[ports[j]]
+		}
+		return ports[i][0] < ports[j][0] || (ports[i][0] == ports[j][0] && ports[i][1] < ports[j][1])
+	})
+	groupCount := splitParts - 1
+	if len(tq.PortProtoInclude) > 0 {
+		groupCount = splitParts
+	}
+	if len(ports) < groupCount {
+		groupCount = len(ports)
+	}
+	groups := make([][][2]int, groupCount)
+	groupFlows := make([]int, groupCount)
+	for _, pp := range ports {
+		smallest := 0
+		for i := range groups {
+			if groupFlows[i] < groupFlows[smallest] || (groupFlows[i] == groupFlows[smallest] && len(groups[i]) < len(groups[smallest])) {
+				smallest = i
+			}
+		}
+		groups[smallest] = append(groups[smallest], pp)
+		groupFlows[smallest] += counts[pp]
+	}
+
+	tqs, descs := []illumioapi.TrafficQuery{}, []string{}
+	for _, group := range groups {
+		n := tq
+		n.PortProtoInclude = group
+		tqs = append(tqs, n)
+		descs = append(descs, fmt.Sprintf("%d ports (%s)", len(group), portList(group)))
+	}
+
+	// Ports not in the results. Not needed if the query already includes specific ports since they are all in a group.
+	if len(tq.PortProtoInclude) == 0 {
+		n := tq
+		n.PortProtoExclude = append(append([][2]int{}, tq.PortProtoExclude...), ports...)
+		tqs = append(tqs, n)
+		descs = append(descs, fmt.Sprintf("excluding %d ports", len(ports)))
+	}
+	return tqs, descs
+}
+
+// splitLabels divides the sources or destinations by each label of the split label key.
+// A last query excludes all the labels to get the flows without a label of that key.
+func splitLabels(tq illumioapi.TrafficQuery, src bool) ([]illumioapi.TrafficQuery, []string) {
+	side, include := "dst", tq.DestinationsInclude
+	if src {
+		side, include = "src", tq.SourcesInclude
+	}
+	if len(include) == 0 {
+		include = [][]string{{}}
+	}
+
+	// Get the labels of the key
+	labels := []illumioapi.Label{}
+	for href, l := range pce.Labels {
+		if href == l.Href && l.Key == splitLabelKey {
+			labels = append(labels, l)
+		}
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Value < labels[j].Value })
+	labelHrefs := make(map[string]bool)
+	for _, l := range labels {
+		labelHrefs[l.Href] = true
+	}
+
+	// The include cannot be split if it already has a label of the key
+	for _, and := range include {
+		for _, href := range and {
+			if labelHrefs[href] {
+				return nil, nil
+			}
+		}
+	}
+
+	tqs, descs := []illumioapi.TrafficQuery{}, []string{}
+	excludes := []string{}
+	for _, l := range labels {
+		n := tq
+		newInclude := [][]string{}
+		for _, and := range include {
+			newInclude = append(newInclude, append(append([]string{}, and...), l.Href))
+		}
+		if src {
+			n.SourcesInclude = newInclude
+		} else {
+			n.DestinationsInclude = newInclude
+		}
+		tqs = append(tqs, n)
+		descs = append(descs, fmt.Sprintf("%s %s:%s", side, l.Key, l.Value))
+		excludes = append(excludes, l.Href)
+	}
+
+	n := tq
+	if src {
+		n.SourcesExclude = append(append([]string{}, tq.SourcesExclude...), excludes...)
+	} else {
+		n.DestinationsExclude = append(append([]string{}, tq.DestinationsExclude...), excludes...)
+	}
+	tqs = append(tqs, n)
+	descs = append(descs, fmt.Sprintf("%s without %s label", side, splitLabelKey))
+
+	return tqs, descs
+}
+
+// Time formats of the first and last detected columns
+var detectedTimeFormat = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04:05 MST", "01/02/2006 15:04:05"}
+
+// earlier returns true if detected time a is before b. Unknown formats are compared as strings.
+func earlier(a, b string) bool {
+	for _, layout := range detectedTimeFormat {
+		ta, errA := time.Parse(layout, a)
+		tb, errB := time.Parse(layout, b)
+		if errA == nil && errB == nil {
+			return ta.Before(tb)
+		}
+	}
+	return a < b
+}
+
+// mergeRows combines the csv data of the queries by header. Rows that are the same in every column except the connections and first and last detected
+// are the same flow from different queries (e.g., time slices). They are merged by summing the connections and keeping the first first detected and
+// last last detected. Identical rows from overlapping queries are dropped. The rows of a single query are returned unchanged.
+// It returns the merged data and the number of rows merged or dropped.
+func mergeRows(queries []*splitQuery) ([][]string, int) {
+	if len(queries) == 1 {
+		return queries[0].rows, 0
+	}
+
+	headers := []string{}
+	headerIndex := make(map[string]int)
+	for _, q := range queries {
+		if len(q.rows) == 0 {
+			continue
+		}
+		for _, h := range q.rows[0] {
+			if _, ok := headerIndex[h]; !ok {
+				headerIndex[h] = len(headers)
+				headers = append(headers, h)
+			}
+		}
+	}
+	col := func(header string) int {
+		if i, ok := headerIndex[header]; ok {
+			return i
+		}
+		return -1
+	}
+	countCol, firstCol, lastCol := col(trafficsync.HeaderNumConnections), col(trafficsync.HeaderFirstDetected), col(trafficsync.HeaderLastDetected)
+
+	csvData := [][]string{headers}
+	identical := make(map[string]bool)
+	flows := make(map[string]int)
+	merged := 0
+	for _, q := range queries {
+		if len(q.rows) == 0 {
+			continue
+		}
+		for _, row := range q.rows[1:] {
+			newRow := make([]string, len(headers))
+			for i, value := range row {
+				if i < len(q.rows[0]) {
+					newRow[headerIndex[q.rows[0][i]]] = value
+				}
+			}
+			rowKey := strings.Join(newRow, "\x00")
+			if identical[rowKey] {
+				merged++
+				continue
+			}
+			identical[rowKey] = true
+
+			// The flow is every column except the connections and detected times
+			values := []string{}
+			for i, value := range newRow {
+				if i != countCol && i != firstCol && i != lastCol {
+					values = append(values, value)
+				}
+			}
+			key := strings.Join(values, "\x00")
+			index, ok := flows[key]
+			if !ok {
+				flows[key] = len(csvData)
+				csvData = append(csvData, newRow)
+				continue
+			}
+
+			// Merge into the existing flow
+			merged++
+			existing := csvData[index]
+			if countCol != -1 {
+				c1, err1 := strconv.Atoi(existing[countCol])
+				c2, err2 := strconv.Atoi(newRow[countCol])
+				if err1 == nil && err2 == nil {
+					existing[countCol] = strconv.Itoa(c1 + c2)
+				}
+			}
+			if firstCol != -1 && newRow[firstCol] != "" && (existing[firstCol] == "" || earlier(newRow[firstCol], existing[firstCol])) {
+				existing[firstCol] = newRow[firstCol]
+			}
+			if lastCol != -1 && newRow[lastCol] != "" && (existing[lastCol] == "" || earlier(existing[lastCol], newRow[lastCol])) {
+				existing[lastCol] = newRow[lastCol]
+			}
+		}
+	}
+	return csvData, merged
+}
+
+func portList(ports [][2]int) string {
+	s := []string{}
+	for i, pp := range ports {
+		if i == 5 {
+			s = append(s, "...")
+			break
+		}
+		s = append(s, fmt.Sprintf("%d %s", pp[0], illumioapi.ProtocolList()[pp[1]]))
+	}
+	return strings.Join(s, ", ")
+}
@@ -6,14 +6,15 @@ import (
 	"time"
 
 	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var inclHrefDstFile, exclHrefDstFile, inclHrefSrcFile, exclHrefSrcFile, inclServiceCSV, exclServiceCSV, inclProcessCSV, exclProcessCSV, start, end, outputFileName string
-var exclAllowed, exclPotentiallyBlocked, exclBlocked, exclUnknown, nonUni, exclWorkloadsFromIPListQuery, draftPolicy bool
-var maxResults int
+var inclHrefDstFile, exclHrefDstFile, inclHrefSrcFile, exclHrefSrcFile, inclServiceCSV, exclServiceCSV, inclProcessCSV, exclProcessCSV, start, end, fromStore, splitLabelKey, outputFileName string
+var exclAllowed, exclPotentiallyBlocked, exclBlocked, exclUnknown, nonUni, exclWorkloadsFromIPListQuery, draftPolicy, autoSplit bool
+var maxResults, maxParallel, splitMinHours int
 var pce illumioapi.PCE
 var err error
 
@@ -37,6 +38,11 @@ func init() {
 	TrafficCmd.Flags().BoolVar(&nonUni, "incl-non-unicast", false, "includes non-unicast (broadcast and multicast) flows in the output. Default is unicast only.")
 	TrafficCmd.Flags().IntVarP(&maxResults, "max-results", "m", 100000, "max results in explorer. Maximum value is 200000.")
 	TrafficCmd.Flags().BoolVar(&draftPolicy, "draft", false, "include draft policy decision in results (added time to queries).")
+	TrafficCmd.Flags().BoolVar(&autoSplit, "auto-split", true, "split queries that reach the max results and merge the results. set --auto-split=false to disable.")
+	TrafficCmd.Flags().IntVar(&splitMinHours, "split-min-hours", 1, "smallest time window in hours when splitting queries by time.")
+	TrafficCmd.Flags().StringVar(&splitLabelKey, "split-label-key", "app", "label key used to split sources and destinations after time and port splits.")
+	TrafficCmd.Flags().IntVar(&maxParallel, "max-parallel", 4, "max number of split explorer queries run at the same time.")
+	TrafficCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory.")
 	TrafficCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. If iterating through labels, the labels will be appended to the provided name before the provided file extension. To name the files for the labels, use just an extension (--output-file .csv).")
 
 	TrafficCmd.Flags().SortFlags = false
@@ -53,6 +59,15 @@ See the flags for filtering options.
 
 Use the following commands to get necessary HREFs for include/exlude files: label-export, ipl-export, wkld-export.
 
+A query that reaches the max results is missing flows. By default, the query is split and the results are merged:
+1) The time range is split into 4 windows until the window is the --split-min-hours.
+2) The ports are split into groups. If the query includes ports, the included ports are split. Otherwise, the ports in the truncated results are split with a last query for ports not yet seen.
+3) The sources are split by each label of the --split-label-key with a last query for sources without that label key.
+4) The destinations are split the same way.
+Each split query is split again until it is below the max results. Flows in more than one query (same values in every column except the connections and first and last detected) are merged by summing the connections and keeping the earliest first detected and latest last detected. When more than one query is run, a -queries.csv file lists each query, its rows, and its status. The output is reported as complete or incomplete with the queries that could not be split further.
+
+Use --from-store to query a local traffic store populated by traffic-sync instead of explorer. Max results and draft policy decisions do not apply to the store. The headers are the same with or without --from-store.
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -78,6 +93,9 @@ func explorerExport() {
 		utils.LogError("max-results must be between 1 and 200000")
 	}
 	tq.MaxFLows = maxResults
+	if splitMinHours < 1 || maxParallel < 1 {
+		utils.LogError("split-min-hours and max-parallel must be greater than 0")
+	}
 
 	// Get Labels and workloads
 	apiResps, err := pce.Load(illumioapi.LoadInput{Labels: true, Workloads: true}, utils.UseMulti())
@@ -216,21 +234,27 @@ func explorerExport() {
 		tq.TransmissionExcludes = []string{"broadcast", "multicast"}
 	}
 
-	// Set some variables for traffic analysis
-
-	traffic, a, err := pce.GetTrafficAnalysisCsv(tq, draftPolicy)
-	utils.LogInfo("making explorer query", false)
-	utils.LogInfo(a.ReqBody, false)
-	utils.LogAPIRespV2("GetTrafficAnalysis", a)
-	if err != nil {
-		utils.LogError(err.Error())
-	}
-
 	outFileName := fmt.Sprintf("workloader-explorer-%s.csv", time.Now().Format("20060102_150405"))
 	if outputFileName != "" {
 		outFileName = outputFileName
 	}
 
+	// Query the traffic store or explorer
+	var traffic [][]string
+	if fromStore != "" {
+		if draftPolicy {
+			utils.LogWarningf(true, "--draft is ignored with --from-store")
+		}
+		utils.LogInfo(fmt.Sprintf("querying traffic store %s", fromStore), true)
+		flows, err := trafficsync.Load(fromStore, tq.StartTime, tq.EndTime)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		traffic = flows.Filter(trafficsync.FilterV2(tq)).CSVData()
+	} else {
+		traffic = runQueries(tq, outFileName)
+	}
+
 	utils.WriteOutput(traffic, nil, outFileName)
 	utils.LogInfo(fmt.Sprintf("%d traffic records exported", len(traffic)-1), true)
 
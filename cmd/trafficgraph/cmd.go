@@ -0,0 +1,188 @@
+package trafficgraph
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/trafficsync"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+var granularity, labelKeys, ipNodes, formats, start, end, fromStore, outputFileName string
+var exclAllowed, exclPotentiallyBlocked, exclBlocked, consolidate bool
+var maxResults int
+var pce ia.PCE
+var err error
+
+func init() {
+	TrafficGraphCmd.Flags().StringVarP(&granularity, "granularity", "g", "appgroup", "node granularity. options are workload, appgroup, labels, or iplist.")
+	TrafficGraphCmd.Flags().StringVarP(&labelKeys, "label-keys", "k", "app,env", "comma-separated label keys for nodes when granularity is labels.")
+	TrafficGraphCmd.Flags().StringVar(&ipNodes, "ip-nodes", "iplist", "node for endpoints that are not workloads. options are iplist or ip.")
+	TrafficGraphCmd.Flags().BoolVarP(&consolidate, "consolidate", "c", false, "one edge between two nodes with all services instead of an edge for each service.")
+	TrafficGraphCmd.Flags().StringVarP(&formats, "formats", "f", "graphml,gexf,dot,html", "comma-separated output formats. options are graphml, gexf, dot, and html.")
+	TrafficGraphCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -88).In(time.UTC).Format("2006-01-02"), "start date in the format of yyyy-mm-dd.")
+	TrafficGraphCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
+	TrafficGraphCmd.Flags().BoolVar(&exclAllowed, "excl-allowed", false, "excludes allowed traffic flows.")
+	TrafficGraphCmd.Flags().BoolVar(&exclPotentiallyBlocked, "excl-potentially-blocked", false, "excludes potentially blocked traffic flows.")
+	TrafficGraphCmd.Flags().BoolVar(&exclBlocked, "excl-blocked", false, "excludes blocked traffic flows.")
+	TrafficGraphCmd.Flags().IntVarP(&maxResults, "max-results", "m", 200000, "max results in explorer. maximum value is 200000.")
+	TrafficGraphCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory.")
+	TrafficGraphCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output files. the extension of each format replaces the provided extension. default is current location with a timestamped filename.")
+
+	TrafficGraphCmd.Flags().SortFlags = false
+}
+
+// TrafficGraphCmd exports traffic as a graph
+var TrafficGraphCmd = &cobra.Command{
+	Use:   "traffic-graph",
+	Short: "Export traffic as a graph of nodes and edges for Gephi, yEd, Graphviz, or a browser.",
+	Long: `
+Export traffic as a graph of nodes and edges for Gephi, yEd, Graphviz, or a browser.
+
+Nodes are built at the --granularity:
+  - workload: each workload by hostname.
+  - appgroup: the app and env labels of the workload.
+  - labels: the values of the --label-keys of the workload.
+  - iplist: the ip lists of each endpoint, including workloads.
+Endpoints that are not workloads are the first ip list they are in (ignoring the Any ip list when possible) or the ip address with --ip-nodes ip.
+
+Edges are aggregated by source node, destination node, and service with the number of connections, the connections for each policy decision, and the decision (blocked, potentially_blocked, unknown, or allowed in that priority). Use --consolidate for one edge between two nodes with a list of services. Gephi merges parallel edges, so --consolidate is recommended for gexf.
+
+The output formats are:
+  - graphml: yEd, Gephi, Cytoscape, and other graph tools.
+  - gexf: Gephi.
+  - dot: Graphviz (e.g., dot -Tsvg file.dot -o file.svg). Edges are colored by decision.
+  - html: a standalone viewer with no external dependencies. Drag nodes, scroll to zoom, filter by decision, and search for nodes.
+
+Use --from-store to graph a local traffic store populated by traffic-sync instead of explorer.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		trafficGraph()
+	},
+}
+
+func trafficGraph() {
+
+	// Validate the flags
+	granularity = strings.ToLower(granularity)
+	if granularity != "workload" && granularity != "appgroup" && granularity != "labels" && granularity != "iplist" {
+		utils.LogError("granularity must be workload, appgroup, labels, or iplist")
+	}
+	ipNodes = strings.ToLower(ipNodes)
+	if ipNodes != "iplist" && ipNodes != "ip" {
+		utils.LogError("ip-nodes must be iplist or ip")
+	}
+	formatList := []string{}
+	for _, f := range strings.Split(strings.ToLower(strings.ReplaceAll(formats, " ", "")), ",") {
+		if f != "graphml" && f != "gexf" && f != "dot" && f != "html" {
+			utils.LogErrorf("%s is not a valid format. options are graphml, gexf, dot, and html", f)
+		}
+		formatList = append(formatList, f)
+	}
+	if maxResults < 1 || maxResults > 200000 {
+		utils.LogError("max-results must be between 1 and 200000")
+	}
+
+	// Load the pce
+	apiResps, err := pce.Load(ia.LoadInput{Labels: true, IPLists: true, ProvisionStatus: "active"}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Build the traffic query
+	tq := ia.TrafficQuery{
+		PolicyStatuses:                  []string{},
+		SourcesInclude:                  [][]string{make([]string, 0)},
+		DestinationsInclude:             [][]string{make([]string, 0)},
+		TransmissionExcludes:            []string{"broadcast", "multicast"},
+		MaxFLows:                        maxResults,
+		ExcludeWorkloadsFromIPListQuery: true}
+	if !exclAllowed {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "allowed")
+	}
+	if !exclPotentiallyBlocked {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "potentially_blocked")
+	}
+	if !exclBlocked {
+		tq.PolicyStatuses = append(tq.PolicyStatuses, "blocked")
+	}
+	tq.StartTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s %s", start, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.StartTime = tq.StartTime.In(time.UTC)
+	tq.EndTime, err = time.Parse("2006-01-02 15:04:05 MST", fmt.Sprintf("%s 23:59:59 %s", end, "UTC"))
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	tq.EndTime = tq.EndTime.In(time.UTC)
+
+	// Get the traffic
+	var traffic []ia.TrafficAnalysis
+	if fromStore != "" {
+		traffic, err = trafficsync.QueryV2(fromStore, tq)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+	} else {
+		var a ia.APIResponse
+		traffic, a, err = pce.GetTrafficAnalysis(tq)
+		utils.LogAPIRespV2("GetTrafficAnalysis", a)
+		utils.LogInfo(fmt.Sprintf("explorer query body: %s", a.ReqBody), false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		if len(traffic) >= maxResults {
+			utils.LogWarningf(true, "explorer returned the max results of %d. the graph may be missing flows. use traffic-sync and --from-store for larger time ranges.", maxResults)
+		}
+	}
+	utils.LogInfo(fmt.Sprintf("%d flows", len(traffic)), true)
+
+	// Build the graph
+	g := newGraph()
+	for _, t := range traffic {
+		g.addFlow(t)
+	}
+	g.sort()
+	if len(g.nodes) == 0 {
+		utils.LogInfo("no flows to graph", true)
+		return
+	}
+	utils.LogInfo(fmt.Sprintf("graph has %d nodes and %d edges", len(g.nodes), len(g.edges)), true)
+
+	// Write the outputs
+	base := fmt.Sprintf("workloader-traffic-graph-%s", time.Now().Format("20060102_150405"))
+	if outputFileName != "" {
+		base = strings.TrimSuffix(outputFileName, filepath.Ext(outputFileName))
+	}
+	for _, f := range formatList {
+		fileName := base + "." + f
+		var err error
+		switch f {
+		case "graphml":
+			err = writeGraphML(g, fileName)
+		case "gexf":
+			err = writeGEXF(g, fileName)
+		case "dot":
+			err = writeDOT(g, fileName)
+		case "html":
+			err = writeHTML(g, fileName)
+		}
+		if err != nil {
+			utils.LogErrorf("writing %s - %s", fileName, err)
+		}
+		utils.LogInfo(fmt.Sprintf("created %s", fileName), true)
+	}
+}
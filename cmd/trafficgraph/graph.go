@@ -0,0 +1,233 @@
+package trafficgraph
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// decisions in priority order for the edge decision
+var decisions = []string{"blocked", "potentially_blocked", "unknown", "allowed"}
+
+type node struct {
+	ID        string
+	Label     string
+	Type      string
+	key       string
+	endpoints map[string]bool
+}
+
+type edge struct {
+	ID          string
+	Src, Dst    *node
+	Services    []string
+	Connections int
+	Decisions   map[string]int
+	services    map[string]bool
+}
+
+// Decision returns the highest priority decision of the edge
+func (e *edge) Decision() string {
+	for _, d := range decisions {
+		if e.Decisions[d] > 0 {
+			return d
+		}
+	}
+	return "unknown"
+}
+
+type graph struct {
+	nodes    []*node
+	edges    []*edge
+	nodeMap  map[string]*node
+	edgeMap  map[string]*edge
+	ipLists  []ipList
+	labelKey []string
+}
+
+type ipList struct {
+	name             string
+	include, exclude []ipRange
+}
+
+// ipRange is an inclusive range of addresses from an ip list
+type ipRange struct {
+	from, to netip.Addr
+}
+
+func newGraph() *graph {
+	g := &graph{nodeMap: make(map[string]*node), edgeMap: make(map[string]*edge)}
+	for _, k := range strings.Split(labelKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			g.labelKey = append(g.labelKey, k)
+		}
+	}
+
+	// Build the ip lists with the Any ip list last so more specific lists are preferred
+	for href, ipl := range pce.IPLists {
+		if href != ipl.Href {
+			continue
+		}
+		l := ipList{name: ipl.Name}
+		l.include, l.exclude = ipRanges(ipl)
+		g.ipLists = append(g.ipLists, l)
+	}
+	sort.Slice(g.ipLists, func(i, j int) bool {
+		iAny, jAny := strings.HasPrefix(g.ipLists[i].name, "Any (0.0.0.0/0"), strings.HasPrefix(g.ipLists[j].name, "Any (0.0.0.0/0")
+		if iAny != jAny {
+			return jAny
+		}
+		return g.ipLists[i].name < g.ipLists[j].name
+	})
+	return g
+}
+
+// addFlow adds the flow to the edge between the source and destination nodes
+func (g *graph) addFlow(t ia.TrafficAnalysis) {
+	src := g.node(t.Src.Workload, t.Src.IP)
+	dst := g.node(t.Dst.Workload, t.Dst.IP)
+	service := fmt.Sprintf("%d %s", t.ExpSrv.Port, ia.ProtocolList()[t.ExpSrv.Proto])
+	if t.ExpSrv.Port == 0 {
+		service = ia.ProtocolList()[t.ExpSrv.Proto]
+	}
+
+	key := src.key + "|" + dst.key
+	if !consolidate {
+		key = key + "|" + service
+	}
+	e, ok := g.edgeMap[key]
+	if !ok {
+		e = &edge{Src: src, Dst: dst, Decisions: make(map[string]int), services: make(map[string]bool)}
+		g.edgeMap[key] = e
+		g.edges = append(g.edges, e)
+	}
+	if !e.services[service] {
+		e.services[service] = true
+		e.Services = append(e.Services, service)
+	}
+	e.Connections = e.Connections + int(t.NumConnections)
+	e.Decisions[t.PolicyDecision] = e.Decisions[t.PolicyDecision] + int(t.NumConnections)
+}
+
+// node returns the node for the endpoint at the granularity
+func (g *graph) node(w *ia.Workload, ip string) *node {
+	var label, nodeType, endpoint string
+	switch {
+	case granularity == "iplist" || w == nil:
+		label, nodeType = g.ipListName(ip), "iplist"
+		if label == "" || (w == nil && ipNodes == "ip") {
+			label, nodeType = ip, "ip"
+		}
+		endpoint = ip
+		if w != nil {
+			endpoint = w.Href
+		}
+	case granularity == "workload":
+		label, nodeType, endpoint = ia.PtrToVal(w.Hostname), "workload", w.Href
+		if label == "" {
+			label = w.Href
+		}
+	case granularity == "appgroup":
+		label, nodeType, endpoint = w.GetAppGroup(pce.Labels), "appgroup", w.Href
+	default:
+		values := []string{}
+		for _, k := range g.labelKey {
+			v := w.GetLabelByKey(k, pce.Labels).Value
+			if v == "" {
+				v = "no " + k
+			}
+			values = append(values, v)
+		}
+		label, nodeType, endpoint = strings.Join(values, " | "), "labels", w.Href
+	}
+
+	key := nodeType + "|" + label
+	n, ok := g.nodeMap[key]
+	if !ok {
+		n = &node{Label: label, Type: nodeType, key: key, endpoints: make(map[string]bool)}
+		g.nodeMap[key] = n
+		g.nodes = append(g.nodes, n)
+	}
+	n.endpoints[endpoint] = true
+	return n
+}
+
+// ipListName returns the first ip list the address is in
+func (g *graph) ipListName(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	for _, l := range g.ipLists {
+		if inRanges(addr, l.include) && !inRanges(addr, l.exclude) {
+			return l.name
+		}
+	}
+	return ""
+}
+
+// sort orders the nodes and edges and assigns ids
+func (g *graph) sort() {
+	sort.Slice(g.nodes, func(i, j int) bool {
+		if g.nodes[i].Type != g.nodes[j].Type {
+			return g.nodes[i].Type < g.nodes[j].Type
+		}
+		return g.nodes[i].Label < g.nodes[j].Label
+	})
+	for i, n := range g.nodes {
+		n.ID = fmt.Sprintf("n%d", i)
+	}
+	for _, e := range g.edges {
+		sort.Strings(e.Services)
+	}
+	sort.Slice(g.edges, func(i, j int) bool {
+		a, b := g.edges[i], g.edges[j]
+		if a.Src.ID != b.Src.ID {
+			return a.Src.ID < b.Src.ID
+		}
+		if a.Dst.ID != b.Dst.ID {
+			return a.Dst.ID < b.Dst.ID
+		}
+		return strings.Join(a.Services, ";") < strings.Join(b.Services, ";")
+	})
+	for i, e := range g.edges {
+		e.ID = fmt.Sprintf("e%d", i)
+	}
+}
+
+// ipRanges converts the ip list entries to address ranges. FQDNs are ignored.
+func ipRanges(ipl ia.IPList) (include, exclude []ipRange) {
+	for _, r := range ia.PtrToVal(ipl.IPRanges) {
+		var ipr ipRange
+		if prefix, err := netip.ParsePrefix(r.FromIP); err == nil {
+			ipr = ipRange{from: prefix.Masked().Addr(), to: utils.LastAddr(prefix)}
+		} else if from, err := netip.ParseAddr(r.FromIP); err == nil {
+			ipr = ipRange{from: from, to: from}
+			if to, err := netip.ParseAddr(r.ToIP); err == nil {
+				ipr.to = to
+			}
+		} else {
+			continue
+		}
+		if r.Exclusion {
+			exclude = append(exclude, ipr)
+		} else {
+			include = append(include, ipr)
+		}
+	}
+	return include, exclude
+}
+
+// inRanges returns true if the ip is in one of the ranges
+func inRanges(addr netip.Addr, ranges []ipRange) bool {
+	for _, r := range ranges {
+		if r.from.BitLen() == addr.BitLen() && addr.Compare(r.from) >= 0 && addr.Compare(r.to) <= 0 {
+			return true
+		}
+	}
+	return false
+}
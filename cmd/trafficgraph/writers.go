@@ -0,0 +1,258 @@
+package trafficgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// edgeColors are the dot and html colors for each decision
+var edgeColors = map[string]string{"allowed": "#2e8b57", "potentially_blocked": "#e69500", "blocked": "#d62728", "unknown": "#7f7f7f"}
+
+func esc(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeGraphML(g *graph, fileName string) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">` + "\n")
+	b.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="type" for="node" attr.name="type" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="endpoints" for="node" attr.name="endpoints" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="services" for="edge" attr.name="services" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="connections" for="edge" attr.name="connections" attr.type="int"/>` + "\n")
+	for _, d := range decisions {
+		b.WriteString(fmt.Sprintf(`  <key id="%s" for="edge" attr.name="%s" attr.type="int"/>`+"\n", d, d))
+	}
+	b.WriteString(`  <key id="decision" for="edge" attr.name="decision" attr.type="string"/>` + "\n")
+	b.WriteString(`  <graph id="workloader" edgedefault="directed">` + "\n")
+	for _, n := range g.nodes {
+		b.WriteString(fmt.Sprintf(`    <node id="%s"><data key="label">%s</data><data key="type">%s</data><data key="endpoints">%d</data></node>`+"\n", n.ID, esc(n.Label), n.Type, len(n.endpoints)))
+	}
+	for _, e := range g.edges {
+		b.WriteString(fmt.Sprintf(`    <edge id="%s" source="%s" target="%s"><data key="services">%s</data><data key="connections">%d</data>`, e.ID, e.Src.ID, e.Dst.ID, esc(strings.Join(e.Services, ";")), e.Connections))
+		for _, d := range decisions {
+			b.WriteString(fmt.Sprintf(`<data key="%s">%d</data>`, d, e.Decisions[d]))
+		}
+		b.WriteString(fmt.Sprintf(`<data key="decision">%s</data></edge>`+"\n", e.Decision()))
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	return os.WriteFile(fileName, []byte(b.String()), 0644)
+}
+
+func writeGEXF(g *graph, fileName string) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<gexf xmlns="http://www.gexf.net/1.2draft" version="1.2">` + "\n")
+	b.WriteString(`  <meta><creator>workloader</creator><description>traffic graph</description></meta>` + "\n")
+	b.WriteString(`  <graph mode="static" defaultedgetype="directed">` + "\n")
+	b.WriteString(`    <attributes class="node"><attribute id="type" title="type" type="string"/><attribute id="endpoints" title="endpoints" type="integer"/></attributes>` + "\n")
+	b.WriteString(`    <attributes class="edge"><attribute id="services" title="services" type="string"/><attribute id="connections" title="connections" type="integer"/>`)
+	for _, d := range decisions {
+		b.WriteString(fmt.Sprintf(`<attribute id="%s" title="%s" type="integer"/>`, d, d))
+	}
+	b.WriteString(`<attribute id="decision" title="decision" type="string"/></attributes>` + "\n")
+	b.WriteString("    <nodes>\n")
+	for _, n := range g.nodes {
+		b.WriteString(fmt.Sprintf(`      <node id="%s" label="%s"><attvalues><attvalue for="type" value="%s"/><attvalue for="endpoints" value="%d"/></attvalues></node>`+"\n", n.ID, esc(n.Label), n.Type, len(n.endpoints)))
+	}
+	b.WriteString("    </nodes>\n    <edges>\n")
+	for _, e := range g.edges {
+		b.WriteString(fmt.Sprintf(`      <edge id="%s" source="%s" target="%s" label="%s" weight="%d"><attvalues><attvalue for="services" value="%s"/><attvalue for="connections" value="%d"/>`, e.ID, e.Src.ID, e.Dst.ID, esc(strings.Join(e.Services, ";")), e.Connections, esc(strings.Join(e.Services, ";")), e.Connections))
+		for _, d := range decisions {
+			b.WriteString(fmt.Sprintf(`<attvalue for="%s" value="%d"/>`, d, e.Decisions[d]))
+		}
+		b.WriteString(fmt.Sprintf(`<attvalue for="decision" value="%s"/></attvalues></edge>`+"\n", e.Decision()))
+	}
+	b.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+	return os.WriteFile(fileName, []byte(b.String()), 0644)
+}
+
+func writeDOT(g *graph, fileName string) error {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+	}
+	shapes := map[string]string{"workload": "box", "appgroup": "box", "labels": "box", "iplist": "ellipse", "ip": "ellipse"}
+	var b strings.Builder
+	b.WriteString("digraph workloader {\n  rankdir=LR;\n  node [style=rounded, fontname=\"Helvetica\"];\n  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range g.nodes {
+		b.WriteString(fmt.Sprintf("  %s [label=%s, shape=%s];\n", n.ID, quote(n.Label), shapes[n.Type]))
+	}
+	for _, e := range g.edges {
+		b.WriteString(fmt.Sprintf("  %s -> %s [label=%s, color=%s, fontcolor=%s];\n", e.Src.ID, e.Dst.ID, quote(fmt.Sprintf("%s (%d)", strings.Join(e.Services, ", "), e.Connections)), quote(edgeColors[e.Decision()]), quote(edgeColors[e.Decision()])))
+	}
+	b.WriteString("}\n")
+	return os.WriteFile(fileName, []byte(b.String()), 0644)
+}
+
+func writeHTML(g *graph, fileName string) error {
+	type htmlNode struct {
+		ID        string `json:"id"`
+		Label     string `json:"label"`
+		Type      string `json:"type"`
+		Endpoints int    `json:"endpoints"`
+	}
+	type htmlEdge struct {
+		Source      string         `json:"source"`
+		Target      string         `json:"target"`
+		Services    string         `json:"services"`
+		Connections int            `json:"connections"`
+		Decisions   map[string]int `json:"decisions"`
+		Decision    string         `json:"decision"`
+	}
+	data := struct {
+		Nodes  []htmlNode        `json:"nodes"`
+		Edges  []htmlEdge        `json:"edges"`
+		Colors map[string]string `json:"colors"`
+	}{Colors: edgeColors}
+	for _, n := range g.nodes {
+		data.Nodes = append(data.Nodes, htmlNode{ID: n.ID, Label: n.Label, Type: n.Type, Endpoints: len(n.endpoints)})
+	}
+	for _, e := range g.edges {
+		data.Edges = append(data.Edges, htmlEdge{Source: e.Src.ID, Target: e.Dst.ID, Services: strings.Join(e.Services, ", "), Connections: e.Connections, Decisions: e.Decisions, Decision: e.Decision()})
+	}
+
+	// json.Marshal escapes <, >, and & so the data is safe in the script tag
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, []byte(strings.Replace(htmlViewer, "/*DATA*/", string(jsonData), 1)), 0644)
+}
+
+const htmlViewer = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>workloader traffic graph</title>
+<style>
+body { margin: 0; font-family: Helvetica, Arial, sans-serif; font-size: 13px; overflow: hidden; }
+#bar { position: absolute; top: 0; left: 0; right: 0; padding: 8px; background: #f4f4f4; border-bottom: 1px solid #ccc; z-index: 1; }
+#bar label { margin-right: 12px; }
+#info { position: absolute; bottom: 8px; left: 8px; max-width: 480px; padding: 8px; background: rgba(255,255,255,0.9); border: 1px solid #ccc; display: none; white-space: pre-wrap; }
+svg { width: 100vw; height: 100vh; cursor: grab; }
+.node circle { stroke: #fff; stroke-width: 1.5px; cursor: pointer; }
+.node text { pointer-events: none; fill: #222; }
+.edge { fill: none; stroke-opacity: 0.6; }
+.dim { opacity: 0.1; }
+</style>
+</head>
+<body>
+<div id="bar">
+<input id="search" placeholder="search nodes" style="margin-right: 12px">
+<span id="filters"></span>
+<span id="counts"></span>
+</div>
+<div id="info"></div>
+<svg id="svg"><defs id="defs"></defs><g id="view"><g id="edges"></g><g id="nodes"></g></g></svg>
+<script>
+var data = /*DATA*/;
+var ns = "http://www.w3.org/2000/svg";
+var svg = document.getElementById("svg"), view = document.getElementById("view");
+var nodeColors = {workload: "#1f77b4", appgroup: "#1f77b4", labels: "#1f77b4", iplist: "#9467bd", ip: "#8c564b"};
+var byId = {}, show = {}, scale = 1, tx = 0, ty = 0, selected = null;
+function el(tag, attrs, parent) { var e = document.createElementNS(ns, tag); for (var k in attrs) e.setAttribute(k, attrs[k]); if (parent) parent.appendChild(e); return e; }
+
+// Arrow markers for each decision
+Object.keys(data.colors).forEach(function (d) {
+  show[d] = true;
+  var m = el("marker", {id: "arrow-" + d, viewBox: "0 0 10 10", refX: 18, refY: 5, markerWidth: 6, markerHeight: 6, orient: "auto"}, document.getElementById("defs"));
+  el("path", {d: "M0,0L10,5L0,10z", fill: data.colors[d]}, m);
+  var label = document.createElement("label");
+  label.innerHTML = "<input type=checkbox checked> <span style='color:" + data.colors[d] + "'>" + d + "</span>";
+  label.firstChild.onchange = function () { show[d] = this.checked; render(); };
+  document.getElementById("filters").appendChild(label);
+});
+
+// Initial positions in a circle
+var w = window.innerWidth, h = window.innerHeight;
+data.nodes.forEach(function (n, i) {
+  var a = 2 * Math.PI * i / data.nodes.length, r = Math.min(w, h) / 3;
+  n.x = w / 2 + r * Math.cos(a); n.y = h / 2 + r * Math.sin(a); n.vx = 0; n.vy = 0; n.degree = 0;
+  byId[n.id] = n;
+});
+data.edges.forEach(function (e) { e.s = byId[e.source]; e.t = byId[e.target]; e.s.degree++; e.t.degree++; });
+var maxConn = Math.max.apply(null, data.edges.map(function (e) { return e.connections; }).concat([1]));
+
+// Draw the edges and nodes
+data.edges.forEach(function (e) {
+  e.el = el("path", {"class": "edge", stroke: data.colors[e.decision], "stroke-width": 1 + 5 * Math.sqrt(e.connections / maxConn), "marker-end": "url(#arrow-" + e.decision + ")"}, document.getElementById("edges"));
+  el("title", {}, e.el).textContent = e.s.label + " -> " + e.t.label + "\n" + e.services + "\n" + e.connections + " connections (" + e.decision + ")";
+  e.el.onclick = function (ev) { ev.stopPropagation(); info(e.s.label + " -> " + e.t.label + "\nservices: " + e.services + "\nconnections: " + e.connections + "\n" + Object.keys(e.decisions).map(function (d) { return d + ": " + e.decisions[d]; }).join("\n")); };
+});
+data.nodes.forEach(function (n) {
+  n.el = el("g", {"class": "node"}, document.getElementById("nodes"));
+  el("circle", {r: 6 + Math.min(12, Math.sqrt(n.degree) * 2), fill: nodeColors[n.type] || "#1f77b4"}, n.el);
+  el("text", {x: 14, y: 4}, n.el).textContent = n.label;
+  n.el.onmousedown = function (ev) { ev.stopPropagation(); drag = n; };
+  n.el.onclick = function (ev) { ev.stopPropagation(); selected = selected === n ? null : n; render(); info(n.label + "\ntype: " + n.type + "\nendpoints: " + n.endpoints + "\nedges: " + n.degree); };
+});
+
+function info(text) { var i = document.getElementById("info"); i.textContent = text; i.style.display = "block"; }
+
+// Force layout
+function tick(alpha) {
+  var k = Math.sqrt(w * h / Math.max(1, data.nodes.length)) * 0.6;
+  for (var i = 0; i < data.nodes.length; i++) {
+    for (var j = i + 1; j < data.nodes.length; j++) {
+      var a = data.nodes[i], b = data.nodes[j], dx = a.x - b.x, dy = a.y - b.y, d2 = dx * dx + dy * dy + 0.01, f = k * k / d2 * alpha;
+      a.vx += dx * f / 10; a.vy += dy * f / 10; b.vx -= dx * f / 10; b.vy -= dy * f / 10;
+    }
+  }
+  data.edges.forEach(function (e) {
+    var dx = e.t.x - e.s.x, dy = e.t.y - e.s.y, d = Math.sqrt(dx * dx + dy * dy) + 0.01, f = (d - k) / d * alpha * 0.1;
+    e.s.vx += dx * f; e.s.vy += dy * f; e.t.vx -= dx * f; e.t.vy -= dy * f;
+  });
+  data.nodes.forEach(function (n) {
+    n.vx += (w / 2 - n.x) * 0.005 * alpha; n.vy += (h / 2 - n.y) * 0.005 * alpha;
+    if (n !== drag) { n.x += Math.max(-20, Math.min(20, n.vx)); n.y += Math.max(-20, Math.min(20, n.vy)); }
+    n.vx *= 0.5; n.vy *= 0.5;
+  });
+}
+
+function render() {
+  var term = document.getElementById("search").value.toLowerCase(), shown = 0;
+  data.edges.forEach(function (e) {
+    var visible = show[e.decision];
+    e.el.style.display = visible ? "" : "none";
+    if (visible) shown++;
+    var dx = e.t.x - e.s.x, dy = e.t.y - e.s.y, dr = Math.sqrt(dx * dx + dy * dy) * 2;
+    e.el.setAttribute("d", e.s === e.t ? "M" + e.s.x + "," + e.s.y + "a20,20 0 1,1 1,0" : "M" + e.s.x + "," + e.s.y + "A" + dr + "," + dr + " 0 0,1 " + e.t.x + "," + e.t.y);
+    e.el.classList.toggle("dim", selected !== null && e.s !== selected && e.t !== selected);
+  });
+  data.nodes.forEach(function (n) {
+    n.el.setAttribute("transform", "translate(" + n.x + "," + n.y + ")");
+    var linked = selected === null || n === selected || data.edges.some(function (e) { return show[e.decision] && ((e.s === selected && e.t === n) || (e.t === selected && e.s === n)); });
+    n.el.classList.toggle("dim", !linked || (term !== "" && n.label.toLowerCase().indexOf(term) === -1));
+  });
+  view.setAttribute("transform", "translate(" + tx + "," + ty + ") scale(" + scale + ")");
+  document.getElementById("counts").textContent = data.nodes.length + " nodes - " + shown + " of " + data.edges.length + " edges";
+}
+
+var alpha = 1, drag = null, pan = null;
+function step() { if (alpha > 0.01 || drag) { tick(Math.max(alpha, 0.05)); alpha *= 0.985; render(); } requestAnimationFrame(step); }
+svg.onmousedown = function (ev) { pan = {x: ev.clientX - tx, y: ev.clientY - ty}; };
+svg.onmousemove = function (ev) {
+  if (drag) { drag.x = (ev.clientX - tx) / scale; drag.y = (ev.clientY - ty) / scale; alpha = Math.max(alpha, 0.1); }
+  else if (pan) { tx = ev.clientX - pan.x; ty = ev.clientY - pan.y; render(); }
+};
+window.onmouseup = function () { drag = null; pan = null; };
+svg.onclick = function () { selected = null; document.getElementById("info").style.display = "none"; render(); };
+svg.onwheel = function (ev) {
+  ev.preventDefault();
+  var f = ev.deltaY < 0 ? 1.1 : 1 / 1.1;
+  tx = ev.clientX - (ev.clientX - tx) * f; ty = ev.clientY - (ev.clientY - ty) * f; scale *= f; render();
+};
+document.getElementById("search").oninput = render;
+render();
+step();
+</script>
+</body>
+</html>
+`
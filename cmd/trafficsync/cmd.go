@@ -0,0 +1,163 @@
+package trafficsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// DefaultStore is the default traffic store directory
+const DefaultStore = "workloader-traffic-store"
+
+var storeDir, start string
+var chunkHours, maxResults, retentionDays int
+
+func init() {
+	TrafficSyncCmd.Flags().StringVar(&storeDir, "store", DefaultStore, "directory of the traffic store. created if it does not exist.")
+	TrafficSyncCmd.Flags().StringVarP(&start, "start", "s", time.Now().AddDate(0, 0, -88).In(time.UTC).Format("2006-01-02"), "start date for the first sync in the format of yyyy-mm-dd. later syncs start at the end of the previous sync. all times in GMT.")
+	TrafficSyncCmd.Flags().IntVar(&chunkHours, "chunk-hours", 24, "hours of traffic in each explorer query. reduce if queries reach the max results.")
+	TrafficSyncCmd.Flags().IntVarP(&maxResults, "max-results", "m", 200000, "max results for each explorer query. maximum value is 200000.")
+	TrafficSyncCmd.Flags().IntVar(&retentionDays, "retention-days", 0, "delete days in the store older than this number of days. 0 keeps all days.")
+
+	TrafficSyncCmd.Flags().SortFlags = false
+}
+
+// TrafficSyncCmd pulls explorer traffic into the local traffic store
+var TrafficSyncCmd = &cobra.Command{
+	Use:   "traffic-sync",
+	Short: "Pull explorer traffic since the last sync into a local traffic store.",
+	Long: `
+Pull explorer traffic since the last sync into a local traffic store.
+
+The first sync starts at the --start date. Each later sync pulls only the window since the previous sync. The window is split into queries of --chunk-hours so the store is not limited by the explorer max results. A warning is logged if a query reaches the max results.
+
+The store is a directory with a gzipped json file of flows for each day and a state file with the pce and last sync time. Flows are deduplicated by source, destination, service, policy decision, and day. Connections for the same flow from different windows are summed. If the detected times of the flows overlap (e.g., a window is pulled again) the larger count is kept so connections are not counted twice. A store can only be synced from one pce.
+
+The traffic, appgroup-flow-summary, mislabel, unused-umwl, and port-usage commands use the store instead of explorer with --from-store. Policy decisions in the store are the reported decisions at the time of the sync.
+
+Schedule the command (e.g., daily) to keep the store current.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err := utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		if maxResults < 1 || maxResults > 200000 {
+			utils.LogError("max-results must be between 1 and 200000")
+		}
+		if chunkHours < 1 {
+			utils.LogError("chunk-hours must be greater than 0")
+		}
+
+		trafficSync(pce)
+	},
+}
+
+func trafficSync(pce ia.PCE) {
+
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		utils.LogError(err.Error())
+	}
+	st, err := readState(storeDir)
+	if err != nil {
+		utils.LogErrorf("reading traffic store state - %s", err)
+	}
+	if st.PCE != "" && st.PCE != pce.FQDN {
+		utils.LogErrorf("%s is a traffic store for %s. use a different --store for %s.", storeDir, st.PCE, pce.FQDN)
+	}
+
+	// Get the window
+	startTime := st.LastSync
+	if startTime.IsZero() {
+		startTime, err = time.Parse("2006-01-02 MST", fmt.Sprintf("%s UTC", start))
+		if err != nil {
+			utils.LogErrorf("error parsing start time: %s", err)
+		}
+	}
+	startTime = startTime.In(time.UTC)
+	endTime := time.Now().In(time.UTC)
+	utils.LogInfo(fmt.Sprintf("syncing %s traffic from %s to %s", pce.FriendlyName, startTime.Format(time.RFC3339), endTime.Format(time.RFC3339)), true)
+
+	// Pull each chunk and save the state after each so an interrupted sync resumes
+	var totalFlows, totalAdded, totalMerged int
+	for windowStart := startTime; windowStart.Before(endTime); {
+		windowEnd := windowStart.Add(time.Duration(chunkHours) * time.Hour)
+		if windowEnd.After(endTime) {
+			windowEnd = endTime
+		}
+		tq := ia.TrafficQuery{
+			StartTime:                       windowStart,
+			EndTime:                         windowEnd,
+			PolicyStatuses:                  []string{},
+			SourcesInclude:                  [][]string{make([]string, 0)},
+			DestinationsInclude:             [][]string{make([]string, 0)},
+			MaxFLows:                        maxResults,
+			ExcludeWorkloadsFromIPListQuery: true}
+		traffic, a, err := pce.GetTrafficAnalysis(tq)
+		utils.LogAPIRespV2("GetTrafficAnalysis", a)
+		if err != nil {
+			utils.LogError(err.Error())
+			return
+		}
+
+		// Store the explorer json so the flows can be read by either version of illumioapi
+		rawFlows := []map[string]interface{}{}
+		jsonBytes, err := json.Marshal(traffic)
+		if err == nil {
+			err = json.Unmarshal(jsonBytes, &rawFlows)
+		}
+		if err != nil {
+			utils.LogErrorf("converting explorer results - %s", err)
+			return
+		}
+		flows := Flows{}
+		for _, raw := range rawFlows {
+			flows = append(flows, Flow{Raw: raw})
+		}
+		if len(flows) >= maxResults {
+			utils.LogWarningf(true, "%s to %s reached the max results of %d. flows are missing from the store for this window. use a smaller --chunk-hours.", windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339), maxResults)
+		}
+
+		added, merged, err := add(storeDir, flows)
+		if err != nil {
+			utils.LogErrorf("writing traffic store - %s", err)
+			return
+		}
+		utils.LogInfo(fmt.Sprintf("%s to %s - %d flows - %d new - %d merged", windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339), len(flows), added, merged), true)
+		totalFlows, totalAdded, totalMerged = totalFlows+len(flows), totalAdded+added, totalMerged+merged
+
+		st.PCE, st.LastSync = pce.FQDN, windowEnd
+		if err := writeState(storeDir, st); err != nil {
+			utils.LogErrorf("writing traffic store state - %s", err)
+			return
+		}
+		windowStart = windowEnd
+	}
+
+	// Remove days past the retention
+	if retentionDays > 0 {
+		cutoff := time.Now().In(time.UTC).AddDate(0, 0, -retentionDays).Format(dayFormat)
+		files, _ := filepath.Glob(filepath.Join(storeDir, filePrefix+"*"+fileSuffix))
+		for _, file := range files {
+			if strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), filePrefix), fileSuffix) < cutoff {
+				if err := os.Remove(file); err != nil {
+					utils.LogWarningf(true, "removing %s - %s", file, err)
+					continue
+				}
+				utils.LogInfo(fmt.Sprintf("removed %s past the retention", file), true)
+			}
+		}
+	}
+
+	utils.LogInfo(fmt.Sprintf("sync complete - %d flows - %d new - %d merged into existing flows", totalFlows, totalAdded, totalMerged), true)
+}
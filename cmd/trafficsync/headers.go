@@ -0,0 +1,55 @@
+package trafficsync
+
+import "strings"
+
+// Constants for the csv headers of the traffic command with or without --from-store. Label columns are src_<key> and dst_<key>.
+const (
+	HeaderSrcIP              = "src_ip"
+	HeaderSrcHostname        = "src_hostname"
+	HeaderSrcHref            = "src_href"
+	HeaderSrcIPLists         = "src_iplists"
+	HeaderDstIP              = "dst_ip"
+	HeaderDstHostname        = "dst_hostname"
+	HeaderDstHref            = "dst_href"
+	HeaderDstIPLists         = "dst_iplists"
+	HeaderPort               = "port"
+	HeaderProto              = "proto"
+	HeaderProcessName        = "process_name"
+	HeaderWindowsServiceName = "windows_service_name"
+	HeaderUserName           = "user_name"
+	HeaderPolicyDecision     = "policy_decision"
+	HeaderFlowDirection      = "flow_direction"
+	HeaderTransmission       = "transmission"
+	HeaderNumConnections     = "num_connections"
+	HeaderFirstDetected      = "first_detected"
+	HeaderLastDetected       = "last_detected"
+)
+
+// headerAliases are the explorer csv names of the headers that are not the same after NormalizeHeader replaces the source and destination prefixes
+var headerAliases = map[string]string{
+	"src_ip_lists":             HeaderSrcIPLists,
+	"dst_ip_lists":             HeaderDstIPLists,
+	"protocol":                 HeaderProto,
+	"process":                  HeaderProcessName,
+	"windows_service":          HeaderWindowsServiceName,
+	"user":                     HeaderUserName,
+	"reported_policy_decision": HeaderPolicyDecision,
+	"num_flows":                HeaderNumConnections,
+	"flows":                    HeaderNumConnections,
+	"connections":              HeaderNumConnections,
+}
+
+// NormalizeHeader returns the header constant for an explorer csv header (e.g., "Source IP" is src_ip and "Num Flows" is num_connections).
+// Headers without a constant are returned lower case with underscores.
+func NormalizeHeader(header string) string {
+	h := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(header, "_", " ")), "_"))
+	for prefix, replacement := range map[string]string{"source_": "src_", "consumer_": "src_", "destination_": "dst_", "provider_": "dst_"} {
+		if strings.HasPrefix(h, prefix) {
+			h = replacement + strings.TrimPrefix(h, prefix)
+		}
+	}
+	if alias, ok := headerAliases[h]; ok {
+		return alias
+	}
+	return h
+}
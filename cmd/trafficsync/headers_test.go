@@ -0,0 +1,29 @@
+package trafficsync
+
+import "testing"
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Source IP", HeaderSrcIP},
+		{"Consumer Hostname", HeaderSrcHostname},
+		{"Destination IP Lists", HeaderDstIPLists},
+		{"Provider IP", HeaderDstIP},
+		{"Protocol", HeaderProto},
+		{"Process", HeaderProcessName},
+		{"Windows Service", HeaderWindowsServiceName},
+		{"Reported Policy Decision", HeaderPolicyDecision},
+		{"Num Flows", HeaderNumConnections},
+		{"First Detected", HeaderFirstDetected},
+		{" last_detected ", HeaderLastDetected},
+		{"Source app", "src_app"},
+		{HeaderPort, HeaderPort},
+	}
+	for _, tt := range tests {
+		if got := NormalizeHeader(tt.header); got != tt.want {
+			t.Errorf("NormalizeHeader(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package trafficsync
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/brian1917/illumioapi"
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// FilterV1 converts a v1 traffic query to a store filter
+func FilterV1(tq illumioapi.TrafficQuery) Filter {
+	return Filter{
+		StartTime:            tq.StartTime,
+		EndTime:              tq.EndTime,
+		PolicyStatuses:       tq.PolicyStatuses,
+		SourcesInclude:       tq.SourcesInclude,
+		DestinationsInclude:  tq.DestinationsInclude,
+		SourcesExclude:       tq.SourcesExclude,
+		DestinationsExclude:  tq.DestinationsExclude,
+		PortProtoInclude:     tq.PortProtoInclude,
+		PortProtoExclude:     tq.PortProtoExclude,
+		ProcessInclude:       tq.ProcessInclude,
+		ProcessExclude:       tq.ProcessExclude,
+		TransmissionExcludes: tq.TransmissionExcludes,
+		QueryOperator:        tq.QueryOperator,
+	}
+}
+
+// FilterV2 converts a v2 traffic query to a store filter
+func FilterV2(tq ia.TrafficQuery) Filter {
+	return Filter{
+		StartTime:            tq.StartTime,
+		EndTime:              tq.EndTime,
+		PolicyStatuses:       tq.PolicyStatuses,
+		SourcesInclude:       tq.SourcesInclude,
+		DestinationsInclude:  tq.DestinationsInclude,
+		SourcesExclude:       tq.SourcesExclude,
+		DestinationsExclude:  tq.DestinationsExclude,
+		PortProtoInclude:     tq.PortProtoInclude,
+		PortProtoExclude:     tq.PortProtoExclude,
+		ProcessInclude:       tq.ProcessInclude,
+		ProcessExclude:       tq.ProcessExclude,
+		TransmissionExcludes: tq.TransmissionExcludes,
+		QueryOperator:        tq.QueryOperator,
+	}
+}
+
+// QueryV1 returns the flows in the store that match the v1 traffic query. The max results of the query is not applied.
+func QueryV1(dir string, tq illumioapi.TrafficQuery) ([]illumioapi.TrafficAnalysis, error) {
+	flows, err := Load(dir, tq.StartTime, tq.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return flows.V1(tq)
+}
+
+// QueryV2 returns the flows in the store that match the v2 traffic query. The max results of the query is not applied.
+func QueryV2(dir string, tq ia.TrafficQuery) ([]ia.TrafficAnalysis, error) {
+	flows, err := Load(dir, tq.StartTime, tq.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return flows.V2(tq)
+}
+
+// V1 filters loaded flows with a v1 traffic query. Use it to run many queries against one load of the store.
+func (flows Flows) V1(tq illumioapi.TrafficQuery) ([]illumioapi.TrafficAnalysis, error) {
+	traffic := []illumioapi.TrafficAnalysis{}
+	err := flows.Filter(FilterV1(tq)).Unmarshal(&traffic)
+	return traffic, err
+}
+
+// V2 filters loaded flows with a v2 traffic query. Use it to run many queries against one load of the store.
+func (flows Flows) V2(tq ia.TrafficQuery) ([]ia.TrafficAnalysis, error) {
+	traffic := []ia.TrafficAnalysis{}
+	err := flows.Filter(FilterV2(tq)).Unmarshal(&traffic)
+	return traffic, err
+}
+
+// CSVData returns the flows as csv data with a column for each label key
+func (flows Flows) CSVData() [][]string {
+
+	// Get the label keys
+	keyMap := make(map[string]bool)
+	for _, flow := range flows {
+		for _, side := range []string{"src", "dst"} {
+			for k := range flow.labels(side) {
+				keyMap[k] = true
+			}
+		}
+	}
+	keys := []string{}
+	for k := range keyMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	headers := []string{HeaderSrcIP, HeaderSrcHostname, HeaderSrcHref}
+	for _, k := range keys {
+		headers = append(headers, "src_"+k)
+	}
+	headers = append(headers, HeaderSrcIPLists, HeaderDstIP, HeaderDstHostname, HeaderDstHref)
+	for _, k := range keys {
+		headers = append(headers, "dst_"+k)
+	}
+	headers = append(headers, HeaderDstIPLists, HeaderPort, HeaderProto, HeaderProcessName, HeaderWindowsServiceName, HeaderUserName, HeaderPolicyDecision, HeaderFlowDirection, HeaderTransmission, HeaderNumConnections, HeaderFirstDetected, HeaderLastDetected)
+
+	csvData := [][]string{headers}
+	for _, flow := range flows {
+		row := []string{}
+		for _, side := range []string{"src", "dst"} {
+			s := flow.side(side)
+			wkld, _ := s["workload"].(map[string]interface{})
+			row = append(row, flow.str(s, "ip"), flow.str(wkld, "hostname"), flow.str(wkld, "href"))
+			labels := flow.labels(side)
+			for _, k := range keys {
+				row = append(row, labels[k])
+			}
+			ipLists := []string{}
+			ipls, _ := s["ip_lists"].([]interface{})
+			for _, i := range ipls {
+				ipl, _ := i.(map[string]interface{})
+				ipLists = append(ipLists, flow.str(ipl, "name"))
+			}
+			row = append(row, strings.Join(ipLists, ";"))
+		}
+		svc := flow.service()
+		tr, _ := flow.Raw["timestamp_range"].(map[string]interface{})
+		row = append(row, flow.str(svc, "port"), ia.ProtocolList()[intValue(svc["proto"])], flow.str(svc, "process_name"), flow.str(svc, "windows_service_name"), flow.str(svc, "user_name"), flow.str(flow.Raw, "policy_decision"), flow.str(flow.Raw, "flow_direction"), flow.str(flow.Raw, "transmission"), flow.str(flow.Raw, "num_connections"), flow.str(tr, "first_detected"), flow.str(tr, "last_detected"))
+		csvData = append(csvData, row)
+	}
+	return csvData
+}
+
+// labels returns the workload labels of the side of the flow as key to value
+func (flow Flow) labels(side string) map[string]string {
+	labels := make(map[string]string)
+	wkld, _ := flow.side(side)["workload"].(map[string]interface{})
+	l, _ := wkld["labels"].([]interface{})
+	for _, label := range l {
+		m, _ := label.(map[string]interface{})
+		labels[flow.str(m, "key")] = flow.str(m, "value")
+	}
+	return labels
+}
+
+func intValue(v interface{}) int {
+	f, _ := v.(float64)
+	return int(f)
+}
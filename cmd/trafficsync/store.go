@@ -0,0 +1,456 @@
+package trafficsync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The store is a directory with a gzipped json lines file of explorer flows for each day and a state file
+const (
+	stateFileName = "state.json"
+	dayFormat     = "20060102"
+	filePrefix    = "flows-"
+	fileSuffix    = ".jsonl.gz"
+)
+
+// state is the sync state of the store
+type state struct {
+	PCE      string    `json:"pce"`
+	LastSync time.Time `json:"last_sync"`
+}
+
+// Flow is an explorer flow in the store. Raw is the explorer json so it can be unmarshaled into either version of illumioapi.
+type Flow struct {
+	Raw map[string]interface{}
+}
+
+// Flows is a set of flows loaded from the store
+type Flows []Flow
+
+// Filter is the subset of an explorer query evaluated against the store. The fields match illumioapi.TrafficQuery.
+// Sources and destinations are hrefs of workloads, labels, or ip lists, or ip addresses and cidrs.
+type Filter struct {
+	StartTime, EndTime                  time.Time
+	PolicyStatuses                      []string
+	SourcesInclude, DestinationsInclude [][]string
+	SourcesExclude, DestinationsExclude []string
+	PortProtoInclude, PortProtoExclude  [][2]int
+	ProcessInclude, ProcessExclude      []string
+	TransmissionExcludes                []string
+	QueryOperator                       string
+}
+
+func readState(dir string) (state, error) {
+	var s state
+	b, err := os.ReadFile(filepath.Join(dir, stateFileName))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+func writeState(dir string, s state) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, stateFileName), b, 0644)
+}
+
+func dayFile(dir string, day time.Time) string {
+	return filepath.Join(dir, filePrefix+day.Format(dayFormat)+fileSuffix)
+}
+
+// readDay returns the flows in the day file. A missing file is no flows.
+func readDay(file string) (Flows, error) {
+	flows := Flows{}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return flows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s - %s", file, err)
+	}
+	defer gz.Close()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		raw := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			return nil, fmt.Errorf("%s - %s", file, err)
+		}
+		flows = append(flows, Flow{Raw: raw})
+	}
+	return flows, scanner.Err()
+}
+
+// writeDay replaces the day file with the flows. The file is written to a temp file first so a failed write does not lose the day.
+func writeDay(file string, flows Flows) error {
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	encoder := json.NewEncoder(gz)
+	for _, flow := range flows {
+		if err := encoder.Encode(flow.Raw); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// add merges the flows into the day files. Flows with the same key on the same day are combined.
+// Flows that do not change the stored flow, from re-pulling a window, are skipped. It returns the number of new and merged flows.
+func add(dir string, flows Flows) (added, merged int, err error) {
+	days := make(map[string]Flows)
+	for _, flow := range flows {
+		day := flow.firstDetected().Format(dayFormat)
+		days[day] = append(days[day], flow)
+	}
+	for day, dayFlows := range days {
+		t, _ := time.Parse(dayFormat, day)
+		file := dayFile(dir, t)
+		existing, err := readDay(file)
+		if err != nil {
+			return added, merged, err
+		}
+		index := make(map[string]int)
+		for i, flow := range existing {
+			index[flow.key()] = i
+		}
+		for _, flow := range dayFlows {
+			i, ok := index[flow.key()]
+			if !ok {
+				index[flow.key()] = len(existing)
+				existing = append(existing, flow)
+				added++
+				continue
+			}
+			if existing[i].merge(flow) {
+				merged++
+			}
+		}
+		if err := writeDay(file, existing); err != nil {
+			return added, merged, err
+		}
+	}
+	return added, merged, nil
+}
+
+// Load returns the flows in the store that were detected between start and end.
+// Day files are by first detected so every day up to end is read. A flow from before start is kept if it was last detected after start.
+func Load(dir string, start, end time.Time) (Flows, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("traffic store %s - %s", dir, err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	flows := Flows{}
+	for _, file := range files {
+		day, err := time.Parse(dayFormat, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), filePrefix), fileSuffix))
+		if err != nil {
+			continue
+		}
+		if !end.IsZero() && day.After(end) {
+			continue
+		}
+		dayFlows, err := readDay(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, flow := range dayFlows {
+			if flow.inWindow(start, end) {
+				flows = append(flows, flow)
+			}
+		}
+	}
+	return flows, nil
+}
+
+// Filter returns the flows that match the filter
+func (flows Flows) Filter(f Filter) Flows {
+	matches := Flows{}
+	for _, flow := range flows {
+		if flow.match(f) {
+			matches = append(matches, flow)
+		}
+	}
+	return matches
+}
+
+// Unmarshal converts the flows to a slice of explorer results such as []illumioapi.TrafficAnalysis
+func (flows Flows) Unmarshal(v interface{}) error {
+	raw := make([]map[string]interface{}, 0, len(flows))
+	for _, flow := range flows {
+		raw = append(raw, flow.Raw)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// ******************** Flow fields ********************
+
+func (flow Flow) side(side string) map[string]interface{} {
+	m, _ := flow.Raw[side].(map[string]interface{})
+	return m
+}
+
+func (flow Flow) service() map[string]interface{} {
+	m, _ := flow.Raw["service"].(map[string]interface{})
+	return m
+}
+
+func (flow Flow) str(m map[string]interface{}, key string) string {
+	if m == nil || m[key] == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", m[key])
+}
+
+func (flow Flow) timestamp(key string) time.Time {
+	tr, _ := flow.Raw["timestamp_range"].(map[string]interface{})
+	t, _ := time.Parse(time.RFC3339, flow.str(tr, key))
+	return t
+}
+
+func (flow Flow) firstDetected() time.Time {
+	return flow.timestamp("first_detected").In(time.UTC)
+}
+
+// key identifies a flow on a day for deduplication
+func (flow Flow) key() string {
+	svc := flow.service()
+	return strings.Join([]string{
+		flow.firstDetected().Format(dayFormat),
+		flow.str(flow.side("src"), "ip"), flow.workloadHref("src"),
+		flow.str(flow.side("dst"), "ip"), flow.workloadHref("dst"),
+		flow.str(svc, "port"), flow.str(svc, "proto"), flow.str(svc, "process_name"), flow.str(svc, "windows_service_name"), flow.str(svc, "user_name"),
+		flow.str(flow.Raw, "policy_decision"), flow.str(flow.Raw, "transmission"), flow.str(flow.Raw, "flow_direction"),
+	}, "|")
+}
+
+func (flow Flow) workloadHref(side string) string {
+	wkld, _ := flow.side(side)["workload"].(map[string]interface{})
+	return flow.str(wkld, "href")
+}
+
+// hrefs returns the workload, label, and ip list hrefs of the side of the flow
+func (flow Flow) hrefs(side string) map[string]bool {
+	hrefs := make(map[string]bool)
+	s := flow.side(side)
+	if wkld, ok := s["workload"].(map[string]interface{}); ok {
+		hrefs[flow.str(wkld, "href")] = true
+		labels, _ := wkld["labels"].([]interface{})
+		for _, l := range labels {
+			label, _ := l.(map[string]interface{})
+			hrefs[flow.str(label, "href")] = true
+		}
+	}
+	ipLists, _ := s["ip_lists"].([]interface{})
+	for _, i := range ipLists {
+		ipl, _ := i.(map[string]interface{})
+		hrefs[flow.str(ipl, "href")] = true
+	}
+	return hrefs
+}
+
+// merge combines a flow with the same key into this flow. Connections are summed when the detected times do not overlap.
+// When they overlap (e.g., from re-pulling a window) the larger count is kept so connections are not counted twice.
+// It returns false if the flow did not change this flow.
+func (flow Flow) merge(other Flow) bool {
+	first, last := flow.timestamp("first_detected"), flow.timestamp("last_detected")
+	otherFirst, otherLast := other.timestamp("first_detected"), other.timestamp("last_detected")
+	overlap := (otherFirst.Before(last) && otherLast.After(first)) || (otherFirst.Equal(first) && otherLast.Equal(last))
+
+	changed := false
+	for _, key := range []string{"num_connections", "dst_bi", "dst_bo"} {
+		a, aOK := flow.Raw[key].(float64)
+		b, bOK := other.Raw[key].(float64)
+		switch {
+		case overlap && bOK && (!aOK || b > a):
+			flow.Raw[key] = b
+			changed = true
+		case !overlap && (aOK || bOK):
+			flow.Raw[key] = a + b
+			changed = true
+		}
+	}
+	tr, _ := flow.Raw["timestamp_range"].(map[string]interface{})
+	if tr != nil {
+		if !otherFirst.IsZero() && otherFirst.Before(first) {
+			tr["first_detected"] = otherFirst.Format(time.RFC3339)
+			changed = true
+		}
+		if otherLast.After(last) {
+			tr["last_detected"] = otherLast.Format(time.RFC3339)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ******************** Filter ********************
+
+func (flow Flow) match(f Filter) bool {
+
+	// Time
+	if !flow.inWindow(f.StartTime, f.EndTime) {
+		return false
+	}
+
+	// Policy decision and transmission
+	if len(f.PolicyStatuses) > 0 && !contains(f.PolicyStatuses, flow.str(flow.Raw, "policy_decision")) {
+		return false
+	}
+	if contains(f.TransmissionExcludes, flow.str(flow.Raw, "transmission")) {
+		return false
+	}
+
+	// Services
+	svc := flow.service()
+	port, proto := flow.str(svc, "port"), flow.str(svc, "proto")
+	portMatch := func(pp [2]int) bool {
+		return (pp[0] == 0 || fmt.Sprint(pp[0]) == port) && fmt.Sprint(pp[1]) == proto
+	}
+	if len(f.PortProtoInclude) > 0 && !anyPortProto(f.PortProtoInclude, portMatch) {
+		return false
+	}
+	if anyPortProto(f.PortProtoExclude, portMatch) {
+		return false
+	}
+	processes := []string{flow.str(svc, "process_name"), flow.str(svc, "windows_service_name")}
+	if len(f.ProcessInclude) > 0 && !contains(f.ProcessInclude, processes[0]) && !contains(f.ProcessInclude, processes[1]) {
+		return false
+	}
+	if (processes[0] != "" && contains(f.ProcessExclude, processes[0])) || (processes[1] != "" && contains(f.ProcessExclude, processes[1])) {
+		return false
+	}
+
+	// Excludes
+	for _, e := range f.SourcesExclude {
+		if flow.sideMatch("src", e) {
+			return false
+		}
+	}
+	for _, e := range f.DestinationsExclude {
+		if flow.sideMatch("dst", e) {
+			return false
+		}
+	}
+
+	// Includes. The or operator matches either the sources or destinations.
+	srcMatch, dstMatch := flow.includeMatch("src", f.SourcesInclude), flow.includeMatch("dst", f.DestinationsInclude)
+	if strings.EqualFold(f.QueryOperator, "or") && !isEmpty(f.SourcesInclude) && !isEmpty(f.DestinationsInclude) {
+		return srcMatch || dstMatch
+	}
+	return srcMatch && dstMatch
+}
+
+// inWindow checks the flow was detected between start and end. A zero start or end is not checked.
+func (flow Flow) inWindow(start, end time.Time) bool {
+	if !start.IsZero() && flow.timestamp("last_detected").Before(start) {
+		return false
+	}
+	if !end.IsZero() && flow.timestamp("first_detected").After(end) {
+		return false
+	}
+	return true
+}
+
+// includeMatch checks the include where the outer slice is OR and the inner slice is AND. An empty include matches all.
+func (flow Flow) includeMatch(side string, include [][]string) bool {
+	if isEmpty(include) {
+		return true
+	}
+	for _, and := range include {
+		if len(and) == 0 {
+			continue
+		}
+		matched := true
+		for _, entry := range and {
+			if !flow.sideMatch(side, entry) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sideMatch checks if the entry is an href of the side or contains its ip address
+func (flow Flow) sideMatch(side, entry string) bool {
+	if strings.HasPrefix(entry, "/orgs/") {
+		return flow.hrefs(side)[entry]
+	}
+	ip := net.ParseIP(flow.str(flow.side(side), "ip"))
+	if ip == nil {
+		return false
+	}
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network.Contains(ip)
+	}
+	return ip.Equal(net.ParseIP(entry))
+}
+
+func isEmpty(include [][]string) bool {
+	for _, and := range include {
+		if len(and) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func anyPortProto(pps [][2]int, match func([2]int) bool) bool {
+	for _, pp := range pps {
+		if match(pp) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(s []string, value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
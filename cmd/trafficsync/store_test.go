@@ -0,0 +1,212 @@
+package trafficsync
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// testFlow builds a flow from the explorer json fields used by the store
+func testFlow(t *testing.T, srcIP, dstIP string, port int, first, last string, connections int) Flow {
+	t.Helper()
+	raw := make(map[string]interface{})
+	b := []byte(`{
+		"src": {"ip": "` + srcIP + `", "workload": {"href": "/orgs/1/workloads/src", "labels": [{"href": "/orgs/1/labels/1"}]}},
+		"dst": {"ip": "` + dstIP + `", "ip_lists": [{"href": "/orgs/1/sec_policy/active/ip_lists/1"}]},
+		"service": {"port": ` + jsonNumber(port) + `, "proto": 6, "process_name": "nginx"},
+		"policy_decision": "potentially_blocked",
+		"flow_direction": "outbound",
+		"num_connections": ` + jsonNumber(connections) + `,
+		"timestamp_range": {"first_detected": "` + first + `", "last_detected": "` + last + `"}
+	}`)
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return Flow{Raw: raw}
+}
+
+func jsonNumber(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestAddMerge(t *testing.T) {
+	dir := t.TempDir()
+	first := testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z", 5)
+
+	added, merged, err := add(dir, Flows{first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || merged != 0 {
+		t.Fatalf("first add = %d added, %d merged, want 1, 0", added, merged)
+	}
+
+	tests := []struct {
+		name                string
+		flow                Flow
+		added, merged       int
+		flows               int
+		connections         float64
+		firstTime, lastTime string
+	}{
+		{"exact duplicate is skipped", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z", 5), 0, 0, 1, 5, "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z"},
+		{"same key later window is merged", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T12:00:00Z", "2024-03-01T13:00:00Z", 3), 0, 1, 1, 8, "2024-03-01T10:00:00Z", "2024-03-01T13:00:00Z"},
+		{"same key earlier window is merged", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T08:00:00Z", "2024-03-01T09:00:00Z", 2), 0, 1, 1, 10, "2024-03-01T08:00:00Z", "2024-03-01T13:00:00Z"},
+		{"overlapping window keeps the larger count", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T12:30:00Z", "2024-03-01T14:00:00Z", 4), 0, 1, 1, 10, "2024-03-01T08:00:00Z", "2024-03-01T14:00:00Z"},
+		{"overlapping window with fewer connections is skipped", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z", 5), 0, 0, 1, 10, "2024-03-01T08:00:00Z", "2024-03-01T14:00:00Z"},
+		{"overlapping window with more connections replaces the count", testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T08:00:00Z", "2024-03-01T14:00:00Z", 12), 0, 1, 1, 12, "2024-03-01T08:00:00Z", "2024-03-01T14:00:00Z"},
+		{"different port is added", testFlow(t, "10.0.0.1", "10.0.1.1", 80, "2024-03-01T08:00:00Z", "2024-03-01T09:00:00Z", 1), 1, 0, 2, 12, "2024-03-01T08:00:00Z", "2024-03-01T14:00:00Z"},
+	}
+	for _, tt := range tests {
+		added, merged, err := add(dir, Flows{tt.flow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != tt.added || merged != tt.merged {
+			t.Errorf("%s - add = %d added, %d merged, want %d, %d", tt.name, added, merged, tt.added, tt.merged)
+		}
+		flows, err := readDay(dayFile(dir, mustTime(t, "2024-03-01T00:00:00Z")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flows) != tt.flows {
+			t.Fatalf("%s - %d flows in the day file, want %d", tt.name, len(flows), tt.flows)
+		}
+		if got := flows[0].Raw["num_connections"]; got != tt.connections {
+			t.Errorf("%s - num_connections = %v, want %v", tt.name, got, tt.connections)
+		}
+		if got := flows[0].timestamp("first_detected"); !got.Equal(mustTime(t, tt.firstTime)) {
+			t.Errorf("%s - first_detected = %s, want %s", tt.name, got, tt.firstTime)
+		}
+		if got := flows[0].timestamp("last_detected"); !got.Equal(mustTime(t, tt.lastTime)) {
+			t.Errorf("%s - last_detected = %s, want %s", tt.name, got, tt.lastTime)
+		}
+	}
+}
+
+func TestAddSplitsDays(t *testing.T) {
+	dir := t.TempDir()
+	flows := Flows{
+		testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T23:00:00Z", "2024-03-02T01:00:00Z", 1),
+		testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-02T10:00:00Z", "2024-03-02T11:00:00Z", 1),
+	}
+	added, merged, err := add(dir, flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 || merged != 0 {
+		t.Errorf("add = %d added, %d merged, want 2, 0", added, merged)
+	}
+	for _, day := range []string{"2024-03-01T00:00:00Z", "2024-03-02T00:00:00Z"} {
+		dayFlows, err := readDay(dayFile(dir, mustTime(t, day)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dayFlows) != 1 {
+			t.Errorf("%d flows in the %s file, want 1", len(dayFlows), day)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := add(dir, Flows{
+		testFlow(t, "10.0.0.1", "10.0.1.1", 1, "2024-02-20T10:00:00Z", "2024-03-05T10:00:00Z", 1),
+		testFlow(t, "10.0.0.1", "10.0.1.1", 2, "2024-02-20T10:00:00Z", "2024-02-21T10:00:00Z", 1),
+		testFlow(t, "10.0.0.1", "10.0.1.1", 3, "2024-03-02T10:00:00Z", "2024-03-02T11:00:00Z", 1),
+		testFlow(t, "10.0.0.1", "10.0.1.1", 4, "2024-03-10T10:00:00Z", "2024-03-10T11:00:00Z", 1),
+		testFlow(t, "10.0.0.1", "10.0.1.1", 5, "2024-03-07T20:00:00Z", "2024-03-07T21:00:00Z", 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		ports      []float64
+	}{
+		{"long running flow from before start is loaded", "2024-03-01T00:00:00Z", "2024-03-07T12:00:00Z", []float64{1, 3}},
+		{"no end loads all days", "2024-03-01T00:00:00Z", "", []float64{1, 3, 5, 4}},
+		{"no start loads all days up to end", "", "2024-03-08T00:00:00Z", []float64{1, 2, 3, 5}},
+		{"window with no flows", "2024-03-11T00:00:00Z", "2024-03-12T00:00:00Z", []float64{}},
+	}
+	for _, tt := range tests {
+		var start, end time.Time
+		if tt.start != "" {
+			start = mustTime(t, tt.start)
+		}
+		if tt.end != "" {
+			end = mustTime(t, tt.end)
+		}
+		flows, err := Load(dir, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports := []float64{}
+		for _, f := range flows {
+			ports = append(ports, f.service()["port"].(float64))
+		}
+		if len(ports) != len(tt.ports) {
+			t.Errorf("%s - loaded ports %v, want %v", tt.name, ports, tt.ports)
+			continue
+		}
+		for i := range ports {
+			if ports[i] != tt.ports[i] {
+				t.Errorf("%s - loaded ports %v, want %v", tt.name, ports, tt.ports)
+				break
+			}
+		}
+	}
+
+	if _, err := Load(dir+"/missing", time.Time{}, time.Time{}); err == nil {
+		t.Error("Load of a missing store did not return an error")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	flow := testFlow(t, "10.0.0.1", "10.0.1.1", 443, "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z", 1)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"start before last detected", Filter{StartTime: mustTime(t, "2024-03-01T10:30:00Z")}, true},
+		{"start after last detected", Filter{StartTime: mustTime(t, "2024-03-01T11:30:00Z")}, false},
+		{"end before first detected", Filter{EndTime: mustTime(t, "2024-03-01T09:00:00Z")}, false},
+		{"policy status", Filter{PolicyStatuses: []string{"potentially_blocked"}}, true},
+		{"other policy status", Filter{PolicyStatuses: []string{"allowed", "blocked"}}, false},
+		{"transmission exclude", Filter{TransmissionExcludes: []string{"broadcast"}}, true},
+		{"port include", Filter{PortProtoInclude: [][2]int{{443, 6}}}, true},
+		{"protocol include with any port", Filter{PortProtoInclude: [][2]int{{0, 6}}}, true},
+		{"port include other protocol", Filter{PortProtoInclude: [][2]int{{443, 17}}}, false},
+		{"port exclude", Filter{PortProtoExclude: [][2]int{{443, 6}}}, false},
+		{"process include", Filter{ProcessInclude: []string{"nginx"}}, true},
+		{"process exclude", Filter{ProcessExclude: []string{"nginx"}}, false},
+		{"source workload href", Filter{SourcesInclude: [][]string{{"/orgs/1/workloads/src"}}}, true},
+		{"source label and cidr", Filter{SourcesInclude: [][]string{{"/orgs/1/labels/1", "10.0.0.0/24"}}}, true},
+		{"source label and other cidr", Filter{SourcesInclude: [][]string{{"/orgs/1/labels/1", "10.9.0.0/24"}}}, false},
+		{"source or", Filter{SourcesInclude: [][]string{{"/orgs/1/labels/2"}, {"10.0.0.1"}}}, true},
+		{"destination ip list", Filter{DestinationsInclude: [][]string{{"/orgs/1/sec_policy/active/ip_lists/1"}}}, true},
+		{"destination exclude", Filter{DestinationsExclude: []string{"10.0.1.0/24"}}, false},
+		{"source exclude other", Filter{SourcesExclude: []string{"/orgs/1/labels/2"}}, true},
+		{"and operator needs both sides", Filter{SourcesInclude: [][]string{{"10.0.0.1"}}, DestinationsInclude: [][]string{{"10.9.9.9"}}}, false},
+		{"or operator needs either side", Filter{SourcesInclude: [][]string{{"10.0.0.1"}}, DestinationsInclude: [][]string{{"10.9.9.9"}}, QueryOperator: "or"}, true},
+	}
+	for _, tt := range tests {
+		if got := len(Flows{flow}.Filter(tt.filter)) == 1; got != tt.want {
+			t.Errorf("%s - match = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // Set global variables for flags
-var hrefFile, labelFile, neverUnpairFile, hrefHeader, restore string
+var hrefFile, labelFile, selectExpr, neverUnpairFile, hrefHeader, restore string
 var updatePCE, noPrompt, includeOnline, singleAPI, singleUnpair bool
 var hoursSinceLastHB int
 var pce illumioapi.PCE
@@ -25,6 +25,7 @@ func init() {
 	UnpairCmd.Flags().StringVar(&hrefFile, "href-file", "", "csv file with target ven hrefs to unpair. the input file should have a header row. use the --header flag to specify the header with the ven href.")
 	UnpairCmd.Flags().StringVar(&hrefHeader, "header", "ven_href", "column header for ven hrefs in the href-file.")
 	UnpairCmd.Flags().StringVar(&labelFile, "label-file", "", "csv file with labels to filter query. see description below.")
+	UnpairCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to target workloads. can be combined with label-file. see description below.")
 	UnpairCmd.Flags().StringVar(&neverUnpairFile, "never-unpair-file", "", "csv file with hrefs that should never be unpaired (e.g., hrefs of VDI golden images). headers are optional.")
 	UnpairCmd.Flags().IntVar(&hoursSinceLastHB, "hours", 0, "limit unpairing to workloads that have not sent a heartbeat in set time. 0 will ignore heartbeats.")
 	UnpairCmd.Flags().BoolVar(&includeOnline, "include-online", false, "include workloads that are online. by default only offline workloads that meet criteria will be unpaired.")
@@ -56,6 +57,9 @@ This example queries all workloads that are
 - OR bos(loc) AND it (bu)
 - OR CRM (app)
 
+Workloads can also be targeted with --select.
+` + utils.SelectorHelp + `
+
 Use the --update-pce command to run the unpair with a user prompt confirmation. Use --update-pce and --no-prompt to run unpair with no prompts.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
@@ -80,12 +84,18 @@ func unpair() {
 		utils.LogError("restore value must be saved, default, or disable.")
 	}
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Check the input files
-	if hrefFile == "" && labelFile == "" {
-		utils.LogError("must provide either a label file or href file.")
+	if hrefFile == "" && labelFile == "" && selector == nil {
+		utils.LogError("must provide a label file, selector, or href file.")
 	}
-	if hrefFile != "" && labelFile != "" {
-		utils.LogError("cannot provide both a label file and href file.")
+	if hrefFile != "" && (labelFile != "" || selector != nil) {
+		utils.LogError("cannot provide an href file with a label file or selector.")
 	}
 	if hrefFile == "" && singleAPI {
 		utils.LogError("single-api only valid when using an href file.")
@@ -119,6 +129,7 @@ func unpair() {
 		}
 		// Get workloads, VENs, and label dimensions
 		pce.Load(illumioapi.LoadInput{Workloads: true, VENs: true, LabelDimensions: true, WorkloadsQueryParameters: wkldParams}, utils.UseMulti())
+		pce.WorkloadsSlice = selector.FilterV2(pce.WorkloadsSlice, pce.Labels)
 	} else {
 		// Get the VENs individually
 		pce.VENs = make(map[string]illumioapi.VEN)
@@ -154,7 +165,7 @@ func unpair() {
 	}
 
 	// Build the href file from the label data export
-	if labelFile != "" {
+	if labelFile != "" || selector != nil {
 		// Get the workloads
 		headers := []string{"ven_href", "hostname"}
 		for _, ld := range pce.LabelDimensionsSlice {
@@ -292,7 +303,10 @@ func processVENsFile() []illumioapi.VEN {
 				}
 			}
 		} else {
-			// Skip if on the list
+			// Skip blank hrefs and hrefs on the list
+			if row[venHrefCol] == "" {
+				continue
+			}
 			if neverUnpairHrefs[row[venHrefCol]] {
 				utils.LogInfof(true, "skipping %s because it is in the always skip list", row[venHrefCol])
 			} else {
@@ -0,0 +1,260 @@
+package unusedobjects
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/cmd/deletehrefs"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Object types
+const (
+	typeIPList            = "ip_list"
+	typeService           = "service"
+	typeLabelGroup        = "label_group"
+	typeVirtualService    = "virtual_service"
+	typeConsumingSecPrinc = "consuming_security_principal"
+	typeAuthSecPrinc      = "auth_security_principal"
+)
+
+var pce illumioapi.PCE
+var err error
+var neverDeleteFile, objectTypes, outputFileName string
+var provision bool
+
+// builtInNeverDelete are objects created by the PCE that cannot be deleted
+var builtInNeverDelete = map[string]bool{"Any (0.0.0.0/0 and ::/0)": true, "All Services": true}
+
+func init() {
+	UnusedObjectsCmd.Flags().StringVar(&objectTypes, "types", "", fmt.Sprintf("comma-separated list of object types to check. options are %s. default is all.", strings.Join(allTypes(), ", ")))
+	UnusedObjectsCmd.Flags().StringVar(&neverDeleteFile, "never-delete", "", "csv file with names or hrefs in the first column that are never reported or deleted. headers optional.")
+	UnusedObjectsCmd.Flags().BoolVar(&provision, "provision", false, "provision the deletion of ip lists, services, label groups, and virtual services.")
+	UnusedObjectsCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
+	UnusedObjectsCmd.Flags().SortFlags = false
+}
+
+// UnusedObjectsCmd finds and optionally deletes objects that nothing references
+var UnusedObjectsCmd = &cobra.Command{
+	Use:   "unused-objects",
+	Short: "Find and optionally delete ip lists, services, label groups, virtual services, and security principals that are not referenced.",
+	Long: `
+Find and optionally delete ip lists, services, label groups, virtual services, and security principals that are not referenced.
+
+References are collected from draft and active rulesets (scopes and rules), draft and active deny rules, label groups, pairing profiles, container workload profiles, and permissions. A label group only referenced by another unused label group is also unused.
+
+Auth security principals are only checked if they are groups. The "Any (0.0.0.0/0 and ::/0)" ip list and "All Services" service are never included. Use --never-delete to provide a csv of other names or hrefs to never include.
+
+A csv of unused objects is always created. Use --update-pce to delete them. The --provision flag will provision the deletions of policy objects.
+
+Recommended to run without --update-pce first to review the unused objects.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		pce, err = utils.GetTargetPCEV2(true)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		unusedObjects(viper.Get("update_pce").(bool), viper.Get("no_prompt").(bool))
+	},
+}
+
+// allTypes returns the object types that can be checked
+func allTypes() []string {
+	return []string{typeIPList, typeService, typeLabelGroup, typeVirtualService, typeConsumingSecPrinc, typeAuthSecPrinc}
+}
+
+// unusedObject is an object with no references
+type unusedObject struct {
+	objectType string
+	name       string
+	href       string
+}
+
+func unusedObjects(updatePCE, noPrompt bool) {
+
+	// Parse the types
+	checkTypes := make(map[string]bool)
+	if objectTypes == "" {
+		for _, t := range allTypes() {
+			checkTypes[t] = true
+		}
+	} else {
+		for _, t := range strings.Split(strings.ReplaceAll(objectTypes, " ", ""), ",") {
+			valid := false
+			for _, a := range allTypes() {
+				if t == a {
+					valid = true
+				}
+			}
+			if !valid {
+				utils.LogError(fmt.Sprintf("%s is not a valid type. options are %s", t, strings.Join(allTypes(), ", ")))
+			}
+			checkTypes[t] = true
+		}
+	}
+
+	// Parse the never delete file
+	neverDelete := make(map[string]bool)
+	for k, v := range builtInNeverDelete {
+		neverDelete[k] = v
+	}
+	if neverDeleteFile != "" {
+		csvData, err := utils.ParseCSV(neverDeleteFile)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for _, row := range csvData {
+			if len(row) > 0 && row[0] != "" {
+				neverDelete[row[0]] = true
+			}
+		}
+	}
+
+	// refs holds the hrefs referenced by everything except label groups. label group references are kept separate so sub groups of unused label groups are also unused.
+	refs := make(map[string]bool)
+	labelGroupRefs := make(map[string]map[string]bool)
+
+	// Get the active objects first so the draft objects are in the pce maps at the end
+	for _, policyVersion := range []string{"active", "draft"} {
+		utils.LogInfo(fmt.Sprintf("getting %s rulesets, deny rules, and label groups...", policyVersion), true)
+		loadInput := illumioapi.LoadInput{RuleSets: true, EnforcementBoundaries: true, LabelGroups: true, ProvisionStatus: policyVersion}
+		if policyVersion == "draft" {
+			loadInput.IPLists = true
+			loadInput.Services = true
+			loadInput.VirtualServices = true
+			loadInput.ConsumingSecurityPrincipals = true
+			loadInput.Permissions = true
+			loadInput.AuthSecurityPrincipals = true
+		}
+		apiResps, err := pce.Load(loadInput, utils.UseMulti())
+		utils.LogMultiAPIRespV2(apiResps)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for _, rs := range pce.RuleSetsSlice {
+			addHrefs(rs, refs)
+		}
+		for _, eb := range pce.EnforcementBoundariesSlice {
+			addHrefs(eb, refs)
+		}
+		for _, lg := range pce.LabelGroupsSlice {
+			href := draftHref(lg.Href)
+			if labelGroupRefs[href] == nil {
+				labelGroupRefs[href] = make(map[string]bool)
+			}
+			addHrefs(lg, labelGroupRefs[href])
+		}
+	}
+	for _, p := range pce.PermissionsSlice {
+		addHrefs(p, refs)
+	}
+
+	// Pairing profiles
+	pairingProfiles, api, err := pce.GetPairingProfiles(nil)
+	utils.LogAPIRespV2("GetPairingProfiles", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	for _, pp := range pairingProfiles {
+		addHrefs(pp, refs)
+	}
+
+	// Container workload profiles
+	api, err = pce.GetContainerClusters(nil)
+	utils.LogAPIRespV2("GetContainerClusters", api)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	for _, cc := range pce.ContainerClustersSlice {
+		api, err := pce.GetContainerWkldProfiles(nil, cc.ID())
+		utils.LogAPIRespV2("GetContainerWkldProfiles", api)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for _, cwp := range pce.ContainerWorkloadProfilesSlice {
+			addHrefs(cwp, refs)
+		}
+	}
+
+	// Add references from used label groups until nothing new is referenced
+	expanded := make(map[string]bool)
+	for {
+		added := false
+		for lgHref, lgRefs := range labelGroupRefs {
+			if !refs[lgHref] || expanded[lgHref] {
+				continue
+			}
+			expanded[lgHref] = true
+			for href := range lgRefs {
+				if !refs[href] {
+					refs[href] = true
+					added = true
+				}
+			}
+		}
+		if !added {
+			break
+		}
+	}
+
+	// Find the unused objects
+	unused := []unusedObject{}
+	check := func(objectType, name, href string) {
+		if !checkTypes[objectType] || refs[draftHref(href)] || neverDelete[name] || neverDelete[href] {
+			return
+		}
+		unused = append(unused, unusedObject{objectType: objectType, name: name, href: href})
+	}
+	for _, ipl := range pce.IPListsSlice {
+		check(typeIPList, ipl.Name, ipl.Href)
+	}
+	for _, svc := range pce.ServicesSlice {
+		check(typeService, svc.Name, svc.Href)
+	}
+	for _, lg := range pce.LabelGroupsSlice {
+		check(typeLabelGroup, lg.Name, lg.Href)
+	}
+	for _, vs := range pce.VirtualServicesSlice {
+		check(typeVirtualService, vs.Name, vs.Href)
+	}
+	for _, csp := range pce.ConsumingSecurityPrincipalsSlice {
+		check(typeConsumingSecPrinc, csp.Name, csp.Href)
+	}
+	for _, asp := range pce.AuthSecurityPrincipalsSlices {
+		if asp.Type != "group" || (asp.Name == "" && asp.DisplayName == "") {
+			continue
+		}
+		check(typeAuthSecPrinc, asp.DisplayName, asp.Href)
+	}
+
+	// Output the results
+	if len(unused) == 0 {
+		utils.LogInfo("no unused objects found", true)
+		return
+	}
+	csvData := [][]string{{"object_type", "name", "href"}}
+	hrefs := []string{}
+	typeCounts := make(map[string]int)
+	for _, u := range unused {
+		csvData = append(csvData, []string{u.objectType, u.name, u.href})
+		hrefs = append(hrefs, u.href)
+		typeCounts[u.objectType]++
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-unused-objects-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, outputFileName)
+	for _, t := range allTypes() {
+		if checkTypes[t] {
+			utils.LogInfo(fmt.Sprintf("%s: %d unused", t, typeCounts[t]), true)
+		}
+	}
+
+	// Delete using the delete command. it handles the update-pce and no-prompt logic.
+	deletehrefs.DeleteHrefs(deletehrefs.Input{Hrefs: hrefs, UpdatePCE: updatePCE, NoPrompt: noPrompt, Provision: provision, PCE: pce})
+}
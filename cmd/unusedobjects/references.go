@@ -0,0 +1,57 @@
+package unusedobjects
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/brian1917/workloader/utils"
+)
+
+// addHrefs adds every href referenced in the object to the refs map. The object's own href (the top level href) is skipped.
+// Walking the JSON representation picks up references in any field (scopes, consumers, providers, services, sub groups, etc.)
+func addHrefs(object interface{}, refs map[string]bool) {
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	var generic interface{}
+	if err := json.Unmarshal(jsonBytes, &generic); err != nil {
+		utils.LogError(err.Error())
+	}
+	if topLevel, ok := generic.(map[string]interface{}); ok {
+		for key, value := range topLevel {
+			if key == "href" {
+				continue
+			}
+			walkHrefs(value, refs)
+		}
+		return
+	}
+	walkHrefs(generic, refs)
+}
+
+// walkHrefs recursively finds href values
+func walkHrefs(value interface{}, refs map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if href, ok := child.(string); ok && key == "href" {
+				refs[draftHref(href)] = true
+				continue
+			}
+			walkHrefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkHrefs(child, refs)
+		}
+	}
+}
+
+// policyVersionRegex matches the policy version portion of a policy object href
+var policyVersionRegex = regexp.MustCompile(`/sec_policy/[^/]+/`)
+
+// draftHref converts an active or historical policy object href to the draft href so references from all versions can be compared
+func draftHref(href string) string {
+	return policyVersionRegex.ReplaceAllString(href, "/sec_policy/draft/")
+}
@@ -10,7 +10,7 @@ import (
 
 var pce illumioapi.PCE
 var err error
-var start, end, exclServiceCSV, outputFileName string
+var start, end, exclServiceCSV, fromStore, outputFileName string
 var nonUni, includeAllUmwls bool
 var maxResults int
 
@@ -21,6 +21,7 @@ func init() {
 	UnusedUmwlCmd.Flags().StringVarP(&end, "end", "e", time.Now().Add(time.Hour*24).Format("2006-01-02"), "end date in the format of yyyy-mm-dd.")
 	UnusedUmwlCmd.Flags().BoolVarP(&nonUni, "incl-non-unicast", "n", false, "includes non-unicast (broadcast and multicast) flows in the output. Default is unicast only.")
 	UnusedUmwlCmd.Flags().StringVarP(&exclServiceCSV, "excl-svc-file", "x", "", "file location of csv with port/protocols to exclude. Port number in column 1 and IANA numeric protocol in Col 2. Headers optional.")
+	UnusedUmwlCmd.Flags().StringVar(&fromStore, "from-store", "", "query the local traffic store populated by traffic-sync instead of explorer. value is the store directory.")
 	UnusedUmwlCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename. If iterating through labels, the labels will be appended to the provided name before the provided file extension. To name the files for the labels, use just an extension (--output-file .csv).")
 	UnusedUmwlCmd.Flags().SortFlags = false
 
@@ -33,6 +34,8 @@ var UnusedUmwlCmd = &cobra.Command{
 	Long: `
 	Create a report of unmanaged workloads with no traffic.
 
+Use --from-store to query a local traffic store populated by traffic-sync instead of running an explorer query for each unmanaged workload. The max-results flag does not apply to the store.
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/brian1917/illumioapi"
+	"github.com/brian1917/workloader/cmd/trafficsync"
 	"github.com/brian1917/workloader/utils"
 )
 
@@ -55,6 +56,16 @@ func unusedUmwl() {
 		tq.TransmissionExcludes = []string{"broadcast", "multicast"}
 	}
 
+	// Load the traffic store once for all the queries
+	var flows trafficsync.Flows
+	if fromStore != "" {
+		flows, err = trafficsync.Load(fromStore, tq.StartTime, tq.EndTime)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		utils.LogInfo(fmt.Sprintf("loaded %d flows from traffic store %s", len(flows), fromStore), true)
+	}
+
 	// Start the CSV data
 	csvData := [][]string{{"hostname", "name", "href", "role", "app", "env", "loc", "interfaces", "traffic_count"}}
 
@@ -62,8 +73,13 @@ func unusedUmwl() {
 	for _, umwl := range umwls {
 		tq.SourcesInclude = [][]string{{umwl.Href}}
 		tq.DestinationsInclude = [][]string{{umwl.Href}}
-		traffic, a, err := pce.GetTrafficAnalysis(tq)
-		utils.LogAPIResp("GetTrafficAnalysis", a)
+		var traffic []illumioapi.TrafficAnalysis
+		if fromStore != "" {
+			traffic, err = flows.V1(tq)
+		} else {
+			traffic, a, err = pce.GetTrafficAnalysis(tq)
+			utils.LogAPIResp("GetTrafficAnalysis", a)
+		}
 		if err != nil {
 			utils.LogError(err.Error())
 		}
@@ -85,7 +101,7 @@ func unusedUmwl() {
 
 		// Log iteration
 		str := ""
-		if len(traffic) == maxResults {
+		if len(traffic) == maxResults && fromStore == "" {
 			str = " (query max results)"
 		}
 		utils.LogInfo(fmt.Sprintf("href: %s - hostname: %s - name: %s - %d traffic records%s", umwl.Href, umwl.Hostname, umwl.Name, len(traffic), str), true)
@@ -2,6 +2,7 @@ package upgrade
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,8 +13,11 @@ import (
 )
 
 // Set global variables for flags
-var targetVersion, hostFile, loc, env, app, role, outputFileName string
-var singleAPI, updatePCE, noPrompt bool
+var targetVersion, hostFile, loc, env, app, role, selectExpr, outputFileName, stateFile string
+var waveDefinitions []string
+var waveTimeout, pollInterval int
+var maxFailurePct float64
+var singleAPI, updatePCE, noPrompt, resume bool
 var pce illumioapi.PCE
 var err error
 
@@ -28,6 +32,13 @@ func init() {
 	UpgradeCmd.Flags().StringVarP(&env, "env", "e", "", "environment label. blank means all environments.")
 	UpgradeCmd.Flags().StringVarP(&app, "app", "a", "", "application label. blank means all applications.")
 	UpgradeCmd.Flags().StringVarP(&role, "role", "r", "", "role Label. blank means all roles.")
+	UpgradeCmd.Flags().StringVar(&selectExpr, "select", "", "selector expression to target workloads. can be combined with label flags. see description below.")
+	UpgradeCmd.Flags().StringArrayVar(&waveDefinitions, "wave", []string{}, "wave definition as a percentage (e.g., 5%) or selector expression. use the flag multiple times for multiple waves in order. see description below.")
+	UpgradeCmd.Flags().IntVar(&waveTimeout, "wave-timeout", 60, "minutes to wait for the vens in a wave to reach the target version and be online.")
+	UpgradeCmd.Flags().IntVar(&pollInterval, "poll-interval", 60, "seconds between checks of ven status during a wave.")
+	UpgradeCmd.Flags().Float64Var(&maxFailurePct, "max-failure-pct", 10, "halt the upgrade if the percentage of failed vens in a wave exceeds this value.")
+	UpgradeCmd.Flags().StringVar(&stateFile, "state-file", "workloader-upgrade-state.json", "file to save wave progress to.")
+	UpgradeCmd.Flags().BoolVar(&resume, "resume", false, "resume a wave upgrade from the state file. target selection flags are ignored.")
 	UpgradeCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	UpgradeCmd.Flags().SortFlags = false
@@ -41,9 +52,16 @@ var UpgradeCmd = &cobra.Command{
 	Long: `
 Upgrade the VEN installed on workloads by labels or an input hostname list.
 
-If a host file is used, the label flags are ignored.
+If a host file is used, the label and select flags are ignored.
 
-All workloads will be upgraded if there is no hostfile and no provided labels.
+All workloads will be upgraded if there is no hostfile and no provided labels or selector.
+
+` + utils.SelectorHelp + `
+
+Waves:
+Use --wave to upgrade in stages. Each wave is a percentage of the targeted vens (e.g., 5%) or a selector expression. Selector waves take the matching vens not already in an earlier wave. Targeted vens not in any wave are upgraded in a final wave. Example: --wave 2% --wave "env=dev" --wave 25%
+
+Each wave is upgraded and then the ven status is checked every --poll-interval seconds until every ven in the wave is on the target version, active, healthy (no error or warning conditions), and its workload is online, or --wave-timeout minutes pass. Vens that time out, are unhealthy, or return an upgrade error are failures. If the failure rate of a wave exceeds --max-failure-pct, the upgrade halts. Progress is saved to --state-file after every step. Use --resume to continue an interrupted or halted upgrade. A halted upgrade resumes with the next wave. A csv with the result of each ven is created after each wave.
 
 Default output is a CSV file with what would be upgraded. Use the --update-pce command to run the upgrades with a user prompt confirmation. Use --update-pce and --no-prompt to run upgrade with no prompts.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -62,6 +80,18 @@ Default output is a CSV file with what would be upgraded. Use the --update-pce c
 
 func wkldUpgrade() {
 
+	// Resume from the state file
+	if resume {
+		resumeUpgrade()
+		return
+	}
+
+	// Parse the selector
+	selector, err := utils.ParseSelector(selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Set up the target slices
 	var targetVENs []illumioapi.VEN
 	var targetWorkloads []illumioapi.Workload
@@ -160,6 +190,9 @@ func wkldUpgrade() {
 			if loc != "" && w.GetLoc(pce.Labels).Value != loc {
 				continue
 			}
+			if !selector.Match(utils.SelectorTargetV1(w, pce.Labels)) {
+				continue
+			}
 			if pce.VENs[w.VEN.Href].Version == targetVersion {
 				continue
 			}
@@ -188,12 +221,34 @@ func wkldUpgrade() {
 		utils.LogError("target vens exceed max length of 25,000")
 	}
 
+	// Plan the waves
+	var waves []wave
+	venWave := make(map[string]string)
+	if len(waveDefinitions) > 0 {
+		waves, err = planWaves(waveDefinitions, targetVENs, wkldByVenHrefMap)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+		for i, w := range waves {
+			for _, href := range w.VENHrefs {
+				venWave[href] = strconv.Itoa(i + 1)
+			}
+		}
+	}
+
 	// Build output data
 	if len(targetVENs) > 0 {
 		outputData := [][]string{{"hostname", "ven_href", "wkld_href", "role", "app", "env", "loc", "current_ven_version", "targeted_ven_version"}}
+		if len(waves) > 0 {
+			outputData[0] = append(outputData[0], "wave")
+		}
 		for _, t := range targetVENs {
 			targetWkld := pce.Workloads[t.Hostname]
-			outputData = append(outputData, []string{t.Hostname, t.Href, targetWkld.Href, targetWkld.GetRole(pce.Labels).Value, targetWkld.GetApp(pce.Labels).Value, targetWkld.GetEnv(pce.Labels).Value, targetWkld.GetLoc(pce.Labels).Value, t.Version, targetVersion})
+			row := []string{t.Hostname, t.Href, targetWkld.Href, targetWkld.GetRole(pce.Labels).Value, targetWkld.GetApp(pce.Labels).Value, targetWkld.GetEnv(pce.Labels).Value, targetWkld.GetLoc(pce.Labels).Value, t.Version, targetVersion}
+			if len(waves) > 0 {
+				row = append(row, venWave[t.Href])
+			}
+			outputData = append(outputData, row)
 		}
 		if outputFileName == "" {
 			outputFileName = "workloader-upgrade-" + time.Now().Format("20060102_150405") + ".csv"
@@ -219,6 +274,14 @@ func wkldUpgrade() {
 			}
 		}
 
+		// Run the waves
+		if len(waves) > 0 {
+			state := upgradeState{PCE: pce.FQDN, TargetVersion: targetVersion, Waves: waves}
+			saveState(state)
+			runWaves(state, strings.TrimSuffix(outputFileName, ".csv")+"-waves.csv")
+			return
+		}
+
 		// Call the API
 		resp, a, err := pce.UpgradeVENs(targetVENs, targetVersion)
 		utils.LogAPIResp("UpgradeVENs", a)
@@ -237,3 +300,50 @@ func wkldUpgrade() {
 	}
 
 }
+
+// resumeUpgrade continues a wave upgrade from the state file
+func resumeUpgrade() {
+	state, err := readState(stateFile)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if state.PCE != pce.FQDN {
+		utils.LogError(fmt.Sprintf("state file is for %s. target pce is %s", state.PCE, pce.FQDN))
+	}
+	if state.TargetVersion != targetVersion {
+		utils.LogError(fmt.Sprintf("state file target version is %s. --version is %s", state.TargetVersion, targetVersion))
+	}
+
+	remaining := 0
+	for _, w := range state.Waves {
+		if !w.Complete {
+			remaining += len(w.VENHrefs)
+		}
+	}
+	if remaining == 0 {
+		utils.LogInfo(fmt.Sprintf("all waves in %s are complete", stateFile), true)
+		return
+	}
+
+	// If updatePCE is disabled, we are just going to alert the user what will happen and log
+	if !updatePCE {
+		utils.LogInfo(fmt.Sprintf("workloader identified %d vens in incomplete waves in %s. To resume the upgrade, run again using --update-pce flag. The --no-prompt flag will bypass the prompt if used with --update-pce.", remaining, stateFile), true)
+		return
+	}
+
+	// If updatePCE is set, but not noPrompt, we will prompt the user.
+	if !noPrompt {
+		var prompt string
+		fmt.Printf("[PROMPT] - workloader identified %d vens in incomplete waves in %s for %s (%s). Do you want to resume the upgrade? (yes/no)? ", remaining, stateFile, pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+		fmt.Scanln(&prompt)
+		if strings.ToLower(prompt) != "yes" {
+			utils.LogInfo("prompt denied to resume upgrade", true)
+			return
+		}
+	}
+
+	if outputFileName == "" {
+		outputFileName = "workloader-upgrade-" + time.Now().Format("20060102_150405") + ".csv"
+	}
+	runWaves(state, strings.TrimSuffix(outputFileName, ".csv")+"-waves.csv")
+}
@@ -0,0 +1,294 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brian1917/illumioapi"
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Wave results
+const (
+	resultUpgraded  = "upgraded"
+	resultTimeout   = "timeout"
+	resultUnhealthy = "unhealthy"
+	resultError     = "upgrade error"
+)
+
+// wave is a group of vens upgraded together
+type wave struct {
+	Definition string            `json:"definition"`
+	VENHrefs   []string          `json:"ven_hrefs"`
+	Complete   bool              `json:"complete"`
+	Results    map[string]string `json:"results"`
+}
+
+// upgradeState is saved to the state file after every step so an interrupted upgrade can be resumed
+type upgradeState struct {
+	PCE           string `json:"pce"`
+	TargetVersion string `json:"target_version"`
+	Waves         []wave `json:"waves"`
+}
+
+// venState is the polled status of a ven
+type venState struct {
+	hostname  string
+	version   string
+	status    string
+	online    bool
+	health    string
+	unhealthy bool
+}
+
+// upgraded returns true if the ven is on the target version, active, and online
+func (v venState) upgraded(targetVersion string) bool {
+	return v.version == targetVersion && v.status == "active" && v.online
+}
+
+// done returns true if the ven is upgraded and has no error or warning conditions
+func (v venState) done(targetVersion string) bool {
+	return v.upgraded(targetVersion) && !v.unhealthy
+}
+
+// planWaves splits the target vens into waves. Percentages are of the total target vens. Selector waves take the matching vens not in an earlier wave.
+// Vens not in any wave are put in a final wave.
+func planWaves(definitions []string, targetVENs []illumioapi.VEN, wkldByVenHref map[string]illumioapi.Workload) ([]wave, error) {
+
+	// Sort by hostname so the waves are repeatable
+	vens := append([]illumioapi.VEN{}, targetVENs...)
+	sort.Slice(vens, func(i, j int) bool { return vens[i].Hostname < vens[j].Hostname })
+
+	assigned := make(map[string]bool)
+	waves := []wave{}
+	for i, d := range definitions {
+		d = strings.TrimSpace(d)
+		w := wave{Definition: d, Results: make(map[string]string)}
+		if strings.HasSuffix(d, "%") {
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(d, "%"), 64)
+			if err != nil || pct <= 0 || pct > 100 {
+				return nil, fmt.Errorf("wave %d - %s is not a valid percentage", i+1, d)
+			}
+			count := int(math.Ceil(float64(len(vens)) * pct / 100))
+			for _, v := range vens {
+				if len(w.VENHrefs) == count {
+					break
+				}
+				if !assigned[v.Href] {
+					w.VENHrefs = append(w.VENHrefs, v.Href)
+					assigned[v.Href] = true
+				}
+			}
+		} else {
+			selector, err := utils.ParseSelector(d)
+			if err != nil {
+				return nil, fmt.Errorf("wave %d - %s", i+1, err)
+			}
+			for _, v := range vens {
+				if !assigned[v.Href] && selector.Match(utils.SelectorTargetV1(wkldByVenHref[v.Href], pce.Labels)) {
+					w.VENHrefs = append(w.VENHrefs, v.Href)
+					assigned[v.Href] = true
+				}
+			}
+		}
+		if len(w.VENHrefs) == 0 {
+			utils.LogInfo(fmt.Sprintf("wave %d (%s) has no vens. skipping.", i+1, d), true)
+			continue
+		}
+		waves = append(waves, w)
+	}
+
+	// Remaining vens
+	remaining := wave{Definition: "remaining", Results: make(map[string]string)}
+	for _, v := range vens {
+		if !assigned[v.Href] {
+			remaining.VENHrefs = append(remaining.VENHrefs, v.Href)
+		}
+	}
+	if len(remaining.VENHrefs) > 0 {
+		waves = append(waves, remaining)
+	}
+
+	return waves, nil
+}
+
+// readState reads the state file
+func readState(filename string) (upgradeState, error) {
+	var state upgradeState
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("parsing %s - %s", filename, err)
+	}
+	return state, nil
+}
+
+// saveState writes the state file
+func saveState(state upgradeState) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+	if err := os.WriteFile(stateFile, data, 0600); err != nil {
+		utils.LogError(err.Error())
+	}
+}
+
+// pollVENs gets the status, version, health, and workload online status of all vens
+func pollVENs(pceV2 *ia.PCE) map[string]venState {
+	apiResps, err := pceV2.Load(ia.LoadInput{VENs: true, Workloads: true, WorkloadsQueryParameters: map[string]string{"managed": "true"}}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	online := make(map[string]bool)
+	for _, w := range pceV2.WorkloadsSlice {
+		if w.VEN != nil {
+			online[w.VEN.Href] = ia.PtrToVal(w.Online)
+		}
+	}
+
+	states := make(map[string]venState)
+	for _, v := range pceV2.VENsSlice {
+		health := []string{}
+		unhealthy := false
+		for _, c := range ia.PtrToVal(v.Conditions) {
+			health = append(health, c.LatestEvent.NotificationType)
+			if severity := strings.ToLower(c.LatestEvent.Severity); severity == "error" || severity == "warning" {
+				unhealthy = true
+			}
+		}
+		states[v.Href] = venState{hostname: ia.PtrToVal(v.Hostname), version: v.Version, status: v.Status, online: online[v.Href], health: strings.Join(health, "; "), unhealthy: unhealthy}
+	}
+	return states
+}
+
+// runWaves upgrades each incomplete wave, waits for the vens to finish, and halts if the failure rate is exceeded
+func runWaves(state upgradeState, resultsFile string) {
+
+	pceV2, err := utils.GetTargetPCEV2(false)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	var venStates map[string]venState
+	for i := range state.Waves {
+		w := &state.Waves[i]
+		if w.Complete {
+			utils.LogInfo(fmt.Sprintf("wave %d of %d (%s) already complete. skipping.", i+1, len(state.Waves), w.Definition), true)
+			continue
+		}
+		utils.LogInfo(fmt.Sprintf("starting wave %d of %d (%s) with %d vens", i+1, len(state.Waves), w.Definition, len(w.VENHrefs)), true)
+
+		// Refresh the ven status so vens already on the target version (e.g., from a resumed run) are not upgraded again.
+		// Unhealthy vens on the target version are polled until the wave times out.
+		venStates = pollVENs(&pceV2)
+		upgradeVENs := []illumioapi.VEN{}
+		for _, href := range w.VENHrefs {
+			if venStates[href].done(state.TargetVersion) {
+				w.Results[href] = resultUpgraded
+				continue
+			}
+			delete(w.Results, href)
+			if !venStates[href].upgraded(state.TargetVersion) {
+				upgradeVENs = append(upgradeVENs, illumioapi.VEN{Href: href})
+			}
+		}
+
+		if len(upgradeVENs) > 0 {
+			resp, a, err := pce.UpgradeVENs(upgradeVENs, state.TargetVersion)
+			utils.LogAPIResp("UpgradeVENs", a)
+			if err != nil {
+				utils.LogError(err.Error())
+			}
+			utils.LogInfo(fmt.Sprintf("wave %d - upgrade for %d vens to %s received status code of %d with %d errors.", i+1, len(upgradeVENs), state.TargetVersion, a.StatusCode, len(resp.VENUpgradeErrors)), true)
+			for _, e := range resp.VENUpgradeErrors {
+				for _, href := range e.Hrefs {
+					w.Results[href] = fmt.Sprintf("%s - %s", resultError, e.Message)
+				}
+			}
+		}
+		saveState(state)
+
+		// Poll until all vens are done or the wave times out
+		deadline := time.Now().Add(time.Duration(waveTimeout) * time.Minute)
+		for {
+			pending := 0
+			for _, href := range w.VENHrefs {
+				if w.Results[href] != "" {
+					continue
+				}
+				if venStates[href].done(state.TargetVersion) {
+					w.Results[href] = resultUpgraded
+					continue
+				}
+				pending++
+			}
+			saveState(state)
+			if pending == 0 || time.Now().After(deadline) {
+				break
+			}
+			utils.LogInfo(fmt.Sprintf("wave %d - %d of %d vens complete. checking again in %d seconds.", i+1, len(w.VENHrefs)-pending, len(w.VENHrefs), pollInterval), true)
+			time.Sleep(time.Duration(pollInterval) * time.Second)
+			venStates = pollVENs(&pceV2)
+		}
+		for _, href := range w.VENHrefs {
+			if w.Results[href] == "" && venStates[href].upgraded(state.TargetVersion) {
+				w.Results[href] = fmt.Sprintf("%s - %s", resultUnhealthy, venStates[href].health)
+			}
+			if w.Results[href] == "" {
+				w.Results[href] = resultTimeout
+			}
+		}
+		w.Complete = true
+		saveState(state)
+		writeWaveResults(state, venStates, resultsFile)
+
+		// Check the failure rate of the wave so a resumed upgrade is not halted by the failures of an earlier wave
+		failed := countFailed(*w)
+		failureRate := float64(failed) / float64(len(w.VENHrefs)) * 100
+		utils.LogInfo(fmt.Sprintf("wave %d complete - %d of %d vens upgraded. wave failure rate is %.1f%%.", i+1, len(w.VENHrefs)-failed, len(w.VENHrefs), failureRate), true)
+		if failureRate > maxFailurePct {
+			utils.LogWarningf(true, "halting upgrade. wave %d failure rate of %.1f%% exceeds %.1f%%. see %s for details. run again with --resume to continue with the next wave.", i+1, failureRate, maxFailurePct, resultsFile)
+			return
+		}
+	}
+
+	utils.LogInfo(fmt.Sprintf("all waves complete. see %s for details.", resultsFile), true)
+}
+
+// countFailed returns the number of vens in a wave that did not upgrade
+func countFailed(w wave) int {
+	failed := 0
+	for _, result := range w.Results {
+		if result != resultUpgraded {
+			failed++
+		}
+	}
+	return failed
+}
+
+// writeWaveResults writes the result of every ven in the completed waves
+func writeWaveResults(state upgradeState, venStates map[string]venState, filename string) {
+	csvData := [][]string{{"wave", "wave_definition", "hostname", "ven_href", "result", "ven_version", "ven_status", "online", "health"}}
+	for i, w := range state.Waves {
+		if !w.Complete {
+			continue
+		}
+		for _, href := range w.VENHrefs {
+			v := venStates[href]
+			csvData = append(csvData, []string{strconv.Itoa(i + 1), w.Definition, v.hostname, href, w.Results[href], v.version, v.status, strconv.FormatBool(v.online), v.health})
+		}
+	}
+	utils.WriteOutput(csvData, nil, filename)
+}
@@ -0,0 +1,125 @@
+package venreport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+)
+
+// Declare local global variables
+var pce ia.PCE
+var err error
+var minVersion, supportMatrixFile, labelKeys, outputFileName string
+var staleDays int
+
+func init() {
+	VenReportCmd.Flags().StringVar(&minVersion, "min-version", "", "minimum compliant ven version (e.g., 22.5 or 22.5.10-1234). vens below it are flagged for upgrade.")
+	VenReportCmd.Flags().StringVar(&supportMatrixFile, "support-matrix", "", "csv with version and end_of_support (yyyy-mm-dd) headers. vens on a version past its end of support are flagged for upgrade. see description below.")
+	VenReportCmd.Flags().IntVar(&staleDays, "stale-days", 7, "flag vens with no heartbeat in this many days for unpair. 0 disables.")
+	VenReportCmd.Flags().StringVar(&labelKeys, "label-keys", "", "comma-separated label keys to group the summary by. default is all label dimensions.")
+	VenReportCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the summary file. the remediation, upgrade, and unpair files use the same name with a suffix. default is current location with a timestamped filename.")
+
+	VenReportCmd.Flags().SortFlags = false
+}
+
+// VenReportCmd creates the ven inventory report
+var VenReportCmd = &cobra.Command{
+	Use:   "ven-report",
+	Short: "Create a VEN inventory report with version compliance, stale VENs, and a remediation list.",
+	Long: `
+Create a VEN inventory report with version compliance, stale VENs, and a remediation list.
+
+Each VEN is checked for the following issues:
+  - below-min-version: the version is below --min-version.
+  - past-end-of-support: the version is past its end of support in the --support-matrix.
+  - not-in-support-matrix: the version does not match an entry in the --support-matrix.
+  - stale: no heartbeat in --stale-days days.
+  - fqdn-mismatch: the active pce fqdn is not the target pce fqdn.
+  - clone-detected: the ven has an agent.clone_detected condition.
+
+The support matrix is a csv with version and end_of_support headers. Versions match the ven version by the provided parts so 22.5 matches 22.5.10-1234. The most specific match is used. For example:
+  version,end_of_support
+  21.5,2024-06-30
+  22.5,2026-12-31
+
+Four files are created:
+  - summary: ven counts and issue counts grouped by version, os, ven type, status, and the --label-keys.
+  - remediation: one row per ven with issues and the recommended action (upgrade, unpair, or review).
+  - upgrade: ven hrefs to upgrade. use with the upgrade command --host-file.
+  - unpair: ven hrefs to unpair. use with the unpair command --href-file.
+Stale and clone-detected vens are recommended for unpair. Version issues are recommended for upgrade. FQDN mismatches are recommended for review.
+
+The update-pce and --no-prompt flags are ignored for this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err = utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogError(err.Error())
+		}
+
+		venReport()
+	},
+}
+
+func venReport() {
+
+	// Parse the support matrix
+	var matrix []supportEntry
+	if supportMatrixFile != "" {
+		matrix, err = parseSupportMatrix(supportMatrixFile)
+		if err != nil {
+			utils.LogErrorf("parsing support matrix - %s", err)
+		}
+	}
+
+	// Load the pce
+	utils.LogInfo("getting workloads, vens, labels, and label dimensions...", true)
+	apiResps, err := pce.Load(ia.LoadInput{
+		Workloads:                true,
+		WorkloadsQueryParameters: map[string]string{"managed": "true"},
+		Labels:                   true,
+		VENs:                     true,
+		LabelDimensions:          true,
+	}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
+	// Set the label keys
+	keys := []string{}
+	if labelKeys == "" {
+		for _, ld := range pce.LabelDimensionsSlice {
+			keys = append(keys, ld.Key)
+		}
+	} else {
+		for _, k := range strings.Split(labelKeys, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	// Analyze the vens
+	results := []venResult{}
+	for _, v := range pce.VENsSlice {
+		results = append(results, analyze(v, matrix, keys))
+	}
+	if len(results) == 0 {
+		utils.LogInfo("no vens in PCE.", true)
+		return
+	}
+
+	// Write the outputs
+	base := fmt.Sprintf("workloader-ven-report-%s", time.Now().Format("20060102_150405"))
+	if outputFileName != "" {
+		base = strings.TrimSuffix(outputFileName, ".csv")
+	}
+	writeSummary(results, keys, base+"-summary.csv")
+	writeRemediation(results, keys, base)
+}
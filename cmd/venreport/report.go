@@ -0,0 +1,306 @@
+package venreport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Issues
+const (
+	issueBelowMin      = "below-min-version"
+	issuePastEOS       = "past-end-of-support"
+	issueNotInMatrix   = "not-in-support-matrix"
+	issueStale         = "stale"
+	issueFQDNMismatch  = "fqdn-mismatch"
+	issueCloneDetected = "clone-detected"
+)
+
+// Recommended actions
+const (
+	actionUpgrade = "upgrade"
+	actionUnpair  = "unpair"
+	actionReview  = "review"
+)
+
+const (
+	cloneDetectedEvent   = "agent.clone_detected"
+	heartbeatTimeFormat  = "2006-01-02T15:04:05.000Z"
+	supportMatrixVersion = "version"
+	supportMatrixEOS     = "end_of_support"
+)
+
+// issues in the order they are reported
+var issues = []string{issueBelowMin, issuePastEOS, issueNotInMatrix, issueStale, issueFQDNMismatch, issueCloneDetected}
+
+// supportEntry is a version in the support matrix
+type supportEntry struct {
+	version      string
+	endOfSupport time.Time
+}
+
+// venResult is a ven with its workload and issues
+type venResult struct {
+	ven       ia.VEN
+	wkld      ia.Workload
+	os        string
+	labels    map[string]string
+	heartbeat string
+	issues    map[string]string
+	action    string
+}
+
+// parseSupportMatrix parses the version and end_of_support columns
+func parseSupportMatrix(file string) ([]supportEntry, error) {
+	csvData, err := utils.ParseCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(csvData) == 0 {
+		return nil, fmt.Errorf("%s is empty", file)
+	}
+	versionCol, eosCol := -1, -1
+	for i, h := range csvData[0] {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case supportMatrixVersion:
+			versionCol = i
+		case supportMatrixEOS:
+			eosCol = i
+		}
+	}
+	if versionCol == -1 || eosCol == -1 {
+		return nil, fmt.Errorf("%s requires %s and %s headers", file, supportMatrixVersion, supportMatrixEOS)
+	}
+
+	matrix := []supportEntry{}
+	for i, row := range csvData[1:] {
+		eos, err := time.Parse("2006-01-02", strings.TrimSpace(row[eosCol]))
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d - invalid end_of_support %s - use yyyy-mm-dd", i+2, row[eosCol])
+		}
+		matrix = append(matrix, supportEntry{version: strings.TrimSpace(row[versionCol]), endOfSupport: eos})
+	}
+	return matrix, nil
+}
+
+// supportMatch returns the most specific support matrix entry for the version
+func supportMatch(version string, matrix []supportEntry) (supportEntry, bool) {
+	var best supportEntry
+	bestParts := -1
+	for _, e := range matrix {
+		parts := len(strings.FieldsFunc(e.version, func(r rune) bool { return r == '.' || r == '-' }))
+		if utils.CompareVersions(version, e.version) == 0 && parts > bestParts {
+			best, bestParts = e, parts
+		}
+	}
+	return best, bestParts != -1
+}
+
+// analyze checks the ven for each issue and sets the recommended action
+func analyze(v ia.VEN, matrix []supportEntry, keys []string) venResult {
+	r := venResult{ven: v, labels: make(map[string]string), issues: make(map[string]string), heartbeat: v.LastHeartBeatAt}
+
+	// Get the workload
+	if len(ia.PtrToVal(v.Workloads)) > 0 {
+		r.wkld = pce.Workloads[ia.PtrToVal(v.Workloads)[0].Href]
+	}
+	r.os = ia.PtrToVal(r.wkld.OsID)
+	if r.os == "" {
+		r.os = "unknown"
+	}
+	for _, k := range keys {
+		r.labels[k] = r.wkld.GetLabelByKey(k, pce.Labels).Value
+	}
+
+	// Version compliance
+	if minVersion != "" && utils.CompareVersions(v.Version, minVersion) < 0 {
+		r.issues[issueBelowMin] = fmt.Sprintf("version %s is below %s", v.Version, minVersion)
+	}
+	if len(matrix) > 0 {
+		if e, ok := supportMatch(v.Version, matrix); !ok {
+			r.issues[issueNotInMatrix] = fmt.Sprintf("version %s is not in the support matrix", v.Version)
+		} else if time.Now().After(e.endOfSupport.Add(24 * time.Hour)) {
+			r.issues[issuePastEOS] = fmt.Sprintf("version %s end of support was %s", v.Version, e.endOfSupport.Format("2006-01-02"))
+		}
+	}
+
+	// Stale heartbeat
+	if staleDays > 0 {
+		if hb, err := time.Parse(heartbeatTimeFormat, v.LastHeartBeatAt); err != nil {
+			r.issues[issueStale] = "no heartbeat"
+			r.heartbeat = "never"
+		} else if days := time.Since(hb).Hours() / 24; days >= float64(staleDays) {
+			r.issues[issueStale] = fmt.Sprintf("no heartbeat in %d days", int(days))
+		}
+	}
+
+	// Active and target pce
+	if ia.PtrToVal(v.TargetPceFqdn) != "" && v.ActivePceFqdn != "" && !strings.EqualFold(ia.PtrToVal(v.TargetPceFqdn), v.ActivePceFqdn) {
+		r.issues[issueFQDNMismatch] = fmt.Sprintf("active pce %s is not target pce %s", v.ActivePceFqdn, ia.PtrToVal(v.TargetPceFqdn))
+	}
+
+	// Clone detection
+	for _, c := range ia.PtrToVal(v.Conditions) {
+		if c.LatestEvent.NotificationType == cloneDetectedEvent {
+			r.issues[issueCloneDetected] = "clone detected condition"
+		}
+	}
+
+	// Unpair takes priority since upgrading a stale or cloned ven doesn't fix it
+	switch {
+	case r.issues[issueStale] != "" || r.issues[issueCloneDetected] != "":
+		r.action = actionUnpair
+	case r.issues[issueBelowMin] != "" || r.issues[issuePastEOS] != "":
+		r.action = actionUpgrade
+	case len(r.issues) > 0:
+		r.action = actionReview
+	}
+	return r
+}
+
+// group is a summary row
+type group struct {
+	dimension, value string
+	count            int
+	issueCounts      map[string]int
+	compliant        int
+}
+
+// writeSummary writes the ven and issue counts for each dimension value
+func writeSummary(results []venResult, keys []string, fileName string) {
+	dimensions := append([]string{"version", "os", "ven_type", "status"}, keys...)
+	groups := make(map[string]*group)
+	for _, r := range results {
+		values := map[string]string{"version": r.ven.Version, "os": r.os, "ven_type": r.ven.VenType, "status": r.ven.Status}
+		for _, k := range keys {
+			values[k] = r.labels[k]
+			if values[k] == "" {
+				values[k] = "no " + k
+			}
+		}
+		for _, d := range dimensions {
+			g, ok := groups[d+"|"+values[d]]
+			if !ok {
+				g = &group{dimension: d, value: values[d], issueCounts: make(map[string]int)}
+				groups[d+"|"+values[d]] = g
+			}
+			g.count++
+			if len(r.issues) == 0 {
+				g.compliant++
+			}
+			for issue := range r.issues {
+				g.issueCounts[issue]++
+			}
+		}
+	}
+
+	// Sort by the dimension order and then by count
+	dimensionOrder := make(map[string]int)
+	for i, d := range dimensions {
+		dimensionOrder[d] = i
+	}
+	groupSlice := []*group{}
+	for _, g := range groups {
+		groupSlice = append(groupSlice, g)
+	}
+	sort.Slice(groupSlice, func(i, j int) bool {
+		a, b := groupSlice[i], groupSlice[j]
+		if a.dimension != b.dimension {
+			return dimensionOrder[a.dimension] < dimensionOrder[b.dimension]
+		}
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.value < b.value
+	})
+
+	csvData := [][]string{append([]string{"group_by", "value", "vens", "no_issues"}, issues...)}
+	csvData = append(csvData, totalsRow(results))
+	for _, g := range groupSlice {
+		row := []string{g.dimension, g.value, strconv.Itoa(g.count), strconv.Itoa(g.compliant)}
+		for _, issue := range issues {
+			row = append(row, strconv.Itoa(g.issueCounts[issue]))
+		}
+		csvData = append(csvData, row)
+	}
+	utils.WriteOutput(csvData, csvData, fileName)
+	utils.LogInfof(true, "summary of %d vens created - %s", len(results), fileName)
+}
+
+// totalsRow returns the summary row for all vens and logs the count of each issue
+func totalsRow(results []venResult) []string {
+	compliant := 0
+	issueCounts := make(map[string]int)
+	for _, r := range results {
+		if len(r.issues) == 0 {
+			compliant++
+		}
+		for issue := range r.issues {
+			issueCounts[issue]++
+		}
+	}
+	row := []string{"all", "all", strconv.Itoa(len(results)), strconv.Itoa(compliant)}
+	for _, issue := range issues {
+		row = append(row, strconv.Itoa(issueCounts[issue]))
+	}
+	for _, issue := range issues {
+		if issueCounts[issue] > 0 {
+			utils.LogInfof(true, "%d vens - %s", issueCounts[issue], issue)
+		}
+	}
+	return row
+}
+
+// writeRemediation writes the vens with issues and the upgrade and unpair files
+func writeRemediation(results []venResult, keys []string, base string) {
+	csvData := [][]string{append([]string{"ven_href", "hostname", "wkld_href", "ven_type", "version", "os", "status", "last_heartbeat", "active_pce_fqdn", "target_pce_fqdn", "issues", "details", "recommended_action"}, keys...)}
+	upgradeData := [][]string{{"ven_href"}}
+	unpairData := [][]string{{"ven_href"}}
+	sort.Slice(results, func(i, j int) bool {
+		return ia.PtrToVal(results[i].ven.Hostname) < ia.PtrToVal(results[j].ven.Hostname)
+	})
+	for _, r := range results {
+		if len(r.issues) == 0 {
+			continue
+		}
+		venIssues, details := []string{}, []string{}
+		for _, issue := range issues {
+			if r.issues[issue] != "" {
+				venIssues = append(venIssues, issue)
+				details = append(details, r.issues[issue])
+			}
+		}
+		row := []string{r.ven.Href, ia.PtrToVal(r.ven.Hostname), r.wkld.Href, r.ven.VenType, r.ven.Version, r.os, r.ven.Status, r.heartbeat, r.ven.ActivePceFqdn, ia.PtrToVal(r.ven.TargetPceFqdn), strings.Join(venIssues, "; "), strings.Join(details, "; "), r.action}
+		for _, k := range keys {
+			row = append(row, r.labels[k])
+		}
+		csvData = append(csvData, row)
+
+		switch r.action {
+		case actionUpgrade:
+			upgradeData = append(upgradeData, []string{r.ven.Href})
+		case actionUnpair:
+			unpairData = append(unpairData, []string{r.ven.Href})
+		}
+	}
+
+	if len(csvData) == 1 {
+		utils.LogInfo("no vens with issues.", true)
+		return
+	}
+	utils.WriteOutput(csvData, csvData, base+"-remediation.csv")
+	utils.LogInfof(true, "%d vens with issues - %s", len(csvData)-1, base+"-remediation.csv")
+	if len(upgradeData) > 1 {
+		utils.WriteOutput(upgradeData, upgradeData, base+"-upgrade.csv")
+		utils.LogInfof(true, "%d vens to upgrade - %s", len(upgradeData)-1, base+"-upgrade.csv")
+	}
+	if len(unpairData) > 1 {
+		utils.WriteOutput(unpairData, unpairData, base+"-unpair.csv")
+		utils.LogInfof(true, "%d vens to unpair - %s", len(unpairData)-1, base+"-unpair.csv")
+	}
+}
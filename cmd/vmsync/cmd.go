@@ -10,11 +10,11 @@ import (
 
 var vcenter, datacenter, cluster, folder, userID, secret string
 
-var csvFile string
-var ignoreState, ignoreSubfolders, umwl, keepFile, keepFQDNHostname, deprecated, insecure, allIPs, vcName, ipv6 bool
+var csvFile, cacheFile string
+var ignoreState, ignoreSubfolders, umwl, keepFile, keepFQDNHostname, deprecated, insecure, allIPs, vcName, ipv6, fromCache bool
 var updatePCE, noPrompt bool
 var vc VCenter
-var maxCreate, maxUpdate int
+var maxCreate, maxUpdate, workers int
 
 // Init builds the commands
 func init() {
@@ -23,7 +23,7 @@ func init() {
 	cobra.EnableCommandSorting = false
 
 	//awsimport options
-	VCenterSyncCmd.Flags().StringVarP(&vcenter, "vcenter", "v", "", "fqdn or ip of vcenter instance (e.g., vcenter.illumio.com)")
+	VCenterSyncCmd.Flags().StringVarP(&vcenter, "vcenter", "v", "", "fqdn or ip of vcenter instance (e.g., vcenter.illumio.com). separate multiple vcenters with commas. the same credentials are used for each.")
 	VCenterSyncCmd.Flags().StringVarP(&userID, "user", "u", "", "vcenter username with access to vcenter api")
 	VCenterSyncCmd.Flags().StringVarP(&secret, "password", "p", "", "vcenter password with access to vcenter api")
 	VCenterSyncCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "ignore vcenter ssl certificate validation.")
@@ -41,10 +41,12 @@ func init() {
 	//VCenterSyncCmd.Flags().BoolVarP(&deprecated, "deprecated", "", false, "Use this option if you are running an older version of the API (VCenter 6.5-7.0.u2")
 	VCenterSyncCmd.Flags().IntVar(&maxCreate, "max-create", -1, "maximum number of unmanaged workloads that can be created. -1 is unlimited.")
 	VCenterSyncCmd.Flags().IntVar(&maxUpdate, "max-update", -1, "maximum number of workloads that can be updated. -1 is unlimited.")
+	VCenterSyncCmd.Flags().IntVar(&workers, "workers", 10, "number of concurrent vcenter api calls when getting vm details.")
+	VCenterSyncCmd.Flags().StringVar(&cacheFile, "cache-file", "", "json file to save the vcenter inventory to. used with --from-cache to relabel without calling vcenter.")
+	VCenterSyncCmd.Flags().BoolVar(&fromCache, "from-cache", false, "use the inventory saved in --cache-file instead of calling vcenter.")
 
 	VCenterSyncCmd.MarkFlagRequired("userID")
 	VCenterSyncCmd.MarkFlagRequired("secret")
-	VCenterSyncCmd.MarkFlagRequired("vcenter")
 	VCenterSyncCmd.Flags().SortFlags = false
 
 }
@@ -60,6 +62,15 @@ A csv file is needed to map VCenter Categories to PCE label keys. The csv skips
 The VCenter category should be in the first column and the corredsponding illumio label key in the second.  
 
 For all VCenter object (datacenter, cluster, folder) you can enter more than one.  They need to be seperated by commas without spaces.
+
+More than one VCenter can be synced in a single run by separating them with commas in the --vcenter flag. VM details are retrieved 
+in parallel (see --workers) and the VCenter session is refreshed automatically if it expires during the run. If a VCenter has more 
+VMs than can be returned in a single request, the VMs are retrieved one ESXi host at a time. If the same hostname is in more than one 
+VCenter, the VM in the first VCenter is used and the others are skipped with a warning.
+
+Use --cache-file to save the VCenter inventory (VMs, VMTools identity, interfaces, and tags). Running again with --from-cache and 
+the same --cache-file will relabel from the saved inventory without connecting to VCenter. The cache only includes interfaces if it 
+was created with --umwl and --all-int and only includes tags for categories in the mapping file used to create it.
 	
 Support VCenter version > 7.0.u2`,
 
@@ -76,6 +87,14 @@ Support VCenter version > 7.0.u2`,
 			fmt.Println("Cannot use \"--allintf\" or \"--ipv6\" without \"--uwml\" with \"vmsync\".  \"--ipv6\" requires \"--allintf\"")
 			os.Exit(0)
 		}
+		if fromCache && cacheFile == "" {
+			fmt.Println("\"--from-cache\" requires \"--cache-file\".")
+			os.Exit(0)
+		}
+		if !fromCache && vcenter == "" {
+			fmt.Println("\"--vcenter\" is required unless using \"--from-cache\".")
+			os.Exit(0)
+		}
 		//Get the debug value from viper
 		//debug = viper.Get("debug").(bool)
 		updatePCE = viper.Get("update_pce").(bool)
@@ -84,17 +103,8 @@ Support VCenter version > 7.0.u2`,
 		//load keymapfile, This file will have the Catagories to Label Type mapping
 		keyMap := readKeyFile(csvFile)
 
-		vc.KeyMap = keyMap
-		vc.VCenterURL = vcenter
-		vc.User = userID
-		vc.Secret = secret
-		vc.DisableTLSChecking = insecure
-		vc.Header = make(map[string]string)
-
-		vc.setupVCenterSession()
-
-		vc.compileVMData(keyMap)
 		//Sync VMs to Workloads or create UMWL VMs for all machines in VCenter not running VEN
+		compileVMData(keyMap)
 
 	},
 }
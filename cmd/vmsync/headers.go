@@ -57,6 +57,7 @@ type vcenterObjects struct {
 	Datacenter string `json:"datacenter"`
 	Cluster    string `json:"cluster"`
 	Folder     string `json:"folder"`
+	Host       string `json:"host"`
 }
 
 // RequestObject for getting all tags for a set of VMs
@@ -88,6 +89,25 @@ type Netinterfaces struct {
 	MacAddress string `json:"mac_address"`
 }
 
+// inventoryVM - Everything gathered from VCenter for a single VM.  A slice of these is written to the cache file
+// so labels can be re-applied with --from-cache without calling VCenter.
+type inventoryVM struct {
+	VCenter    string            `json:"vcenter"`
+	VMID       string            `json:"vm"`
+	VCName     string            `json:"vcenter_name"`
+	PowerState string            `json:"power_state"`
+	HostName   string            `json:"host_name"`
+	IdentityIP string            `json:"identity_ip"`
+	Interfaces []Netinterfaces   `json:"interfaces,omitempty"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// vmInventory - Format of the cache file.
+type vmInventory struct {
+	Collected string        `json:"collected"`
+	VMs       []inventoryVM `json:"vms"`
+}
+
 // VCenter getVersion API
 type VCVersion struct {
 	Build       string `json:"build"`
@@ -0,0 +1,109 @@
+package vmsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// collectInventory - Gets the VMs, VMTools identity, network details and mapped tags from a single VCenter.
+// tmpWklds is the map of lowercase PCE hostnames used to skip network detail calls for VMs that already exist.
+func (vc *VCenter) collectInventory(keyMap map[string]string, tmpWklds map[string]illumioapi.Workload) []inventoryVM {
+
+	//return all VMs with filters
+	if vc.getVCenterVMs() == 0 {
+		utils.LogInfo(fmt.Sprintf("No Vcenter VMs found in %s with current filters datacenter:'%s' cluster:'%s' folder:'%s'", vc.cleanFQDN(), datacenter, cluster, folder), true)
+		return nil
+	}
+
+	// Get the VMTools identity and network details for each VM in parallel.
+	utils.LogInfo(fmt.Sprintf("getting vm details for %d vms from %s using %d workers", len(vc.VCVMSlice), vc.cleanFQDN(), workers), true)
+	inventory := make([]inventoryVM, len(vc.VCVMSlice))
+	var processed int64
+	utils.RunWorkers(len(vc.VCVMSlice), workers, func(i int) {
+		vm := vc.VCVMSlice[i]
+		identity := vc.getVMIdentity(vm.VMID)
+		invVM := inventoryVM{VCenter: vc.cleanFQDN(), VMID: vm.VMID, VCName: vm.Name, PowerState: vm.PowerState, HostName: identity.HostName, IdentityIP: identity.IPAddress}
+
+		// Network detail requires VMTools and is only needed for new unmanaged workloads unless the inventory is cached.
+		if umwl && allIPs && identity.HostName != "" {
+			name := identity.HostName
+			if vcName {
+				name = vm.Name
+			}
+			if _, ok := tmpWklds[strings.ToLower(nameCheck(name))]; cacheFile != "" || !ok {
+				invVM.Interfaces = vc.getVMNetworkDetail(vm.VMID)
+			}
+		}
+		inventory[i] = invVM
+
+		if count := atomic.AddInt64(&processed, 1); count%500 == 0 {
+			utils.LogInfo(fmt.Sprintf("%d of %d vm details retrieved", count, len(vc.VCVMSlice)), true)
+		}
+	})
+
+	//After getting all the VMs build a keymap for all the Categories matched in the keyMap to be used for labeling
+	vc.buildVCTagMap(keyMap)
+
+	// Get all the Tags for the VMs and store them by category
+	vmIndex := make(map[string]int)
+	var vmIDs []string
+	for i, invVM := range inventory {
+		vmIndex[invVM.VMID] = i
+		vmIDs = append(vmIDs, invVM.VMID)
+	}
+	for _, object := range vc.getTagsfromVMs(vmIDs) {
+		i, ok := vmIndex[object.ObjectId.ID]
+		if !ok {
+			continue
+		}
+		tmpTags := make(map[string]string)
+		for _, tag := range object.TagIds {
+			//Check for a tag and to see if you have adont have 2 Tags with the same Category on the same VM
+			vcTag, ok := vc.VCTags[tag]
+			if !ok {
+				continue
+			}
+			if _, ok := tmpTags[vcTag.Category]; ok {
+				utils.LogInfo(fmt.Sprintf("VM has 2 or more Tags with the same Category - %s ", inventory[i].VCName), true)
+				continue
+			}
+			tmpTags[vcTag.Category] = vcTag.Tag
+		}
+		inventory[i].Tags = tmpTags
+	}
+
+	return inventory
+}
+
+// writeInventory - Saves the VCenter inventory so it can be reused with --from-cache.
+func writeInventory(filename string, inventory []inventoryVM) {
+	jsonBytes, err := json.MarshalIndent(vmInventory{Collected: time.Now().Format(time.RFC3339), VMs: inventory}, "", "  ")
+	if err != nil {
+		utils.LogError(fmt.Sprintf("marshaling vcenter inventory - %s", err))
+	}
+	if err := os.WriteFile(filename, jsonBytes, 0644); err != nil {
+		utils.LogError(fmt.Sprintf("writing vcenter inventory cache %s - %s", filename, err))
+	}
+	utils.LogInfo(fmt.Sprintf("%d vms saved to inventory cache %s", len(inventory), filename), true)
+}
+
+// readInventory - Loads a VCenter inventory previously saved with --cache-file.
+func readInventory(filename string) []inventoryVM {
+	jsonBytes, err := os.ReadFile(filename)
+	if err != nil {
+		utils.LogError(fmt.Sprintf("reading vcenter inventory cache %s - %s", filename, err))
+	}
+	var inventory vmInventory
+	if err := json.Unmarshal(jsonBytes, &inventory); err != nil {
+		utils.LogError(fmt.Sprintf("unmarshaling vcenter inventory cache %s - %s", filename, err))
+	}
+	utils.LogInfo(fmt.Sprintf("%d vms loaded from inventory cache %s collected %s", len(inventory.VMs), filename, inventory.Collected), true)
+	return inventory.VMs
+}
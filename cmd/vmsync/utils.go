@@ -10,14 +10,33 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/brian1917/illumioapi/v2"
 	"github.com/brian1917/workloader/utils"
 	"github.com/pkg/errors"
 )
 
-// httpCall - Generic Function to call VCenter APIs
+// sessionMu protects the vcenter session header that is read by concurrent workers. refreshMu makes sure
+// only one worker logs back in when the session expires.
+var sessionMu sync.RWMutex
+var refreshMu sync.Mutex
+
+// httpCall - Generic Function to call VCenter APIs.  If the session has expired (401) the session is refreshed
+// and the call is retried once.
 func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.APIResponse, error) {
+	response, sessionID, err := httpCallOnce(httpAction, apiURL, body, login)
+	if response.StatusCode == 401 && !login && sessionID != "" {
+		utils.LogInfo("vcenter session expired. refreshing session and retrying.", false)
+		vc.refreshSession(sessionID)
+		response, _, err = httpCallOnce(httpAction, apiURL, body, login)
+	}
+	return response, err
+}
+
+// httpCallOnce - Makes a single call to the VCenter API.  The session ID used for the request is returned so
+// an expired session can be refreshed.
+func httpCallOnce(httpAction, apiURL string, body []byte, login bool) (illumioapi.APIResponse, string, error) {
 
 	var response illumioapi.APIResponse
 	var httpBody *bytes.Buffer
@@ -26,7 +45,7 @@ func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.AP
 	// Validate the provided action
 	httpAction = strings.ToUpper(httpAction)
 	if httpAction != "GET" && httpAction != "POST" && httpAction != "PUT" && httpAction != "DELETE" {
-		return response, errors.New("invalid http action string. action must be GET, POST, PUT, or DELETE")
+		return response, "", errors.New("invalid http action string. action must be GET, POST, PUT, or DELETE")
 	}
 
 	// Get the base URL
@@ -43,7 +62,7 @@ func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.AP
 
 	req, err := http.NewRequest(httpAction, apiURL, httpBody)
 	if err != nil {
-		return response, err
+		return response, "", err
 	}
 
 	// Set basic authentication and headers
@@ -52,21 +71,24 @@ func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.AP
 	}
 
 	// Set basic authentication and headers
+	sessionMu.RLock()
 	for k, v := range vc.Header {
 		req.Header.Set(k, v)
 	}
+	sessionID := vc.Header["vmware-api-session-id"]
+	sessionMu.RUnlock()
 
 	// Make HTTP Request
 	resp, err := client.Do(req)
 	if err != nil {
-		return response, err
+		return response, "", err
 	}
 	defer resp.Body.Close()
 
 	// Process response
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return response, err
+		return response, "", err
 	}
 
 	// Put relevant response info into struct
@@ -84,11 +106,11 @@ func httpCall(httpAction, apiURL string, body []byte, login bool) (illumioapi.AP
 
 	// Check for a 200 response code
 	if strconv.Itoa(resp.StatusCode)[0:1] != "2" {
-		return response, errors.New("http status code of " + strconv.Itoa(response.StatusCode))
+		return response, sessionID, errors.New("http status code of " + strconv.Itoa(response.StatusCode))
 	}
 
 	// Return data and nil error
-	return response, nil
+	return response, sessionID, nil
 }
 
 // nameCheck - Match Hostname with or without domain information
@@ -103,23 +125,21 @@ func nameCheck(name string) string {
 	return name
 }
 
-// cleanFQDN cleans up the provided PCE FQDN in case of common errors
+// cleanFQDN cleans up the provided VCenter FQDN in case of common errors.  The VCenter is not modified so
+// it is safe to call from concurrent workers.
 func (v *VCenter) cleanFQDN() string {
 	// Remove trailing slash if included
-	v.VCenterURL = strings.TrimSuffix(v.VCenterURL, "/")
+	fqdn := strings.TrimSuffix(v.VCenterURL, "/")
 	// Remove HTTPS if included
-	v.VCenterURL = strings.TrimPrefix(v.VCenterURL, "https://")
-	return v.VCenterURL
+	return strings.TrimPrefix(fqdn, "https://")
 }
 
-// GetCollectionHeaders returns a collection of Illumio objects and allows for customizing headers of HTTP request
-// func (v *VCenter) Get(endpoint string, queryParameters, headers map[string]string, login bool, response interface{}, calledAPI string) (api illumioapi.APIResponse, err error) {
-func (v *VCenter) Get(endpoint string, queryParameters map[string][]string, login bool, response interface{}, calledAPI string) {
+// buildURL - Builds the VCenter API URL with the query parameters encoded the way VCenter expects.
+func (v *VCenter) buildURL(endpoint string, queryParameters map[string][]string, calledAPI string) string {
 	// Build the API URL
 	tmpurl, err := url.Parse("https://" + v.cleanFQDN() + endpoint)
 	if err != nil {
 		utils.LogError(fmt.Sprintf("%s Unable to Parse URL - %s", calledAPI, err))
-		//return illumioapi.APIResponse{}, err
 	}
 
 	// Set the query parameters
@@ -145,8 +165,25 @@ func (v *VCenter) Get(endpoint string, queryParameters map[string][]string, logi
 		}
 	}
 
+	return tmpurl.String()
+}
+
+// tryGet - Calls a VCenter GET API and returns the error instead of exiting so the caller can decide how to handle it.
+func (v *VCenter) tryGet(endpoint string, queryParameters map[string][]string, response interface{}, calledAPI string) (illumioapi.APIResponse, error) {
+	api, err := httpCall("GET", v.buildURL(endpoint, queryParameters, calledAPI), []byte{}, false)
+	utils.LogMultiAPIRespV2(map[string]illumioapi.APIResponse{calledAPI: api})
+	if err != nil {
+		return api, err
+	}
+	return api, json.Unmarshal([]byte(api.RespBody), &response)
+}
+
+// GetCollectionHeaders returns a collection of Illumio objects and allows for customizing headers of HTTP request
+// func (v *VCenter) Get(endpoint string, queryParameters, headers map[string]string, login bool, response interface{}, calledAPI string) (api illumioapi.APIResponse, err error) {
+func (v *VCenter) Get(endpoint string, queryParameters map[string][]string, login bool, response interface{}, calledAPI string) {
+
 	// Call the API
-	api, err := httpCall("GET", tmpurl.String(), []byte{}, login)
+	api, err := httpCall("GET", v.buildURL(endpoint, queryParameters, calledAPI), []byte{}, login)
 	utils.LogMultiAPIRespV2(map[string]illumioapi.APIResponse{calledAPI: api})
 	//Check for ServiceNot available for getVMIdentity or getNetInterfaces because lack of VMTools
 	if (err != nil && api.StatusCode != 503) && (calledAPI == "getVMIdentity" || calledAPI == "getVMNetworkDetail") {
@@ -261,13 +261,91 @@ func (vc *VCenter) getVCenterVMs() int {
 			queryParam["folders"] = tmpObjectIds
 		}
 	}
-	vc.Get(tmpurl, queryParam, false, &vc.VCVMSlice, "getVCenterVMs")
+
+	// VCenter rejects the request when the number of VMs is over its limit (4000).  When that happens page the
+	// request by ESXi host so each call stays under the limit.
+	api, err := vc.tryGet(tmpurl, queryParam, &vc.VCVMSlice, "getVCenterVMs")
+	if err != nil {
+		if !tooManyVMs(api) {
+			utils.LogError(fmt.Sprintf("getVCenterVMs access to VCenter failed - %s", err))
+		}
+		utils.LogInfo("vcenter returned too many vms for a single request. getting vms by host.", true)
+		vc.VCVMSlice = vc.getVCenterVMsByHost(tmpurl, queryParam)
+	}
 	return len(vc.VCVMSlice)
 
 }
 
-// getTagsfromVMs - Function that will get all VMs that have a certain tag.
-func (vc *VCenter) getTagsfromVMs(vms map[string]vcenterVM, tags map[string]vcenterTags) []responseObject {
+// tooManyVMs - Returns true if VCenter rejected the request because the number of VMs is over its limit.  Other 400
+// errors (e.g., an invalid filter) are not retried by host.
+func tooManyVMs(api illumioapi.APIResponse) bool {
+	if api.StatusCode != 400 {
+		return false
+	}
+	body := strings.ToLower(api.RespBody)
+	return strings.Contains(body, "unable_to_allocate_resource") || strings.Contains(body, "too many")
+}
+
+// getHosts - Get the ESXi host ids using the datacenter and cluster filters.
+func (vc *VCenter) getHosts(queryParam map[string][]string) []string {
+
+	tmpurl := "/api/vcenter/host"
+	if deprecated {
+		tmpurl = "/rest/vcenter/host"
+	}
+
+	hostQueryParam := make(map[string][]string)
+	for _, key := range []string{"datacenters", "clusters", "filter.datacenters", "filter.clusters"} {
+		if val, ok := queryParam[key]; ok {
+			hostQueryParam[key] = val
+		}
+	}
+
+	var objs []vcenterObjects
+	vc.Get(tmpurl, hostQueryParam, false, &objs, "getHosts")
+	var hosts []string
+	for _, obj := range objs {
+		hosts = append(hosts, obj.Host)
+	}
+	return hosts
+}
+
+// getVCenterVMsByHost - Gets the VMs one ESXi host at a time in parallel.  VMs are deduplicated in case they
+// move between hosts while paging.
+func (vc *VCenter) getVCenterVMsByHost(tmpurl string, queryParam map[string][]string) []vcenterVM {
+
+	hostKey := "hosts"
+	if deprecated {
+		hostKey = "filter.hosts"
+	}
+
+	hosts := vc.getHosts(queryParam)
+	utils.LogInfo(fmt.Sprintf("getting vms from %d hosts", len(hosts)), true)
+	hostVMs := make([][]vcenterVM, len(hosts))
+	utils.RunWorkers(len(hosts), workers, func(i int) {
+		hostQueryParam := map[string][]string{hostKey: {hosts[i]}}
+		for key, val := range queryParam {
+			hostQueryParam[key] = val
+		}
+		vc.Get(tmpurl, hostQueryParam, false, &hostVMs[i], "getVCenterVMs")
+	})
+
+	var vms []vcenterVM
+	vmIDs := make(map[string]bool)
+	for _, page := range hostVMs {
+		for _, vm := range page {
+			if vmIDs[vm.VMID] {
+				continue
+			}
+			vmIDs[vm.VMID] = true
+			vms = append(vms, vm)
+		}
+	}
+	return vms
+}
+
+// getTagsfromVMs - Function that will get the tags attached to each of the provided VMs.
+func (vc *VCenter) getTagsfromVMs(vmIDs []string) []responseObject {
 
 	tmpurl := "/api/cis/tagging/tag-association?action=list-attached-tags-on-objects"
 	if deprecated {
@@ -278,14 +356,10 @@ func (vc *VCenter) getTagsfromVMs(vms map[string]vcenterVM, tags map[string]vcen
 
 	//loop through all the VMs and make a JSON object with no more than NumVM (const = 500) to send to get the Tags for each VM.
 	var tmpvm []objects
-	var count = 0
-	for vmid := range vms {
+	for count, vmid := range vmIDs {
 		tmpvm = append(tmpvm, objects{Type: "VirtualMachine", ID: vmid})
-		count++
-		if count != len(vms) {
-			if count < NumVM {
-				continue
-			}
+		if count+1 != len(vmIDs) && len(tmpvm) < NumVM {
+			continue
 		}
 		//Build request body with all the VMs you want to get Tags for.
 		tmpvms := requestObject{ObjectId: tmpvm}
@@ -294,6 +368,7 @@ func (vc *VCenter) getTagsfromVMs(vms map[string]vcenterVM, tags map[string]vcen
 		vc.Post(tmpurl, tmpvms, &obj, true, "getTagsfromVMs")
 
 		totalResObject = append(totalResObject, obj...)
+		tmpvm = nil
 	}
 
 	return totalResObject
@@ -353,6 +428,25 @@ func (vc *VCenter) setupVCenterSession() {
 	}
 }
 
+// refreshSession - Logs back into VCenter when the session used for a request has expired.  Workers that hit
+// the same expired session only log in once.
+func (vc *VCenter) refreshSession(expiredSessionID string) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	sessionMu.RLock()
+	current := vc.Header["vmware-api-session-id"]
+	sessionMu.RUnlock()
+	if current != expiredSessionID {
+		return
+	}
+
+	token := vc.getSessionToken()
+	sessionMu.Lock()
+	vc.Header["vmware-api-session-id"] = token
+	sessionMu.Unlock()
+}
+
 // buildVCTagMap - Call the VCenter APIs to build a list of Tags and their category.  These will be used when finding all the VMs
 // that will be discovered based on the filters and options used.
 func (vc *VCenter) buildVCTagMap(keyMap map[string]string) {
@@ -422,7 +516,7 @@ func isIPv6(ip string) bool {
 }
 
 // buildWkldImport - Function that gets the data structure to build a wkld import file and import.
-func buildWkldImport(pce *illumioapi.PCE) {
+func buildWkldImport(pce *illumioapi.PCE, vms map[string]vcenterVM, keyMap map[string]string) {
 
 	var outputFileName string
 	// Set up the csv headers
@@ -430,12 +524,12 @@ func buildWkldImport(pce *illumioapi.PCE) {
 	if umwl {
 		csvData[0] = append(csvData[0], "interfaces")
 	}
-	for _, illumioLabelType := range vc.KeyMap {
+	for _, illumioLabelType := range keyMap {
 		csvData[0] = append(csvData[0], illumioLabelType)
 	}
 
 	//csvData := [][]string{{"hostname", "role", "app", "env", "loc", "interfaces", "name"}
-	for _, vm := range vc.VCVMs {
+	for _, vm := range vms {
 		csvRow := []string{vm.Name, vm.VMID + " - " + "VCenterName = " + vm.VCName}
 		var tmpInf string
 		if umwl {
@@ -461,7 +555,7 @@ func buildWkldImport(pce *illumioapi.PCE) {
 		csvData = append(csvData, csvRow)
 	}
 
-	if len(vc.VCVMs) <= 0 {
+	if len(vms) <= 0 {
 		utils.LogInfo("No Vcenter VMs found", true)
 	} else {
 		if outputFileName == "" {
@@ -495,146 +589,138 @@ func buildWkldImport(pce *illumioapi.PCE) {
 	}
 }
 
-// compileVMData - Function that will pull categories, tags, and vms.  These will map to PCE labeltypes, labels and workloads.
-// The function will find all the tags for each vm that is either running a VEN or desired all machines that are not running a VEN.
-// The output will of the function will be easily imported buy the workload wkld.import feature.
-func (vc *VCenter) compileVMData(keyMap map[string]string) {
-
-	//Get all the PCE data
-	pce, err := utils.GetTargetPCEV2(false)
-	if err != nil {
-		utils.LogError(fmt.Sprintf("Error getting PCE - %s", err.Error()))
-	}
-
-	//Make sure the keyMap file doesnt have incorrect labeltypes.  Exit if it does.
-	validateKeyMap(keyMap, &pce)
+// buildVMs - Matches the inventory VMs to PCE workloads.  Matched VMs are labeled and, with --umwl, unmatched VMs
+// with an IP address become unmanaged workloads.  VCenter categories are converted to PCE label types with the keyMap.
+func buildVMs(inventory []inventoryVM, keyMap map[string]string, tmpWklds map[string]illumioapi.Workload) map[string]vcenterVM {
 
-	//return all VMs with filters
-	if vc.getVCenterVMs() == 0 {
-		utils.LogInfo(fmt.Sprintf("No Vcenter VMs found with current filters datacenter:'%s' cluster:'%s' folder:'%s'", datacenter, cluster, folder), true)
-		return
-	}
+	vms := make(map[string]vcenterVM)
+	labeled := 0
 
-	//Have to build a map of PCE wklds with all the names lowercase
-	tmpWklds := make(map[string]illumioapi.Workload)
-	for key, wkldStruct := range pce.Workloads {
-		tmpWklds[strings.ToLower(nameCheck(key))] = wkldStruct
+	// Hostnames must be unique in the wkld-import file.  The first VM with a hostname is kept.
+	names := make(map[string]inventoryVM)
+	uniqueName := func(name string, invVM inventoryVM) bool {
+		lower := strings.ToLower(nameCheck(name))
+		if first, ok := names[lower]; ok {
+			utils.LogWarning(fmt.Sprintf("%s is the hostname of vm %s in %s and vm %s in %s. skipping the vm in %s.", name, first.VMID, first.VCenter, invVM.VMID, invVM.VCenter, invVM.VCenter), true)
+			return false
+		}
+		names[lower] = invVM
+		return true
 	}
 
-	//Cycle through all VMs looking for match if labeling VMs or no match to creat umwls
-	vc.VCVMs = make(map[string]vcenterVM)
-	//variable to store the correct name
-
-	for _, tmpvm := range vc.VCVMSlice {
+	for _, invVM := range inventory {
 
 		var tmpintfs [][]string
 		count := 0
-		vmTools := true
+		tmpvm := vcenterVM{VMID: invVM.VMID, VCName: invVM.VCName, Name: invVM.VCName, PowerState: invVM.PowerState, IPs: make(map[string]bool)}
 
-		tmpvm.IPs = make(map[string]bool)
 		//Search VMTools Hostname for existing PCE workload or use VCenter Name to match
-		tmpvm.VCName = tmpvm.Name
-		vmIdentity := vc.getVMIdentity(tmpvm.VMID)
 		//If not hostname then VMtools not installed.  Ignore Hostname if using vcenter Name as match.
-		if name := vmIdentity.HostName; name != "" {
+		if invVM.HostName != "" {
 			if !vcName {
-				tmpvm.Name = name
+				tmpvm.Name = invVM.HostName
 			}
 			//IP address is found with getVMIdentity so add it to the map to make sure its only added 1 time to this machine.
-			if vmIdentity.IPAddress != "" {
+			if invVM.IdentityIP != "" {
 				count++
-				tmpvm.IPs[vmIdentity.IPAddress] = true
-				tmpintfips := []string{fmt.Sprint("eth" + fmt.Sprintf("%d", count)), vmIdentity.IPAddress}
-				tmpintfs = [][]string{tmpintfips}
+				tmpvm.IPs[invVM.IdentityIP] = true
+				tmpintfs = [][]string{{fmt.Sprintf("eth%d", count), invVM.IdentityIP}}
+			}
+		}
+
+		// Convert the categories to label types
+		tmpTags := make(map[string]string)
+		for category, tag := range invVM.Tags {
+			if labelType, ok := keyMap[category]; ok {
+				tmpTags[labelType] = tag
 			}
-		} else {
-			vmTools = false
 		}
 
+		// VM IDs are only unique within a VCenter
+		key := invVM.VCenter + "/" + invVM.VMID
+
 		if wkld, ok := tmpWklds[strings.ToLower(nameCheck(tmpvm.Name))]; ok {
-			if !umwl {
-				vc.VCVMs[tmpvm.VMID] = vcenterVM{VCName: tmpvm.VCName, Name: *wkld.Hostname, VMID: tmpvm.VMID, PowerState: tmpvm.PowerState}
+			if !umwl && uniqueName(*wkld.Hostname, invVM) {
+				vms[key] = vcenterVM{VCName: tmpvm.VCName, Name: *wkld.Hostname, VMID: tmpvm.VMID, PowerState: tmpvm.PowerState, Tags: tmpTags}
 			}
 			continue
 		}
 
-		if umwl {
+		if !umwl {
+			continue
+		}
 
-			if allIPs {
-				//If you the VMIdentity API doesnt provide data then no VMtools - Skip getting NetworkDetails.
-				if vmTools {
-					tmpvm.VMInterfaces = vc.getVMNetworkDetail(tmpvm.VMID)
-				}
-				if len(tmpintfs) == 0 && len(tmpvm.VMInterfaces) == 0 {
-					continue
-				}
-				for _, intf := range tmpvm.VMInterfaces {
-					//increment eth for more interfaces
-					count++
-					//VMware will provide the same IP multiple times but PCE doesnt like that.  Only get unique IPs
-					for _, ips := range intf.IP.IPAddresses {
-						if isIPv6(ips.IPAddress) && !ipv6 {
-							// bydefault skip all IPv6 address unless added as an option
-							continue
-						}
-						if ok := tmpvm.IPs[ips.IPAddress]; ok {
-							continue
-						} else {
-							tmpvm.IPs[ips.IPAddress] = true
-						}
-
-						tmpintfips := []string{fmt.Sprint("eth" + fmt.Sprintf("%d", count)), ips.IPAddress}
-						tmpintfs = append(tmpintfs, tmpintfips)
+		if allIPs {
+			for _, intf := range invVM.Interfaces {
+				//increment eth for more interfaces
+				count++
+				//VMware will provide the same IP multiple times but PCE doesnt like that.  Only get unique IPs
+				for _, ips := range intf.IP.IPAddresses {
+					if isIPv6(ips.IPAddress) && !ipv6 {
+						// bydefault skip all IPv6 address unless added as an option
+						continue
+					}
+					if tmpvm.IPs[ips.IPAddress] {
+						continue
 					}
+					tmpvm.IPs[ips.IPAddress] = true
+					tmpintfs = append(tmpintfs, []string{fmt.Sprintf("eth%d", count), ips.IPAddress})
 				}
-
 			}
+		}
 
-			//Make sure there is an is an interface that has an IP otherwise VM should not be added as an UWM
-			if len(tmpintfs) == 0 {
-				continue
-			}
-			vc.VCVMs[tmpvm.VMID] = vcenterVM{VCName: tmpvm.VCName, Name: tmpvm.Name, VMID: tmpvm.VMID, PowerState: tmpvm.PowerState, Interfaces: tmpintfs}
+		//Make sure there is an is an interface that has an IP otherwise VM should not be added as an UWM
+		if len(tmpintfs) == 0 || !uniqueName(tmpvm.Name, invVM) {
+			continue
 		}
+		vms[key] = vcenterVM{VCName: tmpvm.VCName, Name: tmpvm.Name, VMID: tmpvm.VMID, PowerState: tmpvm.PowerState, Interfaces: tmpintfs, Tags: tmpTags}
 	}
 
-	//After getting all the VMs build a keymap for all the Categories matched in the keyMap to be used for labeling
-	vc.buildVCTagMap(keyMap)
+	for _, vm := range vms {
+		if len(vm.Tags) > 0 {
+			labeled++
+		}
+	}
+	utils.LogInfo(fmt.Sprintf("Total VMs found - %d.  Total VMs with Illumio Labels - %d", len(vms), labeled), true)
 
-	//Get all the Tags for VMs that were found above.
-	totalVMs := vc.getTagsfromVMs(vc.VCVMs, vc.VCTags)
+	return vms
+}
 
-	//Cycle through all the VMs that returned with tags and add the Tags that are importable.  All other VMs will not have Tags.
-	count := 0
-	for _, object := range totalVMs {
-		tmpTags := make(map[string]string)
-		//Variable to store if VM has Illumio Labels or not
-		found := false
-		for _, tag := range object.TagIds {
+// compileVMData - Function that will pull categories, tags, and vms.  These will map to PCE labeltypes, labels and workloads.
+// The function will find all the tags for each vm that is either running a VEN or desired all machines that are not running a VEN.
+// VMs are gathered from each VCenter (or the inventory cache) and the output is imported with the wkld-import feature.
+func compileVMData(keyMap map[string]string) {
 
-			//Check for a tag and to see if you have adont have 2 Tags with the same Category on the same VM
+	//Get all the PCE data
+	pce, err := utils.GetTargetPCEV2(false)
+	if err != nil {
+		utils.LogError(fmt.Sprintf("Error getting PCE - %s", err.Error()))
+	}
 
-			if _, ok := vc.VCTags[tag]; ok {
-				found = true
-				if _, ok := tmpTags[vc.VCTags[tag].LabelType]; ok {
-					utils.LogInfo(fmt.Sprintf("VM has 2 or more Tags with the same Category - %s ", vc.VCVMs[object.ObjectId.ID].Name), true)
-					continue
-				}
-				tmpTags[vc.VCTags[tag].LabelType] = vc.VCTags[tag].Tag
-			}
-			//If we VM has Illumio Labels count this VM.
+	//Make sure the keyMap file doesnt have incorrect labeltypes.  Exit if it does.
+	validateKeyMap(keyMap, &pce)
 
-		}
+	//Have to build a map of PCE wklds with all the names lowercase
+	tmpWklds := make(map[string]illumioapi.Workload)
+	for key, wkldStruct := range pce.Workloads {
+		tmpWklds[strings.ToLower(nameCheck(key))] = wkldStruct
+	}
 
-		//count up all the VMs and total labels.
-		if found {
-			count++
+	// Get the inventory from the cache or from each VCenter
+	var inventory []inventoryVM
+	if fromCache {
+		inventory = readInventory(cacheFile)
+	} else {
+		for _, vcenterFQDN := range strings.Split(vcenter, ",") {
+			vc = VCenter{KeyMap: keyMap, VCenterURL: vcenterFQDN, User: userID, Secret: secret, DisableTLSChecking: insecure, Header: make(map[string]string)}
+			vc.setupVCenterSession()
+			inventory = append(inventory, vc.collectInventory(keyMap, tmpWklds)...)
+		}
+		if cacheFile != "" {
+			writeInventory(cacheFile, inventory)
 		}
-		vc.VCVMs[object.ObjectId.ID] = vcenterVM{VMID: vc.VCVMs[object.ObjectId.ID].VMID, VCName: vc.VCVMs[object.ObjectId.ID].VCName, Name: vc.VCVMs[object.ObjectId.ID].Name, PowerState: vc.VCVMs[object.ObjectId.ID].PowerState, Tags: tmpTags, Interfaces: vc.VCVMs[object.ObjectId.ID].Interfaces}
 	}
 
-	utils.LogInfo(fmt.Sprintf("Total VMs found - %d.  Total VMs with Illumio Labels - %d", len(vc.VCVMs), count), true)
-
 	//Build call wkld-Import using the VMs and the tags found in VCenter.
-	buildWkldImport(&pce)
+	buildWkldImport(&pce, buildVMs(inventory, keyMap, tmpWklds), keyMap)
 }
@@ -25,7 +25,7 @@ The criteria for identifying for removal are below:
 1) Multiple VENs with the same hostname
 2) Other VENs with the same hostname have a more recent heartbeat
 
-The output of this command can be fed into the wkld-unpair command.
+The output of this command can be fed into the wkld-unpair command. Use wkld-reconcile to also unpair the VENs.
 
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
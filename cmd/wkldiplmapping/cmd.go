@@ -21,6 +21,7 @@ type input struct {
 	role, app, env, loc string
 	skipIPLs            string
 	labelFile           string
+	selectExpr          string
 }
 
 var in input
@@ -35,6 +36,7 @@ func init() {
 	WkldIPLMappingCmd.Flags().StringVarP(&in.env, "env", "e", "", "env label value. label flags are an \"and\" operator.")
 	WkldIPLMappingCmd.Flags().StringVarP(&in.loc, "loc", "l", "", "loc label value. label flags are an \"and\" operator.")
 	WkldIPLMappingCmd.Flags().StringVar(&in.labelFile, "label-file", "", "csv file with labels to filter query. the file should have 4 headers: role, app, env, and loc. The four columns in each row is an \"AND\" operation. Each row is an \"OR\" operation.")
+	WkldIPLMappingCmd.Flags().StringVar(&in.selectExpr, "select", "", "selector expression to filter workloads. can be combined with label flags or label-file. see description below.")
 	WkldIPLMappingCmd.Flags().StringVar(&in.outputFileName, "output-file", "", "optionally specify the name of the output file location. default is current location with a timestamped filename.")
 
 	WkldIPLMappingCmd.Flags().SortFlags = false
@@ -48,6 +50,8 @@ var WkldIPLMappingCmd = &cobra.Command{
 	Long: `
 Create a CSV export showing how a workload maps to IP lists.
 
+` + utils.SelectorHelp + `
+
 The update-pce and --no-prompt flags are ignored for this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -93,6 +97,12 @@ func ipCheck(ip string, ipl illumioapi.IPList) (bool, error) {
 
 func wkldToIPLMapping(input input) {
 
+	// Parse the selector
+	selector, err := utils.ParseSelector(input.selectExpr)
+	if err != nil {
+		utils.LogError(err.Error())
+	}
+
 	// Load the PCE
 	apiResps, err := input.pce.Load(illumioapi.LoadInput{Labels: true, IPLists: true, Workloads: false})
 	utils.LogMultiAPIResp(apiResps)
@@ -161,6 +171,7 @@ func wkldToIPLMapping(input input) {
 	if err != nil {
 		utils.LogError(fmt.Sprintf("getting all workloads - %s", err))
 	}
+	wklds = selector.FilterV1(wklds, input.pce.Labels)
 
 	csvData := [][]string{{"hostname", "interfaces", "matching_iplists", "policy_state", "role", "app", "env", "loc"}}
 
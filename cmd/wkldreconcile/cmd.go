@@ -0,0 +1,295 @@
+package wkldreconcile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Declare local global variables
+var pce ia.PCE
+var err error
+var matchStrategies, interfaceMatch, labelMode, restore, outputFileName string
+var caseSensitive, keepDomain, skipLabels, skipUMWLDelete, skipUnpair, updatePCE, noPrompt bool
+var minConfidence, staleHours int
+
+func init() {
+	WkldReconcileCmd.Flags().StringVarP(&matchStrategies, "match", "m", "hostname,interfaces,external-data,cloud-id", "comma-separated match strategies. options are hostname, interfaces, external-data, and cloud-id.")
+	WkldReconcileCmd.Flags().StringVar(&interfaceMatch, "interface-match", "all", "all requires all unmanaged workload interfaces to be on the managed workload. any adds a lower confidence for a partial match.")
+	WkldReconcileCmd.Flags().BoolVarP(&caseSensitive, "case-sensitive", "c", false, "require hostname matches to be case-sensitive.")
+	WkldReconcileCmd.Flags().BoolVar(&keepDomain, "keep-domain", false, "require hostnames to match with the domain. by default a match without the domain is a lower confidence match.")
+	WkldReconcileCmd.Flags().IntVar(&minConfidence, "min-confidence", 60, "minimum confidence (1-100) for a match to be actioned. lower confidence matches are in the plan for review.")
+	WkldReconcileCmd.Flags().StringVar(&labelMode, "label-mode", "fill", "fill only adds unmanaged workload labels for dimensions the managed workload doesn't have. overwrite replaces the managed workload labels.")
+	WkldReconcileCmd.Flags().IntVar(&staleHours, "stale-hours", 0, "only unpair duplicate vens that have not sent a heartbeat in set time. 0 will ignore heartbeats.")
+	WkldReconcileCmd.Flags().StringVar(&restore, "restore", "saved", "restore value for unpairing stale vens. must be saved, default, or disable.")
+	WkldReconcileCmd.Flags().BoolVar(&skipLabels, "skip-labels", false, "do not carry unmanaged workload labels to managed workloads.")
+	WkldReconcileCmd.Flags().BoolVar(&skipUMWLDelete, "skip-umwl-delete", false, "do not delete matched unmanaged workloads.")
+	WkldReconcileCmd.Flags().BoolVar(&skipUnpair, "skip-unpair", false, "do not unpair stale vens.")
+	WkldReconcileCmd.Flags().StringVar(&outputFileName, "output-file", "", "optionally specify the name of the plan file. default is current location with a timestamped filename.")
+
+	WkldReconcileCmd.Flags().SortFlags = false
+}
+
+// WkldReconcileCmd reconciles unmanaged workloads and stale vens with managed workloads
+var WkldReconcileCmd = &cobra.Command{
+	Use:   "wkld-reconcile",
+	Short: "Match unmanaged workloads to managed workloads, carry labels, delete the unmanaged workloads, and unpair stale VENs.",
+	Long: `
+Match unmanaged workloads to managed workloads, carry labels, delete the unmanaged workloads, and unpair stale VENs.
+
+This combines dupecheck, umwl-cleanup, and wkld-cleanup. It helps when unmanaged workloads were created and labeled before VENs were installed and when hosts are re-paired.
+
+Stale VENs are VENs with the same hostname (or cloud instance id with the cloud-id strategy) as another VEN with a more recent heartbeat. Their workloads are not matched.
+
+Each unmanaged workload is matched to managed workloads with the --match strategies. The confidence of a match is the sum of the strategies that match (max 100):
+  - cloud-id (100): the cloud instance id of the managed workload is the external data reference, name, or hostname of the unmanaged workload.
+  - external-data (90): same external data set and reference.
+  - hostname (60, or 45 without the domain): the hostname or name of the unmanaged workload is the managed workload hostname. case-insensitive unless --case-sensitive.
+  - interfaces (60, or 30 for a partial match with --interface-match any): the unmanaged workload ip addresses are on the managed workload.
+The highest confidence managed workload is the match. Matches below --min-confidence, ties, and managed workloads matched by more than one unmanaged workload are marked for review.
+
+The plan csv has a row for each action:
+  - label: carry the unmanaged workload labels to the managed workload (--label-mode fill or overwrite).
+  - delete-umwl: delete the unmanaged workload. skipped if labels need to be carried and the label step does not run.
+  - unpair: unpair the stale ven.
+  - review: matches that are not actioned.
+Each step is prompted separately with --update-pce. Use --skip-labels, --skip-umwl-delete, or --skip-unpair to leave out a step.
+
+umwl_href is only filled on delete-umwl rows and ven_href is only filled on unpair rows. Label and review rows identify the unmanaged workload by umwl_hostname, umwl_name, and umwl_interfaces.
+The plan can be used with the delete command (--header umwl_href) and the unpair command (--href-file with the ven_href header). Rows with a blank href are skipped by those commands, so edit the plan to remove any deletes or unpairs you do not want.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Get the PCE
+		pce, err = utils.GetTargetPCEV2(false)
+		if err != nil {
+			utils.LogErrorf("getting target pce - %s", err)
+		}
+
+		// Get the viper values
+		updatePCE = viper.Get("update_pce").(bool)
+		noPrompt = viper.Get("no_prompt").(bool)
+
+		wkldReconcile()
+	},
+}
+
+func wkldReconcile() {
+
+	// Validate the flags
+	strategyNames := []string{}
+	for _, s := range strings.Split(strings.ToLower(strings.ReplaceAll(matchStrategies, " ", "")), ",") {
+		if _, ok := strategies[s]; !ok {
+			utils.LogErrorf("%s is not a valid match strategy. options are hostname, interfaces, external-data, and cloud-id", s)
+		}
+		strategyNames = append(strategyNames, s)
+	}
+	interfaceMatch = strings.ToLower(interfaceMatch)
+	if interfaceMatch != "all" && interfaceMatch != "any" {
+		utils.LogError("interface-match must be all or any")
+	}
+	labelMode = strings.ToLower(labelMode)
+	if labelMode != "fill" && labelMode != "overwrite" {
+		utils.LogError("label-mode must be fill or overwrite")
+	}
+	if minConfidence < 1 || minConfidence > 100 {
+		utils.LogError("min-confidence must be between 1 and 100")
+	}
+	if restore != "saved" && restore != "default" && restore != "disable" {
+		utils.LogError("restore must be saved, default, or disable")
+	}
+
+	// Load the pce
+	apiResps, err := pce.Load(ia.LoadInput{Workloads: true, VENs: true, Labels: true, LabelDimensions: true}, utils.UseMulti())
+	utils.LogMultiAPIRespV2(apiResps)
+	if err != nil {
+		utils.LogErrorf("loading the pce - %s", err)
+	}
+
+	// Find the stale vens and build the plan
+	stale := staleVENs(strategyIncluded(strategyNames, "cloud-id"))
+	staleWklds := make(map[string]bool)
+	for _, s := range stale {
+		staleWklds[s.wkld.Href] = true
+	}
+	r := newReconciler(pce.WorkloadsSlice, staleWklds, strategyNames)
+	p := buildPlan(r, stale)
+	writePlan(p)
+
+	labels, deletes, unpairs := p.count(actionLabel), p.count(actionDeleteUMWL), p.count(actionUnpair)
+	utils.LogInfof(true, "%d label updates, %d unmanaged workload deletes, %d ven unpairs, and %d to review", labels, deletes, unpairs, p.count(actionReview))
+	if labels+deletes+unpairs == 0 {
+		utils.LogInfo("nothing to be done.", true)
+		return
+	}
+	if !updatePCE {
+		utils.LogInfo("see the plan file for all identified actions. to run the actions, run again using --update-pce flag. each step is prompted separately unless --no-prompt is used.", true)
+		return
+	}
+
+	// Carry the labels
+	labelsApplied := false
+	if labels > 0 && confirm(fmt.Sprintf("update the labels of %d managed workloads", labels)) {
+		updates := []ia.Workload{}
+		for _, a := range p.actions(actionLabel) {
+			updates = append(updates, a.update)
+		}
+		apiResps, err := pce.BulkWorkload(updates, "update", true)
+		for _, a := range apiResps {
+			utils.LogAPIRespV2("BulkWorkload", a)
+		}
+		if err != nil {
+			utils.LogErrorf("bulk updating workloads - %s", err)
+		}
+		utils.LogInfof(true, "updated the labels of %d managed workloads", len(updates))
+		labelsApplied = true
+	}
+
+	// Delete the unmanaged workloads. Deletes that depend on labels being carried are skipped if the labels were not updated.
+	deleteWklds := []ia.Workload{}
+	for _, a := range p.actions(actionDeleteUMWL) {
+		if a.needsLabels && !labelsApplied {
+			utils.LogInfof(true, "%s - labels were not carried to %s - skipping delete", a.umwl.Href, a.managed.Href)
+			continue
+		}
+		deleteWklds = append(deleteWklds, ia.Workload{Href: a.umwl.Href})
+	}
+	if len(deleteWklds) > 0 && confirm(fmt.Sprintf("delete %d unmanaged workloads", len(deleteWklds))) {
+		apiResps, err := pce.BulkWorkload(deleteWklds, "delete", true)
+		for _, a := range apiResps {
+			utils.LogAPIRespV2("BulkWorkload", a)
+		}
+		if err != nil {
+			utils.LogErrorf("bulk deleting workloads - %s", err)
+		}
+		utils.LogInfof(true, "deleted %d unmanaged workloads", len(deleteWklds))
+	}
+
+	// Unpair the stale vens
+	if unpairs > 0 && confirm(fmt.Sprintf("unpair %d stale vens", unpairs)) {
+		vens := []ia.VEN{}
+		for _, a := range p.actions(actionUnpair) {
+			vens = append(vens, ia.VEN{Href: a.ven.Href})
+		}
+		apiResps, err := pce.VensUnpair(vens, restore)
+		for _, a := range apiResps {
+			utils.LogAPIRespV2("VensUnpair", a)
+		}
+		if err != nil {
+			utils.LogErrorf("unpairing vens - %s", err)
+		}
+		utils.LogInfof(true, "unpaired %d vens", len(vens))
+	}
+}
+
+// confirm prompts for a step unless no-prompt is set
+func confirm(step string) bool {
+	if noPrompt {
+		return true
+	}
+	var prompt string
+	fmt.Printf("%s [PROMPT] - workloader will %s in %s (%s). Do you want to run this step (yes/no)? ", time.Now().Format("2006-01-02 15:04:05 "), step, pce.FriendlyName, viper.Get(pce.FriendlyName+".fqdn").(string))
+	fmt.Scanln(&prompt)
+	if strings.ToLower(prompt) != "yes" {
+		utils.LogInfof(true, "prompt denied to %s.", step)
+		return false
+	}
+	return true
+}
+
+// strategyIncluded returns true if the strategy is in the list
+func strategyIncluded(strategyNames []string, name string) bool {
+	for _, s := range strategyNames {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// staleVEN is a ven with a duplicate that has a more recent heartbeat
+type staleVEN struct {
+	ven, current ia.VEN
+	wkld         ia.Workload
+	reason       string
+}
+
+// staleVENs groups vens by hostname and optionally cloud instance id. All but the most recent heartbeat in each group are stale.
+func staleVENs(byInstanceID bool) []staleVEN {
+	venWklds := make(map[string]ia.Workload)
+	for _, ven := range pce.VENsSlice {
+		if len(ia.PtrToVal(ven.Workloads)) != 1 {
+			continue
+		}
+		if w, ok := pce.Workloads[ia.PtrToVal(ven.Workloads)[0].Href]; ok {
+			venWklds[ven.Href] = w
+		}
+	}
+
+	groupings := []struct {
+		name string
+		key  func(ven ia.VEN) string
+	}{{"hostname", func(ven ia.VEN) string { return normalizeHostname(ia.PtrToVal(ven.Hostname), false) }}}
+	if byInstanceID {
+		groupings = append(groupings, struct {
+			name string
+			key  func(ven ia.VEN) string
+		}{"cloud instance id", func(ven ia.VEN) string {
+			if w, ok := venWklds[ven.Href]; ok && w.Agent != nil {
+				return strings.ToLower(w.Agent.Status.InstanceID)
+			}
+			return ""
+		}})
+	}
+
+	stale := []staleVEN{}
+	staleHrefs := make(map[string]bool)
+	for _, grouping := range groupings {
+		groups := make(map[string][]ia.VEN)
+		for _, ven := range pce.VENsSlice {
+			if key := grouping.key(ven); key != "" && !staleHrefs[ven.Href] {
+				groups[key] = append(groups[key], ven)
+			}
+		}
+		keys := []string{}
+		for k := range groups {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			vens := groups[key]
+			if len(vens) == 1 {
+				continue
+			}
+			sort.Slice(vens, func(i, j int) bool { return heartbeat(vens[i]).After(heartbeat(vens[j])) })
+			for _, ven := range vens[1:] {
+				if staleHours > 0 && time.Since(heartbeat(ven)).Hours() < float64(staleHours) {
+					utils.LogInfof(false, "%s - %s - last heartbeat within %d hours. not stale.", ven.Href, ia.PtrToVal(ven.Hostname), staleHours)
+					continue
+				}
+				if _, ok := venWklds[ven.Href]; !ok {
+					utils.LogWarningf(true, "%s - ven does not have 1 workload attached. skipping.", ven.Href)
+					continue
+				}
+				staleHrefs[ven.Href] = true
+				stale = append(stale, staleVEN{ven: ven, current: vens[0], wkld: venWklds[ven.Href], reason: fmt.Sprintf("same %s %s", grouping.name, key)})
+			}
+		}
+	}
+	return stale
+}
+
+// heartbeat parses the last heartbeat of the ven. vens that never sent a heartbeat are the zero time.
+func heartbeat(ven ia.VEN) time.Time {
+	t, err := time.Parse("2006-01-02T15:04:05.000Z", ven.LastHeartBeatAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
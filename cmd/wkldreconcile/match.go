@@ -0,0 +1,224 @@
+package wkldreconcile
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// Confidence of each match. The confidence of a candidate is the sum of its matches with a max of 100.
+const (
+	confidenceCloudID        = 100
+	confidenceExternalData   = 90
+	confidenceHostname       = 60
+	confidenceShortHostname  = 45
+	confidenceAllInterfaces  = 60
+	confidenceSomeInterfaces = 30
+)
+
+// strategy returns the matches of an unmanaged workload to managed workloads
+type strategy func(r *reconciler, umwl ia.Workload) []match
+
+// strategies are the available match strategies by name
+var strategies = map[string]strategy{
+	"hostname":      matchHostname,
+	"interfaces":    matchInterfaces,
+	"external-data": matchExternalData,
+	"cloud-id":      matchCloudID,
+}
+
+// match is a managed workload matched by a strategy
+type match struct {
+	href       string
+	confidence int
+	reason     string
+}
+
+// candidate is a managed workload with the combined confidence of all matches
+type candidate struct {
+	managed    ia.Workload
+	confidence int
+	reasons    []string
+}
+
+// reconciler holds the managed workload indexes used by the strategies
+type reconciler struct {
+	managed        map[string]ia.Workload
+	hostnames      map[string][]string
+	shortHostnames map[string][]string
+	ips            map[string][]string
+	externalData   map[string][]string
+	instanceIDs    map[string][]string
+	strategies     []string
+}
+
+// newReconciler indexes the managed workloads. Workloads with stale VENs are excluded so the current workload is matched.
+func newReconciler(workloads []ia.Workload, exclude map[string]bool, strategyNames []string) *reconciler {
+	r := &reconciler{
+		managed:        make(map[string]ia.Workload),
+		hostnames:      make(map[string][]string),
+		shortHostnames: make(map[string][]string),
+		ips:            make(map[string][]string),
+		externalData:   make(map[string][]string),
+		instanceIDs:    make(map[string][]string),
+		strategies:     strategyNames,
+	}
+	add := func(m map[string][]string, key, href string) {
+		if key == "" {
+			return
+		}
+		for _, h := range m[key] {
+			if h == href {
+				return
+			}
+		}
+		m[key] = append(m[key], href)
+	}
+	for _, w := range workloads {
+		if w.GetMode() == "unmanaged" || exclude[w.Href] {
+			continue
+		}
+		r.managed[w.Href] = w
+		add(r.hostnames, normalizeHostname(ia.PtrToVal(w.Hostname), false), w.Href)
+		add(r.shortHostnames, normalizeHostname(ia.PtrToVal(w.Hostname), true), w.Href)
+		for _, i := range ia.PtrToVal(w.Interfaces) {
+			add(r.ips, i.Address, w.Href)
+		}
+		if ia.PtrToVal(w.ExternalDataReference) != "" {
+			add(r.externalData, ia.PtrToVal(w.ExternalDataSet)+"|"+ia.PtrToVal(w.ExternalDataReference), w.Href)
+		}
+		if w.Agent != nil {
+			add(r.instanceIDs, strings.ToLower(w.Agent.Status.InstanceID), w.Href)
+		}
+	}
+	return r
+}
+
+// candidates returns the managed workloads matching the unmanaged workload sorted by confidence
+func (r *reconciler) candidates(umwl ia.Workload) []candidate {
+	candidateMap := make(map[string]*candidate)
+	for _, name := range r.strategies {
+		// Only the best match of each strategy counts toward the confidence
+		best := make(map[string]match)
+		for _, m := range strategies[name](r, umwl) {
+			if m.confidence > best[m.href].confidence {
+				best[m.href] = m
+			}
+		}
+		for href, m := range best {
+			c, ok := candidateMap[href]
+			if !ok {
+				c = &candidate{managed: r.managed[href]}
+				candidateMap[href] = c
+			}
+			c.confidence = c.confidence + m.confidence
+			c.reasons = append(c.reasons, m.reason)
+		}
+	}
+
+	candidates := []candidate{}
+	for _, c := range candidateMap {
+		if c.confidence > 100 {
+			c.confidence = 100
+		}
+		candidates = append(candidates, *c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].confidence != candidates[j].confidence {
+			return candidates[i].confidence > candidates[j].confidence
+		}
+		return candidates[i].managed.Href < candidates[j].managed.Href
+	})
+	return candidates
+}
+
+// matchHostname matches the hostname and name of the unmanaged workload to managed hostnames
+func matchHostname(r *reconciler, umwl ia.Workload) []match {
+	matches := []match{}
+	for _, field := range []struct{ name, value string }{{"hostname", ia.PtrToVal(umwl.Hostname)}, {"name", ia.PtrToVal(umwl.Name)}} {
+		if field.value == "" {
+			continue
+		}
+		for _, href := range r.hostnames[normalizeHostname(field.value, false)] {
+			matches = append(matches, match{href: href, confidence: confidenceHostname, reason: fmt.Sprintf("%s %s matches hostname", field.name, field.value)})
+		}
+		if keepDomain {
+			continue
+		}
+		for _, href := range r.shortHostnames[normalizeHostname(field.value, true)] {
+			matches = append(matches, match{href: href, confidence: confidenceShortHostname, reason: fmt.Sprintf("%s %s matches hostname without the domain", field.name, field.value)})
+		}
+	}
+	return matches
+}
+
+// matchInterfaces matches the ip addresses of the unmanaged workload to managed interfaces
+func matchInterfaces(r *reconciler, umwl ia.Workload) []match {
+	ips := []string{}
+	for _, i := range ia.PtrToVal(umwl.Interfaces) {
+		if i.Address != "" {
+			ips = append(ips, i.Address)
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, ip := range ips {
+		for _, href := range r.ips[ip] {
+			counts[href]++
+		}
+	}
+	matches := []match{}
+	for href, count := range counts {
+		if count == len(ips) {
+			matches = append(matches, match{href: href, confidence: confidenceAllInterfaces, reason: fmt.Sprintf("all %d interfaces match", len(ips))})
+		} else if interfaceMatch == "any" {
+			matches = append(matches, match{href: href, confidence: confidenceSomeInterfaces, reason: fmt.Sprintf("%d of %d interfaces match", count, len(ips))})
+		}
+	}
+	return matches
+}
+
+// matchExternalData matches the external data set and reference
+func matchExternalData(r *reconciler, umwl ia.Workload) []match {
+	if ia.PtrToVal(umwl.ExternalDataReference) == "" {
+		return nil
+	}
+	matches := []match{}
+	for _, href := range r.externalData[ia.PtrToVal(umwl.ExternalDataSet)+"|"+ia.PtrToVal(umwl.ExternalDataReference)] {
+		matches = append(matches, match{href: href, confidence: confidenceExternalData, reason: fmt.Sprintf("external data %s %s matches", ia.PtrToVal(umwl.ExternalDataSet), ia.PtrToVal(umwl.ExternalDataReference))})
+	}
+	return matches
+}
+
+// matchCloudID matches the cloud instance id of the managed workload to the external data reference, name, or hostname of the unmanaged workload.
+// Cloud sync tools commonly store the instance id in one of these fields.
+func matchCloudID(r *reconciler, umwl ia.Workload) []match {
+	matches := []match{}
+	for _, field := range []struct{ name, value string }{{"external data reference", ia.PtrToVal(umwl.ExternalDataReference)}, {"name", ia.PtrToVal(umwl.Name)}, {"hostname", ia.PtrToVal(umwl.Hostname)}} {
+		if field.value == "" {
+			continue
+		}
+		for _, href := range r.instanceIDs[strings.ToLower(field.value)] {
+			matches = append(matches, match{href: href, confidence: confidenceCloudID, reason: fmt.Sprintf("%s matches cloud instance id %s", field.name, field.value)})
+		}
+	}
+	return matches
+}
+
+// normalizeHostname trims and lowercases the hostname. With short, the domain is removed unless the hostname is an ip address.
+func normalizeHostname(hostname string, short bool) string {
+	hostname = strings.TrimSuffix(strings.TrimSpace(hostname), ".")
+	if !caseSensitive {
+		hostname = strings.ToLower(hostname)
+	}
+	if short && net.ParseIP(hostname) == nil {
+		hostname = strings.Split(hostname, ".")[0]
+	}
+	return hostname
+}
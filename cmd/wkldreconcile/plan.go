@@ -0,0 +1,187 @@
+package wkldreconcile
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ia "github.com/brian1917/illumioapi/v2"
+	"github.com/brian1917/workloader/utils"
+)
+
+// Plan actions
+const (
+	actionLabel      = "label"
+	actionDeleteUMWL = "delete-umwl"
+	actionUnpair     = "unpair"
+	actionReview     = "review"
+)
+
+// action is a step of the plan
+type action struct {
+	action      string
+	confidence  int
+	reason      string
+	details     string
+	umwl        ia.Workload
+	managed     ia.Workload
+	ven         ia.VEN
+	update      ia.Workload
+	needsLabels bool
+}
+
+type plan struct {
+	steps []action
+}
+
+func (p *plan) add(a action) {
+	p.steps = append(p.steps, a)
+}
+
+// actions returns the steps of an action type
+func (p *plan) actions(actionType string) []action {
+	actions := []action{}
+	for _, a := range p.steps {
+		if a.action == actionType {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
+
+func (p *plan) count(actionType string) int {
+	return len(p.actions(actionType))
+}
+
+// buildPlan matches each unmanaged workload and adds the label, delete, and unpair actions
+func buildPlan(r *reconciler, stale []staleVEN) *plan {
+	p := &plan{}
+
+	// Match the unmanaged workloads
+	type matched struct {
+		umwl ia.Workload
+		best candidate
+	}
+	matches := []matched{}
+	managedMatchCount := make(map[string]int)
+	for _, w := range pce.WorkloadsSlice {
+		if w.GetMode() != "unmanaged" {
+			continue
+		}
+		candidates := r.candidates(w)
+		if len(candidates) == 0 {
+			continue
+		}
+		best := candidates[0]
+		switch {
+		case best.confidence < minConfidence:
+			p.add(action{action: actionReview, confidence: best.confidence, reason: strings.Join(best.reasons, "; "), details: fmt.Sprintf("below min confidence of %d", minConfidence), umwl: w, managed: best.managed})
+		case len(candidates) > 1 && candidates[1].confidence == best.confidence:
+			hrefs := []string{}
+			for _, c := range candidates {
+				if c.confidence == best.confidence {
+					hrefs = append(hrefs, c.managed.Href)
+				}
+			}
+			p.add(action{action: actionReview, confidence: best.confidence, reason: strings.Join(best.reasons, "; "), details: fmt.Sprintf("matches %d managed workloads with the same confidence: %s", len(hrefs), strings.Join(hrefs, "; ")), umwl: w, managed: best.managed})
+		default:
+			matches = append(matches, matched{umwl: w, best: best})
+			managedMatchCount[best.managed.Href]++
+		}
+	}
+
+	// Label and delete the matched unmanaged workloads
+	for _, m := range matches {
+		a := action{confidence: m.best.confidence, reason: strings.Join(m.best.reasons, "; "), umwl: m.umwl, managed: m.best.managed}
+		if managedMatchCount[m.best.managed.Href] > 1 {
+			a.action = actionReview
+			a.details = fmt.Sprintf("%d unmanaged workloads match the managed workload", managedMatchCount[m.best.managed.Href])
+			p.add(a)
+			continue
+		}
+
+		changes, update := carryLabels(m.umwl, m.best.managed)
+		if len(changes) > 0 && !skipLabels {
+			labelAction := a
+			labelAction.action = actionLabel
+			labelAction.details = strings.Join(changes, "; ")
+			labelAction.update = update
+			p.add(labelAction)
+		}
+		if skipUMWLDelete {
+			continue
+		}
+		deleteAction := a
+		deleteAction.action = actionDeleteUMWL
+		deleteAction.needsLabels = len(changes) > 0
+		if len(changes) > 0 && skipLabels {
+			deleteAction.action = actionReview
+			deleteAction.details = "labels not carried with --skip-labels: " + strings.Join(changes, "; ")
+		}
+		p.add(deleteAction)
+	}
+
+	// Unpair the stale vens
+	if !skipUnpair {
+		for _, s := range stale {
+			p.add(action{action: actionUnpair, confidence: 100, reason: s.reason, details: fmt.Sprintf("last heartbeat at %s. %s has a more recent heartbeat at %s", s.ven.LastHeartBeatAt, s.current.Href, s.current.LastHeartBeatAt), managed: s.wkld, ven: s.ven})
+		}
+	}
+
+	return p
+}
+
+// carryLabels returns the label changes and the managed workload with the unmanaged workload labels based on the label mode
+func carryLabels(umwl, managed ia.Workload) ([]string, ia.Workload) {
+	changes := []string{}
+	newLabels := []ia.Label{}
+	for _, ld := range pce.LabelDimensionsSlice {
+		umwlLabel := umwl.GetLabelByKey(ld.Key, pce.Labels)
+		managedLabel := managed.GetLabelByKey(ld.Key, pce.Labels)
+		switch {
+		case umwlLabel.Href == "" || umwlLabel.Href == managedLabel.Href || (labelMode == "fill" && managedLabel.Href != ""):
+			if managedLabel.Href != "" {
+				newLabels = append(newLabels, ia.Label{Href: managedLabel.Href})
+			}
+		default:
+			from := managedLabel.Value
+			if from == "" {
+				from = "none"
+			}
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", ld.Key, from, umwlLabel.Value))
+			newLabels = append(newLabels, ia.Label{Href: umwlLabel.Href})
+		}
+	}
+	managed.Labels = &newLabels
+	return changes, managed
+}
+
+// writePlan writes a row for each action. umwl_href is only filled on delete-umwl rows so the plan can be passed to the delete command.
+func writePlan(p *plan) {
+	csvData := [][]string{{"action", "confidence", "reason", "details", "umwl_href", "umwl_hostname", "umwl_name", "umwl_interfaces", "managed_href", "managed_hostname", "managed_interfaces", "ven_href"}}
+	for _, a := range p.steps {
+		umwlHref := ""
+		if a.action == actionDeleteUMWL {
+			umwlHref = a.umwl.Href
+		}
+		csvData = append(csvData, []string{a.action, fmt.Sprintf("%d", a.confidence), a.reason, a.details, umwlHref, ia.PtrToVal(a.umwl.Hostname), ia.PtrToVal(a.umwl.Name), interfaces(a.umwl), a.managed.Href, ia.PtrToVal(a.managed.Hostname), interfaces(a.managed), a.ven.Href})
+	}
+	if len(csvData) == 1 {
+		utils.LogInfo("no unmanaged workloads matched and no stale vens found.", true)
+		return
+	}
+	if outputFileName == "" {
+		outputFileName = fmt.Sprintf("workloader-wkld-reconcile-%s.csv", time.Now().Format("20060102_150405"))
+	}
+	utils.WriteOutput(csvData, csvData, outputFileName)
+	utils.LogInfof(true, "plan with %d actions created - %s", len(csvData)-1, outputFileName)
+}
+
+// interfaces returns the interfaces in name:address format
+func interfaces(w ia.Workload) string {
+	s := []string{}
+	for _, i := range ia.PtrToVal(w.Interfaces) {
+		s = append(s, fmt.Sprintf("%s:%s", i.Name, i.Address))
+	}
+	return strings.Join(s, ";")
+}
@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// LastIP returns the last IP address in a CIDR
+func LastIP(ipNet *net.IPNet) net.IP {
+	lastIP := make(net.IP, len(ipNet.IP))
+	copy(lastIP, ipNet.IP)
+	for i := range lastIP {
+		lastIP[i] |= ^ipNet.Mask[i]
+	}
+	return lastIP
+}
+
+// RemoveSubsetCIDRs removes any CIDR that is a subset of another CIDR. Invalid CIDRs are logged and skipped.
+func RemoveSubsetCIDRs(cidrs []string) []string {
+	ipNets := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			LogWarningf(false, "Invalid CIDR: %s", cidr)
+			continue
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+
+	filtered := []string{}
+	for i, ipNet1 := range ipNets {
+		isSubset := false
+		for j, ipNet2 := range ipNets {
+			if i == j {
+				continue
+			}
+			// Check if ipNet2 fully contains ipNet1. Identical CIDRs keep the first one.
+			if ipNet2.Contains(ipNet1.IP) && ipNet2.Contains(LastIP(ipNet1)) && (ipNet1.String() != ipNet2.String() || j < i) {
+				isSubset = true
+				break
+			}
+		}
+		if !isSubset {
+			filtered = append(filtered, ipNet1.String())
+		}
+	}
+	return filtered
+}
+
+// MergeConsecutiveCIDRs merges adjacent CIDRs of the same size into the larger CIDR until no more merges are possible.
+// Run RemoveSubsetCIDRs first so overlapping CIDRs are removed.
+func MergeConsecutiveCIDRs(cidrs []string) []string {
+	filtered := cidrs
+	for {
+		merged := []string{}
+		ipNets := []*net.IPNet{}
+		for _, cidr := range filtered {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				LogWarningf(false, "Invalid CIDR: %s", cidr)
+				continue
+			}
+			ipNets = append(ipNets, ipNet)
+		}
+
+		// Sort by IP address
+		sort.Slice(ipNets, func(i, j int) bool {
+			return bytes.Compare(ipNets[i].IP, ipNets[j].IP) < 0
+		})
+
+		for i := 0; i < len(ipNets); i++ {
+			current := ipNets[i]
+			for j := i + 1; j < len(ipNets); j++ {
+				if !canMergeCIDRs(current, ipNets[j]) {
+					break
+				}
+				current = mergeCIDRs(current, ipNets[j])
+				i = j
+			}
+			merged = append(merged, current.String())
+		}
+		if len(filtered) == len(merged) {
+			return merged
+		}
+		filtered = merged
+	}
+}
+
+// canMergeCIDRs returns true if the CIDRs are the same size and the two halves of the next larger CIDR
+func canMergeCIDRs(ipNet1, ipNet2 *net.IPNet) bool {
+	ones1, bits1 := ipNet1.Mask.Size()
+	ones2, bits2 := ipNet2.Mask.Size()
+	if bits1 != bits2 || ones1 != ones2 || ones1 == 0 {
+		return false
+	}
+	mask := net.CIDRMask(ones1-1, bits1)
+	return ipNet1.IP.Mask(mask).Equal(ipNet2.IP.Mask(mask))
+}
+
+// mergeCIDRs returns the CIDR one bit larger than the two CIDRs
+func mergeCIDRs(ipNet1, ipNet2 *net.IPNet) *net.IPNet {
+	ones, bits := ipNet1.Mask.Size()
+	mask := net.CIDRMask(ones-1, bits)
+	ip := ipNet1.IP.Mask(mask)
+	if bytes.Compare(ipNet2.IP, ip) < 0 {
+		ip = ipNet2.IP.Mask(mask)
+	}
+	return &net.IPNet{IP: ip, Mask: mask}
+}
+
+// ipInterval is an inclusive range of addresses in the same family
+type ipInterval struct {
+	from, to netip.Addr
+}
+
+// IPSet is a set of IPv4 and IPv6 addresses stored as sorted, non-overlapping ranges.
+// The zero value is an empty set.
+type IPSet struct {
+	intervals []ipInterval
+}
+
+// ParseIPEntry parses an address, CIDR, or range (e.g., 10.0.0.1-10.0.0.9) and returns the first and last address
+func ParseIPEntry(entry string) (netip.Addr, netip.Addr, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "-") {
+		parts := strings.SplitN(entry, "-", 2)
+		from, err := netip.ParseAddr(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid range %s", entry)
+		}
+		to, err := netip.ParseAddr(strings.TrimSpace(parts[1]))
+		if err != nil || from.Is4() != to.Is4() || to.Less(from) {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid range %s", entry)
+		}
+		return from.Unmap(), to.Unmap(), nil
+	}
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid cidr %s", entry)
+		}
+		prefix = prefix.Masked()
+		return prefix.Addr(), LastAddr(prefix), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid ip %s", entry)
+	}
+	return addr.Unmap(), addr.Unmap(), nil
+}
+
+// LastAddr returns the last address of the prefix
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	bits := prefix.Bits()
+	for i := range b {
+		for bit := 0; bit < 8; bit++ {
+			if i*8+bit >= bits {
+				b[i] |= 1 << (7 - bit)
+			}
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Add adds addresses, CIDRs, or ranges to the set. Nothing is added if an entry is invalid.
+func (s *IPSet) Add(entries ...string) error {
+	intervals := append([]ipInterval{}, s.intervals...)
+	for _, entry := range entries {
+		from, to, err := ParseIPEntry(entry)
+		if err != nil {
+			return err
+		}
+		intervals = append(intervals, ipInterval{from: from, to: to})
+	}
+	s.intervals = normalize(intervals)
+	return nil
+}
+
+// Empty returns true if the set has no addresses
+func (s *IPSet) Empty() bool {
+	return len(s.intervals) == 0
+}
+
+// normalize sorts the intervals and merges the overlapping and adjacent ones
+func normalize(intervals []ipInterval) []ipInterval {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].from.Less(intervals[j].from)
+	})
+	merged := []ipInterval{}
+	for _, in := range intervals {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if last.to.Is4() == in.from.Is4() && (!last.to.Less(in.from) || last.to.Next() == in.from) {
+				if last.to.Less(in.to) {
+					last.to = in.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
+
+// Union returns the addresses in either set
+func (s *IPSet) Union(other *IPSet) *IPSet {
+	intervals := append(append([]ipInterval{}, s.intervals...), other.intervals...)
+	return &IPSet{intervals: normalize(intervals)}
+}
+
+// Intersect returns the addresses in both sets
+func (s *IPSet) Intersect(other *IPSet) *IPSet {
+	result := []ipInterval{}
+	i, j := 0, 0
+	for i < len(s.intervals) && j < len(other.intervals) {
+		a, b := s.intervals[i], other.intervals[j]
+		from, to := a.from, a.to
+		if from.Less(b.from) {
+			from = b.from
+		}
+		if b.to.Less(to) {
+			to = b.to
+		}
+		if from.Is4() == to.Is4() && !to.Less(from) {
+			result = append(result, ipInterval{from: from, to: to})
+		}
+		if a.to.Less(b.to) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return &IPSet{intervals: normalize(result)}
+}
+
+// Subtract returns the addresses in the set that are not in the other set
+func (s *IPSet) Subtract(other *IPSet) *IPSet {
+	result := []ipInterval{}
+	for _, a := range s.intervals {
+		remaining := []ipInterval{a}
+		for _, b := range other.intervals {
+			next := []ipInterval{}
+			for _, r := range remaining {
+				// No overlap
+				if r.to.Less(b.from) || b.to.Less(r.from) || r.from.Is4() != b.from.Is4() {
+					next = append(next, r)
+					continue
+				}
+				if r.from.Less(b.from) {
+					next = append(next, ipInterval{from: r.from, to: b.from.Prev()})
+				}
+				if b.to.Less(r.to) {
+					next = append(next, ipInterval{from: b.to.Next(), to: r.to})
+				}
+			}
+			remaining = next
+		}
+		result = append(result, remaining...)
+	}
+	return &IPSet{intervals: normalize(result)}
+}
+
+// CIDRs returns the minimum list of CIDRs that cover the set
+func (s *IPSet) CIDRs() []string {
+	cidrs := []string{}
+	for _, in := range s.intervals {
+		from := in.from
+		for {
+			// Use the largest prefix that starts at from and ends before to
+			for bits := 0; bits <= from.BitLen(); bits++ {
+				prefix := netip.PrefixFrom(from, bits).Masked()
+				last := LastAddr(prefix)
+				if prefix.Addr() == from && !in.to.Less(last) {
+					cidrs = append(cidrs, prefix.String())
+					from = last
+					break
+				}
+			}
+			if from == in.to || !from.Next().IsValid() {
+				break
+			}
+			from = from.Next()
+		}
+	}
+	return cidrs
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestLastAddr(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"10.1.2.0/24", "10.1.2.255"},
+		{"10.1.2.3/24", "10.1.2.255"},
+		{"10.1.2.3/32", "10.1.2.3"},
+		{"10.1.2.0/23", "10.1.3.255"},
+		{"0.0.0.0/0", "255.255.255.255"},
+		{"2001:db8::/64", "2001:db8::ffff:ffff:ffff:ffff"},
+		{"2001:db8::/127", "2001:db8::1"},
+		{"::/0", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+	}
+	for _, tt := range tests {
+		if got := LastAddr(netip.MustParsePrefix(tt.prefix)); got != netip.MustParseAddr(tt.want) {
+			t.Errorf("LastAddr(%s) = %s, want %s", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestParseIPEntry(t *testing.T) {
+	tests := []struct {
+		entry    string
+		from, to string
+		wantErr  bool
+	}{
+		{entry: "10.0.0.1", from: "10.0.0.1", to: "10.0.0.1"},
+		{entry: " 10.0.0.1 ", from: "10.0.0.1", to: "10.0.0.1"},
+		{entry: "10.0.0.5/30", from: "10.0.0.4", to: "10.0.0.7"},
+		{entry: "10.0.0.1-10.0.0.9", from: "10.0.0.1", to: "10.0.0.9"},
+		{entry: "10.0.0.1 - 10.0.0.9", from: "10.0.0.1", to: "10.0.0.9"},
+		{entry: "::ffff:10.0.0.1", from: "10.0.0.1", to: "10.0.0.1"},
+		{entry: "2001:db8::/127", from: "2001:db8::", to: "2001:db8::1"},
+		{entry: "2001:db8::1-2001:db8::ff", from: "2001:db8::1", to: "2001:db8::ff"},
+		{entry: "10.0.0.9-10.0.0.1", wantErr: true},
+		{entry: "10.0.0.1-2001:db8::1", wantErr: true},
+		{entry: "10.0.0.0/33", wantErr: true},
+		{entry: "10.0.0.256", wantErr: true},
+		{entry: "corp", wantErr: true},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseIPEntry(tt.entry)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseIPEntry(%q) = %s-%s, want an error", tt.entry, from, to)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseIPEntry(%q) returned %s", tt.entry, err)
+			continue
+		}
+		if from != netip.MustParseAddr(tt.from) || to != netip.MustParseAddr(tt.to) {
+			t.Errorf("ParseIPEntry(%q) = %s-%s, want %s-%s", tt.entry, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestIPSetCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{"empty", nil, []string{}},
+		{"single address", []string{"10.0.0.1"}, []string{"10.0.0.1/32"}},
+		{"adjacent merge", []string{"10.0.0.0/25", "10.0.0.128/25"}, []string{"10.0.0.0/24"}},
+		{"adjacent addresses", []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}, []string{"10.0.0.0/30"}},
+		{"overlapping merge", []string{"10.0.0.0/24", "10.0.0.128/25", "10.0.0.200-10.0.1.10"}, []string{"10.0.0.0/24", "10.0.1.0/29", "10.0.1.8/31", "10.0.1.10/32"}},
+		{"duplicate", []string{"10.0.0.0/24", "10.0.0.0/24"}, []string{"10.0.0.0/24"}},
+		{"unaligned range", []string{"10.0.0.1-10.0.0.6"}, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"sorted", []string{"192.168.0.0/16", "10.0.0.0/8"}, []string{"10.0.0.0/8", "192.168.0.0/16"}},
+		{"mixed v4 and v6", []string{"2001:db8::/33", "10.0.0.0/24", "2001:db8:8000::/33"}, []string{"10.0.0.0/24", "2001:db8::/32"}},
+		{"v4 end is not adjacent to v6 start", []string{"255.255.255.255", "::"}, []string{"255.255.255.255/32", "::/128"}},
+		{"all v4 and v6", []string{"0.0.0.0/0", "::/0"}, []string{"0.0.0.0/0", "::/0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &IPSet{}
+			if err := s.Add(tt.entries...); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.CIDRs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CIDRs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPSetAddInvalid(t *testing.T) {
+	s := &IPSet{}
+	if err := s.Add("10.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("10.1.0.0/24", "bad"); err == nil {
+		t.Error("Add with an invalid entry did not return an error")
+	}
+	if got, want := s.CIDRs(), []string{"10.0.0.0/24"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CIDRs() after invalid add = %v, want %v", got, want)
+	}
+}
+
+func TestIPSetOperations(t *testing.T) {
+	set := func(entries ...string) *IPSet {
+		s := &IPSet{}
+		if err := s.Add(entries...); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name string
+		got  *IPSet
+		want []string
+	}{
+		{"union", set("10.0.0.0/25").Union(set("10.0.0.128/25", "2001:db8::/64")), []string{"10.0.0.0/24", "2001:db8::/64"}},
+		{"intersect", set("10.0.0.0/24").Intersect(set("10.0.0.128/25", "10.0.1.0/24")), []string{"10.0.0.128/25"}},
+		{"intersect families", set("10.0.0.0/8", "2001:db8::/32").Intersect(set("2001:db8::/64")), []string{"2001:db8::/64"}},
+		{"intersect disjoint", set("10.0.0.0/24").Intersect(set("2001:db8::/64")), []string{}},
+		{"subtract middle", set("10.0.0.0/24").Subtract(set("10.0.0.128/26")), []string{"10.0.0.0/25", "10.0.0.192/26"}},
+		{"subtract edges", set("10.0.0.0/24").Subtract(set("10.0.0.0", "10.0.0.255")), []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/27", "10.0.0.224/28", "10.0.0.240/29", "10.0.0.248/30", "10.0.0.252/31", "10.0.0.254/32"}},
+		{"subtract other family", set("10.0.0.0/24", "2001:db8::/64").Subtract(set("::/0")), []string{"10.0.0.0/24"}},
+		{"subtract all", set("10.0.0.0/24").Subtract(set("10.0.0.0/8")), []string{}},
+	}
+	for _, tt := range tests {
+		if got := tt.got.CIDRs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveSubsetCIDRs(t *testing.T) {
+	tests := []struct {
+		cidrs []string
+		want  []string
+	}{
+		{[]string{"10.0.0.0/24", "10.0.0.0/25", "10.0.1.0/24"}, []string{"10.0.0.0/24", "10.0.1.0/24"}},
+		{[]string{"10.0.0.0/24", "10.0.0.0/24"}, []string{"10.0.0.0/24"}},
+		{[]string{"2001:db8::/64", "2001:db8::/32", "10.0.0.0/8"}, []string{"2001:db8::/32", "10.0.0.0/8"}},
+		{[]string{"bad", "10.0.0.0/8"}, []string{"10.0.0.0/8"}},
+	}
+	for _, tt := range tests {
+		if got := RemoveSubsetCIDRs(tt.cidrs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RemoveSubsetCIDRs(%v) = %v, want %v", tt.cidrs, got, tt.want)
+		}
+	}
+}
+
+func TestMergeConsecutiveCIDRs(t *testing.T) {
+	tests := []struct {
+		cidrs []string
+		want  []string
+	}{
+		{[]string{"10.0.0.128/25", "10.0.0.0/25"}, []string{"10.0.0.0/24"}},
+		{[]string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/25"}, []string{"10.0.0.0/24"}},
+		{[]string{"10.0.0.128/25", "10.0.1.0/25"}, []string{"10.0.0.128/25", "10.0.1.0/25"}},
+		{[]string{"2001:db8::/33", "2001:db8:8000::/33"}, []string{"2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		if got := MergeConsecutiveCIDRs(tt.cidrs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MergeConsecutiveCIDRs(%v) = %v, want %v", tt.cidrs, got, tt.want)
+		}
+	}
+}
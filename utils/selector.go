@@ -0,0 +1,515 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	ia1 "github.com/brian1917/illumioapi"
+	ia "github.com/brian1917/illumioapi/v2"
+)
+
+// SelectorHelp is the --select syntax description for command help text.
+const SelectorHelp = `Selector syntax (--select):
+  Predicates can be combined with and, or, not, and parentheses. Values with spaces or special characters must be quoted.
+  - <label key>=value, <label key>!=value, <label key> in (value1,value2) for any label dimension. prefix with "label:" if the key matches another attribute. * is a wildcard.
+  - <label key>~regex and <label key>!~regex for regex matches.
+  - has <label key> for workloads with any label of that key.
+  - managed, unmanaged, online, offline. online and offline only match managed workloads.
+  - enforcement=value using the values in the wkld-export enforcement column (e.g., idle, visibility_only, selective, full, unmanaged).
+  - os=value matches the os id or os detail (case insensitive). os~regex is also supported.
+  - ven_version with =, !=, <, <=, >, >= (e.g., ven_version<21.5.0).
+  - subnet=10.0.0.0/8 or subnet in (10.0.0.0/8,192.168.0.0/16) matches workloads with an interface in the subnet.
+  - hostname and name with =, !=, in, and ~.
+  Example: --select "app in (erp,crm) and env=prod and not loc=dr and managed and online"`
+
+// SelectorTarget is the workload data a selector is evaluated against.
+type SelectorTarget struct {
+	Labels      map[string]string
+	Hostname    string
+	Name        string
+	Managed     bool
+	Online      bool
+	Enforcement string
+	OSID        string
+	OSDetail    string
+	VENVersion  string
+	IPs         []string
+}
+
+// SelectorTargetV2 builds a selector target from an illumioapi v2 workload.
+func SelectorTargetV2(w ia.Workload, labels map[string]ia.Label) SelectorTarget {
+	t := SelectorTarget{Labels: make(map[string]string), Hostname: ia.PtrToVal(w.Hostname), Name: ia.PtrToVal(w.Name), Online: ia.PtrToVal(w.Online), Enforcement: w.GetMode(), OSID: ia.PtrToVal(w.OsID), OSDetail: ia.PtrToVal(w.OsDetail)}
+	for _, l := range ia.PtrToVal(w.Labels) {
+		t.Labels[labels[l.Href].Key] = labels[l.Href].Value
+	}
+	if (w.Agent != nil && w.Agent.Href != "") || (w.VEN != nil && w.VEN.Href != "") {
+		t.Managed = true
+	}
+	if w.Agent != nil && w.Agent.Href != "" {
+		t.VENVersion = w.Agent.Status.AgentVersion
+	}
+	for _, i := range ia.PtrToVal(w.Interfaces) {
+		t.IPs = append(t.IPs, i.Address)
+	}
+	return t
+}
+
+// SelectorTargetV1 builds a selector target from an illumioapi v1 workload.
+func SelectorTargetV1(w ia1.Workload, labels map[string]ia1.Label) SelectorTarget {
+	t := SelectorTarget{Labels: make(map[string]string), Hostname: w.Hostname, Name: w.Name, Online: w.Online, Enforcement: w.GetMode(), OSID: w.OsID, OSDetail: w.OsDetail}
+	if w.Labels != nil {
+		for _, l := range *w.Labels {
+			t.Labels[labels[l.Href].Key] = labels[l.Href].Value
+		}
+	}
+	if (w.Agent != nil && w.Agent.Href != "") || (w.VEN != nil && w.VEN.Href != "") {
+		t.Managed = true
+	}
+	if w.Agent != nil && w.Agent.Status != nil {
+		t.VENVersion = w.Agent.Status.AgentVersion
+	}
+	for _, i := range w.Interfaces {
+		t.IPs = append(t.IPs, i.Address)
+	}
+	return t
+}
+
+// Selector is a parsed --select expression.
+type Selector struct {
+	root selectorNode
+}
+
+// selectorNode is a node in the parsed expression.
+type selectorNode interface {
+	match(t SelectorTarget) bool
+}
+
+type andNode struct{ left, right selectorNode }
+type orNode struct{ left, right selectorNode }
+type notNode struct{ node selectorNode }
+
+// predicate is a single attribute comparison.
+type predicate struct {
+	attribute string
+	labelKey  string
+	op        string
+	values    []string
+	regex     *regexp.Regexp
+	prefixes  []netip.Prefix
+}
+
+func (n andNode) match(t SelectorTarget) bool { return n.left.match(t) && n.right.match(t) }
+func (n orNode) match(t SelectorTarget) bool  { return n.left.match(t) || n.right.match(t) }
+func (n notNode) match(t SelectorTarget) bool { return !n.node.match(t) }
+
+// Match returns true if the target matches the selector. A nil selector matches everything.
+func (s *Selector) Match(t SelectorTarget) bool {
+	if s == nil || s.root == nil {
+		return true
+	}
+	return s.root.match(t)
+}
+
+// FilterV2 returns the illumioapi v2 workloads that match the selector.
+func (s *Selector) FilterV2(wklds []ia.Workload, labels map[string]ia.Label) []ia.Workload {
+	if s == nil {
+		return wklds
+	}
+	filtered := []ia.Workload{}
+	for _, w := range wklds {
+		if s.Match(SelectorTargetV2(w, labels)) {
+			filtered = append(filtered, w)
+		}
+	}
+	LogInfo(fmt.Sprintf("%d of %d workloads match the selector", len(filtered), len(wklds)), true)
+	return filtered
+}
+
+// FilterV1 returns the illumioapi v1 workloads that match the selector.
+func (s *Selector) FilterV1(wklds []ia1.Workload, labels map[string]ia1.Label) []ia1.Workload {
+	if s == nil {
+		return wklds
+	}
+	filtered := []ia1.Workload{}
+	for _, w := range wklds {
+		if s.Match(SelectorTargetV1(w, labels)) {
+			filtered = append(filtered, w)
+		}
+	}
+	LogInfo(fmt.Sprintf("%d of %d workloads match the selector", len(filtered), len(wklds)), true)
+	return filtered
+}
+
+// ParseSelector parses a selector expression. An empty expression returns a nil selector that matches all workloads.
+func ParseSelector(expression string) (*Selector, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeSelector(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &selectorParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("selector - unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Selector{root: root}, nil
+}
+
+// selectorToken is a word, quoted string, or operator.
+type selectorToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSelector splits the expression into tokens.
+func tokenizeSelector(expression string) ([]selectorToken, error) {
+	tokens := []selectorToken{}
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, selectorToken{text: string(r)})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("selector - unterminated quote")
+			}
+			tokens = append(tokens, selectorToken{text: string(runes[i+1 : end]), quoted: true})
+			i = end + 1
+		case strings.ContainsRune("=!~<>", r):
+			end := i + 1
+			if end < len(runes) && (runes[end] == '=' || runes[end] == '~') {
+				end++
+			}
+			op := string(runes[i:end])
+			if op == "!" {
+				return nil, fmt.Errorf("selector - invalid operator !. use not or !=")
+			}
+			tokens = append(tokens, selectorToken{text: op})
+			i = end
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()=,!~<>\"'", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, selectorToken{text: string(runes[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// selectorParser is a recursive descent parser for selector expressions.
+type selectorParser struct {
+	tokens []selectorToken
+	pos    int
+}
+
+// peek returns the next token in lower case if it is not quoted.
+func (p *selectorParser) peek() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.pos].text)
+}
+
+// next returns the next token and advances.
+func (p *selectorParser) next() (selectorToken, error) {
+	if p.pos >= len(p.tokens) {
+		return selectorToken{}, fmt.Errorf("selector - unexpected end of expression")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseNot() (selectorNode, error) {
+	if p.peek() == "not" {
+		p.pos++
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	}
+	if p.peek() == "(" {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t.text != ")" {
+			return nil, fmt.Errorf("selector - missing closing parenthesis")
+		}
+		return node, nil
+	}
+	return p.parsePredicate()
+}
+
+// parsePredicate parses a single comparison or boolean attribute.
+func (p *selectorParser) parsePredicate() (selectorNode, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(t.text)
+
+	// Boolean attributes
+	switch name {
+	case "managed", "unmanaged", "online", "offline":
+		return predicate{attribute: name}, nil
+	case "has":
+		key, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		return predicate{attribute: "label", labelKey: strings.TrimPrefix(key.text, "label:"), op: "has"}, nil
+	}
+
+	pred := predicate{attribute: name}
+	switch {
+	case strings.HasPrefix(t.text, "label:"):
+		pred.attribute = "label"
+		pred.labelKey = strings.TrimPrefix(t.text, "label:")
+	case name != "enforcement" && name != "os" && name != "ven_version" && name != "subnet" && name != "hostname" && name != "name":
+		pred.attribute = "label"
+		pred.labelKey = t.text
+	}
+
+	// Operator
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	pred.op = strings.ToLower(op.text)
+	switch pred.op {
+	case "in":
+		if t, err := p.next(); err != nil || t.text != "(" {
+			return nil, fmt.Errorf("selector - in must be followed by a list in parentheses")
+		}
+		for {
+			value, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			pred.values = append(pred.values, value.text)
+			sep, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if sep.text == ")" {
+				break
+			}
+			if sep.text != "," {
+				return nil, fmt.Errorf("selector - expected , or ) in list")
+			}
+		}
+	case "=", "!=", "~", "!~", "<", "<=", ">", ">=":
+		value, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		pred.values = []string{value.text}
+	default:
+		return nil, fmt.Errorf("selector - invalid operator %q after %s", op.text, t.text)
+	}
+
+	// Validate and compile
+	if (pred.op == "<" || pred.op == "<=" || pred.op == ">" || pred.op == ">=") && pred.attribute != "ven_version" {
+		return nil, fmt.Errorf("selector - %s is only supported for ven_version", pred.op)
+	}
+	if pred.op == "~" || pred.op == "!~" {
+		if pred.attribute == "subnet" || pred.attribute == "ven_version" {
+			return nil, fmt.Errorf("selector - regex is not supported for %s", pred.attribute)
+		}
+		pred.regex, err = regexp.Compile(pred.values[0])
+		if err != nil {
+			return nil, fmt.Errorf("selector - %s", err)
+		}
+	}
+	if pred.attribute == "subnet" {
+		for _, v := range pred.values {
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("selector - invalid subnet %s", v)
+			}
+			pred.prefixes = append(pred.prefixes, prefix)
+		}
+	}
+	return pred, nil
+}
+
+// match evaluates the predicate
+func (pred predicate) match(t SelectorTarget) bool {
+	switch pred.attribute {
+	case "managed":
+		return t.Managed
+	case "unmanaged":
+		return !t.Managed
+	case "online":
+		return t.Managed && t.Online
+	case "offline":
+		return t.Managed && !t.Online
+	case "subnet":
+		inSubnet := false
+		for _, ip := range t.IPs {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+			for _, prefix := range pred.prefixes {
+				if prefix.Contains(addr) {
+					inSubnet = true
+				}
+			}
+		}
+		return inSubnet == (pred.op != "!=")
+	case "ven_version":
+		if !t.Managed {
+			return false
+		}
+		c := CompareVersions(t.VENVersion, pred.values[0])
+		switch pred.op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+		return false
+	case "os":
+		return pred.compare([]string{t.OSID, t.OSDetail}, true)
+	case "enforcement":
+		return pred.compare([]string{t.Enforcement}, true)
+	case "hostname":
+		return pred.compare([]string{t.Hostname}, true)
+	case "name":
+		return pred.compare([]string{t.Name}, false)
+	}
+
+	// Labels
+	value, ok := t.Labels[pred.labelKey]
+	if pred.op == "has" {
+		return ok && value != ""
+	}
+	return pred.compare([]string{value}, false)
+}
+
+// compare checks the string comparison operators. The predicate matches if any of the provided values match (all for negative operators).
+func (pred predicate) compare(actual []string, caseInsensitive bool) bool {
+	anyMatch := false
+	for _, a := range actual {
+		if pred.regex != nil {
+			if pred.regex.MatchString(a) {
+				anyMatch = true
+			}
+			continue
+		}
+		for _, v := range pred.values {
+			if globMatch(v, a, caseInsensitive) {
+				anyMatch = true
+			}
+		}
+	}
+	if pred.op == "!=" || pred.op == "!~" {
+		return !anyMatch
+	}
+	return anyMatch
+}
+
+// globMatch compares a value that may contain * wildcards
+func globMatch(pattern, value string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	}
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	regex := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, _ := regexp.MatchString(regex, value)
+	return matched
+}
+
+// CompareVersions compares a dotted version (e.g., 21.5.10-1234) to the provided version. Only the parts in the provided version
+// are compared so 21.5.10-1234 is equal to 21.5 and 21.5.10. returns -1, 0, or 1.
+func CompareVersions(a, b string) int {
+	split := func(v string) []int {
+		parts := []int{}
+		for _, p := range strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' }) {
+			n, _ := strconv.Atoi(p)
+			parts = append(parts, n)
+		}
+		return parts
+	}
+	x, y := split(a), split(b)
+	for i := 0; i < len(y); i++ {
+		var xi, yi int
+		if i < len(x) {
+			xi = x[i]
+		}
+		if i < len(y) {
+			yi = y[i]
+		}
+		if xi != yi {
+			if xi < yi {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package utils
+
+import "testing"
+
+func TestParseSelectorErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{"app=erp and", "selector - unexpected end of expression"},
+		{"(app=erp", "selector - missing closing parenthesis"},
+		{"app=erp)", `selector - unexpected ")"`},
+		{"app", "selector - unexpected end of expression"},
+		{"app erp", `selector - invalid operator "erp" after app`},
+		{"app ! erp", "selector - invalid operator !. use not or !="},
+		{`app="erp`, "selector - unterminated quote"},
+		{"app in erp", "selector - in must be followed by a list in parentheses"},
+		{"app in (erp crm)", "selector - expected , or ) in list"},
+		{"app<erp", "selector - < is only supported for ven_version"},
+		{"subnet~10.*", "selector - regex is not supported for subnet"},
+		{"ven_version~21.*", "selector - regex is not supported for ven_version"},
+		{"subnet=10.0.0.0", "selector - invalid subnet 10.0.0.0"},
+		{`app~"(erp"`, "selector - error parsing regexp: missing closing ): `(erp`"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSelector(tt.expression)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("ParseSelector(%q) error = %v, want %s", tt.expression, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSelectorEmpty(t *testing.T) {
+	s, err := ParseSelector("  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != nil {
+		t.Errorf("ParseSelector of a blank expression = %v, want nil", s)
+	}
+	if !s.Match(SelectorTarget{}) {
+		t.Error("nil selector does not match")
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	managed := SelectorTarget{
+		Labels:      map[string]string{"app": "erp", "env": "prod", "loc": "us east", "name": "label-name"},
+		Hostname:    "ERP-DB01.corp.local",
+		Name:        "erp-db01",
+		Managed:     true,
+		Online:      true,
+		Enforcement: "full",
+		OSID:        "centos-x86_64-7",
+		OSDetail:    "CentOS Linux 7",
+		VENVersion:  "21.5.10-1234",
+		IPs:         []string{"10.1.2.3", "fe80::1"},
+	}
+	offline := managed
+	offline.Online = false
+	unmanaged := SelectorTarget{Labels: map[string]string{"app": "crm"}, Hostname: "crm01", Online: true, Enforcement: "unmanaged", IPs: []string{"192.168.1.10"}}
+
+	tests := []struct {
+		expression string
+		target     SelectorTarget
+		want       bool
+	}{
+		// Labels
+		{"app=erp", managed, true},
+		{"APP=erp", managed, false},
+		{"app=ERP", managed, false},
+		{"app!=erp", managed, false},
+		{"app!=erp", unmanaged, true},
+		{"app in (crm, erp)", managed, true},
+		{"app in (crm,web)", managed, false},
+		{"app=e*", managed, true},
+		{"app=*p", unmanaged, false},
+		{"app~^e.p$", managed, true},
+		{"app!~^e", managed, false},
+		{`loc="us east"`, managed, true},
+		{"loc='us east'", managed, true},
+		{"has env", managed, true},
+		{"has env", unmanaged, false},
+		{"not has env", unmanaged, true},
+		{"label:name=label-name", managed, true},
+		{"name=erp-db01", managed, true},
+		{"name=ERP-DB01", managed, false},
+
+		// Managed, online, and offline. Unmanaged workloads are neither online nor offline.
+		{"managed", managed, true},
+		{"unmanaged", managed, false},
+		{"managed", unmanaged, false},
+		{"unmanaged", unmanaged, true},
+		{"online", managed, true},
+		{"offline", managed, false},
+		{"online", offline, false},
+		{"offline", offline, true},
+		{"online", unmanaged, false},
+		{"offline", unmanaged, false},
+		{"not online", unmanaged, true},
+		{"not offline", unmanaged, true},
+		{"unmanaged or online", unmanaged, true},
+
+		// Other attributes
+		{"enforcement=full", managed, true},
+		{"enforcement=UNMANAGED", unmanaged, true},
+		{"hostname=erp-db01.corp.local", managed, true},
+		{"hostname=erp-*", managed, true},
+		{"os=centos*", managed, true},
+		{"os='centos linux 7'", managed, true},
+		{"os~Linux", managed, true},
+		{"os!=windows*", managed, true},
+		{"ven_version<22", managed, true},
+		{"ven_version>=21.5.10", managed, true},
+		{"ven_version>21.5", managed, false},
+		{"ven_version=21.5", managed, true},
+		{"ven_version!=21.4", managed, true},
+		{"ven_version<99", unmanaged, false},
+		{"subnet=10.0.0.0/8", managed, true},
+		{"subnet in (172.16.0.0/12, 192.168.0.0/16)", managed, false},
+		{"subnet in (172.16.0.0/12, 192.168.0.0/16)", unmanaged, true},
+		{"subnet=fe80::/10", managed, true},
+		{"subnet!=10.0.0.0/8", managed, false},
+
+		// Precedence. and binds tighter than or and not binds tighter than and.
+		{"app=crm or app=erp and env=dev", managed, false},
+		{"app=crm or app=erp and env=prod", managed, true},
+		{"(app=crm or app=erp) and env=dev", managed, false},
+		{"app=erp or app=crm and env=dev", managed, true},
+		{"not app=crm and env=prod", managed, true},
+		{"not (app=erp and env=prod)", managed, false},
+		{"not not managed", managed, true},
+		{"APP=erp OR app=erp AND NOT offline", managed, true},
+		{`app="and"`, managed, false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSelector(tt.expression)
+		if err != nil {
+			t.Errorf("ParseSelector(%q) returned %s", tt.expression, err)
+			continue
+		}
+		if got := s.Match(tt.target); got != tt.want {
+			t.Errorf("%q match %s = %t, want %t", tt.expression, tt.target.Hostname, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"21.5.10-1234", "21.5", 0},
+		{"21.5.10-1234", "21.5.10", 0},
+		{"21.5.10-1234", "21.5.10-1235", -1},
+		{"21.5.10", "21.5.9", 1},
+		{"21.5", "21.5.1", -1},
+		{"19.3.0", "21", -1},
+		{"22.2.0", "21.5.99", 1},
+		{"", "21", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "sync"
+
+// RunWorkers calls work for every index from 0 to n-1 using no more than the provided number of workers.
+func RunWorkers(n, numWorkers int, work func(i int)) {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}